@@ -3,52 +3,228 @@ package blobadapter
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"math"
+	"net/http"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	azcontainer "github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
 	"github.com/casbin/casbin/v2/model"
 	"github.com/casbin/casbin/v2/persist"
-	"github.com/casbin/casbin/v2/util"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
 )
 
-// client is the interface that wraps around methods NewListContainersPager, NewListBlobsFlatPager,
-// CreateContainer, DownloadStream and UploadStream.
-type client interface {
-	NewListContainersPager(o *azblob.ListContainersOptions) *runtime.Pager[azblob.ListContainersResponse]
-	NewListBlobsFlatPager(containerName string, o *azblob.ListBlobsFlatOptions) *runtime.Pager[azblob.ListBlobsFlatResponse]
-	CreateContainer(ctx context.Context, containerName string, o *azblob.CreateContainerOptions) (azblob.CreateContainerResponse, error)
-	DownloadStream(ctx context.Context, containerName string, blobName string, o *azblob.DownloadStreamOptions) (azblob.DownloadStreamResponse, error)
-	UploadStream(ctx context.Context, containerName string, blobName string, body io.Reader, o *azblob.UploadStreamOptions) (azblob.UploadStreamResponse, error)
-}
+// Compile-time assertions that Adapter satisfies the casbin interfaces it
+// supports.
+var (
+	_ persist.Adapter          = (*Adapter)(nil)
+	_ persist.ContextAdapter   = (*Adapter)(nil)
+	_ persist.FilteredAdapter  = (*Adapter)(nil)
+	_ persist.BatchAdapter     = (*Adapter)(nil)
+	_ persist.UpdatableAdapter = (*Adapter)(nil)
+)
 
 // Adapter is an Azure Blob Storage adapter for casbin.
 type Adapter struct {
-	c         client
-	container string
-	blob      string
-	timeout   time.Duration
+	c           client
+	container   string
+	blob        string
+	prefix      string
+	timeout     time.Duration
+	lineHandler func(string, model.Model) error
+	requests    requestCounter
+	stats       operationStats
+	// hierarchicalNamespace is set when the storage account has hierarchical
+	// namespace (Data Lake Storage Gen2) enabled.
+	hierarchicalNamespace bool
+	// downloadConcurrency and downloadBlockSize configures concurrent ranged
+	// downloads of blobs larger than downloadBlockSize.
+	downloadConcurrency int
+	downloadBlockSize   int64
+	// downloadOptionsFn modifies the options of every download stream and
+	// retryReaderOptions configures reading of the policy blob.
+	downloadOptionsFn  func(o *azblob.DownloadStreamOptions)
+	retryReaderOptions *blob.RetryReaderOptions
+	// immutableUntil, immutabilityMode and legalHold are applied to the blob
+	// after it has been saved.
+	immutableUntil   time.Time
+	immutabilityMode blob.ImmutabilityPolicySetting
+	legalHold        bool
+	// uploadBlockSize and uploadConcurrency are used for all uploads
+	// when set.
+	uploadBlockSize   int64
+	uploadConcurrency int
+	// maxBlobSize is the maximum size of the policy blob in bytes when set.
+	maxBlobSize int64
+	// uploadOptionsFn modifies the options of every upload.
+	uploadOptionsFn func(o *azblob.UploadStreamOptions)
+	// verifyOnSave is set when saved blobs should be downloaded and compared
+	// with the uploaded content.
+	verifyOnSave bool
+	// onLoad and onSave are called after a successful load and save.
+	onLoad func(ctx context.Context, info LoadInfo)
+	onSave func(ctx context.Context, info SaveInfo)
+	// onChange is called with the added and removed rules before each save.
+	onChange func(added, removed [][]string)
+	logger   Logger
+	// auditBlob is the append blob that audit records are written to on
+	// each save. If strictAudit is set a failed write fails the save.
+	auditBlob   string
+	strictAudit bool
+	// backupSuffix is set when the policy blob should be copied to a backup
+	// blob with the suffix before each save.
+	backupSuffix string
+	// historyPrefix and historyKeep are set when timestamped copies of the
+	// policy blob should be kept before each save.
+	historyPrefix string
+	historyKeep   int
+	// lineEnding separates the rules written on save.
+	lineEnding LineEnding
+	// fieldDelimiter separates the fields of rules when set, instead of a comma.
+	fieldDelimiter rune
+	// clientOptions are used when creating the client. Unless noSharedClient
+	// is set the client is shared with adapters with the same account,
+	// credentials and client options.
+	clientOptions  *azblob.ClientOptions
+	noSharedClient bool
+	// applicationID is set as the telemetry application ID of the client.
+	applicationID string
+	// serviceAPIVersion is sent as the x-ms-version of every request when set.
+	serviceAPIVersion string
+	// readOnly is set when all writes should be rejected with ErrReadOnly.
+	readOnly bool
+	// throttleRetries is the number of times a load or save that is throttled
+	// by the storage is retried, waiting at most maxThrottleDelay before each
+	// retry. onThrottle is called before each retry.
+	throttleRetries  int
+	maxThrottleDelay time.Duration
+	onThrottle       func(ctx context.Context, info ThrottleInfo)
+	// filtered is set to 1 when the policy was last loaded with a filter.
+	filtered int32
+	// dryRun is set when writes should be logged instead of made.
+	dryRun bool
+	// baseCtx is the parent of the contexts of operations that are not
+	// passed a context.
+	baseCtx context.Context
+	// initCtx is the parent of the context of the initialization of the
+	// adapter when it is created with NewAdapterWithContext.
+	initCtx context.Context
+	// missingAsEmpty is set when a blob that does not exist should load as an
+	// empty policy instead of ErrBlobDoesNotExist.
+	missingAsEmpty bool
+	// staleWriteProtection is set when a save should be refused if the blob
+	// changed since it was loaded. loadedETag holds the ETag of the blob when
+	// the policy was last loaded or saved.
+	staleWriteProtection bool
+	loadedETag           atomic.Value
+	// conflictResolver merges the rules of the blob and the model when a save
+	// is refused because the blob was modified since it was loaded.
+	conflictResolver func(current, mine []PolicyLine) ([]PolicyLine, error)
+	// format is the format of the policy blob.
+	format Format
+	// lenient is set when lines that are not valid rules should be skipped
+	// on load instead of failing it. skippedLines holds the lines skipped by
+	// the last load.
+	lenient      bool
+	skippedLines atomic.Value
+	// encoding is the character encoding of the policy blob, or nil if it
+	// is UTF-8.
+	encoding encoding.Encoding
+	// bootstrap returns the rules to seed the policy with when the blob does
+	// not exist on load. bootstrapSave is set when they should be saved.
+	bootstrap     func() [][]string
+	bootstrapSave bool
+	// containerExists is set when the container is known to exist and the
+	// check for it on initialization is skipped. blobMayNotExist is set when
+	// the blob should be created on initialization without checking for it.
+	containerExists bool
+	blobMayNotExist bool
+	// maxPolicySize is the maximum number of bytes, and maxRules the maximum
+	// number of rules, read when the policy is loaded when set.
+	maxPolicySize int64
+	maxRules      int
+	// checksumVerification is set when the checksum of the policy should be
+	// stored in the metadata of the blob on save and verified on load.
+	checksumVerification bool
+	// secondaryReads is set when the policy should be downloaded from the
+	// secondary endpoint of the account.
+	secondaryReads bool
+	// signingKeys are the keys the signature of the policy is verified with
+	// on load, and the first key signs the policy on save, when set.
+	signingKeys [][]byte
+	// encryptionKey is the AES-256 key the policy is encrypted with on save
+	// and decrypted with on load when set.
+	encryptionKey []byte
+	// keyVaultKeyURL and keyVaultCred are the URL of the Key Vault key that
+	// wraps the data keys of the policy and the credential of the vault, and
+	// keyWrapper wraps and unwraps the data keys when set.
+	keyVaultKeyURL string
+	keyVaultCred   azcore.TokenCredential
+	keyWrapper     keyWrapper
+	// sortFunc orders the rules of each ptype when the policy is saved when
+	// set.
+	sortFunc func(a, b []string) bool
+	// clearByDelete is set when Clear should delete the policy blob instead of
+	// overwriting it with empty content.
+	clearByDelete bool
+	// noCreate is set when the container and blob should be checked for
+	// instead of created.
+	noCreate bool
+	// includeSnapshots is set when the blob should not be created if it has
+	// snapshots or previous versions.
+	includeSnapshots bool
+	// httpClient is the HTTP client that sends the requests of the clients of
+	// the adapter when set.
+	httpClient *http.Client
+	// expvarPrefix is the prefix set with WithExpvar, and vars are the
+	// variables published under it when set.
+	expvarPrefix string
+	vars         *adapterVars
+	// loadAttempts is the number of attempts of a load that fails with a
+	// transient error, with loadRetryBaseDelay before the first retry.
+	loadAttempts       int
+	loadRetryBaseDelay time.Duration
 }
 
 // NewAdapter returns a new adapter with the given account, container, blob and credentials.
 // If the container and blob does not exist, they will be created.
+// Failures to acquire a token with cred match ErrCredentialFailure.
 func NewAdapter(account, container, blob string, cred azcore.TokenCredential, options ...Option) (*Adapter, error) {
+	return newCredentialAdapter(account, container, blob, cred, true, options...)
+}
+
+// newCredentialAdapter returns a new adapter like NewAdapter. The client is only
+// shared with other adapters if shared is set, so that clients with a credential
+// created for the adapter, which no other adapter can share, are not cached.
+func newCredentialAdapter(account, container, blob string, cred azcore.TokenCredential, shared bool, options ...Option) (*Adapter, error) {
 	if err := checkAccountCredentialsArguments(account, cred); err != nil {
 		return nil, err
 	}
 
-	clientFn := func() (client, error) {
-		return azblob.NewClient(serviceURL(account), cred, nil)
+	var key *clientKey
+	if shared {
+		key = &clientKey{endpoint: serviceURL(account), credential: cred}
+	}
+	clientFn := func(o *azblob.ClientOptions) (client, error) {
+		return newBlobClient(azblob.NewClient(serviceURL(account), failureCredential{cred}, o))
 	}
 
-	a, err := newAdapter(container, blob, clientFn, options...)
+	a, err := newAdapter(container, blob, key, clientFn, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -56,18 +232,35 @@ func NewAdapter(account, container, blob string, cred azcore.TokenCredential, op
 	return a, nil
 }
 
+// NewAdapterWithContext returns a new adapter like NewAdapter, where the creation of
+// the container and blob if they do not exist is done with ctx, so that it respects
+// the deadline and cancellation of ctx in addition to the timeout of the adapter.
+// The context is only used during the call.
+func NewAdapterWithContext(ctx context.Context, account, container, blob string, cred azcore.TokenCredential, options ...Option) (*Adapter, error) {
+	options = append(options[:len(options):len(options)], func(a *Adapter) {
+		a.initCtx = ctx
+	})
+	return NewAdapter(account, container, blob, cred, options...)
+}
+
 // NewAdapterFromConnectionString returns a new adapter with the given connection string, container and blob.
 // If the container and blob does not exist, they will be created.
+//
+// The development storage shortcut UseDevelopmentStorage=true is supported and
+// targets the Azure Storage emulator (Azurite) on its default blob endpoint.
+// Connection strings with an explicit BlobEndpoint are used as is, which allows
+// for custom hosts and ports.
 func NewAdapterFromConnectionString(connectionString, container, blob string, options ...Option) (*Adapter, error) {
 	if len(connectionString) == 0 {
 		return nil, ErrInvalidConnectionString
 	}
 
-	clientFn := func() (client, error) {
-		return azblob.NewClientFromConnectionString(connectionString, nil)
+	key := clientKey{credential: secretKey(expandConnectionString(connectionString))}
+	clientFn := func(o *azblob.ClientOptions) (client, error) {
+		return newBlobClient(azblob.NewClientFromConnectionString(expandConnectionString(connectionString), o))
 	}
 
-	a, err := newAdapter(container, blob, clientFn, options...)
+	a, err := newAdapter(container, blob, &key, clientFn, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -82,15 +275,16 @@ func NewAdapterFromSharedKeyCredential(account, key, container, blob string, opt
 		return nil, err
 	}
 
-	clientFn := func() (client, error) {
+	ck := clientKey{endpoint: serviceURL(account), credential: secretKey(key)}
+	clientFn := func(o *azblob.ClientOptions) (client, error) {
 		cred, err := azblob.NewSharedKeyCredential(account, key)
 		if err != nil {
 			return nil, err
 		}
-		return azblob.NewClientWithSharedKeyCredential(serviceURL(account), cred, nil)
+		return newBlobClient(azblob.NewClientWithSharedKeyCredential(serviceURL(account), cred, o))
 	}
 
-	a, err := newAdapter(container, blob, clientFn, options...)
+	a, err := newAdapter(container, blob, &ck, clientFn, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -98,140 +292,1138 @@ func NewAdapterFromSharedKeyCredential(account, key, container, blob string, opt
 	return a, nil
 }
 
-// newAdapter returns a new adapter with the given container, blob and options.
-func newAdapter(container, blob string, clientFn func() (client, error), options ...Option) (*Adapter, error) {
+// NewAdaptersFromClient returns a new adapter for each of the given blobs in the
+// container, all using the provided client. This shares one connection pool and
+// credential between the adapters, e.g. for enforcers with different models. The
+// options are applied to every adapter, except the client options, application ID
+// and service API version which are set on the client. Each adapter has its own
+// state, like statistics and the ETag of the loaded policy. If the container and
+// blobs do not exist, they will be created.
+func NewAdaptersFromClient(client *azblob.Client, container string, blobs []string, options ...Option) ([]*Adapter, error) {
+	if client == nil {
+		return nil, ErrInvalidClient
+	}
+	if len(blobs) == 0 {
+		return nil, ErrInvalidBlob
+	}
+
+	c := &blobClient{Client: client}
+	options = append(options[:len(options):len(options)], func(a *Adapter) {
+		a.c = c
+	})
+	adapters := make([]*Adapter, 0, len(blobs))
+	for _, blob := range blobs {
+		a, err := newAdapter(container, blob, nil, nil, options...)
+		if err != nil {
+			return nil, err
+		}
+		adapters = append(adapters, a)
+	}
+	return adapters, nil
+}
+
+const (
+	// defaultMaxPolicySize is the default maximum number of bytes read when
+	// the policy is loaded.
+	defaultMaxPolicySize = 256 << 20
+	// defaultMaxRules is the default maximum number of rules read when the
+	// policy is loaded.
+	defaultMaxRules = 10000000
+)
+
+// newAdapter returns a new adapter with the given container, blob and options. The
+// client is created with clientFn, or taken from the shared client cache by key
+// unless key is nil or WithSharedClient(false) is set.
+func newAdapter(container, blob string, key *clientKey, clientFn func(o *azblob.ClientOptions) (client, error), options ...Option) (*Adapter, error) {
 	if err := checkContainerBlobArguments(container, blob); err != nil {
 		return nil, err
 	}
 
 	a := &Adapter{
-		container: container,
-		blob:      blob,
-		timeout:   time.Second * 10,
+		container:     container,
+		blob:          blob,
+		timeout:       time.Second * 10,
+		maxPolicySize: defaultMaxPolicySize,
+		maxRules:      defaultMaxRules,
 	}
 
 	for _, option := range options {
 		option(a)
 	}
+	if a.blob = blobPath(a.prefix, a.blob); len(a.blob) == 0 {
+		return nil, ErrInvalidBlob
+	}
+	if len(a.auditBlob) > 0 {
+		a.auditBlob = blobPath(a.prefix, a.auditBlob)
+	}
+	if len(a.expvarPrefix) > 0 {
+		a.vars = publishVars(a.expvarPrefix)
+	}
+	if a.encryptionKey != nil && len(a.encryptionKey) != encryptionKeySize {
+		return nil, ErrInvalidEncryptionKey
+	}
+	if len(a.keyVaultKeyURL) > 0 && a.keyWrapper == nil {
+		if a.encryptionKey != nil {
+			return nil, fmt.Errorf("%w: client-side and Key Vault encryption cannot be combined", ErrInvalidEncryptionKey)
+		}
+		var o *policy.ClientOptions
+		if a.clientOptions != nil {
+			o = &a.clientOptions.ClientOptions
+		}
+		if a.httpClient != nil {
+			var ho policy.ClientOptions
+			if o != nil {
+				ho = *o
+			}
+			ho.Transport = a.httpClient
+			o = &ho
+		}
+		kv, err := newKeyVaultClient(a.keyVaultKeyURL, a.keyVaultCred, o)
+		if err != nil {
+			return nil, err
+		}
+		a.keyWrapper = kv
+	}
 
 	if a.c == nil {
 		var err error
-		a.c, err = clientFn()
+		if a.noSharedClient || key == nil {
+			a.c, err = clientFn(a.newClientOptions())
+		} else {
+			key.options, key.applicationID, key.serviceAPIVersion = a.clientOptions, a.applicationID, a.serviceAPIVersion
+			key.httpClient = a.httpClient
+			a.c, err = sharedClients.get(*key, func() (client, error) {
+				return clientFn(a.newClientOptions())
+			})
+		}
 		if err != nil {
-			return nil, err
+			return nil, redactError(err)
 		}
 	}
 
-	if err := a.initAdapter(); err != nil {
-		return nil, err
+	if !a.readOnly {
+		err := a.initAdapter()
+		a.initCtx = nil
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return a, nil
 }
 
+// Container returns the name of the container of the adapter.
+func (a *Adapter) Container() string {
+	return a.container
+}
+
+// Blob returns the full name of the blob of the adapter, including
+// the prefix set with WithBlobPrefix.
+func (a *Adapter) Blob() string {
+	return a.blob
+}
+
+// blobPath joins the prefix and the blob name into a blob path. Duplicate,
+// leading and trailing slashes are removed.
+func blobPath(prefix, blob string) string {
+	var segments []string
+	for _, segment := range strings.Split(prefix+"/"+blob, "/") {
+		if len(segment) > 0 {
+			segments = append(segments, segment)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
 // serviceURL returns the service URL for the provided account.
 func serviceURL(account string) string {
 	return strings.Replace("https://{account}.blob.core.windows.net/", "{account}", account, 1)
 }
 
+const (
+	// developmentStorageAccount is the account name of the Azure Storage emulator.
+	developmentStorageAccount = "devstoreaccount1"
+	// developmentStorageKey is the well-known account key of the Azure Storage emulator.
+	developmentStorageKey = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+	// developmentStorageHost is the default host of the Azure Storage emulator.
+	developmentStorageHost = "http://127.0.0.1"
+	// developmentStorageBlobPort is the default blob service port of the Azure Storage emulator.
+	developmentStorageBlobPort = "10000"
+)
+
+// expandConnectionString expands the development storage shortcut (UseDevelopmentStorage=true)
+// into a full connection string for the Azure Storage emulator. If DevelopmentStorageProxyUri
+// is set it is used as the host for the blob endpoint. All other connection strings are
+// returned unmodified.
+func expandConnectionString(connectionString string) string {
+	var dev bool
+	host := developmentStorageHost
+	for _, part := range strings.Split(strings.TrimRight(connectionString, ";"), ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		switch {
+		case strings.EqualFold(key, "UseDevelopmentStorage"):
+			dev = strings.EqualFold(value, "true")
+		case strings.EqualFold(key, "DevelopmentStorageProxyUri"):
+			host = strings.TrimRight(value, "/")
+		}
+	}
+	if !dev {
+		return connectionString
+	}
+
+	return "DefaultEndpointsProtocol=http;AccountName=" + developmentStorageAccount +
+		";AccountKey=" + developmentStorageKey +
+		";BlobEndpoint=" + host + ":" + developmentStorageBlobPort + "/" + developmentStorageAccount + ";"
+}
+
 // LoadPolicy loads all policy rules from the storage.
 func (a *Adapter) LoadPolicy(model model.Model) error {
+	return a.LoadPolicyCtx(a.baseContext(), model)
+}
+
+// LoadPolicyCtx loads all policy rules from the storage with context.
+func (a *Adapter) LoadPolicyCtx(ctx context.Context, model model.Model) error {
+	if err := checkContainerBlobArguments(a.container, a.blob); err != nil {
+		return err
+	}
+	err := a.loadPolicy(ctx, model, a.policyLineHandler(), blob.HTTPRange{})
+	if a.bootstrap != nil && errors.Is(err, ErrBlobDoesNotExist) {
+		return a.bootstrapPolicy(ctx, model)
+	}
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&a.filtered, 0)
+	return nil
+}
+
+// LoadPolicyRange loads the policy rules within count bytes of the blob starting
+// at offset start. A count of 0 reads to the end of the blob. The range should
+// start at the beginning of a line. If the range ends in the middle of a line
+// the incomplete trailing line is discarded.
+func (a *Adapter) LoadPolicyRange(model model.Model, start, count int64) error {
 	if err := checkContainerBlobArguments(a.container, a.blob); err != nil {
 		return err
 	}
-	return a.loadPolicyBlob(model, persist.LoadPolicyLine)
+	if start < 0 || count < 0 {
+		return fmt.Errorf("invalid range: start %d, count %d", start, count)
+	}
+	return a.loadPolicy(a.baseContext(), model, a.policyLineHandler(), blob.HTTPRange{Offset: start, Count: count})
+}
+
+// baseContext returns the context set with WithBaseContext, or context.Background
+// if it is not set.
+func (a *Adapter) baseContext() context.Context {
+	if a.baseCtx != nil {
+		return a.baseCtx
+	}
+	return context.Background()
+}
+
+// policyLineHandler returns the handler for policy lines set with WithLineHandler,
+// or persist.LoadPolicyLine if it is not set. If a field delimiter is set with
+// WithFieldDelimiter the default handler splits the fields on it instead.
+func (a *Adapter) policyLineHandler() func(string, model.Model) error {
+	if a.lineHandler != nil {
+		return a.lineHandler
+	}
+	if delimiter := a.delimiter(); delimiter != defaultFieldDelimiter {
+		return func(line string, m model.Model) error {
+			tokens, err := parseRuleLine(line, delimiter)
+			if err != nil || tokens == nil {
+				return err
+			}
+			return persist.LoadPolicyArray(tokens, m)
+		}
+	}
+	return persist.LoadPolicyLine
 }
 
-// loadPolicyBlob loads all policy rules from the storage by downloading
-// the blob and reading it line by line.
-func (a *Adapter) loadPolicyBlob(model model.Model, handler func(string, model.Model) error) error {
-	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+// defaultFieldDelimiter separates the fields of rules unless another
+// delimiter is set with WithFieldDelimiter.
+const defaultFieldDelimiter = ','
+
+// delimiter returns the field delimiter of the adapter.
+func (a *Adapter) delimiter() rune {
+	if a.fieldDelimiter != 0 && a.format != FormatCSVWithHeader {
+		return a.fieldDelimiter
+	}
+	return defaultFieldDelimiter
+}
+
+// loadPolicy loads the policy rules from the storage with the line handler. On
+// success the statistics of the load are recorded and the hook set with WithOnLoad
+// is called.
+func (a *Adapter) loadPolicy(ctx context.Context, model model.Model, handler func(string, model.Model) error, rng blob.HTTPRange) (err error) {
+	start := time.Now()
+	var n int64
+	var etag azcore.ETag
+	if a.vars != nil {
+		defer func() {
+			a.vars.recordLoad(time.Since(start), etag, err)
+		}()
+	}
+	var skipped []LineError
+	if err := a.retryThrottled(ctx, "load", func() error {
+		return a.retryLoad(ctx, func() error {
+			h := handler
+			if a.lenient {
+				skipped = nil
+				h = a.lenientHandler(handler, &skipped)
+			}
+			var err error
+			n, etag, err = a.loadPolicyBlob(ctx, model, h, rng)
+			return err
+		})
+	}); err != nil {
+		if !a.missingAsEmpty || !errors.Is(err, ErrBlobDoesNotExist) {
+			return err
+		}
+		a.logf("blobadapter: blob %s does not exist, loading empty policy", a.blob)
+	}
+	a.loadedETag.Store(etag)
+	if a.lenient {
+		a.skippedLines.Store(skipped)
+		if len(skipped) > 0 {
+			a.logf("blobadapter: skipped %d invalid lines of blob %s", len(skipped), a.blob)
+		}
+	}
+
+	stats := newOperationStats(model, n, start)
+	a.stats.load.Store(stats)
+	if a.onLoad != nil {
+		info := LoadInfo{Rules: ruleCounts(model), Bytes: n, ETag: etag, Duration: stats.Duration}
+		a.runHook("load", func() { a.onLoad(ctx, info) })
+	}
+	return nil
+}
+
+// loadPolicyBlob loads the policy rules from the storage by downloading
+// the blob and reading it line by line. If rng is set only that range of
+// the blob is downloaded. It returns the number of bytes read and the
+// ETag of the blob.
+func (a *Adapter) loadPolicyBlob(ctx context.Context, model model.Model, handler func(string, model.Model) error, rng blob.HTTPRange) (int64, azcore.ETag, error) {
+	return a.loadBlob(ctx, a.blob, model, handler, rng)
+}
+
+// loadBlob loads policy rules from the blob with the provided name in the
+// container of the adapter the same way as loadPolicyBlob.
+func (a *Adapter) loadBlob(ctx context.Context, name string, model model.Model, handler func(string, model.Model) error, rng blob.HTTPRange) (int64, azcore.ETag, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
 	defer cancel()
 
-	res, err := a.c.DownloadStream(ctx, a.container, a.blob, nil)
+	var o *azblob.DownloadStreamOptions
+	if rng != (blob.HTTPRange{}) {
+		o = &azblob.DownloadStreamOptions{Range: rng}
+	}
+	o = a.downloadStreamOptions(o)
+	ranged := o != nil && o.Range != (blob.HTTPRange{})
+	concurrent := !ranged && a.downloadConcurrency > 1
+
+	first := o
+	if concurrent {
+		// Only the first block is downloaded with the stream. The size of the
+		// blob is read from its Content-Range, and the rest of the blob, if
+		// any, is downloaded with concurrent ranged requests.
+		first = &azblob.DownloadStreamOptions{}
+		if o != nil {
+			*first = *o
+		}
+		first.Range = blob.HTTPRange{Count: a.downloadBlockSize}
+	}
+	ctx, res, err := a.downloadStream(ctx, name, first)
+	if concurrent && bloberror.HasCode(err, bloberror.InvalidRange) {
+		// A range cannot be requested from an empty blob.
+		concurrent = false
+		ctx, res, err = a.downloadStream(ctx, name, o)
+	}
 	if err != nil {
-		if bloberror.HasCode(err, bloberror.ContainerNotFound) {
-			return fmt.Errorf("%w: %s", ErrContainerDoesNotExist, a.container)
-		} else if bloberror.HasCode(err, bloberror.BlobNotFound) {
-			return fmt.Errorf("%w: %s", ErrBlobDoesNotExist, a.blob)
-		} else {
-			return err
+		return 0, "", a.downloadError(err, name)
+	}
+
+	rc := a.downloadBody(ctx, &res)
+	defer rc.Close()
+
+	if a.hierarchicalNamespace && isDirectory(res.Metadata) {
+		return 0, "", fmt.Errorf("%w: %s", ErrBlobIsDirectory, name)
+	}
+	size := res.ContentLength
+	if concurrent {
+		if n, ok := rangeSize(res.ContentRange); ok {
+			size = &n
 		}
 	}
+	if a.maxBlobSize > 0 && size != nil && *size > a.maxBlobSize {
+		return 0, "", fmt.Errorf("%w: %s is %d bytes, limit is %d bytes", ErrBlobTooLarge, name, *size, a.maxBlobSize)
+	}
+	if a.maxPolicySize > 0 && size != nil && *size > a.maxPolicySize {
+		return 0, "", fmt.Errorf("%w: %s is %d bytes, limit is %d bytes", ErrPolicyTooLarge, name, *size, a.maxPolicySize)
+	}
 
-	defer res.Body.Close()
+	var body io.Reader = rc
+	if concurrent && size != nil && res.ContentLength != nil && *size > *res.ContentLength {
+		if body, err = a.downloadBuffer(ctx, name, rc, *res.ContentLength, *size, res.ETag); err != nil {
+			return 0, "", err
+		}
+	}
 
-	scanner := bufio.NewScanner(res.Body)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+	var h hash.Hash
+	if a.checksumVerification && !ranged && name == a.blob {
+		h = sha256.New()
+		body = io.TeeReader(body, h)
+	}
+	if a.maxPolicySize > 0 {
+		// The content length is not known for all downloads, and is not
+		// trusted to match the content.
+		body = &maxSizeReader{r: body, n: a.maxPolicySize, err: ErrPolicyTooLarge}
+	}
+	cr := &countingReader{r: body}
+	var decoded io.Reader = cr
+	encrypted := a.encryptionKey != nil || a.keyWrapper != nil
+	if len(a.signingKeys) > 0 || encrypted || h != nil {
+		// The content is read completely, so that it is verified and decrypted
+		// before any line is passed to the model.
+		if ranged && len(a.signingKeys) > 0 {
+			return 0, "", fmt.Errorf("%w: a range of blob %s cannot be verified", ErrSignatureInvalid, name)
+		}
+		if ranged {
+			return 0, "", fmt.Errorf("%w: a range of blob %s cannot be decrypted", ErrDecryptionFailed, name)
+		}
+		b, err := io.ReadAll(cr)
+		if err != nil {
+			if errors.Is(err, ErrPolicyTooLarge) {
+				return 0, "", err
+			}
+			return 0, "", newStorageError(err)
+		}
+		if h != nil {
+			if err := verifyChecksum(name, res.Metadata, h.Sum(nil)); err != nil {
+				return 0, "", err
+			}
+		}
+		if len(a.signingKeys) > 0 {
+			if err := a.verifySignature(name, b, res.Metadata); err != nil {
+				return 0, "", err
+			}
+		}
+		if encrypted {
+			if b, err = a.decryptPolicy(ctx, name, b, res.Metadata); err != nil {
+				return 0, "", err
+			}
+		}
+		decoded = bytes.NewReader(b)
+	}
+	if !ranged {
+		// Blobs are loaded the same way whether they are compressed or not,
+		// so that compressed and plain blobs can be mixed during a migration.
+		if decoded, err = a.decompressReader(decoded); err != nil {
+			if errors.Is(err, ErrPolicyTooLarge) {
+				return 0, "", err
+			}
+			return 0, "", newStorageError(err)
+		}
+	}
+	if a.encoding != nil {
+		decoded = transform.NewReader(decoded, a.encoding.NewDecoder())
+	}
+	scanner := bufio.NewScanner(decoded)
+	if ranged && !rangeReachesEnd(res.ContentRange) {
+		scanner.Split(scanCompleteLines)
+	}
+	var rules int
+	for first := true; scanner.Scan(); first = false {
+		text := scanner.Text()
+		if first {
+			text = strings.TrimPrefix(text, byteOrderMark)
+		}
+		line := trimLine(text)
+		if a.format == FormatCSVWithHeader {
+			if line, err = csvLine(line); err != nil {
+				return 0, "", err
+			}
+		}
+		if len(line) > 0 && !strings.HasPrefix(line, "#") {
+			if rules++; a.maxRules > 0 && rules > a.maxRules {
+				return 0, "", fmt.Errorf("%w: %s has more than %d rules", ErrPolicyTooLarge, name, a.maxRules)
+			}
+		}
 		if err := handler(line, model); err != nil {
-			return err
+			return 0, "", err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, ErrPolicyTooLarge) {
+			return 0, "", err
+		}
+		return 0, "", newStorageError(err)
+	}
+
+	var etag azcore.ETag
+	if res.ETag != nil {
+		etag = *res.ETag
+	}
+	return cr.n, etag, nil
+}
+
+// downloadStreamOptions returns the options for a download with the options set by
+// the adapter in o, which may be nil. The function set with WithDownloadStreamOptions
+// is called last, on a new options value if o is nil.
+func (a *Adapter) downloadStreamOptions(o *azblob.DownloadStreamOptions) *azblob.DownloadStreamOptions {
+	if a.downloadOptionsFn == nil {
+		return o
+	}
+	if o == nil {
+		o = &azblob.DownloadStreamOptions{}
+	}
+	a.downloadOptionsFn(o)
+	return o
+}
+
+// downloadBody returns the body of the download response, wrapped in a retry reader
+// if retry reader options are set with WithRetryReaderOptions.
+func (a *Adapter) downloadBody(ctx context.Context, res *azblob.DownloadStreamResponse) io.ReadCloser {
+	if a.retryReaderOptions == nil {
+		return res.Body
+	}
+	return res.NewRetryReader(ctx, a.retryReaderOptions)
+}
+
+// downloadError returns the error of a failed download of the blob name
+// wrapped in a StorageError that matches ErrContainerDoesNotExist or
+// ErrBlobDoesNotExist if the container or blob does not exist.
+func (a *Adapter) downloadError(err error, name string) error {
+	if bloberror.HasCode(err, bloberror.ContainerNotFound) {
+		return newStorageErrorWithSentinel(err, ErrContainerDoesNotExist, a.container)
+	} else if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return newStorageErrorWithSentinel(err, ErrBlobDoesNotExist, name)
+	}
+	return newStorageError(err)
+}
+
+// rangeReachesEnd reports whether the Content-Range of a ranged download
+// (e.g. "bytes 0-99/1000") includes the last byte of the blob. If the header
+// is missing or cannot be parsed the full blob is assumed to be returned.
+func rangeReachesEnd(contentRange *string) bool {
+	if contentRange == nil {
+		return true
+	}
+	var first, last, size int64
+	if _, err := fmt.Sscanf(*contentRange, "bytes %d-%d/%d", &first, &last, &size); err != nil {
+		return true
+	}
+	return last+1 >= size
+}
+
+// rangeSize returns the size of the blob from the Content-Range of a ranged
+// download (e.g. "bytes 0-99/1000"). It reports false if the header is missing
+// or cannot be parsed.
+func rangeSize(contentRange *string) (int64, bool) {
+	if contentRange == nil {
+		return 0, false
+	}
+	var first, last, size int64
+	if _, err := fmt.Sscanf(*contentRange, "bytes %d-%d/%d", &first, &last, &size); err != nil {
+		return 0, false
+	}
+	return size, true
+}
+
+// gzipMagic is the magic number of gzip streams, followed by the deflate
+// compression method.
+var gzipMagic = []byte{0x1f, 0x8b, 0x08}
+
+// decompressReader returns a reader of the decompressed content of r if it is a
+// gzip stream, or of the content of r as it is otherwise. The stream is detected
+// by its magic number, which is peeked from a buffer so that the content can be
+// read as it is if it is not found. The size of the decompressed content is
+// limited like the size of the content with WithMaxPolicySize.
+func (a *Adapter) decompressReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !bytes.Equal(magic, gzipMagic) {
+		return br, nil
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	if a.maxPolicySize > 0 {
+		return &maxSizeReader{r: zr, n: a.maxPolicySize, err: ErrPolicyTooLarge}, nil
+	}
+	return zr, nil
+}
+
+// byteOrderMark is the UTF-8 byte order mark that editors such as Notepad
+// write at the start of a file. It is stripped from the first line of a blob.
+const byteOrderMark = "\ufeff"
+
+// trimLine strips a trailing carriage return from a scanned line before
+// trimming surrounding whitespace, so that lines of blobs with CRLF line
+// endings are handled the same way as lines with LF line endings.
+func trimLine(line string) string {
+	return strings.TrimSpace(strings.TrimSuffix(line, "\r"))
+}
+
+// scanCompleteLines is a split function for bufio.Scanner that works like
+// bufio.ScanLines but discards a trailing line that is not terminated by
+// a newline.
+func scanCompleteLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && bytes.IndexByte(data, '\n') < 0 {
+		return len(data), nil, nil
+	}
+	return bufio.ScanLines(data, atEOF)
+}
+
+// downloadBuffer downloads the blob name of the provided size into a buffer. The
+// first n bytes are read from r, the body of the download of the first block, and
+// the rest with concurrent ranged requests. If etag is set the ranged requests are
+// conditioned on it to make sure the same version of the blob is downloaded.
+func (a *Adapter) downloadBuffer(ctx context.Context, name string, r io.Reader, n, size int64, etag *azcore.ETag) (io.Reader, error) {
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf[:n]); err != nil {
+		return nil, newStorageError(err)
+	}
+
+	concurrency := a.downloadConcurrency
+	if concurrency > math.MaxUint16 {
+		concurrency = math.MaxUint16
+	}
+	o := &azblob.DownloadBufferOptions{
+		Range:       blob.HTTPRange{Offset: n, Count: size - n},
+		BlockSize:   a.downloadBlockSize,
+		Concurrency: uint16(concurrency),
+	}
+	if etag != nil {
+		o.AccessConditions = &blob.AccessConditions{
+			ModifiedAccessConditions: &blob.ModifiedAccessConditions{
+				IfMatch: etag,
+			},
 		}
 	}
-	return scanner.Err()
+
+	// The range is set, so no request is made for the properties of the blob,
+	// only one request for each block.
+	for i := int64(0); i < (o.Range.Count+a.downloadBlockSize-1)/a.downloadBlockSize; i++ {
+		a.requests.add(operationDownload)
+	}
+	m, err := a.c.DownloadBuffer(ctx, a.container, name, buf[n:], o)
+	if err != nil {
+		return nil, newStorageError(err)
+	}
+	return bytes.NewReader(buf[:n+m]), nil
 }
 
 // SavePolicy saves all policy rules to the storage.
 func (a *Adapter) SavePolicy(model model.Model) error {
-	if err := checkContainerBlobArguments(a.container, a.blob); err != nil {
-		return err
+	return a.SavePolicyCtx(a.baseContext(), model)
+}
+
+// SavePolicyCtx saves all policy rules to the storage with context.
+func (a *Adapter) SavePolicyCtx(ctx context.Context, model model.Model) error {
+	_, err := a.savePolicy(ctx, model, false)
+	return err
+}
+
+// savePolicy saves all policy rules to the storage and returns the result of
+// the save. Unless force is set, the save is refused if the blob was modified
+// since it was loaded and stale-write protection is enabled. The upload is then
+// conditioned on the ETag of the loaded blob, so that a modification between
+// the check and the upload is not overwritten.
+func (a *Adapter) savePolicy(ctx context.Context, model model.Model, force bool) (result SaveResult, err error) {
+	if a.vars != nil {
+		defer func(start time.Time) {
+			a.vars.recordSave(time.Since(start), result.ETag, err)
+		}(time.Now())
+	}
+	if err := a.checkWritable(); err != nil {
+		return SaveResult{}, err
+	}
+	if a.IsFiltered() {
+		return SaveResult{}, ErrFilteredPolicy
+	}
+	var match *azcore.ETag
+	if a.staleWriteProtection && !force {
+		if loaded, ok := a.loadedETag.Load().(azcore.ETag); ok {
+			match = &loaded
+		}
+		// A dry run does not upload, so the condition is checked with the
+		// properties of the blob instead.
+		if a.dryRun {
+			if err := a.checkStale(ctx); err != nil {
+				return a.staleSave(ctx, model, err)
+			}
+		}
 	}
 
-	var buf bytes.Buffer
-	for ptype, ast := range model["p"] {
-		for _, rule := range ast.Policy {
-			writeRule(&buf, ptype, rule)
+	start := time.Now()
+	var added, removed [][]string
+	audit := len(a.auditBlob) > 0
+	if a.onChange != nil || audit {
+		var err error
+		if added, removed, err = a.policyChanges(ctx, model); err != nil {
+			if a.onChange != nil || a.strictAudit {
+				return SaveResult{}, err
+			}
+			a.logf("blobadapter: writing audit record: %v", err)
+			audit = false
 		}
 	}
 
-	for ptype, ast := range model["g"] {
-		for _, rule := range ast.Policy {
-			writeRule(&buf, ptype, rule)
+	cr := &countingReader{}
+	if err := a.retryThrottled(ctx, "save", func() error {
+		return pipe(func(w io.Writer) error {
+			return a.writeModel(w, model)
+		}, func(r io.Reader) error {
+			cr.r, cr.n = r, 0
+			var err error
+			result, err = a.uploadPolicyBlob(ctx, cr, match)
+			return err
+		})
+	}); err != nil {
+		if match != nil && errors.Is(err, ErrPolicyModifiedSinceLoad) {
+			return a.staleSave(ctx, model, err)
 		}
+		return SaveResult{}, err
 	}
+	etag := result.ETag
+	if !a.dryRun {
+		a.loadedETag.Store(etag)
+	}
+	if a.onChange != nil {
+		a.onChange(added, removed)
+	}
+
+	if audit {
+		if err := a.writeAuditRecord(ctx, auditOperationSave, added, removed); err != nil {
+			if a.strictAudit {
+				return SaveResult{}, err
+			}
+			a.logf("blobadapter: writing audit record: %v", err)
+		}
+	}
+
+	stats := newOperationStats(model, cr.n, start)
+	a.stats.save.Store(stats)
+	if a.onSave != nil {
+		info := SaveInfo{Rules: ruleCounts(model), Bytes: cr.n, ETag: etag, Duration: stats.Duration}
+		a.runHook("save", func() { a.onSave(ctx, info) })
+	}
+	result.Bytes, result.Rules = cr.n, stats.Rules
+	return result, nil
+}
+
+// staleSave handles the error of a save refused by stale-write protection. If
+// the blob was modified since it was loaded and a conflict resolver is set, the
+// model is merged with the blob and saved instead.
+func (a *Adapter) staleSave(ctx context.Context, model model.Model, err error) (SaveResult, error) {
+	if a.conflictResolver == nil || !errors.Is(err, ErrPolicyModifiedSinceLoad) {
+		return SaveResult{}, err
+	}
+	return a.resolveConflict(ctx, model)
+}
+
+// pipePolicy writes the policy rules of the model into a pipe from a separate goroutine
+// while fn consumes the read side, so that the serialized policy is never fully held in
+// memory. It waits for the writer to finish before returning so that the model is not
+// read after pipePolicy returns. An error from the writer takes precedence over the
+// error returned by fn, since fn fails with it when the writer fails.
+func pipePolicy(model model.Model, lineEnding LineEnding, delimiter rune, fn func(r io.Reader) error) error {
+	return pipe(func(w io.Writer) error {
+		return writePolicy(w, model, lineEnding, delimiter)
+	}, fn)
+}
+
+// pipe runs write with the write side of a pipe in a separate goroutine while fn
+// consumes the read side. Errors are returned the same way as pipePolicy.
+func pipe(write func(w io.Writer) error, fn func(r io.Reader) error) error {
+	pr, pw := io.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		err := write(pw)
+		pw.CloseWithError(err)
+		errc <- err
+	}()
 
-	return a.savePolicyBlob(strings.TrimRight(buf.String(), "\n"))
+	err := fn(pr)
+	// Close the read side to unblock the writer if fn returned before
+	// reading all of the policy.
+	pr.Close()
+	if werr := <-errc; werr != nil && !errors.Is(werr, io.ErrClosedPipe) {
+		return werr
+	}
+	return err
 }
 
 // savePolicyBlob saves all policy rules to the storage by uploading
-// the blob.
-func (a *Adapter) savePolicyBlob(text string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+// the contents of the reader to the blob.
+func (a *Adapter) savePolicyBlob(ctx context.Context, r io.Reader) (azcore.ETag, error) {
+	res, err := a.uploadPolicyBlob(ctx, r, nil)
+	return res.ETag, err
+}
+
+// uploadPolicyBlob uploads the contents of the reader to the blob like
+// savePolicyBlob, and returns the ETag of the blob and whether the container
+// was created and a backup was made. Bytes and Rules of the result are not set.
+// If match is set the upload is conditioned on the blob having the ETag, or not
+// existing if it is empty, and fails with ErrPolicyModifiedSinceLoad otherwise.
+func (a *Adapter) uploadPolicyBlob(ctx context.Context, r io.Reader, match *azcore.ETag) (SaveResult, error) {
+	if a.encoding != nil {
+		r = transform.NewReader(r, a.encoding.NewEncoder())
+	}
+	if a.dryRun {
+		// The content is not encrypted, so that no key is wrapped with Key
+		// Vault for an upload that does not happen.
+		return SaveResult{}, a.dryRunUpload(r)
+	}
+	var envelope map[string]string
+	if a.encryptionKey != nil || a.keyWrapper != nil {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return SaveResult{}, err
+		}
+		if b, envelope, err = a.encryptPolicy(ctx, b); err != nil {
+			return SaveResult{}, err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
 	defer cancel()
 
-	if _, err := a.c.CreateContainer(ctx, a.container, nil); err != nil && !bloberror.HasCode(err, bloberror.ContainerAlreadyExists, bloberror.ResourceAlreadyExists) {
+	var result SaveResult
+	if !a.noCreate {
+		a.requests.add(operationCreate)
+		_, err := a.c.CreateContainer(ctx, a.container, nil)
+		if err != nil && !bloberror.HasCode(err, bloberror.ContainerAlreadyExists, bloberror.ResourceAlreadyExists) {
+			return SaveResult{}, newStorageError(err)
+		}
+		result.ContainerCreated = err == nil
+	}
+	if a.maxBlobSize > 0 {
+		r = &maxSizeReader{r: r, n: a.maxBlobSize}
+	}
+
+	var h hash.Hash
+	if a.verifyOnSave || a.checksumVerification {
+		h = sha256.New()
+		r = io.TeeReader(r, h)
+	}
+	mac := a.newMAC()
+	if mac != nil {
+		r = io.TeeReader(r, mac)
+	}
+	values := make(map[string]string, len(envelope)+1)
+	for k, v := range envelope {
+		values[k] = v
+	}
+	if a.checksumVerification || mac != nil || len(a.backupSuffix) > 0 || a.historyKeep > 0 {
+		// The content is read completely, so that its checksum and signature
+		// are uploaded in the metadata of the blob with it, and a load never
+		// sees the content without them. It also makes sure the content is
+		// within the size limit before the backups are made.
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return SaveResult{}, err
+		}
+		for k, v := range a.integrityMetadata(h, mac) {
+			values[k] = v
+		}
+		r = bytes.NewReader(b)
+	}
+	if len(a.backupSuffix) > 0 {
+		backedUp, err := a.backupPolicy(ctx, match)
+		if err != nil {
+			return SaveResult{}, err
+		}
+		result.BackupCreated = backedUp
+	}
+	if a.historyKeep > 0 {
+		backedUp, err := a.backupHistory(ctx, match)
+		if err != nil {
+			return SaveResult{}, err
+		}
+		result.BackupCreated = result.BackupCreated || backedUp
+	}
+
+	o := a.uploadStreamOptions()
+	if match != nil {
+		o = conditionalUploadOptions(o, *match)
+	}
+	if len(values) > 0 {
+		o = metadataUploadOptions(o, values)
+	}
+
+	a.requests.add(operationUpload)
+	var raw *http.Response
+	res, err := a.c.UploadStream(captureResponse(ctx, &raw), a.container, a.blob, r, o)
+	a.recordOperation(operationInfoUpload, raw, res.RequestID, res.ClientRequestID, err)
+	if err != nil {
+		if errors.Is(err, ErrBlobTooLarge) {
+			return SaveResult{}, err
+		}
+		if match != nil && bloberror.HasCode(err, bloberror.ConditionNotMet, bloberror.BlobAlreadyExists) {
+			return SaveResult{}, newStorageErrorWithSentinel(err, ErrPolicyModifiedSinceLoad, a.blob)
+		}
+		if bloberror.HasCode(err, bloberror.BlobImmutableDueToPolicy, codeBlobImmutableDueToLegalHold) {
+			return SaveResult{}, newStorageErrorWithSentinel(err, ErrImmutable, "")
+		}
+		if bloberror.HasCode(err, bloberror.ContainerNotFound) {
+			return SaveResult{}, newStorageErrorWithSentinel(err, ErrContainerDoesNotExist, a.container)
+		}
+		return SaveResult{}, newStorageError(err)
+	}
+
+	saved := res.ETag
+	if a.verifyOnSave {
+		if err := a.verifySave(ctx, saved, h.Sum(nil)); err != nil {
+			return SaveResult{}, err
+		}
+	}
+	if err := a.applyImmutability(ctx); err != nil {
+		return SaveResult{}, err
+	}
+
+	if saved != nil {
+		result.ETag = *saved
+	}
+	return result, nil
+}
+
+// dryRunUpload reads r to the end without uploading it, the same way as an upload
+// with the size limit of the adapter, and logs the suppressed upload.
+func (a *Adapter) dryRunUpload(r io.Reader) error {
+	if a.maxBlobSize > 0 {
+		r = &maxSizeReader{r: r, n: a.maxBlobSize}
+	}
+	n, err := io.Copy(io.Discard, r)
+	if err != nil {
 		return err
 	}
-	_, err := a.c.UploadStream(ctx, a.container, a.blob, bytes.NewReader([]byte(text)), nil)
-	return err
+	a.logf("blobadapter: dry run: suppressed upload of %d bytes to blob %s", n, a.blob)
+	return nil
+}
+
+// maxSizeReader reads from r and fails with err, or ErrBlobTooLarge if err
+// is not set, if more than n bytes are read.
+type maxSizeReader struct {
+	r    io.Reader
+	n    int64
+	read int64
+	err  error
+}
+
+// Read reads from the underlying reader and returns an error if the limit
+// is exceeded.
+func (r *maxSizeReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if r.read += int64(n); r.read > r.n {
+		sentinel := r.err
+		if sentinel == nil {
+			sentinel = ErrBlobTooLarge
+		}
+		return n, fmt.Errorf("%w: limit is %d bytes", sentinel, r.n)
+	}
+	return n, err
+}
+
+// verifySave downloads the blob and verifies that its ETag and the SHA-256
+// checksum of its content matches the provided ETag and checksum of the
+// uploaded content.
+func (a *Adapter) verifySave(ctx context.Context, etag *azcore.ETag, checksum []byte) error {
+	a.requests.add(operationDownload)
+	var raw *http.Response
+	res, err := a.c.DownloadStream(captureResponse(ctx, &raw), a.container, a.blob, a.downloadStreamOptions(nil))
+	a.recordOperation(operationInfoDownload, raw, res.RequestID, res.ClientRequestID, err)
+	if err != nil {
+		return newStorageError(err)
+	}
+	defer res.Body.Close()
+
+	if etag != nil && res.ETag != nil && *etag != *res.ETag {
+		return fmt.Errorf("%w: etag %s does not match uploaded etag %s", ErrSaveVerificationFailed, *res.ETag, *etag)
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, res.Body); err != nil {
+		return newStorageError(err)
+	}
+	if !bytes.Equal(h.Sum(nil), checksum) {
+		return fmt.Errorf("%w: content does not match uploaded content", ErrSaveVerificationFailed)
+	}
+	return nil
+}
+
+// uploadStreamOptions returns the options used for all uploads. The function
+// set with WithUploadStreamOptions is called last on a new options value for
+// every upload.
+func (a *Adapter) uploadStreamOptions() *azblob.UploadStreamOptions {
+	if a.uploadBlockSize == 0 && a.uploadConcurrency == 0 && a.uploadOptionsFn == nil {
+		return nil
+	}
+	o := &azblob.UploadStreamOptions{
+		BlockSize:   a.uploadBlockSize,
+		Concurrency: a.uploadConcurrency,
+	}
+	if a.uploadOptionsFn != nil {
+		a.uploadOptionsFn(o)
+	}
+	return o
+}
+
+// conditionalUploadOptions returns a copy of o, which may be nil, with the upload
+// conditioned on the blob having etag, or not existing if etag is empty.
+func conditionalUploadOptions(o *azblob.UploadStreamOptions, etag azcore.ETag) *azblob.UploadStreamOptions {
+	co := &azblob.UploadStreamOptions{}
+	if o != nil {
+		*co = *o
+	}
+	conditions := &blob.ModifiedAccessConditions{IfMatch: toPtr(etag)}
+	if len(etag) == 0 {
+		conditions = &blob.ModifiedAccessConditions{IfNoneMatch: toPtr(azcore.ETagAny)}
+	}
+	co.AccessConditions = &blob.AccessConditions{ModifiedAccessConditions: conditions}
+	return co
+}
+
+// metadataUploadOptions returns a copy of o, which may be nil, with the values
+// added to the metadata of the upload.
+func metadataUploadOptions(o *azblob.UploadStreamOptions, values map[string]string) *azblob.UploadStreamOptions {
+	mo := &azblob.UploadStreamOptions{}
+	if o != nil {
+		*mo = *o
+	}
+	mo.Metadata = withMetadata(mo.Metadata, values)
+	return mo
+}
+
+// codeBlobImmutableDueToLegalHold is the error code returned when a blob
+// with an active legal hold is modified. It is not defined by bloberror.
+const codeBlobImmutableDueToLegalHold bloberror.Code = "BlobImmutableDueToLegalHold"
+
+// applyImmutability sets the immutability policy and legal hold on the blob
+// if they are configured.
+func (a *Adapter) applyImmutability(ctx context.Context) error {
+	if !a.immutableUntil.IsZero() {
+		var o *blob.SetImmutabilityPolicyOptions
+		if len(a.immutabilityMode) > 0 {
+			o = &blob.SetImmutabilityPolicyOptions{Mode: toPtr(a.immutabilityMode)}
+		}
+		a.requests.add(operationOther)
+		if _, err := a.c.SetImmutabilityPolicy(ctx, a.container, a.blob, a.immutableUntil, o); err != nil {
+			return newStorageError(err)
+		}
+	}
+	if a.legalHold {
+		a.requests.add(operationOther)
+		if _, err := a.c.SetLegalHold(ctx, a.container, a.blob, true, nil); err != nil {
+			return newStorageError(err)
+		}
+	}
+	return nil
 }
 
-// AddPolicy adds a policy rule to the storage.
-// NOTE: This method is not implemented.
+// AddPolicy adds a policy rule to the storage. See MergePolicies.
 func (a *Adapter) AddPolicy(sec, ptype string, rule []string) error {
-	return errors.New("not implemented")
+	return a.AddPolicyCtx(a.baseContext(), sec, ptype, rule)
 }
 
-// RemovePolicy removes a policy rule from the storage.
-// NOTE: This method is not implemented.
+// AddPolicyCtx adds a policy rule to the storage with context. See MergePolicies.
+func (a *Adapter) AddPolicyCtx(ctx context.Context, sec, ptype string, rule []string) error {
+	_, err := a.MergePolicies(ctx, sec, ptype, [][]string{rule})
+	return err
+}
+
+// RemovePolicy removes a policy rule from the storage. See RemovePoliciesCtx.
 func (a *Adapter) RemovePolicy(sec, ptype string, rule []string) error {
-	return errors.New("not implemented")
+	return a.RemovePolicyCtx(a.baseContext(), sec, ptype, rule)
+}
+
+// RemovePolicyCtx removes a policy rule from the storage with context. See
+// RemovePoliciesCtx.
+func (a *Adapter) RemovePolicyCtx(ctx context.Context, sec, ptype string, rule []string) error {
+	return a.RemovePoliciesCtx(ctx, sec, ptype, [][]string{rule})
 }
 
 // RemoveFilteredPolicy removes policy rules that match the filter from the storage.
-// NOTE: This method is not implemented.
+// See RemoveFilteredPolicyCtx.
 func (a *Adapter) RemoveFilteredPolicy(sec, ptype string, fieldIndex int, fieldValues ...string) error {
-	return errors.New("not implemented")
+	return a.RemoveFilteredPolicyCtx(a.baseContext(), sec, ptype, fieldIndex, fieldValues...)
+}
+
+// UpdatePolicy replaces a policy rule in the storage. See UpdatePoliciesCtx.
+func (a *Adapter) UpdatePolicy(sec, ptype string, oldRule, newRule []string) error {
+	return a.UpdatePolicyCtx(a.baseContext(), sec, ptype, oldRule, newRule)
+}
+
+// UpdatePolicyCtx replaces a policy rule in the storage with context. See
+// UpdatePoliciesCtx.
+func (a *Adapter) UpdatePolicyCtx(ctx context.Context, sec, ptype string, oldRule, newRule []string) error {
+	return a.UpdatePoliciesCtx(ctx, sec, ptype, [][]string{oldRule}, [][]string{newRule})
 }
 
 // initAdapter initializes the adapter by creating container and blob if they don't
-// exist.
+// exist. The context is derived from the context set by NewAdapterWithContext, or
+// the base context of the adapter.
 func (a *Adapter) initAdapter() error {
-	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	if a.dryRun {
+		a.logf("blobadapter: dry run: suppressed creation of container %s and blob %s", a.container, a.blob)
+		return nil
+	}
+
+	parent := a.initCtx
+	if parent == nil {
+		parent = a.baseContext()
+	}
+	return a.ensureResources(parent)
+}
+
+// EnsureResources creates the container and blob of the adapter if they don't
+// exist, with the same checks and options as the initialization of the adapter,
+// e.g. WithContainerExists, WithBlobMayNotExist and the initial content of the
+// blob. It can be used to provision the container and blob again after they are
+// deleted, and is safe to call repeatedly, e.g. with retries while the storage
+// account is being provisioned. An existing blob is left as is. With WithNoCreate
+// nothing is created, and ErrContainerDoesNotExist or ErrBlobDoesNotExist is
+// returned if the container or blob does not exist. If the adapter is read-only
+// ErrReadOnly is returned.
+func (a *Adapter) EnsureResources(ctx context.Context) error {
+	if a.readOnly {
+		return ErrReadOnly
+	}
+	if a.dryRun {
+		a.logf("blobadapter: dry run: suppressed creation of container %s and blob %s", a.container, a.blob)
+		return nil
+	}
+	return a.ensureResources(ctx)
+}
+
+// ensureResources creates the container and blob if they don't exist, or checks
+// that they exist with WithNoCreate.
+func (a *Adapter) ensureResources(ctx context.Context) error {
+	if a.noCreate {
+		return a.checkResources(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
 	defer cancel()
 
-	if err := a.createContainerIfNotExist(ctx, a.container); err != nil {
-		return err
+	if !a.containerExists {
+		if err := a.createContainerIfNotExist(ctx, a.container); err != nil {
+			return err
+		}
+	}
+	if a.blobMayNotExist && !a.includeSnapshots {
+		return a.createBlobIfAbsent(ctx, a.container, a.blob)
+	}
+	if a.hierarchicalNamespace && !a.includeSnapshots {
+		return a.createPathIfNotExist(ctx, a.container, a.blob)
 	}
 	if err := a.createBlobIfNotExist(ctx, a.container, a.blob); err != nil {
 		return err
@@ -239,69 +1431,273 @@ func (a *Adapter) initAdapter() error {
 	return nil
 }
 
-// createContainerIfNotExist creates a container if it does not exist.
+// checkResources returns ErrContainerDoesNotExist or ErrBlobDoesNotExist if the
+// container or blob does not exist, without creating them.
+func (a *Adapter) checkResources(ctx context.Context) error {
+	containerExists, blobExists, err := a.Exists(ctx)
+	if err != nil {
+		return newInitError(InitStepCheckExists, err)
+	}
+	if !containerExists {
+		return newInitError(InitStepCheckExists, fmt.Errorf("%w: %s", ErrContainerDoesNotExist, a.container))
+	}
+	if !blobExists {
+		return newInitError(InitStepCheckExists, fmt.Errorf("%w: %s", ErrBlobDoesNotExist, a.blob))
+	}
+	return nil
+}
+
+// maxContainerListPages is the maximum number of pages fetched when looking
+// for the container before attempting to create it.
+const maxContainerListPages = 10
+
+// createContainerIfNotExist creates a container if it does not exist. Containers
+// are listed in lexicographical order, so the listing stops as soon as the container
+// or a name sorting after it is seen. At most maxContainerListPages pages are fetched,
+// after which the container is created and an already existing container is accepted.
 func (a *Adapter) createContainerIfNotExist(ctx context.Context, container string) error {
 	pager := a.c.NewListContainersPager(&azblob.ListContainersOptions{
 		Prefix: toPtr(container),
 	})
 
 	var found bool
-	for pager.More() && !found {
+list:
+	for pages := 0; pager.More() && pages < maxContainerListPages; pages++ {
+		a.requests.add(operationList)
 		res, err := pager.NextPage(ctx)
 		if err != nil {
-			return err
+			return newInitError(InitStepListContainers, newStorageError(err))
 		}
 		for _, c := range res.ContainerItems {
 			if *c.Name == container {
 				found = true
-				break
+				break list
+			}
+			if *c.Name > container {
+				break list
 			}
 		}
 	}
 	if !found {
-		if _, err := a.c.CreateContainer(ctx, container, nil); err != nil {
-			return err
+		a.requests.add(operationCreate)
+		if _, err := a.c.CreateContainer(ctx, container, nil); err != nil && !bloberror.HasCode(err, bloberror.ContainerAlreadyExists) {
+			return newInitError(InitStepCreateContainer, newStorageError(err))
 		}
 	}
 	return nil
 }
 
-// createBlobIfNotExist creates a blob if it does not exist.
+// createBlobIfNotExist creates a blob if it does not exist. With WithIncludeSnapshots
+// ErrBlobHasSnapshots is returned instead if the blob does not exist but has
+// snapshots or previous versions.
 func (a *Adapter) createBlobIfNotExist(ctx context.Context, container, blob string) error {
-	pager := a.c.NewListBlobsFlatPager(container, &azblob.ListBlobsFlatOptions{
+	o := &azblob.ListBlobsFlatOptions{
 		Prefix: toPtr(blob),
-	})
-	var found bool
+	}
+	if a.hierarchicalNamespace {
+		o.Include = azcontainer.ListBlobsInclude{Metadata: true}
+	}
+	if a.includeSnapshots {
+		o.Include.Snapshots, o.Include.Versions = true, true
+	}
+
+	pager := a.c.NewListBlobsFlatPager(container, o)
+	var found, recoverable bool
 	for pager.More() && !found {
+		a.requests.add(operationList)
 		res, err := pager.NextPage(ctx)
 		if err != nil {
-			return err
+			return newInitError(InitStepListBlobs, newStorageError(err))
 		}
 		for _, b := range res.Segment.BlobItems {
 			if *b.Name == blob {
+				if isSnapshotOrVersion(b) {
+					recoverable = true
+					continue
+				}
+				if a.hierarchicalNamespace && isDirectory(b.Metadata) {
+					return newInitError(InitStepListBlobs, fmt.Errorf("%w: %s", ErrBlobIsDirectory, blob))
+				}
 				found = true
 				break
 			}
 		}
 	}
+	if !found && recoverable {
+		return newInitError(InitStepListBlobs, fmt.Errorf("%w: %s", ErrBlobHasSnapshots, blob))
+	}
 	if !found {
-		if _, err := a.c.UploadStream(ctx, container, blob, bytes.NewReader([]byte("")), nil); err != nil {
-			return err
+		content, values, err := a.emptyBlobContent(ctx)
+		if err != nil {
+			return newInitError(InitStepCreateBlob, err)
+		}
+		a.requests.add(operationUpload)
+		var raw *http.Response
+		res, err := a.c.UploadStream(captureResponse(ctx, &raw), container, blob, bytes.NewReader(content), a.emptyBlobUploadOptions(content, values))
+		a.recordOperation(operationInfoUpload, raw, res.RequestID, res.ClientRequestID, err)
+		if err != nil {
+			return newInitError(InitStepCreateBlob, newStorageError(err))
 		}
 	}
 	return nil
 }
 
+// createBlobIfAbsent creates an empty blob with an upload that is conditioned on
+// the blob not existing, instead of listing the blobs to find it first. A blob
+// that already exists is left as is.
+func (a *Adapter) createBlobIfAbsent(ctx context.Context, container, name string) error {
+	content, values, err := a.emptyBlobContent(ctx)
+	if err != nil {
+		return newInitError(InitStepCreateBlob, err)
+	}
+	o := &azblob.UploadStreamOptions{}
+	if uo := a.emptyBlobUploadOptions(content, values); uo != nil {
+		*o = *uo
+	}
+	o.AccessConditions = &blob.AccessConditions{
+		ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfNoneMatch: toPtr(azcore.ETagAny)},
+	}
+
+	a.requests.add(operationUpload)
+	var raw *http.Response
+	res, err := a.c.UploadStream(captureResponse(ctx, &raw), container, name, bytes.NewReader(content), o)
+	a.recordOperation(operationInfoUpload, raw, res.RequestID, res.ClientRequestID, err)
+	if err != nil && !bloberror.HasCode(err, bloberror.BlobAlreadyExists, bloberror.ConditionNotMet) {
+		return newInitError(InitStepCreateBlob, newStorageError(err))
+	}
+	return nil
+}
+
+// createPathIfNotExist creates the blob if it does not exist on an account with
+// hierarchical namespace. The existence check gets the properties of the path
+// instead of listing the blobs with it as prefix, since the listing includes the
+// directories of the account, and a directory at the path results in
+// ErrBlobIsDirectory. The blob is created like with createBlobIfAbsent, and the
+// storage creates the missing parent directories of the path with it.
+func (a *Adapter) createPathIfNotExist(ctx context.Context, container, name string) error {
+	a.requests.add(operationOther)
+	var raw *http.Response
+	props, err := a.c.GetProperties(captureResponse(ctx, &raw), container, name, nil)
+	a.recordOperation(operationInfoProperties, raw, props.RequestID, props.ClientRequestID, err)
+	if err == nil {
+		if isDirectory(props.Metadata) {
+			return newInitError(InitStepCheckExists, fmt.Errorf("%w: %s", ErrBlobIsDirectory, name))
+		}
+		return nil
+	}
+	if !bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return newInitError(InitStepCheckExists, newStorageError(err))
+	}
+	return a.createBlobIfAbsent(ctx, container, name)
+}
+
+// isSnapshotOrVersion reports whether the listed blob is a snapshot or a previous
+// version of a blob instead of the blob itself.
+func isSnapshotOrVersion(b *azcontainer.BlobItem) bool {
+	if b.Snapshot != nil && len(*b.Snapshot) > 0 {
+		return true
+	}
+	return b.VersionID != nil && (b.IsCurrentVersion == nil || !*b.IsCurrentVersion)
+}
+
+// isDirectory reports whether the provided blob metadata marks the blob
+// as a directory on an account with hierarchical namespace.
+func isDirectory(metadata map[string]*string) bool {
+	for k, v := range metadata {
+		if strings.EqualFold(k, "hdi_isfolder") && v != nil && strings.EqualFold(*v, "true") {
+			return true
+		}
+	}
+	return false
+}
+
 // toPtr returns a pointer to the provided value.s
 func toPtr[T any](t T) *T {
 	return &t
 }
 
-// writeRule writes ptype and rule to the buffer.
-func writeRule(buf *bytes.Buffer, ptype string, rule []string) {
-	buf.WriteString(ptype + ", ")
-	buf.WriteString(util.ArrayToString(rule))
-	buf.WriteString("\n")
+// writeModel writes all policy rules of the model to the writer in the format
+// of the adapter, sorted with the function set with WithSortFunc.
+func (a *Adapter) writeModel(w io.Writer, model model.Model) error {
+	if a.sortFunc != nil {
+		model = sortedModel(model, a.sortFunc)
+	}
+	if a.format == FormatCSVWithHeader {
+		return writeCSV(w, modelRules(model), a.lineEnding)
+	}
+	return writePolicy(w, model, a.lineEnding, a.delimiter())
+}
+
+// sortedModel returns a model with the policy rules of m, with the rules of each
+// ptype sorted with less. The order of rules that are equal is kept. Only the
+// rules are set on the returned model, which is only meant to be saved.
+func sortedModel(m model.Model, less func(a, b []string) bool) model.Model {
+	sorted := model.Model{}
+	for _, sec := range []string{"p", "g"} {
+		sorted[sec] = model.AssertionMap{}
+		for ptype, ast := range m[sec] {
+			rules := make([][]string, len(ast.Policy))
+			copy(rules, ast.Policy)
+			sort.SliceStable(rules, func(i, j int) bool {
+				return less(rules[i], rules[j])
+			})
+			sorted[sec][ptype] = &model.Assertion{Key: ast.Key, Value: ast.Value, Policy: rules}
+		}
+	}
+	return sorted
+}
+
+// writeRules writes the lines of a policy blob followed by the rules, each
+// starting with its ptype, to the writer in the format of the adapter.
+func (a *Adapter) writeRules(w io.Writer, lines []string, rules [][]string) error {
+	if a.format == FormatCSVWithHeader {
+		all, err := rulesFromLines(lines, rules)
+		if err != nil {
+			return err
+		}
+		return writeCSV(w, all, a.lineEnding)
+	}
+	return writeLines(w, lines, rules, a.lineEnding, a.delimiter())
+}
+
+// writePolicy writes all policy rules of the model to the writer. Sections
+// are written in the order p, g and the ptypes of each section are sorted
+// to keep the output deterministic. Rules are separated by the line ending,
+// without a trailing line ending after the last rule, and fields by the
+// delimiter.
+func writePolicy(w io.Writer, model model.Model, lineEnding LineEnding, delimiter rune) error {
+	bw := bufio.NewWriter(w)
+	sep := lineEnding.String()
+	var written bool
+	for _, sec := range []string{"p", "g"} {
+		ptypes := make([]string, 0, len(model[sec]))
+		for ptype := range model[sec] {
+			ptypes = append(ptypes, ptype)
+		}
+		sort.Strings(ptypes)
+
+		for _, ptype := range ptypes {
+			for _, rule := range model[sec][ptype].Policy {
+				if written {
+					bw.WriteString(sep)
+				}
+				writeRule(bw, ptype, rule, delimiter)
+				written = true
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// writeRule writes ptype and rule to the writer. Fields are separated by the
+// delimiter, followed by a space if it is a comma like util.ArrayToString.
+func writeRule(w *bufio.Writer, ptype string, rule []string, delimiter rune) {
+	sep := string(delimiter)
+	if delimiter == defaultFieldDelimiter {
+		sep += " "
+	}
+	w.WriteString(ptype + sep)
+	w.WriteString(strings.Join(rule, sep))
 }
 
 // checkAccountCredentialsArguments checks if the provided account and credentials are not empty.
@@ -315,6 +1711,18 @@ func checkAccountCredentialsArguments(account string, cred azcore.TokenCredentia
 	return nil
 }
 
+// checkWritable checks the container and blob arguments of the adapter, and
+// returns ErrReadOnly if the adapter is read-only.
+func (a *Adapter) checkWritable() error {
+	if err := checkContainerBlobArguments(a.container, a.blob); err != nil {
+		return err
+	}
+	if a.readOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
 // checkContainerBlobArguments checks if the provided container and blob are not empty.
 func checkContainerBlobArguments(container, blob string) error {
 	if len(container) == 0 {
@@ -2,10 +2,15 @@ package blobadapter
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,13 +18,19 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/appendblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
 	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
 )
 
 func TestNewAdapter(t *testing.T) {
@@ -55,10 +66,12 @@ func TestNewAdapter(t *testing.T) {
 				},
 			},
 			want: &Adapter{
-				c:         &mockBlobClient{},
-				container: "container",
-				blob:      "blob",
-				timeout:   time.Second * 10,
+				c:             &mockBlobClient{},
+				container:     "container",
+				blob:          "blob",
+				timeout:       time.Second * 10,
+				maxPolicySize: defaultMaxPolicySize,
+				maxRules:      defaultMaxRules,
 			},
 			wantErr: nil,
 		},
@@ -83,10 +96,42 @@ func TestNewAdapter(t *testing.T) {
 				},
 			},
 			want: &Adapter{
-				c:         &mockBlobClient{},
+				c:             &mockBlobClient{},
+				container:     "container",
+				blob:          "blob",
+				timeout:       time.Second * 20,
+				maxPolicySize: defaultMaxPolicySize,
+				maxRules:      defaultMaxRules,
+			},
+		},
+		{
+			name: "Create a new adapter with blob prefix",
+			input: struct {
+				account   string
+				container string
+				blob      string
+				cred      azcore.TokenCredential
+				options   []Option
+			}{
+				account:   "account",
 				container: "container",
-				blob:      "blob",
-				timeout:   time.Second * 20,
+				blob:      "/blob",
+				cred:      &mockCredential{},
+				options: []Option{
+					func(a *Adapter) {
+						a.c = &mockBlobClient{}
+					},
+					WithBlobPrefix("casbin//"),
+				},
+			},
+			want: &Adapter{
+				c:             &mockBlobClient{},
+				container:     "container",
+				blob:          "casbin/blob",
+				prefix:        "casbin//",
+				timeout:       time.Second * 10,
+				maxPolicySize: defaultMaxPolicySize,
+				maxRules:      defaultMaxRules,
 			},
 		},
 		{
@@ -112,11 +157,73 @@ func TestNewAdapter(t *testing.T) {
 				},
 			},
 			want: &Adapter{
-				c:         &mockBlobClient{},
+				c:             &mockBlobClient{},
+				container:     "container",
+				blob:          "blob",
+				timeout:       time.Second * 10,
+				maxPolicySize: defaultMaxPolicySize,
+				maxRules:      defaultMaxRules,
+			},
+		},
+		{
+			name: "Create a new adapter with hierarchical namespace",
+			input: struct {
+				account   string
+				container string
+				blob      string
+				cred      azcore.TokenCredential
+				options   []Option
+			}{
+				account:   "account",
 				container: "container",
 				blob:      "blob",
-				timeout:   time.Second * 10,
+				cred:      &mockCredential{},
+				options: []Option{
+					func(a *Adapter) {
+						a.c = &mockBlobClient{
+							containerFound: true,
+							blobFound:      true,
+						}
+					},
+					WithHierarchicalNamespace(),
+				},
+			},
+			want: &Adapter{
+				c:                     &mockBlobClient{},
+				container:             "container",
+				blob:                  "blob",
+				timeout:               time.Second * 10,
+				maxPolicySize:         defaultMaxPolicySize,
+				maxRules:              defaultMaxRules,
+				hierarchicalNamespace: true,
+			},
+		},
+		{
+			name: "Create a new adapter with hierarchical namespace where blob is a directory",
+			input: struct {
+				account   string
+				container string
+				blob      string
+				cred      azcore.TokenCredential
+				options   []Option
+			}{
+				account:   "account",
+				container: "container",
+				blob:      "blob",
+				cred:      &mockCredential{},
+				options: []Option{
+					func(a *Adapter) {
+						a.c = &mockBlobClient{
+							containerFound:  true,
+							blobFound:       true,
+							blobIsDirectory: true,
+						}
+					},
+					WithHierarchicalNamespace(),
+				},
 			},
+			want:    nil,
+			wantErr: ErrBlobIsDirectory,
 		},
 		{
 			name: "Create a new adapter with invalid account",
@@ -212,7 +319,7 @@ func TestNewAdapter(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			got, gotErr := NewAdapter(test.input.account, test.input.container, test.input.blob, test.input.cred, test.input.options...)
 
-			if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(Adapter{}), cmpopts.IgnoreUnexported(mockBlobClient{})); diff != "" {
+			if diff := cmp.Diff(test.want, got, cmpAdapterOptions...); diff != "" {
 				t.Errorf("NewAdapter() unexpected result (-want +got):\n%s\n", diff)
 			}
 
@@ -223,6 +330,60 @@ func TestNewAdapter(t *testing.T) {
 	}
 }
 
+func TestBlobPath(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			prefix string
+			blob   string
+		}
+		want string
+	}{
+		{
+			name: "Without prefix",
+			input: struct {
+				prefix string
+				blob   string
+			}{
+				blob: "policy.csv",
+			},
+			want: "policy.csv",
+		},
+		{
+			name: "With prefix",
+			input: struct {
+				prefix string
+				blob   string
+			}{
+				prefix: "casbin",
+				blob:   "policy.csv",
+			},
+			want: "casbin/policy.csv",
+		},
+		{
+			name: "With prefix and duplicate slashes",
+			input: struct {
+				prefix string
+				blob   string
+			}{
+				prefix: "/casbin//policies/",
+				blob:   "/policy.csv",
+			},
+			want: "casbin/policies/policy.csv",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := blobPath(test.input.prefix, test.input.blob)
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("blobPath() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
 func TestNewAdapterFromConnectionString(t *testing.T) {
 	var tests = []struct {
 		name  string
@@ -253,10 +414,12 @@ func TestNewAdapterFromConnectionString(t *testing.T) {
 				},
 			},
 			want: &Adapter{
-				c:         &mockBlobClient{},
-				container: "container",
-				blob:      "blob",
-				timeout:   time.Second * 10,
+				c:             &mockBlobClient{},
+				container:     "container",
+				blob:          "blob",
+				timeout:       time.Second * 10,
+				maxPolicySize: defaultMaxPolicySize,
+				maxRules:      defaultMaxRules,
 			},
 			wantErr: nil,
 		},
@@ -279,10 +442,12 @@ func TestNewAdapterFromConnectionString(t *testing.T) {
 				},
 			},
 			want: &Adapter{
-				c:         &mockBlobClient{},
-				container: "container",
-				blob:      "blob",
-				timeout:   time.Second * 20,
+				c:             &mockBlobClient{},
+				container:     "container",
+				blob:          "blob",
+				timeout:       time.Second * 20,
+				maxPolicySize: defaultMaxPolicySize,
+				maxRules:      defaultMaxRules,
 			},
 		},
 		{
@@ -311,7 +476,7 @@ func TestNewAdapterFromConnectionString(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			got, gotErr := NewAdapterFromConnectionString(test.input.connectionString, test.input.container, test.input.blob, test.input.options...)
 
-			if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(Adapter{}), cmpopts.IgnoreUnexported(mockBlobClient{})); diff != "" {
+			if diff := cmp.Diff(test.want, got, cmpAdapterOptions...); diff != "" {
 				t.Errorf("NewAdapterFromConnectionString() unexpected result (-want +got):\n%s\n", diff)
 			}
 
@@ -322,6 +487,59 @@ func TestNewAdapterFromConnectionString(t *testing.T) {
 	}
 }
 
+func TestExpandConnectionString(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   string
+		want    string
+		wantURL string
+	}{
+		{
+			name:    "Development storage shortcut",
+			input:   "UseDevelopmentStorage=true",
+			want:    "DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;AccountKey=" + developmentStorageKey + ";BlobEndpoint=http://127.0.0.1:10000/devstoreaccount1;",
+			wantURL: "http://127.0.0.1:10000/devstoreaccount1/",
+		},
+		{
+			name:    "Development storage shortcut with proxy",
+			input:   "UseDevelopmentStorage=true;DevelopmentStorageProxyUri=http://azurite/",
+			want:    "DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;AccountKey=" + developmentStorageKey + ";BlobEndpoint=http://azurite:10000/devstoreaccount1;",
+			wantURL: "http://azurite:10000/devstoreaccount1/",
+		},
+		{
+			name:    "Explicit blob endpoint with custom port",
+			input:   "DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;AccountKey=" + developmentStorageKey + ";BlobEndpoint=http://localhost:11000/devstoreaccount1;",
+			want:    "DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;AccountKey=" + developmentStorageKey + ";BlobEndpoint=http://localhost:11000/devstoreaccount1;",
+			wantURL: "http://localhost:11000/devstoreaccount1/",
+		},
+		{
+			name:    "Account connection string",
+			input:   fmt.Sprintf("DefaultEndpointsProtocol=https;AccountName=account;AccountKey=%s;EndpointSuffix=core.windows.net", _testKey),
+			want:    fmt.Sprintf("DefaultEndpointsProtocol=https;AccountName=account;AccountKey=%s;EndpointSuffix=core.windows.net", _testKey),
+			wantURL: "https://account.blob.core.windows.net/",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := expandConnectionString(test.input)
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("expandConnectionString() unexpected result (-want +got):\n%s\n", diff)
+			}
+
+			c, err := azblob.NewClientFromConnectionString(got, nil)
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			if diff := cmp.Diff(test.wantURL, c.URL()); diff != "" {
+				t.Errorf("expandConnectionString() unexpected URL (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
 func TestNewAdapterFromSharedKeyCredential(t *testing.T) {
 	var tests = []struct {
 		name  string
@@ -355,10 +573,12 @@ func TestNewAdapterFromSharedKeyCredential(t *testing.T) {
 				},
 			},
 			want: &Adapter{
-				c:         &mockBlobClient{},
-				container: "container",
-				blob:      "blob",
-				timeout:   time.Second * 10,
+				c:             &mockBlobClient{},
+				container:     "container",
+				blob:          "blob",
+				timeout:       time.Second * 10,
+				maxPolicySize: defaultMaxPolicySize,
+				maxRules:      defaultMaxRules,
 			},
 		},
 		{
@@ -382,10 +602,12 @@ func TestNewAdapterFromSharedKeyCredential(t *testing.T) {
 				},
 			},
 			want: &Adapter{
-				c:         &mockBlobClient{},
-				container: "container",
-				blob:      "blob",
-				timeout:   time.Second * 20,
+				c:             &mockBlobClient{},
+				container:     "container",
+				blob:          "blob",
+				timeout:       time.Second * 20,
+				maxPolicySize: defaultMaxPolicySize,
+				maxRules:      defaultMaxRules,
 			},
 		},
 		{
@@ -438,7 +660,7 @@ func TestNewAdapterFromSharedKeyCredential(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			got, gotErr := NewAdapterFromSharedKeyCredential(test.input.account, test.input.key, test.input.container, test.input.blob, test.input.options...)
 
-			if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(Adapter{}), cmpopts.IgnoreUnexported(mockBlobClient{})); diff != "" {
+			if diff := cmp.Diff(test.want, got, cmpAdapterOptions...); diff != "" {
 				t.Errorf("NewAdapterFromSharedKeyCredential() unexpected result (-want +got):\n%s\n", diff)
 			}
 
@@ -463,6 +685,7 @@ func TestAdapter_LoadPolicy(t *testing.T) {
 					c:         &mockBlobClient{},
 					container: "container",
 					blob:      "blob",
+					timeout:   time.Second * 10,
 				}
 			},
 			want: [][]string{
@@ -480,6 +703,7 @@ func TestAdapter_LoadPolicy(t *testing.T) {
 					},
 					container: "container",
 					blob:      "blob",
+					timeout:   time.Second * 10,
 				}
 			},
 			want:    nil,
@@ -496,6 +720,7 @@ func TestAdapter_LoadPolicy(t *testing.T) {
 					},
 					container: "container",
 					blob:      "blob",
+					timeout:   time.Second * 10,
 				}
 			},
 			want:    nil,
@@ -545,6 +770,22 @@ func TestAdapter_SavePolicy(t *testing.T) {
 			},
 			want: []byte(`p, alice, domain1, data1, read` + "\n" + `g, alice, admin, domain1`),
 		},
+		{
+			name: "Save policy with error (upload)",
+			input: struct {
+				c         *mockBlobClient
+				container string
+				blob      string
+			}{
+				c: &mockBlobClient{
+					errUpload: errTest,
+				},
+				container: "container",
+				blob:      "blob",
+			},
+			want:    nil,
+			wantErr: errTest,
+		},
 	}
 
 	for _, test := range tests {
@@ -553,6 +794,7 @@ func TestAdapter_SavePolicy(t *testing.T) {
 				c:         test.input.c,
 				container: test.input.container,
 				blob:      test.input.blob,
+				timeout:   time.Second * 10,
 			}
 
 			e, err := casbin.NewEnforcer("_examples/rbac_with_domains_model.conf", a)
@@ -570,100 +812,3009 @@ func TestAdapter_SavePolicy(t *testing.T) {
 				t.Errorf("SavePolicy() unexpected result (-want +got):\n%s\n", diff)
 			}
 
-			if diff := cmp.Diff(nil, gotErr, cmpopts.EquateErrors()); diff != "" {
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
 				t.Errorf("SavePolicy() unexpected error (-want +got):\n%s\n", diff)
 			}
-
 		})
 	}
 }
 
-type mockBlobClient struct {
-	errCreate      error
-	errDownload    error
-	errUpload      error
-	containerFound bool
-	blobFound      bool
-	policies       []byte
-}
-
-func (c mockBlobClient) NewListContainersPager(o *azblob.ListContainersOptions) *runtime.Pager[azblob.ListContainersResponse] {
-	containers := []*service.ContainerItem{}
-	if c.containerFound {
-		containers = append(containers, &service.ContainerItem{
-			Name: toPtr("container"),
-		})
-	}
-	pager := runtime.NewPager(runtime.PagingHandler[azblob.ListContainersResponse]{
-		More: func(page azblob.ListContainersResponse) bool {
-			return false
+func TestPipePolicy(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   *mockBlobClient
+		wantErr error
+	}{
+		{
+			name:  "Pipe policy",
+			input: &mockBlobClient{},
 		},
-		Fetcher: func(ctx context.Context, page *azblob.ListContainersResponse) (azblob.ListContainersResponse, error) {
-			return azblob.ListContainersResponse{
-				ListContainersSegmentResponse: azblob.ListContainersSegmentResponse{
-					ContainerItems: containers,
-				},
-			}, nil
+		{
+			name: "Pipe policy with upload canceled mid-stream",
+			input: &mockBlobClient{
+				uploadReadLimit: 1024,
+			},
+			wantErr: context.Canceled,
 		},
-	})
-	return pager
-}
+		{
+			name: "Pipe policy with upload failing before reading",
+			input: &mockBlobClient{
+				errUpload: errTest,
+			},
+			wantErr: errTest,
+		},
+	}
 
-func (c mockBlobClient) NewListBlobsFlatPager(containerName string, o *azblob.ListBlobsFlatOptions) *runtime.Pager[azblob.ListBlobsFlatResponse] {
-	blobs := []*container.BlobItem{}
-	if c.blobFound {
-		blobs = append(blobs, &container.BlobItem{
-			Name: toPtr("blob"),
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			for i := 0; i < 10000; i++ {
+				m.AddPolicy("p", "p", []string{"alice", "domain1", fmt.Sprintf("data%d", i), "read"})
+			}
+
+			gotErr := pipePolicy(m, LF, defaultFieldDelimiter, func(r io.Reader) error {
+				_, err := test.input.UploadStream(context.Background(), "container", "blob", r, nil)
+				return err
+			})
+
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("pipePolicy() unexpected error (-want +got):\n%s\n", diff)
+			}
 		})
 	}
-	pager := runtime.NewPager(runtime.PagingHandler[azblob.ListBlobsFlatResponse]{
-		More: func(page azblob.ListBlobsFlatResponse) bool {
-			return false
-		},
-		Fetcher: func(ctx context.Context, page *azblob.ListBlobsFlatResponse) (azblob.ListBlobsFlatResponse, error) {
-			return azblob.ListBlobsFlatResponse{
-				ListBlobsFlatSegmentResponse: azblob.ListBlobsFlatSegmentResponse{
-					Segment: &container.BlobFlatListSegment{
-						BlobItems: blobs,
-					},
-				},
-			}, nil
-		},
-	})
-	return pager
 }
 
-func (c mockBlobClient) CreateContainer(ctx context.Context, containerName string, o *azblob.CreateContainerOptions) (azblob.CreateContainerResponse, error) {
-	if c.errCreate != nil {
-		return azblob.CreateContainerResponse{}, c.errCreate
+func TestWritePolicy_Error(t *testing.T) {
+	m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
 	}
-	return azblob.CreateContainerResponse{}, nil
-}
+	m.AddPolicy("p", "p", []string{"alice", "domain1", "data1", "read"})
 
-func (c mockBlobClient) DownloadStream(ctx context.Context, containerName string, blobName string, o *azblob.DownloadStreamOptions) (azblob.DownloadStreamResponse, error) {
-	if c.errDownload != nil {
-		return azblob.DownloadStreamResponse{}, c.errDownload
-	}
-	return azblob.DownloadStreamResponse{
-		DownloadResponse: blob.DownloadResponse{
-			Body: io.NopCloser(bytes.NewReader([]byte(`p, alice, domain1, data1, read`))),
-		},
-	}, nil
-}
+	gotErr := writePolicy(errWriter{}, m, LF, defaultFieldDelimiter)
 
-func (c *mockBlobClient) UploadStream(ctx context.Context, containerName string, blobName string, body io.Reader, o *azblob.UploadStreamOptions) (azblob.UploadStreamResponse, error) {
-	if c.errUpload != nil {
-		return azblob.UploadStreamResponse{}, c.errUpload
+	if diff := cmp.Diff(errTest, gotErr, cmpopts.EquateErrors()); diff != "" {
+		t.Errorf("writePolicy() unexpected error (-want +got):\n%s\n", diff)
 	}
-	b, _ := io.ReadAll(body)
-	c.policies = b
-	return azblob.UploadStreamResponse{}, nil
 }
 
-type mockCredential struct{}
+// errWriter is a writer that always fails.
+type errWriter struct{}
 
-func (c *mockCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
-	return azcore.AccessToken{}, nil
+func (w errWriter) Write(p []byte) (int, error) {
+	return 0, errTest
 }
 
-var _testKey = base64.StdEncoding.EncodeToString([]byte("<accountKey>"))
+func TestWritePolicy(t *testing.T) {
+	var tests = []struct {
+		name       string
+		input      map[string]map[string][][]string
+		lineEnding LineEnding
+		delimiter  rune
+		want       string
+	}{
+		{
+			name: "Write policy",
+			input: map[string]map[string][][]string{
+				"p": {
+					"p": {{"alice", "domain1", "data1", "read"}},
+				},
+				"g": {
+					"g": {{"alice", "admin", "domain1"}},
+				},
+			},
+			want: "p, alice, domain1, data1, read\ng, alice, admin, domain1",
+		},
+		{
+			name: "Write policy with multiple ptypes in sorted order",
+			input: map[string]map[string][][]string{
+				"p": {
+					"p2": {{"bob", "data2", "write"}},
+					"p":  {{"alice", "data1", "read"}, {"alice", "data1", "write"}},
+				},
+				"g": {
+					"g2": {{"data1", "group1"}},
+					"g":  {{"alice", "admin"}},
+				},
+			},
+			want: "p, alice, data1, read\np, alice, data1, write\np2, bob, data2, write\ng, alice, admin\ng2, data1, group1",
+		},
+		{
+			name: "Write policy with CRLF line ending",
+			input: map[string]map[string][][]string{
+				"p": {
+					"p": {{"alice", "domain1", "data1", "read"}, {"bob", "domain2", "data2", "write"}},
+				},
+				"g": {
+					"g": {{"alice", "admin", "domain1"}},
+				},
+			},
+			lineEnding: CRLF,
+			want:       "p, alice, domain1, data1, read\r\np, bob, domain2, data2, write\r\ng, alice, admin, domain1",
+		},
+		{
+			name: "Write policy with tab delimiter",
+			input: map[string]map[string][][]string{
+				"p": {
+					"p": {{"alice", "domain1", "data1", "read"}},
+				},
+				"g": {
+					"g": {{"alice", "admin", "domain1"}},
+				},
+			},
+			delimiter: '\t',
+			want:      "p\talice\tdomain1\tdata1\tread\ng\talice\tadmin\tdomain1",
+		},
+		{
+			name:  "Write empty policy",
+			input: map[string]map[string][][]string{},
+			want:  "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := model.Model{}
+			for sec, ptypes := range test.input {
+				m[sec] = model.AssertionMap{}
+				for ptype, rules := range ptypes {
+					m[sec][ptype] = &model.Assertion{Policy: rules}
+				}
+			}
+
+			var buf bytes.Buffer
+			delimiter := test.delimiter
+			if delimiter == 0 {
+				delimiter = defaultFieldDelimiter
+			}
+			if err := writePolicy(&buf, m, test.lineEnding, delimiter); err != nil {
+				t.Errorf("error in test: %v\n", err)
+			}
+
+			if diff := cmp.Diff(test.want, buf.String()); diff != "" {
+				t.Errorf("writePolicy() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_SavePolicy_SortFunc(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input func(a, b []string) bool
+		want  string
+	}{
+		{
+			name: "Save policy in model order",
+			want: "p, bob, domain1, data2, read\np, alice, domain1, data2, read\np, alice, domain1, data1, read\ng, bob, admin, domain1\ng, alice, admin, domain1",
+		},
+		{
+			name: "Save policy sorted by subject and object",
+			input: func(a, b []string) bool {
+				if a[0] != b[0] {
+					return a[0] < b[0]
+				}
+				return a[2] < b[2]
+			},
+			want: "p, alice, domain1, data1, read\np, alice, domain1, data2, read\np, bob, domain1, data2, read\ng, alice, admin, domain1\ng, bob, admin, domain1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &mockBlobClient{}
+			a := &Adapter{
+				c:         c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			WithSortFunc(test.input)(a)
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			m.AddPolicies("p", "p", [][]string{{"bob", "domain1", "data2", "read"}, {"alice", "domain1", "data2", "read"}, {"alice", "domain1", "data1", "read"}})
+			m.AddPolicies("g", "g", [][]string{{"bob", "admin", "domain1"}, {"alice", "admin", "domain1"}})
+
+			if err := a.SavePolicy(m); err != nil {
+				t.Fatalf("SavePolicy() unexpected error: %v\n", err)
+			}
+			if diff := cmp.Diff(test.want, string(c.policies)); diff != "" {
+				t.Errorf("SavePolicy() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_LoadPolicyCtx(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   func() (context.Context, *Adapter)
+		want    [][]string
+		wantErr error
+	}{
+		{
+			name: "Load policy",
+			input: func() (context.Context, *Adapter) {
+				return context.Background(), &Adapter{
+					c:         &mockBlobClient{},
+					container: "container",
+					blob:      "blob",
+					timeout:   time.Second * 10,
+				}
+			},
+			want: [][]string{
+				{"alice", "domain1", "data1", "read"},
+			},
+		},
+		{
+			name: "Load policy with line handler",
+			input: func() (context.Context, *Adapter) {
+				return context.Background(), &Adapter{
+					c:         &mockBlobClient{},
+					container: "container",
+					blob:      "blob",
+					timeout:   time.Second * 10,
+					lineHandler: func(line string, m model.Model) error {
+						return persist.LoadPolicyLine(strings.ReplaceAll(line, "domain1", "tenant1/domain1"), m)
+					},
+				}
+			},
+			want: [][]string{
+				{"alice", "tenant1/domain1", "data1", "read"},
+			},
+		},
+		{
+			name: "Load policy with hierarchical namespace where blob is a directory",
+			input: func() (context.Context, *Adapter) {
+				return context.Background(), &Adapter{
+					c: &mockBlobClient{
+						blobIsDirectory: true,
+					},
+					container:             "container",
+					blob:                  "blob",
+					timeout:               time.Second * 10,
+					hierarchicalNamespace: true,
+				}
+			},
+			want:    nil,
+			wantErr: ErrBlobIsDirectory,
+		},
+		{
+			name: "Load policy with canceled context",
+			input: func() (context.Context, *Adapter) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, &Adapter{
+					c:         &mockBlobClient{},
+					container: "container",
+					blob:      "blob",
+					timeout:   time.Second * 10,
+				}
+			},
+			want:    nil,
+			wantErr: context.Canceled,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			ctx, a := test.input()
+			gotErr := a.LoadPolicyCtx(ctx, m)
+			got := m.GetPolicy("p", "p")
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("LoadPolicyCtx() unexpected result (-want +got):\n%s\n", diff)
+			}
+
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("LoadPolicyCtx() unexpected error (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_LoadPolicy_StorageError(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input error
+		want  struct {
+			statusCode int
+			errorCode  string
+			requestID  string
+			sentinel   error
+		}
+	}{
+		{
+			name: "Storage error with response",
+			input: &azcore.ResponseError{
+				StatusCode: http.StatusInternalServerError,
+				ErrorCode:  string(bloberror.InternalError),
+				RawResponse: &http.Response{
+					StatusCode: http.StatusInternalServerError,
+					Header:     http.Header{"X-Ms-Request-Id": []string{"00000000-0000-0000-0000-000000000001"}},
+				},
+			},
+			want: struct {
+				statusCode int
+				errorCode  string
+				requestID  string
+				sentinel   error
+			}{
+				statusCode: http.StatusInternalServerError,
+				errorCode:  string(bloberror.InternalError),
+				requestID:  "00000000-0000-0000-0000-000000000001",
+			},
+		},
+		{
+			name: "Storage error with response matching sentinel",
+			input: &azcore.ResponseError{
+				StatusCode: http.StatusNotFound,
+				ErrorCode:  string(bloberror.BlobNotFound),
+				RawResponse: &http.Response{
+					StatusCode: http.StatusNotFound,
+					Header:     http.Header{"X-Ms-Request-Id": []string{"00000000-0000-0000-0000-000000000002"}},
+				},
+			},
+			want: struct {
+				statusCode int
+				errorCode  string
+				requestID  string
+				sentinel   error
+			}{
+				statusCode: http.StatusNotFound,
+				errorCode:  string(bloberror.BlobNotFound),
+				requestID:  "00000000-0000-0000-0000-000000000002",
+				sentinel:   ErrBlobDoesNotExist,
+			},
+		},
+		{
+			name: "Storage error with response matching sentinel (container)",
+			input: &azcore.ResponseError{
+				StatusCode: http.StatusNotFound,
+				ErrorCode:  string(bloberror.ContainerNotFound),
+				RawResponse: &http.Response{
+					StatusCode: http.StatusNotFound,
+					Header:     http.Header{"X-Ms-Request-Id": []string{"00000000-0000-0000-0000-000000000003"}},
+				},
+			},
+			want: struct {
+				statusCode int
+				errorCode  string
+				requestID  string
+				sentinel   error
+			}{
+				statusCode: http.StatusNotFound,
+				errorCode:  string(bloberror.ContainerNotFound),
+				requestID:  "00000000-0000-0000-0000-000000000003",
+				sentinel:   ErrContainerDoesNotExist,
+			},
+		},
+		{
+			name:  "Storage error without response",
+			input: errTest,
+			want: struct {
+				statusCode int
+				errorCode  string
+				requestID  string
+				sentinel   error
+			}{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         &mockBlobClient{errDownload: test.input},
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			gotErr := a.LoadPolicy(m)
+			var serr *StorageError
+			if !errors.As(gotErr, &serr) {
+				t.Fatalf("LoadPolicy() expected StorageError, got: %v\n", gotErr)
+			}
+
+			if diff := cmp.Diff(test.want.statusCode, serr.StatusCode()); diff != "" {
+				t.Errorf("StatusCode() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.want.errorCode, serr.ErrorCode()); diff != "" {
+				t.Errorf("ErrorCode() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.want.requestID, serr.RequestID()); diff != "" {
+				t.Errorf("RequestID() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if test.want.sentinel != nil && !errors.Is(gotErr, test.want.sentinel) {
+				t.Errorf("LoadPolicy() expected error to match %v, got: %v\n", test.want.sentinel, gotErr)
+			}
+			if !errors.Is(gotErr, test.input) {
+				t.Errorf("LoadPolicy() expected error to wrap %v, got: %v\n", test.input, gotErr)
+			}
+			var resErr *azcore.ResponseError
+			if diff := cmp.Diff(test.want.statusCode != 0, errors.As(gotErr, &resErr)); diff != "" {
+				t.Errorf("LoadPolicy() unexpected ResponseError (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_SavePolicyCtx(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   func() (context.Context, *mockBlobClient)
+		want    []byte
+		wantErr error
+	}{
+		{
+			name: "Save policy",
+			input: func() (context.Context, *mockBlobClient) {
+				return context.Background(), &mockBlobClient{}
+			},
+			want: []byte(`p, alice, domain1, data1, read` + "\n" + `g, alice, admin, domain1`),
+		},
+		{
+			name: "Save policy with canceled context",
+			input: func() (context.Context, *mockBlobClient) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, &mockBlobClient{}
+			},
+			want:    nil,
+			wantErr: context.Canceled,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			m.AddPolicy("p", "p", []string{"alice", "domain1", "data1", "read"})
+			m.AddPolicy("g", "g", []string{"alice", "admin", "domain1"})
+
+			ctx, c := test.input()
+			a := &Adapter{
+				c:         c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+
+			gotErr := a.SavePolicyCtx(ctx, m)
+			got := c.policies
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("SavePolicyCtx() unexpected result (-want +got):\n%s\n", diff)
+			}
+
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("SavePolicyCtx() unexpected error (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_RequestCounts(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input *mockBlobClient
+		want  RequestCounts
+	}{
+		{
+			name:  "Count requests when container and blob does not exist",
+			input: &mockBlobClient{},
+			want: RequestCounts{
+				List:     2,
+				Download: 1,
+				Upload:   2,
+				Create:   2,
+			},
+		},
+		{
+			name: "Count requests when container and blob exist",
+			input: &mockBlobClient{
+				containerFound: true,
+				blobFound:      true,
+			},
+			want: RequestCounts{
+				List:     2,
+				Download: 1,
+				Upload:   1,
+				Create:   1,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, err := NewAdapter("account", "container", "blob", &mockCredential{}, func(a *Adapter) {
+				a.c = test.input
+			})
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			if err := a.LoadPolicy(m); err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			if err := a.SavePolicy(m); err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			got := a.RequestCounts()
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("RequestCounts() unexpected result (-want +got):\n%s\n", diff)
+			}
+
+			if diff := cmp.Diff(test.want.Total(), a.RequestCount()); diff != "" {
+				t.Errorf("RequestCount() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_InitExistenceChecks(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			client          *mockBlobClient
+			containerExists bool
+			blobMayNotExist bool
+		}
+		want        RequestCounts
+		wantIfMatch bool
+		wantErr     bool
+	}{
+		{
+			name: "Initialize with container that exists",
+			input: struct {
+				client          *mockBlobClient
+				containerExists bool
+				blobMayNotExist bool
+			}{
+				client:          &mockBlobClient{blobFound: true},
+				containerExists: true,
+			},
+			want: RequestCounts{List: 1},
+		},
+		{
+			name: "Initialize with blob that may not exist",
+			input: struct {
+				client          *mockBlobClient
+				containerExists bool
+				blobMayNotExist bool
+			}{
+				client:          &mockBlobClient{},
+				containerExists: true,
+				blobMayNotExist: true,
+			},
+			want:        RequestCounts{Upload: 1},
+			wantIfMatch: true,
+		},
+		{
+			name: "Initialize with blob that may not exist (blob exists)",
+			input: struct {
+				client          *mockBlobClient
+				containerExists bool
+				blobMayNotExist bool
+			}{
+				client:          &mockBlobClient{errUpload: &azcore.ResponseError{ErrorCode: string(bloberror.BlobAlreadyExists)}},
+				containerExists: true,
+				blobMayNotExist: true,
+			},
+			want: RequestCounts{Upload: 1},
+		},
+		{
+			name: "Initialize with blob that may not exist with error",
+			input: struct {
+				client          *mockBlobClient
+				containerExists bool
+				blobMayNotExist bool
+			}{
+				client:          &mockBlobClient{errUpload: errTest},
+				blobMayNotExist: true,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, gotErr := NewAdapter("account", "container", "blob", &mockCredential{}, func(a *Adapter) {
+				a.c = test.input.client
+			}, WithContainerExists(test.input.containerExists), WithBlobMayNotExist(test.input.blobMayNotExist))
+			if test.wantErr != (gotErr != nil) {
+				t.Fatalf("NewAdapter() unexpected error: %v\n", gotErr)
+			}
+			if test.wantErr {
+				return
+			}
+
+			if diff := cmp.Diff(test.want, a.RequestCounts()); diff != "" {
+				t.Errorf("NewAdapter() unexpected requests (-want +got):\n%s\n", diff)
+			}
+			if test.wantIfMatch {
+				o := test.input.client.uploadOptions[0]
+				if o == nil || o.AccessConditions == nil || o.AccessConditions.ModifiedAccessConditions == nil || o.AccessConditions.ModifiedAccessConditions.IfNoneMatch == nil {
+					t.Fatalf("NewAdapter() expected upload conditioned on the blob not existing\n")
+				}
+				if diff := cmp.Diff(azcore.ETagAny, *o.AccessConditions.ModifiedAccessConditions.IfNoneMatch); diff != "" {
+					t.Errorf("NewAdapter() unexpected result (-want +got):\n%s\n", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestAdapter_ReadOnly(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input func(a *Adapter, m model.Model) error
+	}{
+		{
+			name: "Save policy",
+			input: func(a *Adapter, m model.Model) error {
+				return a.SavePolicy(m)
+			},
+		},
+		{
+			name: "Add policy",
+			input: func(a *Adapter, m model.Model) error {
+				return a.AddPolicy("p", "p", []string{"alice", "domain1", "data1", "read"})
+			},
+		},
+		{
+			name: "Add policies",
+			input: func(a *Adapter, m model.Model) error {
+				return a.AddPolicies("p", "p", [][]string{{"alice", "domain1", "data1", "read"}})
+			},
+		},
+		{
+			name: "Remove policy",
+			input: func(a *Adapter, m model.Model) error {
+				return a.RemovePolicy("p", "p", []string{"alice", "domain1", "data1", "read"})
+			},
+		},
+		{
+			name: "Remove filtered policy",
+			input: func(a *Adapter, m model.Model) error {
+				return a.RemoveFilteredPolicy("p", "p", 0, "alice")
+			},
+		},
+		{
+			name: "Update policy",
+			input: func(a *Adapter, m model.Model) error {
+				return a.UpdatePolicy("p", "p", []string{"alice", "domain1", "data1", "read"}, []string{"alice", "domain1", "data1", "write"})
+			},
+		},
+		{
+			name: "Import policy",
+			input: func(a *Adapter, m model.Model) error {
+				return a.ImportFromReader(context.Background(), strings.NewReader("p, alice, domain1, data1, read"))
+			},
+		},
+		{
+			name: "Restore backup",
+			input: func(a *Adapter, m model.Model) error {
+				return a.RestoreBackup(context.Background())
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &mockBlobClient{}
+			a, err := NewAdapter("account", "container", "blob", &mockCredential{}, WithReadOnly(true), func(a *Adapter) {
+				a.c = c
+			})
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			if diff := cmp.Diff(int64(0), a.RequestCount()); diff != "" {
+				t.Errorf("NewAdapter() unexpected number of requests (-want +got):\n%s\n", diff)
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			if err := a.LoadPolicy(m); err != nil {
+				t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+			}
+
+			gotErr := test.input(a, m)
+			if diff := cmp.Diff(ErrReadOnly, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(int64(1), a.RequestCount()); diff != "" {
+				t.Errorf("unexpected number of requests (-want +got):\n%s\n", diff)
+			}
+			if c.uploads > 0 {
+				t.Errorf("unexpected upload to read-only adapter\n")
+			}
+		})
+	}
+}
+
+func TestAdapter_EnsureResources(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			deleteContainer bool
+			readOnly        bool
+		}
+		wantErr error
+	}{
+		{
+			name: "Ensure resources that exist",
+		},
+		{
+			name: "Ensure resources that were deleted",
+			input: struct {
+				deleteContainer bool
+				readOnly        bool
+			}{
+				deleteContainer: true,
+			},
+		},
+		{
+			name: "Ensure resources with error (read-only)",
+			input: struct {
+				deleteContainer bool
+				readOnly        bool
+			}{
+				deleteContainer: true,
+				readOnly:        true,
+			},
+			wantErr: ErrReadOnly,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, err := NewInMemoryAdapter(WithLogger(&mockLogger{}))
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			c := a.c.(*memoryClient)
+			if test.input.deleteContainer {
+				delete(c.containers, a.container)
+			}
+			a.readOnly = test.input.readOnly
+
+			for i := 0; i < 2; i++ {
+				gotErr := a.EnsureResources(context.Background())
+				if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+					t.Errorf("EnsureResources() unexpected error (-want +got):\n%s\n", diff)
+				}
+			}
+			_, gotExists := c.containers[a.container][a.blob]
+			if diff := cmp.Diff(test.wantErr == nil, gotExists); diff != "" {
+				t.Errorf("EnsureResources() unexpected blob existence (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_InitError(t *testing.T) {
+	var tests = []struct {
+		name     string
+		input    *mockBlobClient
+		wantStep string
+	}{
+		{
+			name:     "Initialize with error (create container)",
+			input:    &mockBlobClient{errCreate: errTest},
+			wantStep: InitStepCreateContainer,
+		},
+		{
+			name:     "Initialize with error (list blobs)",
+			input:    &mockBlobClient{containerFound: true, errList: errTest},
+			wantStep: InitStepListBlobs,
+		},
+		{
+			name:     "Initialize with error (create blob)",
+			input:    &mockBlobClient{containerFound: true, errUpload: errTest},
+			wantStep: InitStepCreateBlob,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         test.input,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+
+			gotErr := a.EnsureResources(context.Background())
+			var initErr *InitError
+			if !errors.As(gotErr, &initErr) {
+				t.Fatalf("EnsureResources() unexpected error: %v\n", gotErr)
+			}
+			if diff := cmp.Diff(test.wantStep, initErr.Step); diff != "" {
+				t.Errorf("EnsureResources() unexpected step (-want +got):\n%s\n", diff)
+			}
+			if !errors.Is(gotErr, errTest) {
+				t.Errorf("EnsureResources() unexpected error: %v\n", gotErr)
+			}
+		})
+	}
+}
+
+func TestAdapter_NoCreate(t *testing.T) {
+	if _, gotErr := NewInMemoryAdapter(WithNoCreate(), WithLogger(&mockLogger{})); !errors.Is(gotErr, ErrContainerDoesNotExist) {
+		t.Errorf("NewInMemoryAdapter() unexpected error: %v\n", gotErr)
+	}
+
+	a, err := NewInMemoryAdapter(WithLogger(&mockLogger{}))
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	WithNoCreate()(a)
+	c := a.c.(*memoryClient)
+	if err := a.EnsureResources(context.Background()); err != nil {
+		t.Errorf("EnsureResources() unexpected error: %v\n", err)
+	}
+
+	if _, err := c.DeleteBlob(context.Background(), a.container, a.blob, nil); err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	if gotErr := a.EnsureResources(context.Background()); !errors.Is(gotErr, ErrBlobDoesNotExist) {
+		t.Errorf("EnsureResources() unexpected error: %v\n", gotErr)
+	}
+
+	delete(c.containers, a.container)
+	m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	if gotErr := a.SavePolicy(m); !errors.Is(gotErr, ErrContainerDoesNotExist) {
+		t.Errorf("SavePolicy() unexpected error: %v\n", gotErr)
+	}
+	if _, ok := c.containers[a.container]; ok {
+		t.Errorf("SavePolicy() unexpected creation of container %s\n", a.container)
+	}
+}
+
+func TestAdapter_IncludeSnapshots(t *testing.T) {
+	snapshot := &container.BlobItem{Name: toPtr("blob"), Snapshot: toPtr("2024-01-01T00:00:00.0000000Z")}
+	version := &container.BlobItem{Name: toPtr("blob"), VersionID: toPtr("2024-01-01T00:00:00.0000000Z")}
+	current := &container.BlobItem{Name: toPtr("blob"), VersionID: toPtr("2024-01-02T00:00:00.0000000Z"), IsCurrentVersion: toPtr(true)}
+
+	var tests = []struct {
+		name  string
+		input struct {
+			items            []*container.BlobItem
+			includeSnapshots bool
+		}
+		wantUploads int
+		wantErr     error
+	}{
+		{
+			name: "Initialize with snapshot of blob that does not exist",
+			input: struct {
+				items            []*container.BlobItem
+				includeSnapshots bool
+			}{
+				items:            []*container.BlobItem{snapshot},
+				includeSnapshots: true,
+			},
+			wantErr: ErrBlobHasSnapshots,
+		},
+		{
+			name: "Initialize with previous version of blob that does not exist",
+			input: struct {
+				items            []*container.BlobItem
+				includeSnapshots bool
+			}{
+				items:            []*container.BlobItem{version},
+				includeSnapshots: true,
+			},
+			wantErr: ErrBlobHasSnapshots,
+		},
+		{
+			name: "Initialize with snapshot of blob that exists",
+			input: struct {
+				items            []*container.BlobItem
+				includeSnapshots bool
+			}{
+				items:            []*container.BlobItem{snapshot, version, current},
+				includeSnapshots: true,
+			},
+		},
+		{
+			name: "Initialize without snapshots",
+			input: struct {
+				items            []*container.BlobItem
+				includeSnapshots bool
+			}{
+				includeSnapshots: true,
+			},
+			wantUploads: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &mockBlobClient{containerFound: true, listItems: test.input.items}
+			a := &Adapter{
+				c:                c,
+				container:        "container",
+				blob:             "blob",
+				timeout:          time.Second * 10,
+				includeSnapshots: test.input.includeSnapshots,
+			}
+
+			gotErr := a.EnsureResources(context.Background())
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("EnsureResources() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantUploads, c.uploads); diff != "" {
+				t.Errorf("EnsureResources() unexpected number of uploads (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestNewAdapterWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var tests = []struct {
+		name    string
+		input   context.Context
+		wantErr error
+	}{
+		{
+			name:  "New adapter with context",
+			input: context.Background(),
+		},
+		{
+			name:    "New adapter with error (context cancelled)",
+			input:   ctx,
+			wantErr: context.Canceled,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, gotErr := NewAdapterWithContext(test.input, "account", "container", "blob", &mockCredential{}, func(a *Adapter) {
+				a.c = &mockBlobClient{}
+			})
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("NewAdapterWithContext() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if a != nil && a.initCtx != nil {
+				t.Errorf("NewAdapterWithContext() unexpected context kept by adapter\n")
+			}
+		})
+	}
+}
+
+func TestNewAdaptersFromClient(t *testing.T) {
+	c, err := azblob.NewClientWithNoCredential("https://account.blob.core.windows.net/", &azblob.ClientOptions{
+		ClientOptions: policy.ClientOptions{Transport: &mockTransport{}},
+	})
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+
+	var tests = []struct {
+		name  string
+		input struct {
+			client *azblob.Client
+			blobs  []string
+		}
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "New adapters from client",
+			input: struct {
+				client *azblob.Client
+				blobs  []string
+			}{
+				client: c,
+				blobs:  []string{"policy1.csv", "policy2.csv"},
+			},
+			want: []string{"policy1.csv", "policy2.csv"},
+		},
+		{
+			name: "New adapters with error (invalid client)",
+			input: struct {
+				client *azblob.Client
+				blobs  []string
+			}{
+				blobs: []string{"policy1.csv"},
+			},
+			wantErr: ErrInvalidClient,
+		},
+		{
+			name: "New adapters with error (invalid blob)",
+			input: struct {
+				client *azblob.Client
+				blobs  []string
+			}{
+				client: c,
+				blobs:  []string{"policy1.csv", ""},
+			},
+			wantErr: ErrInvalidBlob,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, gotErr := NewAdaptersFromClient(test.input.client, "container", test.input.blobs, WithReadOnly(true))
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("NewAdaptersFromClient() unexpected error (-want +got):\n%s\n", diff)
+			}
+
+			var blobs []string
+			for _, a := range got {
+				blobs = append(blobs, a.Blob())
+				if a.c.(*blobClient).Client != test.input.client {
+					t.Errorf("NewAdaptersFromClient() expected adapter to use the client\n")
+				}
+			}
+			if diff := cmp.Diff(test.want, blobs); diff != "" {
+				t.Errorf("NewAdaptersFromClient() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if len(got) > 1 {
+				m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+				if err != nil {
+					t.Fatalf("error in test: %v\n", err)
+				}
+				if err := got[0].LoadPolicy(m); err != nil {
+					t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+				}
+				if got[1].Stats().LastLoad.At != (time.Time{}) || got[1].RequestCount() != 0 {
+					t.Errorf("NewAdaptersFromClient() expected adapters to have independent state\n")
+				}
+			}
+		})
+	}
+}
+
+func TestAdapter_DryRun(t *testing.T) {
+	c := &mockBlobClient{}
+	logger := &mockLogger{}
+	var added [][]string
+	a, err := NewAdapter("account", "container", "blob", &mockCredential{},
+		WithDryRun(true),
+		WithLogger(logger),
+		WithAuditBlob("audit.log"),
+		WithChangeCallback(func(a, _ [][]string) {
+			added = a
+		}),
+		func(a *Adapter) {
+			a.c = c
+		},
+	)
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+
+	m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	m.AddPolicy("p", "p", []string{"bob", "domain2", "data2", "write"})
+
+	if err := a.SavePolicy(m); err != nil {
+		t.Fatalf("SavePolicy() unexpected error: %v\n", err)
+	}
+	if err := a.ImportFromReader(context.Background(), strings.NewReader("p, alice, domain1, data1, read")); err != nil {
+		t.Fatalf("ImportFromReader() unexpected error: %v\n", err)
+	}
+
+	if c.uploads > 0 || c.audit != nil {
+		t.Errorf("unexpected write in dry run\n")
+	}
+	if diff := cmp.Diff(RequestCounts{Download: 1}, a.RequestCounts()); diff != "" {
+		t.Errorf("unexpected requests in dry run (-want +got):\n%s\n", diff)
+	}
+	if diff := cmp.Diff([][]string{{"p", "bob", "domain2", "data2", "write"}}, added); diff != "" {
+		t.Errorf("SavePolicy() unexpected changes (-want +got):\n%s\n", diff)
+	}
+
+	want := []string{
+		"blobadapter: dry run: suppressed creation of container container and blob blob",
+		"blobadapter: dry run: suppressed upload of 29 bytes to blob blob",
+		`blobadapter: dry run: suppressed audit record: {"timestamp":`,
+		"blobadapter: dry run: suppressed upload of 30 bytes to blob blob",
+	}
+	if len(logger.lines) != len(want) {
+		t.Fatalf("unexpected log lines: %q\n", logger.lines)
+	}
+	for i, line := range logger.lines {
+		if !strings.HasPrefix(line, want[i]) {
+			t.Errorf("unexpected log line, want prefix: %q, got: %q\n", want[i], line)
+		}
+	}
+}
+
+func TestAdapter_UpdatePolicy_Enforcer(t *testing.T) {
+	a := &Adapter{
+		c:         &mockBlobClient{},
+		container: "container",
+		blob:      "blob",
+		timeout:   time.Second * 10,
+	}
+
+	e, err := casbin.NewEnforcer("_examples/rbac_with_domains_model.conf", a)
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+
+	ok, err := e.UpdatePolicy([]string{"alice", "domain1", "data1", "read"}, []string{"alice", "domain1", "data1", "write"})
+	if err != nil || !ok {
+		t.Fatalf("UpdatePolicy() unexpected result: %v, %v\n", ok, err)
+	}
+	if diff := cmp.Diff([][]string{{"alice", "domain1", "data1", "write"}}, e.GetPolicy()); diff != "" {
+		t.Errorf("UpdatePolicy() unexpected result (-want +got):\n%s\n", diff)
+	}
+
+	ok, err = e.UpdatePolicies([][]string{{"alice", "domain1", "data1", "write"}}, [][]string{{"alice", "domain1", "data2", "write"}})
+	if err != nil || !ok {
+		t.Fatalf("UpdatePolicies() unexpected result: %v, %v\n", ok, err)
+	}
+	if diff := cmp.Diff([][]string{{"alice", "domain1", "data2", "write"}}, e.GetPolicy()); diff != "" {
+		t.Errorf("UpdatePolicies() unexpected result (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestAdapter_BaseContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a, err := NewAdapter("account", "container", "blob", &mockCredential{}, WithBaseContext(ctx), func(a *Adapter) {
+		a.c = &mockBlobClient{containerFound: true, blobFound: true}
+	})
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+
+	m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	if err := a.LoadPolicy(m); err != nil {
+		t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+	}
+
+	cancel()
+	if diff := cmp.Diff(context.Canceled, a.LoadPolicy(m), cmpopts.EquateErrors()); diff != "" {
+		t.Errorf("LoadPolicy() unexpected error (-want +got):\n%s\n", diff)
+	}
+	if diff := cmp.Diff(context.Canceled, a.SavePolicy(m), cmpopts.EquateErrors()); diff != "" {
+		t.Errorf("SavePolicy() unexpected error (-want +got):\n%s\n", diff)
+	}
+	if err := a.LoadPolicyCtx(context.Background(), m); err != nil {
+		t.Errorf("LoadPolicyCtx() unexpected error: %v\n", err)
+	}
+}
+
+func TestAdapter_FieldDelimiter(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			content   string
+			delimiter rune
+		}
+		want      [][]string
+		wantGroup [][]string
+	}{
+		{
+			name: "Load and save policy with tab delimiter",
+			input: struct {
+				content   string
+				delimiter rune
+			}{
+				content:   "p\talice\tdomain1\tdata1\tread\ng\talice\tadmin\tdomain1",
+				delimiter: '\t',
+			},
+			want:      [][]string{{"alice", "domain1", "data1", "read"}},
+			wantGroup: [][]string{{"alice", "admin", "domain1"}},
+		},
+		{
+			name: "Load and save policy with semicolon delimiter",
+			input: struct {
+				content   string
+				delimiter rune
+			}{
+				content:   "p;alice;domain1;data1;read\ng;alice;admin;domain1",
+				delimiter: ';',
+			},
+			want:      [][]string{{"alice", "domain1", "data1", "read"}},
+			wantGroup: [][]string{{"alice", "admin", "domain1"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &mockBlobClient{content: []byte(test.input.content)}
+			a := &Adapter{
+				c:         c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			WithFieldDelimiter(test.input.delimiter)(a)
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			if err := a.LoadPolicy(m); err != nil {
+				t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+			}
+			if diff := cmp.Diff(test.want, m["p"]["p"].Policy); diff != "" {
+				t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantGroup, m["g"]["g"].Policy); diff != "" {
+				t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+			}
+
+			if err := a.SavePolicy(m); err != nil {
+				t.Fatalf("SavePolicy() unexpected error: %v\n", err)
+			}
+			if diff := cmp.Diff(test.input.content, string(c.policies)); diff != "" {
+				t.Errorf("SavePolicy() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_LoadPolicy_CRLF(t *testing.T) {
+	crlf, err := os.ReadFile("testdata/policy_crlf.csv")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	if !bytes.Contains(crlf, []byte("\r\n")) {
+		t.Fatalf("error in test: fixture does not contain CRLF line endings\n")
+	}
+	lf := bytes.ReplaceAll(crlf, []byte("\r\n"), []byte("\n"))
+
+	var got [2]model.Model
+	for i, content := range [][]byte{crlf, lf} {
+		a := &Adapter{
+			c:         &mockBlobClient{content: content},
+			container: "container",
+			blob:      "blob",
+			timeout:   time.Second * 10,
+		}
+		m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+		if err != nil {
+			t.Fatalf("error in test: %v\n", err)
+		}
+		if err := a.LoadPolicy(m); err != nil {
+			t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+		}
+		got[i] = m
+	}
+
+	want := [][]string{
+		{"alice", "domain1", "data1", "read"},
+		{"bob", "domain2", "data2", "write"},
+	}
+	if diff := cmp.Diff(want, got[0]["p"]["p"].Policy); diff != "" {
+		t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+	}
+	for _, sec := range []string{"p", "g"} {
+		if diff := cmp.Diff(got[1][sec][sec].Policy, got[0][sec][sec].Policy); diff != "" {
+			t.Errorf("LoadPolicy() unexpected difference between LF and CRLF (-want +got):\n%s\n", diff)
+		}
+	}
+}
+
+func TestAdapter_LoadPolicy_Encoding(t *testing.T) {
+	encode := func(enc encoding.Encoding, s string) []byte {
+		b, err := enc.NewEncoder().Bytes([]byte(s))
+		if err != nil {
+			t.Fatalf("error in test: %v\n", err)
+		}
+		return b
+	}
+	utf16 := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+
+	var tests = []struct {
+		name  string
+		input struct {
+			content  []byte
+			encoding encoding.Encoding
+		}
+		want     [][]string
+		wantSave []byte
+	}{
+		{
+			name: "Load policy with UTF-8 byte order mark",
+			input: struct {
+				content  []byte
+				encoding encoding.Encoding
+			}{
+				content: []byte("\ufeffp, alice, domain1, data1, read"),
+			},
+			want:     [][]string{{"alice", "domain1", "data1", "read"}},
+			wantSave: []byte("p, alice, domain1, data1, read"),
+		},
+		{
+			name: "Load policy with UTF-16LE encoding",
+			input: struct {
+				content  []byte
+				encoding encoding.Encoding
+			}{
+				content:  encode(utf16, "p, alice, domain1, data1, read"),
+				encoding: utf16,
+			},
+			want:     [][]string{{"alice", "domain1", "data1", "read"}},
+			wantSave: encode(utf16, "p, alice, domain1, data1, read"),
+		},
+		{
+			name: "Load policy with Windows-1252 encoding",
+			input: struct {
+				content  []byte
+				encoding encoding.Encoding
+			}{
+				content:  []byte("p, jos\xe9, domain1, data1, read"),
+				encoding: charmap.Windows1252,
+			},
+			want:     [][]string{{"josé", "domain1", "data1", "read"}},
+			wantSave: []byte("p, jos\xe9, domain1, data1, read"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &mockBlobClient{content: test.input.content}
+			a := &Adapter{
+				c:         c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			WithEncoding(test.input.encoding)(a)
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			if err := a.LoadPolicy(m); err != nil {
+				t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+			}
+			if diff := cmp.Diff(test.want, m["p"]["p"].Policy); diff != "" {
+				t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+			}
+
+			if err := a.SavePolicy(m); err != nil {
+				t.Fatalf("SavePolicy() unexpected error: %v\n", err)
+			}
+			if diff := cmp.Diff(test.wantSave, c.policies); diff != "" {
+				t.Errorf("SavePolicy() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_LoadPolicy_Gzip(t *testing.T) {
+	compress := func(s string) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(s))
+		zw.Close()
+		return buf.Bytes()
+	}
+
+	var tests = []struct {
+		name  string
+		input struct {
+			content       []byte
+			maxPolicySize int64
+		}
+		want    [][]string
+		wantErr error
+	}{
+		{
+			name: "Load gzip-compressed policy",
+			input: struct {
+				content       []byte
+				maxPolicySize int64
+			}{
+				content: compress("p, alice, domain1, data1, read\np, bob, domain2, data2, write"),
+			},
+			want: [][]string{{"alice", "domain1", "data1", "read"}, {"bob", "domain2", "data2", "write"}},
+		},
+		{
+			name: "Load plain policy",
+			input: struct {
+				content       []byte
+				maxPolicySize int64
+			}{
+				content: []byte("p, alice, domain1, data1, read"),
+			},
+			want: [][]string{{"alice", "domain1", "data1", "read"}},
+		},
+		{
+			name: "Load gzip-compressed policy with error (policy too large)",
+			input: struct {
+				content       []byte
+				maxPolicySize int64
+			}{
+				content:       compress(strings.Repeat("p, alice, domain1, data1, read\n", 100)),
+				maxPolicySize: 1000,
+			},
+			wantErr: ErrPolicyTooLarge,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:             &mockBlobClient{content: test.input.content},
+				container:     "container",
+				blob:          "blob",
+				timeout:       time.Second * 10,
+				maxPolicySize: test.input.maxPolicySize,
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			gotErr := a.LoadPolicy(m)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("LoadPolicy() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if test.wantErr != nil {
+				return
+			}
+			if diff := cmp.Diff(test.want, m["p"]["p"].Policy); diff != "" {
+				t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_LoadPolicyRange(t *testing.T) {
+	content := []byte("p, alice, domain1, data1, read\np, bob, domain2, data2, write\np, carol, domain1, data3, read")
+	var tests = []struct {
+		name  string
+		input struct {
+			start int64
+			count int64
+		}
+		want    [][]string
+		wantErr bool
+	}{
+		{
+			name: "Load range ending at a line boundary",
+			input: struct {
+				start int64
+				count int64
+			}{
+				start: 0,
+				count: 31,
+			},
+			want: [][]string{
+				{"alice", "domain1", "data1", "read"},
+			},
+		},
+		{
+			name: "Load range ending in the middle of a line",
+			input: struct {
+				start int64
+				count int64
+			}{
+				start: 0,
+				count: 40,
+			},
+			want: [][]string{
+				{"alice", "domain1", "data1", "read"},
+			},
+		},
+		{
+			name: "Load range to the end of the blob",
+			input: struct {
+				start int64
+				count int64
+			}{
+				start: 31,
+				count: 0,
+			},
+			want: [][]string{
+				{"bob", "domain2", "data2", "write"},
+				{"carol", "domain1", "data3", "read"},
+			},
+		},
+		{
+			name: "Load range with count past the end of the blob",
+			input: struct {
+				start int64
+				count int64
+			}{
+				start: 31,
+				count: 1024,
+			},
+			want: [][]string{
+				{"bob", "domain2", "data2", "write"},
+				{"carol", "domain1", "data3", "read"},
+			},
+		},
+		{
+			name: "Load range with invalid range",
+			input: struct {
+				start int64
+				count int64
+			}{
+				start: -1,
+				count: 10,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         &mockBlobClient{content: content},
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			gotErr := a.LoadPolicyRange(m, test.input.start, test.input.count)
+			if (gotErr != nil) != test.wantErr {
+				t.Fatalf("LoadPolicyRange() unexpected error: %v\n", gotErr)
+			}
+
+			if diff := cmp.Diff(test.want, m.GetPolicy("p", "p")); diff != "" {
+				t.Errorf("LoadPolicyRange() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_Stats(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input func(a *Adapter, m model.Model) error
+		want  Stats
+	}{
+		{
+			name: "Stats before any operation",
+			input: func(a *Adapter, m model.Model) error {
+				return nil
+			},
+			want: Stats{},
+		},
+		{
+			name: "Stats after load",
+			input: func(a *Adapter, m model.Model) error {
+				return a.LoadPolicy(m)
+			},
+			want: Stats{
+				LastLoad: OperationStats{
+					Rules: map[string]int{"p": 1, "g": 0},
+					Bytes: 30,
+				},
+			},
+		},
+		{
+			name: "Stats after load and save",
+			input: func(a *Adapter, m model.Model) error {
+				if err := a.LoadPolicy(m); err != nil {
+					return err
+				}
+				m.AddPolicy("g", "g", []string{"alice", "admin", "domain1"})
+				return a.SavePolicy(m)
+			},
+			want: Stats{
+				LastLoad: OperationStats{
+					Rules: map[string]int{"p": 1, "g": 0},
+					Bytes: 30,
+				},
+				LastSave: OperationStats{
+					Rules: map[string]int{"p": 1, "g": 1},
+					Bytes: 55,
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         &mockBlobClient{},
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			if err := test.input(a, m); err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			got := a.Stats()
+			if diff := cmp.Diff(test.want, got, cmpopts.IgnoreFields(OperationStats{}, "Duration", "At")); diff != "" {
+				t.Errorf("Stats() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if !got.LastLoad.At.IsZero() == (test.want.LastLoad.Rules == nil) {
+				t.Errorf("Stats() unexpected load time: %v\n", got.LastLoad.At)
+			}
+		})
+	}
+}
+
+func TestAdapter_LastOperationInfo(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			client *mockBlobClient
+			fn     func(a *Adapter, m model.Model) error
+		}
+		want OperationInfo
+	}{
+		{
+			name: "Last operation info before any operation",
+			input: struct {
+				client *mockBlobClient
+				fn     func(a *Adapter, m model.Model) error
+			}{
+				client: &mockBlobClient{},
+				fn: func(a *Adapter, m model.Model) error {
+					return nil
+				},
+			},
+			want: OperationInfo{},
+		},
+		{
+			name: "Last operation info after load",
+			input: struct {
+				client *mockBlobClient
+				fn     func(a *Adapter, m model.Model) error
+			}{
+				client: &mockBlobClient{},
+				fn: func(a *Adapter, m model.Model) error {
+					return a.LoadPolicy(m)
+				},
+			},
+			want: OperationInfo{
+				Operation:       "download",
+				ClientRequestID: "download-client-request-id",
+				RequestID:       "download-request-id",
+			},
+		},
+		{
+			name: "Last operation info after save",
+			input: struct {
+				client *mockBlobClient
+				fn     func(a *Adapter, m model.Model) error
+			}{
+				client: &mockBlobClient{},
+				fn: func(a *Adapter, m model.Model) error {
+					return a.SavePolicy(m)
+				},
+			},
+			want: OperationInfo{
+				Operation:       "upload",
+				ClientRequestID: "upload-client-request-id",
+				RequestID:       "upload-request-id",
+			},
+		},
+		{
+			name: "Last operation info after failed load",
+			input: struct {
+				client *mockBlobClient
+				fn     func(a *Adapter, m model.Model) error
+			}{
+				client: &mockBlobClient{
+					errDownload: &azcore.ResponseError{
+						StatusCode: http.StatusInternalServerError,
+						ErrorCode:  string(bloberror.InternalError),
+						RawResponse: &http.Response{
+							StatusCode: http.StatusInternalServerError,
+							Header: http.Header{
+								"X-Ms-Request-Id":        []string{"00000000-0000-0000-0000-000000000001"},
+								"X-Ms-Client-Request-Id": []string{"00000000-0000-0000-0000-000000000002"},
+							},
+						},
+					},
+				},
+				fn: func(a *Adapter, m model.Model) error {
+					a.LoadPolicy(m)
+					return nil
+				},
+			},
+			want: OperationInfo{
+				Operation:       "download",
+				ClientRequestID: "00000000-0000-0000-0000-000000000002",
+				RequestID:       "00000000-0000-0000-0000-000000000001",
+				StatusCode:      http.StatusInternalServerError,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         test.input.client,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			if err := test.input.fn(a, m); err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			got := a.LastOperationInfo()
+			if diff := cmp.Diff(test.want, got, cmpopts.IgnoreFields(OperationInfo{}, "Err", "At")); diff != "" {
+				t.Errorf("LastOperationInfo() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.input.client.errDownload, got.Err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("LastOperationInfo() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.want.Operation == "", got.At.IsZero()); diff != "" {
+				t.Errorf("LastOperationInfo() unexpected time (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_CreateContainerIfNotExist(t *testing.T) {
+	emptyPages := make([][]string, maxContainerListPages+5)
+	emptyPages[len(emptyPages)-1] = []string{"container"}
+
+	var tests = []struct {
+		name  string
+		input *mockBlobClient
+		want  RequestCounts
+	}{
+		{
+			name: "Container found on second page",
+			input: &mockBlobClient{
+				containerPages: [][]string{{"a"}, {"b", "container"}, {"d"}},
+			},
+			want: RequestCounts{
+				List: 2,
+			},
+		},
+		{
+			name: "Container not found before name sorting after it",
+			input: &mockBlobClient{
+				containerPages: [][]string{{"a"}, {"container-1"}, {"container-2"}},
+			},
+			want: RequestCounts{
+				List:   2,
+				Create: 1,
+			},
+		},
+		{
+			name: "Container not found within page limit",
+			input: &mockBlobClient{
+				containerPages: emptyPages,
+				errCreate: &azcore.ResponseError{
+					ErrorCode: string(bloberror.ContainerAlreadyExists),
+				},
+			},
+			want: RequestCounts{
+				List:   maxContainerListPages,
+				Create: 1,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{c: test.input}
+			if err := a.createContainerIfNotExist(context.Background(), "container"); err != nil {
+				t.Errorf("createContainerIfNotExist() unexpected error: %v\n", err)
+			}
+			if diff := cmp.Diff(test.want, a.RequestCounts()); diff != "" {
+				t.Errorf("createContainerIfNotExist() unexpected requests (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_createPathIfNotExist(t *testing.T) {
+	var tests = []struct {
+		name         string
+		input        *mockBlobClient
+		wantUploads  int
+		wantRequests RequestCounts
+		wantErr      error
+	}{
+		{
+			name:         "Path exists",
+			input:        &mockBlobClient{},
+			wantRequests: RequestCounts{Other: 1},
+		},
+		{
+			name: "Path does not exist",
+			input: &mockBlobClient{
+				errProperties: &azcore.ResponseError{
+					ErrorCode: string(bloberror.BlobNotFound),
+				},
+			},
+			wantUploads:  1,
+			wantRequests: RequestCounts{Upload: 1, Other: 1},
+		},
+		{
+			name: "Path is a directory",
+			input: &mockBlobClient{
+				blobIsDirectory: true,
+			},
+			wantRequests: RequestCounts{Other: 1},
+			wantErr:      ErrBlobIsDirectory,
+		},
+		{
+			name: "Path with error",
+			input: &mockBlobClient{
+				errProperties: errTest,
+			},
+			wantRequests: RequestCounts{Other: 1},
+			wantErr:      errTest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{c: test.input, hierarchicalNamespace: true}
+			gotErr := a.createPathIfNotExist(context.Background(), "container", "policies/blob")
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("createPathIfNotExist() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantUploads, test.input.uploads); diff != "" {
+				t.Errorf("createPathIfNotExist() unexpected number of uploads (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantRequests, a.RequestCounts()); diff != "" {
+				t.Errorf("createPathIfNotExist() unexpected requests (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_LoadPolicy_DownloadConcurrency(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			parallel  int
+			blockSize int64
+		}
+		want               [][]string
+		wantDownloadBuffer *azblob.DownloadBufferOptions
+		wantRequests       RequestCounts
+	}{
+		{
+			name: "Load policy larger than block size",
+			input: struct {
+				parallel  int
+				blockSize int64
+			}{
+				parallel:  4,
+				blockSize: 8,
+			},
+			want: [][]string{
+				{"alice", "domain1", "data1", "read"},
+			},
+			wantDownloadBuffer: &azblob.DownloadBufferOptions{
+				Range:       blob.HTTPRange{Offset: 8, Count: 22},
+				BlockSize:   8,
+				Concurrency: 4,
+			},
+			wantRequests: RequestCounts{Download: 4},
+		},
+		{
+			name: "Load policy smaller than block size",
+			input: struct {
+				parallel  int
+				blockSize int64
+			}{
+				parallel:  4,
+				blockSize: 1024,
+			},
+			want: [][]string{
+				{"alice", "domain1", "data1", "read"},
+			},
+			wantDownloadBuffer: nil,
+			wantRequests:       RequestCounts{Download: 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &mockBlobClient{}
+			a := &Adapter{
+				c:         c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			WithDownloadConcurrency(test.input.parallel, test.input.blockSize)(a)
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			if err := a.LoadPolicy(m); err != nil {
+				t.Errorf("LoadPolicy() unexpected error: %v\n", err)
+			}
+
+			if diff := cmp.Diff(test.want, m.GetPolicy("p", "p")); diff != "" {
+				t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+			}
+
+			if diff := cmp.Diff(test.wantDownloadBuffer, c.downloadBuffer, cmpopts.IgnoreFields(azblob.DownloadBufferOptions{}, "AccessConditions", "RetryReaderOptionsPerBlock")); diff != "" {
+				t.Errorf("LoadPolicy() unexpected download buffer options (-want +got):\n%s\n", diff)
+			}
+
+			if diff := cmp.Diff(test.wantRequests, a.RequestCounts()); diff != "" {
+				t.Errorf("LoadPolicy() unexpected requests (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_SavePolicy_Immutability(t *testing.T) {
+	until := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		name  string
+		input struct {
+			c       *mockBlobClient
+			options []Option
+		}
+		wantUntil     time.Time
+		wantMode      *blob.SetImmutabilityPolicyOptions
+		wantLegalHold bool
+		wantErr       error
+	}{
+		{
+			name: "Save policy with immutability policy",
+			input: struct {
+				c       *mockBlobClient
+				options []Option
+			}{
+				c: &mockBlobClient{},
+				options: []Option{
+					WithImmutabilityPolicy(until, blob.ImmutabilityPolicySettingLocked),
+				},
+			},
+			wantUntil: until,
+			wantMode: &blob.SetImmutabilityPolicyOptions{
+				Mode: toPtr(blob.ImmutabilityPolicySettingLocked),
+			},
+		},
+		{
+			name: "Save policy with legal hold",
+			input: struct {
+				c       *mockBlobClient
+				options []Option
+			}{
+				c: &mockBlobClient{},
+				options: []Option{
+					WithLegalHold(true),
+				},
+			},
+			wantLegalHold: true,
+		},
+		{
+			name: "Save policy with error (immutable due to policy)",
+			input: struct {
+				c       *mockBlobClient
+				options []Option
+			}{
+				c: &mockBlobClient{
+					errUpload: &azcore.ResponseError{
+						ErrorCode: string(bloberror.BlobImmutableDueToPolicy),
+					},
+				},
+				options: []Option{
+					WithImmutabilityPolicy(until, blob.ImmutabilityPolicySettingLocked),
+				},
+			},
+			wantErr: ErrImmutable,
+		},
+		{
+			name: "Save policy with error (immutable due to legal hold)",
+			input: struct {
+				c       *mockBlobClient
+				options []Option
+			}{
+				c: &mockBlobClient{
+					errUpload: &azcore.ResponseError{
+						ErrorCode: string(codeBlobImmutableDueToLegalHold),
+					},
+				},
+			},
+			wantErr: ErrImmutable,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         test.input.c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			for _, option := range test.input.options {
+				option(a)
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			gotErr := a.SavePolicy(m)
+
+			if diff := cmp.Diff(test.wantUntil, test.input.c.immutableUntil); diff != "" {
+				t.Errorf("SavePolicy() unexpected immutability expiry (-want +got):\n%s\n", diff)
+			}
+
+			if diff := cmp.Diff(test.wantMode, test.input.c.immutability); diff != "" {
+				t.Errorf("SavePolicy() unexpected immutability options (-want +got):\n%s\n", diff)
+			}
+
+			if diff := cmp.Diff(test.wantLegalHold, test.input.c.legalHold); diff != "" {
+				t.Errorf("SavePolicy() unexpected legal hold (-want +got):\n%s\n", diff)
+			}
+
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("SavePolicy() unexpected error (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_UploadOptions(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input []Option
+		want  []*azblob.UploadStreamOptions
+	}{
+		{
+			name:  "Upload with default options",
+			input: nil,
+			want:  []*azblob.UploadStreamOptions{nil, nil},
+		},
+		{
+			name: "Upload with block size and concurrency",
+			input: []Option{
+				WithUploadOptions(8*1024*1024, 8),
+			},
+			want: []*azblob.UploadStreamOptions{
+				{BlockSize: 8 * 1024 * 1024, Concurrency: 8},
+				{BlockSize: 8 * 1024 * 1024, Concurrency: 8},
+			},
+		},
+		{
+			name: "Upload with upload stream options",
+			input: []Option{
+				WithUploadStreamOptions(func(o *azblob.UploadStreamOptions) {
+					o.AccessTier = toPtr(blob.AccessTierCool)
+					o.Tags = map[string]string{"app": "casbin"}
+				}),
+			},
+			want: []*azblob.UploadStreamOptions{
+				{AccessTier: toPtr(blob.AccessTierCool), Tags: map[string]string{"app": "casbin"}},
+				{AccessTier: toPtr(blob.AccessTierCool), Tags: map[string]string{"app": "casbin"}},
+			},
+		},
+		{
+			name: "Upload with upload stream options overriding block size",
+			input: []Option{
+				WithUploadStreamOptions(func(o *azblob.UploadStreamOptions) {
+					o.BlockSize = 4 * 1024 * 1024
+				}),
+				WithUploadOptions(8*1024*1024, 8),
+			},
+			want: []*azblob.UploadStreamOptions{
+				{BlockSize: 4 * 1024 * 1024, Concurrency: 8},
+				{BlockSize: 4 * 1024 * 1024, Concurrency: 8},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &mockBlobClient{}
+			options := append([]Option{func(a *Adapter) {
+				a.c = c
+			}}, test.input...)
+
+			a, err := NewAdapter("account", "container", "blob", &mockCredential{}, options...)
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			if err := a.SavePolicy(m); err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			if diff := cmp.Diff(test.want, c.uploadOptions); diff != "" {
+				t.Errorf("UploadStream() unexpected options (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_DownloadStreamOptions(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			options []Option
+			load    func(a *Adapter, m model.Model) error
+		}
+		want      []*azblob.DownloadStreamOptions
+		wantRules [][]string
+	}{
+		{
+			name: "Download with default options",
+			input: struct {
+				options []Option
+				load    func(a *Adapter, m model.Model) error
+			}{
+				load: func(a *Adapter, m model.Model) error {
+					return a.LoadPolicy(m)
+				},
+			},
+			want:      []*azblob.DownloadStreamOptions{nil},
+			wantRules: [][]string{{"alice", "domain1", "data1", "read"}, {"bob", "domain2", "data2", "write"}},
+		},
+		{
+			name: "Download with download stream options",
+			input: struct {
+				options []Option
+				load    func(a *Adapter, m model.Model) error
+			}{
+				options: []Option{
+					WithDownloadStreamOptions(func(o *azblob.DownloadStreamOptions) {
+						o.RangeGetContentMD5 = toPtr(true)
+					}),
+				},
+				load: func(a *Adapter, m model.Model) error {
+					return a.LoadPolicy(m)
+				},
+			},
+			want:      []*azblob.DownloadStreamOptions{{RangeGetContentMD5: toPtr(true)}},
+			wantRules: [][]string{{"alice", "domain1", "data1", "read"}, {"bob", "domain2", "data2", "write"}},
+		},
+		{
+			name: "Download with download stream options and range",
+			input: struct {
+				options []Option
+				load    func(a *Adapter, m model.Model) error
+			}{
+				options: []Option{
+					WithDownloadStreamOptions(func(o *azblob.DownloadStreamOptions) {
+						o.RangeGetContentMD5 = toPtr(true)
+					}),
+				},
+				load: func(a *Adapter, m model.Model) error {
+					return a.LoadPolicyRange(m, 0, 40)
+				},
+			},
+			want:      []*azblob.DownloadStreamOptions{{Range: blob.HTTPRange{Count: 40}, RangeGetContentMD5: toPtr(true)}},
+			wantRules: [][]string{{"alice", "domain1", "data1", "read"}},
+		},
+		{
+			name: "Download with range set by download stream options",
+			input: struct {
+				options []Option
+				load    func(a *Adapter, m model.Model) error
+			}{
+				options: []Option{
+					WithDownloadStreamOptions(func(o *azblob.DownloadStreamOptions) {
+						o.Range = blob.HTTPRange{Count: 40}
+					}),
+				},
+				load: func(a *Adapter, m model.Model) error {
+					return a.LoadPolicy(m)
+				},
+			},
+			want:      []*azblob.DownloadStreamOptions{{Range: blob.HTTPRange{Count: 40}}},
+			wantRules: [][]string{{"alice", "domain1", "data1", "read"}},
+		},
+		{
+			name: "Download with retry reader options",
+			input: struct {
+				options []Option
+				load    func(a *Adapter, m model.Model) error
+			}{
+				options: []Option{
+					WithRetryReaderOptions(blob.RetryReaderOptions{MaxRetries: 10}),
+				},
+				load: func(a *Adapter, m model.Model) error {
+					return a.LoadPolicy(m)
+				},
+			},
+			want:      []*azblob.DownloadStreamOptions{nil},
+			wantRules: [][]string{{"alice", "domain1", "data1", "read"}, {"bob", "domain2", "data2", "write"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &mockBlobClient{
+				content: []byte("p, alice, domain1, data1, read\np, bob, domain2, data2, write\n"),
+			}
+			a := &Adapter{
+				c:         c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			for _, option := range test.input.options {
+				option(a)
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			if err := test.input.load(a, m); err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			if diff := cmp.Diff(test.want, c.downloadOptions); diff != "" {
+				t.Errorf("DownloadStream() unexpected options (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantRules, m["p"]["p"].Policy); diff != "" {
+				t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_MaxBlobSize(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			size int64
+			fn   func(a *Adapter, m model.Model) error
+		}
+		wantUploads int
+		wantErr     error
+	}{
+		{
+			name: "Load policy within limit",
+			input: struct {
+				size int64
+				fn   func(a *Adapter, m model.Model) error
+			}{
+				size: 30,
+				fn: func(a *Adapter, m model.Model) error {
+					return a.LoadPolicy(m)
+				},
+			},
+		},
+		{
+			name: "Load policy with error (blob too large)",
+			input: struct {
+				size int64
+				fn   func(a *Adapter, m model.Model) error
+			}{
+				size: 29,
+				fn: func(a *Adapter, m model.Model) error {
+					return a.LoadPolicy(m)
+				},
+			},
+			wantErr: ErrBlobTooLarge,
+		},
+		{
+			name: "Save policy within limit",
+			input: struct {
+				size int64
+				fn   func(a *Adapter, m model.Model) error
+			}{
+				size: 30,
+				fn: func(a *Adapter, m model.Model) error {
+					m.AddPolicy("p", "p", []string{"alice", "domain1", "data1", "read"})
+					return a.SavePolicy(m)
+				},
+			},
+			wantUploads: 1,
+		},
+		{
+			name: "Save policy with error (policy too large)",
+			input: struct {
+				size int64
+				fn   func(a *Adapter, m model.Model) error
+			}{
+				size: 30,
+				fn: func(a *Adapter, m model.Model) error {
+					m.AddPolicy("p", "p", []string{"alice", "domain1", "data1", "read"})
+					m.AddPolicy("p", "p", []string{"bob", "domain2", "data2", "write"})
+					return a.SavePolicy(m)
+				},
+			},
+			wantUploads: 0,
+			wantErr:     ErrBlobTooLarge,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &mockBlobClient{}
+			a := &Adapter{
+				c:         c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			WithMaxBlobSize(test.input.size)(a)
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			gotErr := test.input.fn(a, m)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantUploads, c.uploads); diff != "" {
+				t.Errorf("unexpected uploads (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_MaxPolicySize(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			size  int64
+			rules int
+		}
+		wantErr error
+	}{
+		{
+			name: "Load policy within limits",
+			input: struct {
+				size  int64
+				rules int
+			}{
+				size:  69,
+				rules: 2,
+			},
+		},
+		{
+			name: "Load policy without limits",
+		},
+		{
+			name: "Load policy with error (policy too large)",
+			input: struct {
+				size  int64
+				rules int
+			}{
+				size: 68,
+			},
+			wantErr: ErrPolicyTooLarge,
+		},
+		{
+			name: "Load policy with error (too many rules)",
+			input: struct {
+				size  int64
+				rules int
+			}{
+				rules: 1,
+			},
+			wantErr: ErrPolicyTooLarge,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         &mockBlobClient{content: []byte("# rules\np, alice, domain1, data1, read\n\np, bob, domain2, data2, write")},
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			WithMaxPolicySize(test.input.size)(a)
+			WithMaxRules(test.input.rules)(a)
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			gotErr := a.LoadPolicy(m)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("LoadPolicy() unexpected error (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_SavePolicy_VerifyOnSave(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   *mockBlobClient
+		wantErr error
+	}{
+		{
+			name:  "Save policy with verification",
+			input: &mockBlobClient{},
+		},
+		{
+			name: "Save policy with failed verification",
+			input: &mockBlobClient{
+				staleReads: true,
+			},
+			wantErr: ErrSaveVerificationFailed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:            test.input,
+				container:    "container",
+				blob:         "blob",
+				timeout:      time.Second * 10,
+				verifyOnSave: true,
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			m.AddPolicy("p", "p", []string{"alice", "domain1", "data1", "write"})
+
+			gotErr := a.SavePolicy(m)
+
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("SavePolicy() unexpected error (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+type mockBlobClient struct {
+	errCreate       error
+	errDownload     error
+	errUpload       error
+	containerFound  bool
+	blobFound       bool
+	blobIsDirectory bool
+	content         []byte
+	policies        []byte
+	downloadBuffer  *azblob.DownloadBufferOptions
+	immutableUntil  time.Time
+	immutability    *blob.SetImmutabilityPolicyOptions
+	legalHold       bool
+	uploadOptions   []*azblob.UploadStreamOptions
+	uploads         int
+	staleReads      bool
+	uploadReadLimit int
+	errAppend       error
+	audit           []byte
+	auditCreated    bool
+	containerPages  [][]string
+	blobs           map[string][]byte
+	errCopy         error
+	copies          []string
+	copyPending     int
+	listBlobs       []string
+	errDelete       error
+	deleted         []string
+	downloadOptions []*azblob.DownloadStreamOptions
+	errFilter       error
+	filterPages     [][]string
+	filterQuery     string
+	throttle        []*azcore.ResponseError
+	listItems       []*container.BlobItem
+	errList         error
+	errTier         error
+	tier            blob.AccessTier
+	blobMetadata    map[string]*string
+	errMetadata     error
+	errSecondary    error
+	secondaryReads  int
+	errProperties   error
+}
+
+// throttled returns the next throttling error of the mock, if any.
+func (c *mockBlobClient) throttled() error {
+	if len(c.throttle) == 0 {
+		return nil
+	}
+	err := c.throttle[0]
+	c.throttle = c.throttle[1:]
+	return err
+}
+
+func (c mockBlobClient) NewListContainersPager(o *azblob.ListContainersOptions) *runtime.Pager[azblob.ListContainersResponse] {
+	pages := c.containerPages
+	if pages == nil {
+		pages = [][]string{{}}
+		if c.containerFound {
+			pages[0] = append(pages[0], "container")
+		}
+	}
+	pager := runtime.NewPager(runtime.PagingHandler[azblob.ListContainersResponse]{
+		More: func(page azblob.ListContainersResponse) bool {
+			return page.NextMarker != nil
+		},
+		Fetcher: func(ctx context.Context, page *azblob.ListContainersResponse) (azblob.ListContainersResponse, error) {
+			i := 0
+			if page != nil {
+				fmt.Sscan(*page.NextMarker, &i)
+			}
+			containers := []*service.ContainerItem{}
+			for _, name := range pages[i] {
+				containers = append(containers, &service.ContainerItem{
+					Name: toPtr(name),
+				})
+			}
+			var next *string
+			if i+1 < len(pages) {
+				next = toPtr(fmt.Sprint(i + 1))
+			}
+			return azblob.ListContainersResponse{
+				ListContainersSegmentResponse: azblob.ListContainersSegmentResponse{
+					ContainerItems: containers,
+					NextMarker:     next,
+				},
+			}, nil
+		},
+	})
+	return pager
+}
+
+func (c mockBlobClient) NewListBlobsFlatPager(containerName string, o *azblob.ListBlobsFlatOptions) *runtime.Pager[azblob.ListBlobsFlatResponse] {
+	blobs := []*container.BlobItem{}
+	if c.blobFound {
+		blobs = append(blobs, &container.BlobItem{
+			Name:     toPtr("blob"),
+			Metadata: c.metadata(),
+		})
+	}
+	for _, name := range c.listBlobs {
+		if o == nil || o.Prefix == nil || strings.HasPrefix(name, *o.Prefix) {
+			blobs = append(blobs, &container.BlobItem{Name: toPtr(name)})
+		}
+	}
+	blobs = append(blobs, c.listItems...)
+	pager := runtime.NewPager(runtime.PagingHandler[azblob.ListBlobsFlatResponse]{
+		More: func(page azblob.ListBlobsFlatResponse) bool {
+			return false
+		},
+		Fetcher: func(ctx context.Context, page *azblob.ListBlobsFlatResponse) (azblob.ListBlobsFlatResponse, error) {
+			if c.errList != nil {
+				return azblob.ListBlobsFlatResponse{}, c.errList
+			}
+			return azblob.ListBlobsFlatResponse{
+				ListBlobsFlatSegmentResponse: azblob.ListBlobsFlatSegmentResponse{
+					Segment: &container.BlobFlatListSegment{
+						BlobItems: blobs,
+					},
+				},
+			}, nil
+		},
+	})
+	return pager
+}
+
+func (c mockBlobClient) CreateContainer(ctx context.Context, containerName string, o *azblob.CreateContainerOptions) (azblob.CreateContainerResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return azblob.CreateContainerResponse{}, err
+	}
+	if c.errCreate != nil {
+		return azblob.CreateContainerResponse{}, c.errCreate
+	}
+	return azblob.CreateContainerResponse{}, nil
+}
+
+func (c *mockBlobClient) DownloadStream(ctx context.Context, containerName string, blobName string, o *azblob.DownloadStreamOptions) (azblob.DownloadStreamResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return azblob.DownloadStreamResponse{}, err
+	}
+	c.downloadOptions = append(c.downloadOptions, o)
+	if isSecondaryRead(ctx) {
+		c.secondaryReads++
+		if c.errSecondary != nil {
+			return azblob.DownloadStreamResponse{}, c.errSecondary
+		}
+	}
+	if err := c.throttled(); err != nil {
+		return azblob.DownloadStreamResponse{}, err
+	}
+	if b, ok := c.blobs[blobName]; ok {
+		return azblob.DownloadStreamResponse{
+			DownloadResponse: blob.DownloadResponse{
+				Body:          io.NopCloser(bytes.NewReader(b)),
+				ContentLength: toPtr(int64(len(b))),
+			},
+		}, nil
+	}
+	if c.errDownload != nil {
+		return azblob.DownloadStreamResponse{}, c.errDownload
+	}
+	content := c.blobContent()
+	var contentRange *string
+	if o != nil && o.Range != (blob.HTTPRange{}) {
+		size := int64(len(content))
+		start, end := o.Range.Offset, size
+		if o.Range.Count > 0 && start+o.Range.Count < size {
+			end = start + o.Range.Count
+		}
+		if start > size {
+			start = size
+		}
+		content = content[start:end]
+		contentRange = toPtr(fmt.Sprintf("bytes %d-%d/%d", start, end-1, size))
+	}
+	return azblob.DownloadStreamResponse{
+		DownloadResponse: blob.DownloadResponse{
+			Body:            io.NopCloser(bytes.NewReader(content)),
+			ContentLength:   toPtr(int64(len(content))),
+			ContentRange:    contentRange,
+			ETag:            toPtr(c.etag()),
+			Metadata:        c.metadata(),
+			RequestID:       toPtr("download-request-id"),
+			ClientRequestID: toPtr("download-client-request-id"),
+		},
+	}, nil
+}
+
+func (c *mockBlobClient) DownloadBuffer(ctx context.Context, containerName string, blobName string, buffer []byte, o *azblob.DownloadBufferOptions) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if c.errDownload != nil {
+		return 0, c.errDownload
+	}
+	c.downloadBuffer = o
+	content := c.blobContent()
+	if o != nil && o.Range.Offset < int64(len(content)) {
+		content = content[o.Range.Offset:]
+	}
+	return int64(copy(buffer, content)), nil
+}
+
+func (c mockBlobClient) blobContent() []byte {
+	if c.uploads > 0 && !c.staleReads {
+		return c.policies
+	}
+	if c.content != nil {
+		return c.content
+	}
+	return []byte(`p, alice, domain1, data1, read`)
+}
+
+func (c mockBlobClient) metadata() map[string]*string {
+	if c.blobIsDirectory {
+		return map[string]*string{"hdi_isfolder": toPtr("true")}
+	}
+	return c.blobMetadata
+}
+
+func (c *mockBlobClient) UploadStream(ctx context.Context, containerName string, blobName string, body io.Reader, o *azblob.UploadStreamOptions) (azblob.UploadStreamResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return azblob.UploadStreamResponse{}, err
+	}
+	if c.errUpload != nil {
+		return azblob.UploadStreamResponse{}, c.errUpload
+	}
+	if err := c.throttled(); err != nil {
+		return azblob.UploadStreamResponse{}, err
+	}
+	if o != nil && o.AccessConditions != nil && o.AccessConditions.ModifiedAccessConditions != nil {
+		if match := o.AccessConditions.ModifiedAccessConditions.IfMatch; match != nil && *match != c.etag() {
+			return azblob.UploadStreamResponse{}, &azcore.ResponseError{ErrorCode: string(bloberror.ConditionNotMet), StatusCode: http.StatusPreconditionFailed}
+		}
+	}
+	if c.uploadReadLimit > 0 {
+		_, _ = io.ReadFull(body, make([]byte, c.uploadReadLimit))
+		return azblob.UploadStreamResponse{}, context.Canceled
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return azblob.UploadStreamResponse{}, err
+	}
+	c.policies = b
+	c.uploadOptions = append(c.uploadOptions, o)
+	c.blobMetadata = nil
+	if o != nil {
+		c.blobMetadata = o.Metadata
+	}
+	c.uploads++
+	return azblob.UploadStreamResponse{
+		ETag:            toPtr(azcore.ETag(fmt.Sprintf("\"0x%d\"", c.uploads))),
+		RequestID:       toPtr("upload-request-id"),
+		ClientRequestID: toPtr("upload-client-request-id"),
+	}, nil
+}
+
+func (c *mockBlobClient) CreateAppendBlob(ctx context.Context, containerName string, blobName string, o *appendblob.CreateOptions) (appendblob.CreateResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return appendblob.CreateResponse{}, err
+	}
+	if c.errAppend != nil {
+		return appendblob.CreateResponse{}, c.errAppend
+	}
+	if c.auditCreated {
+		return appendblob.CreateResponse{}, &azcore.ResponseError{ErrorCode: string(bloberror.BlobAlreadyExists)}
+	}
+	c.auditCreated = true
+	return appendblob.CreateResponse{}, nil
+}
+
+func (c *mockBlobClient) AppendBlock(ctx context.Context, containerName string, blobName string, body io.ReadSeekCloser, o *appendblob.AppendBlockOptions) (appendblob.AppendBlockResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return appendblob.AppendBlockResponse{}, err
+	}
+	if c.errAppend != nil {
+		return appendblob.AppendBlockResponse{}, c.errAppend
+	}
+	if !c.auditCreated {
+		return appendblob.AppendBlockResponse{}, &azcore.ResponseError{ErrorCode: string(bloberror.BlobNotFound)}
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return appendblob.AppendBlockResponse{}, err
+	}
+	c.audit = append(c.audit, b...)
+	return appendblob.AppendBlockResponse{}, nil
+}
+
+func (c *mockBlobClient) DeleteBlob(ctx context.Context, containerName string, blobName string, o *azblob.DeleteBlobOptions) (azblob.DeleteBlobResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return azblob.DeleteBlobResponse{}, err
+	}
+	if c.errDelete != nil {
+		return azblob.DeleteBlobResponse{}, c.errDelete
+	}
+	c.deleted = append(c.deleted, blobName)
+	return azblob.DeleteBlobResponse{}, nil
+}
+
+func (c *mockBlobClient) StartCopyFromURL(ctx context.Context, containerName string, blobName string, copySource string, o *blob.StartCopyFromURLOptions) (blob.StartCopyFromURLResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return blob.StartCopyFromURLResponse{}, err
+	}
+	if c.errCopy != nil {
+		return blob.StartCopyFromURLResponse{}, c.errCopy
+	}
+	c.copies = append(c.copies, copySource+" > "+c.BlobURL(containerName, blobName))
+	c.listBlobs = append(c.listBlobs, blobName)
+	status := blob.CopyStatusTypeSuccess
+	if c.copyPending > 0 {
+		status = blob.CopyStatusTypePending
+	}
+	return blob.StartCopyFromURLResponse{CopyStatus: &status}, nil
+}
+
+func (c *mockBlobClient) GetProperties(ctx context.Context, containerName string, blobName string, o *blob.GetPropertiesOptions) (blob.GetPropertiesResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return blob.GetPropertiesResponse{}, err
+	}
+	if c.errProperties != nil {
+		return blob.GetPropertiesResponse{}, c.errProperties
+	}
+	status := blob.CopyStatusTypeSuccess
+	if c.copyPending--; c.copyPending > 0 {
+		status = blob.CopyStatusTypePending
+	}
+	return blob.GetPropertiesResponse{
+		CopyStatus:    &status,
+		ETag:          toPtr(c.etag()),
+		ContentLength: toPtr(int64(len(c.blobContent()))),
+		Metadata:      c.metadata(),
+	}, nil
+}
+
+func (c *mockBlobClient) SetMetadata(ctx context.Context, containerName string, blobName string, metadata map[string]*string, o *blob.SetMetadataOptions) (blob.SetMetadataResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return blob.SetMetadataResponse{}, err
+	}
+	if c.errMetadata != nil {
+		return blob.SetMetadataResponse{}, c.errMetadata
+	}
+	c.blobMetadata = metadata
+	return blob.SetMetadataResponse{ETag: toPtr(c.etag())}, nil
+}
+
+func (c *mockBlobClient) FilterBlobs(ctx context.Context, containerName string, where string, o *container.FilterBlobsOptions) (container.FilterBlobsResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return container.FilterBlobsResponse{}, err
+	}
+	if c.errFilter != nil {
+		return container.FilterBlobsResponse{}, c.errFilter
+	}
+	c.filterQuery = where
+	if len(c.filterPages) == 0 {
+		return container.FilterBlobsResponse{}, nil
+	}
+	i := 0
+	if o != nil && o.Marker != nil {
+		fmt.Sscan(*o.Marker, &i)
+	}
+	var res container.FilterBlobsResponse
+	for _, name := range c.filterPages[i] {
+		res.Blobs = append(res.Blobs, &service.FilterBlobItem{
+			ContainerName: toPtr(containerName),
+			Name:          toPtr(name),
+		})
+	}
+	if i+1 < len(c.filterPages) {
+		res.NextMarker = toPtr(fmt.Sprint(i + 1))
+	}
+	return res, nil
+}
+
+func (c mockBlobClient) BlobURL(containerName string, blobName string) string {
+	return "https://account.blob.core.windows.net/" + containerName + "/" + blobName
+}
+
+// etag returns the ETag of the current content of the blob.
+func (c mockBlobClient) etag() azcore.ETag {
+	if c.staleReads {
+		return azcore.ETag("\"0x0\"")
+	}
+	return azcore.ETag(fmt.Sprintf("\"0x%d\"", c.uploads))
+}
+
+func (c *mockBlobClient) SetImmutabilityPolicy(ctx context.Context, containerName string, blobName string, expiryTime time.Time, o *blob.SetImmutabilityPolicyOptions) (blob.SetImmutabilityPolicyResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return blob.SetImmutabilityPolicyResponse{}, err
+	}
+	c.immutableUntil = expiryTime
+	c.immutability = o
+	return blob.SetImmutabilityPolicyResponse{}, nil
+}
+
+func (c *mockBlobClient) SetLegalHold(ctx context.Context, containerName string, blobName string, legalHold bool, o *blob.SetLegalHoldOptions) (blob.SetLegalHoldResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return blob.SetLegalHoldResponse{}, err
+	}
+	c.legalHold = legalHold
+	return blob.SetLegalHoldResponse{}, nil
+}
+
+func (c *mockBlobClient) SetTier(ctx context.Context, containerName string, blobName string, tier blob.AccessTier, o *blob.SetTierOptions) (blob.SetTierResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return blob.SetTierResponse{}, err
+	}
+	if c.errTier != nil {
+		return blob.SetTierResponse{}, c.errTier
+	}
+	c.tier = tier
+	return blob.SetTierResponse{}, nil
+}
+
+type mockCredential struct {
+	err error
+}
+
+func (c *mockCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	if err := ctx.Err(); err != nil {
+		return azcore.AccessToken{}, err
+	}
+	return azcore.AccessToken{}, c.err
+}
+
+// cmpAdapterOptions are the options used when comparing adapters in tests.
+var cmpAdapterOptions = []cmp.Option{
+	cmp.AllowUnexported(Adapter{}),
+	cmpopts.IgnoreUnexported(mockBlobClient{}),
+	cmpopts.IgnoreFields(Adapter{}, "requests", "stats", "loadedETag", "skippedLines"),
+}
+
+var errTest = errors.New("test error")
+
+var _testKey = base64.StdEncoding.EncodeToString([]byte("<accountKey>"))
+
+func TestAdapter_TreatMissingAsEmpty(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			err            error
+			missingAsEmpty bool
+		}
+		wantErr error
+	}{
+		{
+			name: "Load policy from missing blob",
+			input: struct {
+				err            error
+				missingAsEmpty bool
+			}{
+				err:            &azcore.ResponseError{ErrorCode: string(bloberror.BlobNotFound)},
+				missingAsEmpty: true,
+			},
+		},
+		{
+			name: "Load policy with error (blob does not exist)",
+			input: struct {
+				err            error
+				missingAsEmpty bool
+			}{
+				err: &azcore.ResponseError{ErrorCode: string(bloberror.BlobNotFound)},
+			},
+			wantErr: ErrBlobDoesNotExist,
+		},
+		{
+			name: "Load policy with error (container does not exist)",
+			input: struct {
+				err            error
+				missingAsEmpty bool
+			}{
+				err:            &azcore.ResponseError{ErrorCode: string(bloberror.ContainerNotFound)},
+				missingAsEmpty: true,
+			},
+			wantErr: ErrContainerDoesNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         &mockBlobClient{errDownload: test.input.err},
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+				logger:    &mockLogger{},
+			}
+			WithTreatMissingAsEmpty(test.input.missingAsEmpty)(a)
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			gotErr := a.LoadPolicy(m)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("LoadPolicy() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if len(m["p"]["p"].Policy) > 0 {
+				t.Errorf("LoadPolicy() unexpected result: %v\n", m["p"]["p"].Policy)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package blobadapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/appendblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+)
+
+const (
+	// auditOperationSave is the operation of audit records written on save.
+	auditOperationSave = "save"
+)
+
+// AuditRecord is a record written to the audit blob set with WithAuditBlob.
+// Records are written as JSON, one record per line.
+type AuditRecord struct {
+	// Timestamp is the time the record was written.
+	Timestamp time.Time `json:"timestamp"`
+	// Operation is the write operation, e.g. save.
+	Operation string `json:"operation"`
+	// Added contains the rules added by the operation. Each rule starts with its ptype.
+	Added [][]string `json:"added"`
+	// Removed contains the rules removed by the operation. Each rule starts with its ptype.
+	Removed [][]string `json:"removed"`
+}
+
+// writeAuditRecord appends an audit record with the provided operation and rules
+// to the audit blob. The append blob is created if it does not exist.
+func (a *Adapter) writeAuditRecord(ctx context.Context, operation string, added, removed [][]string) error {
+	record := AuditRecord{
+		Timestamp: time.Now().UTC(),
+		Operation: operation,
+		Added:     added,
+		Removed:   removed,
+	}
+	if record.Added == nil {
+		record.Added = [][]string{}
+	}
+	if record.Removed == nil {
+		record.Removed = [][]string{}
+	}
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	if a.dryRun {
+		a.logf("blobadapter: dry run: suppressed audit record: %s", bytes.TrimSpace(b))
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	a.requests.add(operationUpload)
+	_, err = a.c.AppendBlock(ctx, a.container, a.auditBlob, streaming.NopCloser(bytes.NewReader(b)), nil)
+	if err == nil {
+		return nil
+	}
+	if !bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return newStorageError(err)
+	}
+
+	a.requests.add(operationCreate)
+	_, err = a.c.CreateAppendBlob(ctx, a.container, a.auditBlob, &appendblob.CreateOptions{
+		AccessConditions: &blob.AccessConditions{
+			ModifiedAccessConditions: &blob.ModifiedAccessConditions{
+				IfNoneMatch: toPtr(azcore.ETagAny),
+			},
+		},
+	})
+	if err != nil && !bloberror.HasCode(err, bloberror.BlobAlreadyExists) {
+		return newStorageError(err)
+	}
+
+	a.requests.add(operationUpload)
+	if _, err := a.c.AppendBlock(ctx, a.container, a.auditBlob, streaming.NopCloser(bytes.NewReader(b)), nil); err != nil {
+		return newStorageError(err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package blobadapter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_SavePolicy_AuditBlob(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			client *mockBlobClient
+			strict bool
+			saves  int
+		}
+		want    []AuditRecord
+		wantLog bool
+		wantErr error
+	}{
+		{
+			name: "Save policy with audit blob",
+			input: struct {
+				client *mockBlobClient
+				strict bool
+				saves  int
+			}{
+				client: &mockBlobClient{},
+				saves:  2,
+			},
+			want: []AuditRecord{
+				{
+					Operation: "save",
+					Added: [][]string{
+						{"p", "bob", "domain2", "data2", "write"},
+					},
+					Removed: [][]string{},
+				},
+				{
+					Operation: "save",
+					Added:     [][]string{},
+					Removed:   [][]string{},
+				},
+			},
+		},
+		{
+			name: "Save policy with error writing audit record",
+			input: struct {
+				client *mockBlobClient
+				strict bool
+				saves  int
+			}{
+				client: &mockBlobClient{errAppend: errTest},
+				saves:  1,
+			},
+			want:    nil,
+			wantLog: true,
+		},
+		{
+			name: "Save policy with error writing audit record (strict)",
+			input: struct {
+				client *mockBlobClient
+				strict bool
+				saves  int
+			}{
+				client: &mockBlobClient{errAppend: errTest},
+				strict: true,
+				saves:  1,
+			},
+			want:    nil,
+			wantErr: errTest,
+		},
+		{
+			name: "Save policy with error computing audit record",
+			input: struct {
+				client *mockBlobClient
+				strict bool
+				saves  int
+			}{
+				client: &mockBlobClient{errDownload: errTest},
+				saves:  1,
+			},
+			want:    nil,
+			wantLog: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger := &mockLogger{}
+			a := &Adapter{
+				c:         test.input.client,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			for _, option := range []Option{WithAuditBlob("audit.log"), WithStrictAudit(test.input.strict), WithLogger(logger)} {
+				option(a)
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			m.AddPolicy("p", "p", []string{"alice", "domain1", "data1", "read"})
+			m.AddPolicy("p", "p", []string{"bob", "domain2", "data2", "write"})
+
+			var gotErr error
+			for i := 0; i < test.input.saves && gotErr == nil; i++ {
+				gotErr = a.SavePolicy(m)
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("SavePolicy() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if test.input.client.uploads != test.input.saves {
+				t.Errorf("SavePolicy() unexpected number of uploads, want: %d, got: %d\n", test.input.saves, test.input.client.uploads)
+			}
+
+			var got []AuditRecord
+			scanner := bufio.NewScanner(bytes.NewReader(test.input.client.audit))
+			for scanner.Scan() {
+				var record AuditRecord
+				if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+					t.Fatalf("error in test: %v\n", err)
+				}
+				if record.Timestamp.IsZero() {
+					t.Errorf("SavePolicy() expected audit record timestamp\n")
+				}
+				got = append(got, record)
+			}
+			if diff := cmp.Diff(test.want, got, cmpopts.IgnoreFields(AuditRecord{}, "Timestamp")); diff != "" {
+				t.Errorf("SavePolicy() unexpected audit records (-want +got):\n%s\n", diff)
+			}
+
+			if diff := cmp.Diff(test.wantLog, len(logger.lines) > 0); diff != "" {
+				t.Errorf("SavePolicy() unexpected logging (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
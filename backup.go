@@ -0,0 +1,109 @@
+package blobadapter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+)
+
+const (
+	// defaultBackupSuffix is the suffix of the backup blob if none is provided
+	// to WithBackupOnSave.
+	defaultBackupSuffix = ".bak"
+	// copyPollInterval is the interval between checks of a pending copy.
+	copyPollInterval = 100 * time.Millisecond
+)
+
+// backupBlob returns the name of the backup blob.
+func (a *Adapter) backupBlob() string {
+	return a.blob + a.backupSuffix
+}
+
+// backupPolicy copies the policy blob to the backup blob and reports whether
+// the backup was made. If the policy blob does not exist the backup is skipped.
+// If match is set the copy is conditioned on the policy blob having the ETag,
+// like the upload that follows, so that the backup is not overwritten by a save
+// that fails with ErrPolicyModifiedSinceLoad.
+func (a *Adapter) backupPolicy(ctx context.Context, match *azcore.ETag) (bool, error) {
+	err := a.copyBlob(ctx, a.blob, a.backupBlob(), match)
+	if err != nil && bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.CannotVerifyCopySource) {
+		return false, nil
+	}
+	if err != nil && match != nil && bloberror.HasCode(err, bloberror.SourceConditionNotMet) {
+		return false, newStorageErrorWithSentinel(err, ErrPolicyModifiedSinceLoad, a.blob)
+	}
+	return err == nil, err
+}
+
+// RestoreBackup restores the policy blob from the backup blob written by
+// WithBackupOnSave. If no backup exists ErrBackupDoesNotExist is returned.
+func (a *Adapter) RestoreBackup(ctx context.Context) error {
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+	suffix := a.backupSuffix
+	if len(suffix) == 0 {
+		suffix = defaultBackupSuffix
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	backup := a.blob + suffix
+	if a.dryRun {
+		a.logf("blobadapter: dry run: suppressed restore of blob %s from %s", a.blob, backup)
+		return nil
+	}
+	err := a.copyBlob(ctx, backup, a.blob, nil)
+	if err != nil && bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.CannotVerifyCopySource) {
+		return newStorageErrorWithSentinel(err, ErrBackupDoesNotExist, backup)
+	}
+	return err
+}
+
+// copyBlob copies the blob src to dst in the container of the adapter with a
+// server-side copy, which preserves the content and metadata of the blob. It
+// waits for the copy to complete. If match is set the copy is conditioned on src
+// having the ETag, or not existing if it is empty.
+func (a *Adapter) copyBlob(ctx context.Context, src, dst string, match *azcore.ETag) error {
+	var o *blob.StartCopyFromURLOptions
+	if match != nil {
+		conditions := &blob.SourceModifiedAccessConditions{SourceIfMatch: match}
+		if len(*match) == 0 {
+			conditions = &blob.SourceModifiedAccessConditions{SourceIfNoneMatch: toPtr(azcore.ETagAny)}
+		}
+		o = &blob.StartCopyFromURLOptions{SourceModifiedAccessConditions: conditions}
+	}
+	a.requests.add(operationOther)
+	res, err := a.c.StartCopyFromURL(ctx, a.container, dst, a.c.BlobURL(a.container, src), o)
+	if err != nil {
+		return newStorageError(err)
+	}
+
+	status := res.CopyStatus
+	for status != nil && *status == blob.CopyStatusTypePending {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(copyPollInterval):
+		}
+
+		a.requests.add(operationOther)
+		var raw *http.Response
+		props, err := a.c.GetProperties(captureResponse(ctx, &raw), a.container, dst, nil)
+		a.recordOperation(operationInfoProperties, raw, props.RequestID, props.ClientRequestID, err)
+		if err != nil {
+			return newStorageError(err)
+		}
+		status = props.CopyStatus
+	}
+	if status != nil && *status != blob.CopyStatusTypeSuccess {
+		return fmt.Errorf("copy of %s to %s: %s", src, dst, *status)
+	}
+	return nil
+}
@@ -0,0 +1,369 @@
+package blobadapter
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_SavePolicy_BackupOnSave(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			client *mockBlobClient
+			suffix string
+		}
+		want        []string
+		wantUploads int
+		wantErr     error
+	}{
+		{
+			name: "Save policy with backup",
+			input: struct {
+				client *mockBlobClient
+				suffix string
+			}{
+				client: &mockBlobClient{},
+				suffix: "",
+			},
+			want: []string{
+				"https://account.blob.core.windows.net/container/blob > https://account.blob.core.windows.net/container/blob.bak",
+			},
+			wantUploads: 1,
+		},
+		{
+			name: "Save policy with backup and custom suffix",
+			input: struct {
+				client *mockBlobClient
+				suffix string
+			}{
+				client: &mockBlobClient{},
+				suffix: ".prev",
+			},
+			want: []string{
+				"https://account.blob.core.windows.net/container/blob > https://account.blob.core.windows.net/container/blob.prev",
+			},
+			wantUploads: 1,
+		},
+		{
+			name: "Save policy with backup and pending copy",
+			input: struct {
+				client *mockBlobClient
+				suffix string
+			}{
+				client: &mockBlobClient{copyPending: 2},
+			},
+			want: []string{
+				"https://account.blob.core.windows.net/container/blob > https://account.blob.core.windows.net/container/blob.bak",
+			},
+			wantUploads: 1,
+		},
+		{
+			name: "Save policy with backup when blob does not exist",
+			input: struct {
+				client *mockBlobClient
+				suffix string
+			}{
+				client: &mockBlobClient{
+					errCopy: &azcore.ResponseError{
+						ErrorCode: string(bloberror.CannotVerifyCopySource),
+					},
+				},
+			},
+			want:        nil,
+			wantUploads: 1,
+		},
+		{
+			name: "Save policy with error (backup)",
+			input: struct {
+				client *mockBlobClient
+				suffix string
+			}{
+				client: &mockBlobClient{errCopy: errTest},
+			},
+			want:        nil,
+			wantUploads: 0,
+			wantErr:     errTest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         test.input.client,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			WithBackupOnSave(test.input.suffix)(a)
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			gotErr := a.SavePolicy(m)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("SavePolicy() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.want, test.input.client.copies); diff != "" {
+				t.Errorf("SavePolicy() unexpected copies (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantUploads, test.input.client.uploads); diff != "" {
+				t.Errorf("SavePolicy() unexpected uploads (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_SavePolicy_BackupOnSave_Rejected(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   func(a *Adapter) error
+		wantErr error
+	}{
+		{
+			name: "Save policy larger than the limit",
+			input: func(a *Adapter) error {
+				m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+				if err != nil {
+					return err
+				}
+				m.AddPolicy("p", "p", []string{"bob", "domain1", "data1", "write"})
+				m.AddPolicy("p", "p", []string{"carol", "domain1", "data1", "write"})
+				return a.SavePolicy(m)
+			},
+			wantErr: ErrBlobTooLarge,
+		},
+		{
+			name: "Save policy modified since download",
+			input: func(a *Adapter) error {
+				_, err := a.uploadPolicyBlob(context.Background(), strings.NewReader("p, bob, domain1, data1, write"), toPtr(azcore.ETag("\"0x0\"")))
+				return err
+			},
+			wantErr: ErrPolicyModifiedSinceLoad,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, err := NewInMemoryAdapter(WithBackupOnSave(""), WithMaxBlobSize(40))
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			mc := a.c.(*memoryClient)
+			upload := func(content string) {
+				if _, err := mc.UploadStream(context.Background(), a.container, a.blob, strings.NewReader(content), nil); err != nil {
+					t.Fatalf("error in test: %v\n", err)
+				}
+			}
+			upload("p, alice, domain1, data1, read")
+			if _, err := a.backupPolicy(context.Background(), nil); err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			upload("p, alice, domain1, data1, write")
+
+			gotErr := test.input(a)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("SavePolicy() unexpected error (-want +got):\n%s\n", diff)
+			}
+			want := "p, alice, domain1, data1, read"
+			if diff := cmp.Diff(want, string(mc.containers[a.container][a.backupBlob()].content)); diff != "" {
+				t.Errorf("SavePolicy() unexpected backup (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_RestoreBackup(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   *mockBlobClient
+		want    []string
+		wantErr error
+	}{
+		{
+			name:  "Restore backup",
+			input: &mockBlobClient{},
+			want: []string{
+				"https://account.blob.core.windows.net/container/blob.bak > https://account.blob.core.windows.net/container/blob",
+			},
+		},
+		{
+			name: "Restore backup with error (backup does not exist)",
+			input: &mockBlobClient{
+				errCopy: &azcore.ResponseError{
+					ErrorCode: string(bloberror.CannotVerifyCopySource),
+				},
+			},
+			want:    nil,
+			wantErr: ErrBackupDoesNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         test.input,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+
+			gotErr := a.RestoreBackup(context.Background())
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("RestoreBackup() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.want, test.input.copies); diff != "" {
+				t.Errorf("RestoreBackup() unexpected copies (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_SavePolicy_BackupHistory(t *testing.T) {
+	existing := []string{
+		"history/blob-2024-01-02T00:00:00Z",
+		"history/blob-2024-01-01T00:00:00Z",
+		"history/blob-2024-01-03T00:00:00Z",
+		"history/blob-notes.txt",
+		"history/other-2024-01-01T00:00:00Z",
+	}
+
+	var tests = []struct {
+		name  string
+		input struct {
+			client *mockBlobClient
+			keep   int
+		}
+		wantDeleted []string
+		wantLog     bool
+		wantErr     error
+	}{
+		{
+			name: "Save policy with backup history",
+			input: struct {
+				client *mockBlobClient
+				keep   int
+			}{
+				client: &mockBlobClient{listBlobs: existing},
+				keep:   2,
+			},
+			wantDeleted: []string{
+				"history/blob-2024-01-02T00:00:00Z",
+				"history/blob-2024-01-01T00:00:00Z",
+			},
+		},
+		{
+			name: "Save policy with backup history within limit",
+			input: struct {
+				client *mockBlobClient
+				keep   int
+			}{
+				client: &mockBlobClient{listBlobs: existing},
+				keep:   30,
+			},
+			wantDeleted: nil,
+		},
+		{
+			name: "Save policy with error pruning backup history",
+			input: struct {
+				client *mockBlobClient
+				keep   int
+			}{
+				client: &mockBlobClient{listBlobs: existing, errDelete: errTest},
+				keep:   1,
+			},
+			wantDeleted: nil,
+			wantLog:     true,
+		},
+		{
+			name: "Save policy with error copying backup history",
+			input: struct {
+				client *mockBlobClient
+				keep   int
+			}{
+				client: &mockBlobClient{errCopy: errTest},
+				keep:   1,
+			},
+			wantDeleted: nil,
+			wantErr:     errTest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger := &mockLogger{}
+			a := &Adapter{
+				c:         test.input.client,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+				logger:    logger,
+			}
+			WithBackupHistory("history", test.input.keep)(a)
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			start := time.Now().UTC().Truncate(time.Second)
+			gotErr := a.SavePolicy(m)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("SavePolicy() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantDeleted, test.input.client.deleted); diff != "" {
+				t.Errorf("SavePolicy() unexpected deleted blobs (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantLog, len(logger.lines) > 0); diff != "" {
+				t.Errorf("SavePolicy() unexpected logging (-want +got):\n%s\n", diff)
+			}
+			if gotErr != nil {
+				return
+			}
+
+			if len(test.input.client.copies) != 1 {
+				t.Fatalf("SavePolicy() expected 1 copy, got: %v\n", test.input.client.copies)
+			}
+			dst := test.input.client.listBlobs[len(test.input.client.listBlobs)-1]
+			at, err := time.Parse(time.RFC3339, strings.TrimPrefix(dst, "history/blob-"))
+			if err != nil || at.Before(start) {
+				t.Errorf("SavePolicy() unexpected backup history blob: %s\n", dst)
+			}
+		})
+	}
+}
+
+func TestAdapter_SavePolicy_BackupHistory_Rejected(t *testing.T) {
+	c := &mockBlobClient{}
+	a := &Adapter{
+		c:         c,
+		container: "container",
+		blob:      "blob",
+		timeout:   time.Second * 10,
+	}
+	WithBackupHistory("history", 2)(a)
+	WithMaxBlobSize(10)(a)
+
+	m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	m.AddPolicy("p", "p", []string{"alice", "domain1", "data1", "read"})
+
+	gotErr := a.SavePolicy(m)
+	if diff := cmp.Diff(ErrBlobTooLarge, gotErr, cmpopts.EquateErrors()); diff != "" {
+		t.Errorf("SavePolicy() unexpected error (-want +got):\n%s\n", diff)
+	}
+	if diff := cmp.Diff([]string(nil), c.copies); diff != "" {
+		t.Errorf("SavePolicy() unexpected copies (-want +got):\n%s\n", diff)
+	}
+}
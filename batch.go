@@ -0,0 +1,392 @@
+package blobadapter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/casbin/casbin/v2/model"
+)
+
+const (
+	// auditOperationAdd is the operation of audit records written by MergePolicies.
+	auditOperationAdd = "add"
+	// auditOperationRemove is the operation of audit records written by
+	// RemovePolicies and RemoveFilteredPolicy.
+	auditOperationRemove = "remove"
+	// auditOperationUpdate is the operation of audit records written by
+	// UpdatePolicies and UpdateFilteredPolicies.
+	auditOperationUpdate = "update"
+)
+
+// maxEditRetries is the number of times MergePolicies and the other edits of the
+// policy blob download and edit the rules before they fail because the blob is
+// modified in between.
+const maxEditRetries = 3
+
+// AddPolicies adds policy rules to the storage. See MergePolicies.
+func (a *Adapter) AddPolicies(sec, ptype string, rules [][]string) error {
+	return a.AddPoliciesCtx(a.baseContext(), sec, ptype, rules)
+}
+
+// AddPoliciesCtx adds policy rules to the storage with context. See MergePolicies.
+func (a *Adapter) AddPoliciesCtx(ctx context.Context, sec, ptype string, rules [][]string) error {
+	_, err := a.MergePolicies(ctx, sec, ptype, rules)
+	return err
+}
+
+// RemovePolicies removes policy rules from the storage. See RemovePoliciesCtx.
+func (a *Adapter) RemovePolicies(sec, ptype string, rules [][]string) error {
+	return a.RemovePoliciesCtx(a.baseContext(), sec, ptype, rules)
+}
+
+// RemovePoliciesCtx removes the policy rules of ptype from the storage with context.
+// Every line of the policy blob with one of the rules is removed, and the other lines
+// are kept as they are. The blob is not modified if none of the rules exist. Like
+// MergePolicies, the upload is conditioned on the ETag of the downloaded blob and
+// retried if the blob was modified by others in between.
+func (a *Adapter) RemovePoliciesCtx(ctx context.Context, sec, ptype string, rules [][]string) error {
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+
+	remove := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		remove[ruleKey(append([]string{ptype}, rule...))] = true
+	}
+	_, removed, err := a.editPolicy(ctx, func(lines []string, rules [][]string) ([]string, [][]string, [][]string, [][]string) {
+		return removeLines(lines, rules, func(rule []string) bool {
+			return remove[ruleKey(rule)]
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return a.reportEdit(ctx, auditOperationRemove, nil, removed)
+}
+
+// RemoveFilteredPolicyCtx removes the policy rules of ptype that match the filter
+// from the storage with context. A rule matches the filter like with
+// UpdateFilteredPoliciesCtx. Like RemovePoliciesCtx, the other lines are kept as
+// they are and the upload is conditioned on the ETag of the downloaded blob.
+func (a *Adapter) RemoveFilteredPolicyCtx(ctx context.Context, sec, ptype string, fieldIndex int, fieldValues ...string) error {
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+
+	_, removed, err := a.editPolicy(ctx, func(lines []string, rules [][]string) ([]string, [][]string, [][]string, [][]string) {
+		return removeLines(lines, rules, func(rule []string) bool {
+			return rule[0] == ptype && matchesFilter(rule[1:], fieldIndex, fieldValues)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return a.reportEdit(ctx, auditOperationRemove, nil, removed)
+}
+
+// removeLines returns the lines without the lines of the rules that match, and
+// the removed rules. It is a policyEdit for the rules of the lines.
+func removeLines(lines []string, rules [][]string, match func(rule []string) bool) ([]string, [][]string, [][]string, [][]string) {
+	kept := make([]string, 0, len(lines))
+	var removed [][]string
+	for i, line := range lines {
+		if rules[i] != nil && match(rules[i]) {
+			removed = append(removed, rules[i])
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return kept, nil, nil, removed
+}
+
+// MergePolicies appends the rules of ptype that are not already in the policy blob
+// to it and returns the number of rules that were added. The blob is downloaded once
+// to find the existing rules, and if any rule is new the existing lines followed by
+// the new rules are uploaded once. Duplicates within rules are only added once. The
+// blob is not modified if all rules already exist. A blob or container that does not
+// exist is treated as an empty policy. The upload is conditioned on the ETag of the
+// downloaded blob, and the merge is retried if the blob was modified by others in
+// between. ErrPolicyModifiedSinceLoad is returned if it is still modified after
+// maxEditRetries attempts. The change callback is called and the audit record is
+// written once the upload succeeded.
+func (a *Adapter) MergePolicies(ctx context.Context, sec, ptype string, rules [][]string) (int, error) {
+	if err := a.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	added, _, err := a.editPolicy(ctx, func(lines []string, existing [][]string) ([]string, [][]string, [][]string, [][]string) {
+		keys := make(map[string]bool, len(existing))
+		for _, rule := range existing {
+			if rule != nil {
+				keys[ruleKey(rule)] = true
+			}
+		}
+		var added [][]string
+		for _, rule := range rules {
+			tokens := append([]string{ptype}, rule...)
+			key := ruleKey(tokens)
+			if keys[key] {
+				continue
+			}
+			keys[key] = true
+			added = append(added, tokens)
+		}
+		return lines, added, added, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(added) == 0 {
+		return 0, nil
+	}
+	return len(added), a.reportEdit(ctx, auditOperationAdd, added, nil)
+}
+
+// policyEdit edits the lines of the policy blob. It is called with the lines and
+// the rules of the lines, starting with their ptype, where the rules of comments
+// and empty lines are nil. It returns the edited lines, the rules to write after
+// them, and the rules that are added and removed by the edit.
+type policyEdit func(lines []string, rules [][]string) (edited []string, appended, added, removed [][]string)
+
+// editPolicy downloads the policy blob, edits its lines with edit and uploads the
+// result, and returns the added and removed rules. The blob is not modified if no
+// rule is added or removed. The upload is conditioned on the ETag of the download,
+// and the download and edit are retried if the blob was modified in between. After
+// maxEditRetries attempts ErrPolicyModifiedSinceLoad is returned.
+func (a *Adapter) editPolicy(ctx context.Context, edit policyEdit) (added, removed [][]string, err error) {
+	for attempt := 1; attempt <= maxEditRetries; attempt++ {
+		added, removed, err = a.editPolicyOnce(ctx, edit)
+		if err != nil && errors.Is(err, ErrPolicyModifiedSinceLoad) && attempt < maxEditRetries {
+			a.logf("blobadapter: blob %s modified during edit, retrying (attempt %d of %d)", a.blob, attempt, maxEditRetries)
+			continue
+		}
+		return added, removed, err
+	}
+	return nil, nil, ErrPolicyModifiedSinceLoad
+}
+
+// editPolicyOnce makes one attempt of editPolicy. The upload fails with
+// ErrPolicyModifiedSinceLoad if the blob was modified since it was downloaded.
+func (a *Adapter) editPolicyOnce(ctx context.Context, edit policyEdit) ([][]string, [][]string, error) {
+	var lines []string
+	var rules [][]string
+	delimiter := a.delimiter()
+	_, etag, err := a.loadPolicyBlob(ctx, nil, func(line string, _ model.Model) error {
+		tokens, err := parseRuleLine(line, delimiter)
+		if err != nil {
+			return err
+		}
+		lines, rules = append(lines, line), append(rules, tokens)
+		return nil
+	}, blob.HTTPRange{})
+	if err != nil && !errors.Is(err, ErrContainerDoesNotExist) && !errors.Is(err, ErrBlobDoesNotExist) {
+		return nil, nil, err
+	}
+
+	edited, appended, added, removed := edit(lines, rules)
+	if len(added) == 0 && len(removed) == 0 {
+		return nil, nil, nil
+	}
+
+	var saved azcore.ETag
+	if err := pipe(func(w io.Writer) error {
+		return a.writeRules(w, edited, appended)
+	}, func(r io.Reader) error {
+		res, err := a.uploadPolicyBlob(ctx, r, &etag)
+		saved = res.ETag
+		return err
+	}); err != nil {
+		return nil, nil, err
+	}
+	// The edit keeps a loaded policy in sync with the blob if it was in sync
+	// before, so that it is not seen as a stale write by a later save.
+	if loaded, ok := a.loadedETag.Load().(azcore.ETag); ok && loaded == etag && !a.dryRun {
+		a.loadedETag.Store(saved)
+	}
+	return added, removed, nil
+}
+
+// reportEdit reports the rules added and removed by an edit of the policy blob
+// to the change callback and writes the audit record of operation. A failure to
+// write the audit record is only returned with WithStrictAudit.
+func (a *Adapter) reportEdit(ctx context.Context, operation string, added, removed [][]string) error {
+	if a.onChange != nil {
+		a.onChange(added, removed)
+	}
+	if len(a.auditBlob) > 0 {
+		if err := a.writeAuditRecord(ctx, operation, added, removed); err != nil {
+			if a.strictAudit {
+				return err
+			}
+			a.logf("blobadapter: writing audit record: %v", err)
+		}
+	}
+	return nil
+}
+
+// UpdateFilteredPolicies replaces the policy rules that match the filter in the
+// storage with newRules and returns the replaced rules. See UpdateFilteredPoliciesCtx.
+func (a *Adapter) UpdateFilteredPolicies(sec, ptype string, newRules [][]string, fieldIndex int, fieldValues ...string) ([][]string, error) {
+	return a.UpdateFilteredPoliciesCtx(a.baseContext(), sec, ptype, newRules, fieldIndex, fieldValues...)
+}
+
+// UpdateFilteredPoliciesCtx replaces the policy rules of ptype that match the filter
+// in the storage with newRules with context and returns the replaced rules. A rule
+// matches the filter like with RemoveFilteredPolicy of casbin, if every non-empty
+// value of fieldValues equals the field of the rule at fieldIndex plus its position.
+// The lines of the matching rules are removed and newRules are inserted at the
+// position of the first removed line, or after the last line if no rule matches.
+// The other lines are kept as they are. Like MergePolicies, the upload is
+// conditioned on the ETag of the downloaded blob and retried if the blob was
+// modified by others in between.
+func (a *Adapter) UpdateFilteredPoliciesCtx(ctx context.Context, sec, ptype string, newRules [][]string, fieldIndex int, fieldValues ...string) ([][]string, error) {
+	if err := a.checkWritable(); err != nil {
+		return nil, err
+	}
+
+	delimiter := a.delimiter()
+	added, removed, err := a.editPolicy(ctx, func(lines []string, rules [][]string) ([]string, [][]string, [][]string, [][]string) {
+		edited := make([]string, 0, len(lines)+len(newRules))
+		var removed [][]string
+		insertAt := -1
+		for i, line := range lines {
+			if rule := rules[i]; rule != nil && rule[0] == ptype && matchesFilter(rule[1:], fieldIndex, fieldValues) {
+				if insertAt < 0 {
+					insertAt = len(edited)
+				}
+				removed = append(removed, rule)
+				continue
+			}
+			edited = append(edited, line)
+		}
+		if len(removed) == 0 && len(newRules) == 0 {
+			return lines, nil, nil, nil
+		}
+		if insertAt < 0 {
+			insertAt = len(edited)
+		}
+
+		added := make([][]string, len(newRules))
+		inserted := make([]string, len(newRules))
+		for i, rule := range newRules {
+			added[i] = append([]string{ptype}, rule...)
+			inserted[i] = ruleLine(added[i], delimiter)
+		}
+		edited = append(edited[:insertAt], append(inserted, edited[insertAt:]...)...)
+		return edited, nil, added, removed
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var rules [][]string
+	for _, rule := range removed {
+		rules = append(rules, rule[1:])
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		return rules, nil
+	}
+	return rules, a.reportEdit(ctx, auditOperationUpdate, added, removed)
+}
+
+// UpdatePolicies replaces policy rules in the storage. See UpdatePoliciesCtx.
+func (a *Adapter) UpdatePolicies(sec, ptype string, oldRules, newRules [][]string) error {
+	return a.UpdatePoliciesCtx(a.baseContext(), sec, ptype, oldRules, newRules)
+}
+
+// UpdatePoliciesCtx replaces the policy rules of ptype in oldRules with the rules
+// at the same position in newRules in the storage with context. Every line of the
+// policy blob with one of oldRules is replaced in place, and the other lines are
+// kept as they are. The blob is not modified if none of oldRules exist. Like
+// MergePolicies, the upload is conditioned on the ETag of the downloaded blob and
+// retried if the blob was modified by others in between.
+func (a *Adapter) UpdatePoliciesCtx(ctx context.Context, sec, ptype string, oldRules, newRules [][]string) error {
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+	if len(oldRules) != len(newRules) {
+		return fmt.Errorf("%w: %d old rules and %d new rules", ErrInvalidPolicy, len(oldRules), len(newRules))
+	}
+
+	delimiter := a.delimiter()
+	replace := make(map[string][]string, len(oldRules))
+	for i, rule := range oldRules {
+		replace[ruleKey(append([]string{ptype}, rule...))] = append([]string{ptype}, newRules[i]...)
+	}
+	added, removed, err := a.editPolicy(ctx, func(lines []string, rules [][]string) ([]string, [][]string, [][]string, [][]string) {
+		edited := make([]string, len(lines))
+		var added, removed [][]string
+		for i, line := range lines {
+			edited[i] = line
+			if rules[i] == nil {
+				continue
+			}
+			if rule, ok := replace[ruleKey(rules[i])]; ok {
+				edited[i] = ruleLine(rule, delimiter)
+				added, removed = append(added, rule), append(removed, rules[i])
+			}
+		}
+		return edited, nil, added, removed
+	})
+	if err != nil {
+		return err
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	return a.reportEdit(ctx, auditOperationUpdate, added, removed)
+}
+
+// matchesFilter reports whether the fields of rule match the filter of
+// fieldValues starting at fieldIndex. Empty values match any field.
+func matchesFilter(rule []string, fieldIndex int, fieldValues []string) bool {
+	if fieldIndex < 0 {
+		return false
+	}
+	for i, value := range fieldValues {
+		if len(value) == 0 {
+			continue
+		}
+		if fieldIndex+i >= len(rule) || rule[fieldIndex+i] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ruleLine returns the line of the rule, starting with its ptype, with the
+// fields separated by the delimiter.
+func ruleLine(rule []string, delimiter rune) string {
+	var sb strings.Builder
+	bw := bufio.NewWriter(&sb)
+	writeRule(bw, rule[0], rule[1:], delimiter)
+	bw.Flush()
+	return sb.String()
+}
+
+// writeLines writes the lines followed by the rules, each starting with its ptype,
+// to the writer. Lines and rules are separated by the line ending and the fields
+// of the rules by the delimiter.
+func writeLines(w io.Writer, lines []string, rules [][]string, lineEnding LineEnding, delimiter rune) error {
+	bw := bufio.NewWriter(w)
+	sep := lineEnding.String()
+	for i, line := range lines {
+		if i > 0 {
+			bw.WriteString(sep)
+		}
+		bw.WriteString(line)
+	}
+	for i, rule := range rules {
+		if i > 0 || len(lines) > 0 {
+			bw.WriteString(sep)
+		}
+		writeRule(bw, rule[0], rule[1:], delimiter)
+	}
+	return bw.Flush()
+}
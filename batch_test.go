@@ -0,0 +1,648 @@
+package blobadapter
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_MergePolicies(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			c     *mockBlobClient
+			rules [][]string
+		}
+		want        int
+		wantPolicy  string
+		wantUploads int
+		wantErr     error
+	}{
+		{
+			name: "Merge policies",
+			input: struct {
+				c     *mockBlobClient
+				rules [][]string
+			}{
+				c: &mockBlobClient{
+					content: []byte("# policy\np, alice, domain1, data1, read\ng, alice, admin, domain1\n"),
+				},
+				rules: [][]string{
+					{"alice", "domain1", "data1", "read"},
+					{"bob", "domain2", "data2", "write"},
+					{"bob", "domain2", "data2", "write"},
+					{"carol", "domain1", "data1", "read"},
+				},
+			},
+			want:        2,
+			wantPolicy:  "# policy\np, alice, domain1, data1, read\ng, alice, admin, domain1\np, bob, domain2, data2, write\np, carol, domain1, data1, read",
+			wantUploads: 1,
+		},
+		{
+			name: "Merge policies that already exist",
+			input: struct {
+				c     *mockBlobClient
+				rules [][]string
+			}{
+				c: &mockBlobClient{},
+				rules: [][]string{
+					{"alice", "domain1", "data1", "read"},
+				},
+			},
+			want: 0,
+		},
+		{
+			name: "Merge policies when blob does not exist",
+			input: struct {
+				c     *mockBlobClient
+				rules [][]string
+			}{
+				c: &mockBlobClient{
+					errDownload: &azcore.ResponseError{
+						ErrorCode: string(bloberror.BlobNotFound),
+					},
+				},
+				rules: [][]string{
+					{"alice", "domain1", "data1", "read"},
+				},
+			},
+			want:        1,
+			wantPolicy:  "p, alice, domain1, data1, read",
+			wantUploads: 1,
+		},
+		{
+			name: "Merge policies with error (upload)",
+			input: struct {
+				c     *mockBlobClient
+				rules [][]string
+			}{
+				c: &mockBlobClient{
+					errUpload: errTest,
+				},
+				rules: [][]string{
+					{"bob", "domain2", "data2", "write"},
+				},
+			},
+			wantErr: errTest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         test.input.c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+
+			got, gotErr := a.MergePolicies(context.Background(), "p", "p", test.input.rules)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("MergePolicies() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("MergePolicies() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantPolicy, string(test.input.c.policies)); diff != "" {
+				t.Errorf("MergePolicies() unexpected policy (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantUploads, test.input.c.uploads); diff != "" {
+				t.Errorf("MergePolicies() unexpected number of uploads (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_MergePolicies_ModifiedDuringMerge(t *testing.T) {
+	var tests = []struct {
+		name        string
+		races       int
+		want        int
+		wantPolicy  string
+		wantErr     error
+		wantChanges int
+	}{
+		{
+			name:        "Merge policies modified once during merge",
+			races:       1,
+			want:        1,
+			wantPolicy:  "p, alice, domain1, data1, read\np, carol, domain1, data1, read\np, bob, domain2, data2, write",
+			wantChanges: 1,
+		},
+		{
+			name:       "Merge policies modified during every merge",
+			races:      maxEditRetries,
+			wantPolicy: "p, alice, domain1, data1, read\np, carol, domain1, data1, read",
+			wantErr:    ErrPolicyModifiedSinceLoad,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var changes int
+			a, err := NewInMemoryAdapter(WithLogger(&mockLogger{}), WithChangeCallback(func(added, removed [][]string) {
+				changes++
+			}))
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			mc := a.c.(*memoryClient)
+			if _, err := mc.UploadStream(context.Background(), a.container, a.blob, strings.NewReader("p, alice, domain1, data1, read"), nil); err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			c := &racingClient{memoryClient: mc}
+			a.c = c
+			races := test.races
+			var race func()
+			race = func() {
+				if _, err := mc.UploadStream(context.Background(), a.container, a.blob, strings.NewReader("p, alice, domain1, data1, read\np, carol, domain1, data1, read"), nil); err != nil {
+					t.Fatalf("error in test: %v\n", err)
+				}
+				if races--; races > 0 {
+					c.race = race
+				}
+			}
+			c.race = race
+
+			got, gotErr := a.MergePolicies(context.Background(), "p", "p", [][]string{{"bob", "domain2", "data2", "write"}})
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("MergePolicies() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("MergePolicies() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantPolicy, string(mc.containers[a.container][a.blob].content)); diff != "" {
+				t.Errorf("MergePolicies() unexpected policy (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantChanges, changes); diff != "" {
+				t.Errorf("MergePolicies() unexpected number of changes (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_RemovePolicies(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			c  *mockBlobClient
+			fn func(a *Adapter) error
+		}
+		wantPolicy  string
+		wantRemoved [][]string
+		wantUploads int
+		wantErr     error
+	}{
+		{
+			name: "Remove policies",
+			input: struct {
+				c  *mockBlobClient
+				fn func(a *Adapter) error
+			}{
+				c: &mockBlobClient{
+					content: []byte("# policy\np, alice, domain1, data1, read\np, bob, domain2, data2, write\np, alice, domain1, data1, read\ng, alice, admin, domain1"),
+				},
+				fn: func(a *Adapter) error {
+					return a.RemovePolicies("p", "p", [][]string{{"alice", "domain1", "data1", "read"}, {"carol", "domain1", "data1", "read"}})
+				},
+			},
+			wantPolicy:  "# policy\np, bob, domain2, data2, write\ng, alice, admin, domain1",
+			wantRemoved: [][]string{{"p", "alice", "domain1", "data1", "read"}, {"p", "alice", "domain1", "data1", "read"}},
+			wantUploads: 1,
+		},
+		{
+			name: "Remove policy",
+			input: struct {
+				c  *mockBlobClient
+				fn func(a *Adapter) error
+			}{
+				c: &mockBlobClient{
+					content: []byte("p, alice, domain1, data1, read\np, bob, domain2, data2, write"),
+				},
+				fn: func(a *Adapter) error {
+					return a.RemovePolicy("p", "p", []string{"bob", "domain2", "data2", "write"})
+				},
+			},
+			wantPolicy:  "p, alice, domain1, data1, read",
+			wantRemoved: [][]string{{"p", "bob", "domain2", "data2", "write"}},
+			wantUploads: 1,
+		},
+		{
+			name: "Remove policy that does not exist",
+			input: struct {
+				c  *mockBlobClient
+				fn func(a *Adapter) error
+			}{
+				c: &mockBlobClient{},
+				fn: func(a *Adapter) error {
+					return a.RemovePolicy("p", "p", []string{"bob", "domain2", "data2", "write"})
+				},
+			},
+		},
+		{
+			name: "Remove filtered policy",
+			input: struct {
+				c  *mockBlobClient
+				fn func(a *Adapter) error
+			}{
+				c: &mockBlobClient{
+					content: []byte("p, alice, domain1, data1, read\np, bob, domain2, data2, write\np, alice, domain2, data2, read\ng, alice, admin, domain1"),
+				},
+				fn: func(a *Adapter) error {
+					return a.RemoveFilteredPolicy("p", "p", 0, "alice")
+				},
+			},
+			wantPolicy:  "p, bob, domain2, data2, write\ng, alice, admin, domain1",
+			wantRemoved: [][]string{{"p", "alice", "domain1", "data1", "read"}, {"p", "alice", "domain2", "data2", "read"}},
+			wantUploads: 1,
+		},
+		{
+			name: "Remove policies with error (upload)",
+			input: struct {
+				c  *mockBlobClient
+				fn func(a *Adapter) error
+			}{
+				c: &mockBlobClient{
+					errUpload: errTest,
+				},
+				fn: func(a *Adapter) error {
+					return a.RemovePolicy("p", "p", []string{"alice", "domain1", "data1", "read"})
+				},
+			},
+			wantErr: errTest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var gotRemoved [][]string
+			a := &Adapter{
+				c:         test.input.c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			WithChangeCallback(func(added, removed [][]string) {
+				gotRemoved = removed
+			})(a)
+
+			gotErr := test.input.fn(a)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("RemovePolicies() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantPolicy, string(test.input.c.policies)); diff != "" {
+				t.Errorf("RemovePolicies() unexpected policy (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantRemoved, gotRemoved); diff != "" {
+				t.Errorf("RemovePolicies() unexpected removed rules (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantUploads, test.input.c.uploads); diff != "" {
+				t.Errorf("RemovePolicies() unexpected number of uploads (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_AddPolicy(t *testing.T) {
+	c := &mockBlobClient{}
+	a := &Adapter{
+		c:         c,
+		container: "container",
+		blob:      "blob",
+		timeout:   time.Second * 10,
+	}
+
+	if err := a.AddPolicy("p", "p", []string{"bob", "domain2", "data2", "write"}); err != nil {
+		t.Fatalf("AddPolicy() unexpected error: %v\n", err)
+	}
+	want := "p, alice, domain1, data1, read\np, bob, domain2, data2, write"
+	if diff := cmp.Diff(want, string(c.policies)); diff != "" {
+		t.Errorf("AddPolicy() unexpected policy (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestAdapter_UpdateFilteredPolicies(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			c           *mockBlobClient
+			rules       [][]string
+			fieldIndex  int
+			fieldValues []string
+		}
+		want        [][]string
+		wantPolicy  string
+		wantUploads int
+		wantErr     error
+	}{
+		{
+			name: "Update filtered policies",
+			input: struct {
+				c           *mockBlobClient
+				rules       [][]string
+				fieldIndex  int
+				fieldValues []string
+			}{
+				c: &mockBlobClient{
+					content: []byte("# policy\np, alice, domain1, data1, read\ng, alice, admin, domain1\np, alice, domain2, data2, read\np, bob, domain1, data1, read"),
+				},
+				rules: [][]string{
+					{"alice", "domain1", "data1", "write"},
+					{"carol", "domain1", "data1", "read"},
+				},
+				fieldIndex:  0,
+				fieldValues: []string{"alice", "", "", "read"},
+			},
+			want:        [][]string{{"alice", "domain1", "data1", "read"}, {"alice", "domain2", "data2", "read"}},
+			wantPolicy:  "# policy\np, alice, domain1, data1, write\np, carol, domain1, data1, read\ng, alice, admin, domain1\np, bob, domain1, data1, read",
+			wantUploads: 1,
+		},
+		{
+			name: "Update filtered policies without matching rules",
+			input: struct {
+				c           *mockBlobClient
+				rules       [][]string
+				fieldIndex  int
+				fieldValues []string
+			}{
+				c: &mockBlobClient{},
+				rules: [][]string{
+					{"bob", "domain1", "data1", "read"},
+				},
+				fieldIndex:  1,
+				fieldValues: []string{"domain2"},
+			},
+			wantPolicy:  "p, alice, domain1, data1, read\np, bob, domain1, data1, read",
+			wantUploads: 1,
+		},
+		{
+			name: "Update filtered policies without matching rules and new rules",
+			input: struct {
+				c           *mockBlobClient
+				rules       [][]string
+				fieldIndex  int
+				fieldValues []string
+			}{
+				c:           &mockBlobClient{},
+				fieldIndex:  1,
+				fieldValues: []string{"domain2"},
+			},
+		},
+		{
+			name: "Update filtered policies with error (upload)",
+			input: struct {
+				c           *mockBlobClient
+				rules       [][]string
+				fieldIndex  int
+				fieldValues []string
+			}{
+				c: &mockBlobClient{
+					errUpload: errTest,
+				},
+				fieldIndex:  0,
+				fieldValues: []string{"alice"},
+			},
+			wantErr: errTest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         test.input.c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+
+			got, gotErr := a.UpdateFilteredPolicies("p", "p", test.input.rules, test.input.fieldIndex, test.input.fieldValues...)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("UpdateFilteredPolicies() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("UpdateFilteredPolicies() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantPolicy, string(test.input.c.policies)); diff != "" {
+				t.Errorf("UpdateFilteredPolicies() unexpected policy (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantUploads, test.input.c.uploads); diff != "" {
+				t.Errorf("UpdateFilteredPolicies() unexpected number of uploads (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_UpdateFilteredPolicies_StaleWriteProtection(t *testing.T) {
+	c := &mockBlobClient{errUpload: &azcore.ResponseError{ErrorCode: string(bloberror.ConditionNotMet)}}
+	a := &Adapter{
+		c:         c,
+		container: "container",
+		blob:      "blob",
+		timeout:   time.Second * 10,
+		logger:    &mockLogger{},
+	}
+	WithStaleWriteProtection()(a)
+
+	_, gotErr := a.UpdateFilteredPolicies("p", "p", nil, 0, "alice")
+	if diff := cmp.Diff(ErrPolicyModifiedSinceLoad, gotErr, cmpopts.EquateErrors()); diff != "" {
+		t.Errorf("UpdateFilteredPolicies() unexpected error (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestAdapter_UpdateFilteredPolicies_ModifiedDuringUpdate(t *testing.T) {
+	var tests = []struct {
+		name        string
+		races       int
+		want        [][]string
+		wantPolicy  string
+		wantErr     error
+		wantChanges int
+	}{
+		{
+			name:        "Update filtered policies modified once during update",
+			races:       1,
+			want:        [][]string{{"alice", "domain1", "data1", "read"}},
+			wantPolicy:  "p, alice, domain1, data1, write\np, carol, domain1, data1, read",
+			wantChanges: 1,
+		},
+		{
+			name:       "Update filtered policies modified during every update",
+			races:      maxEditRetries,
+			wantPolicy: "p, alice, domain1, data1, read\np, carol, domain1, data1, read",
+			wantErr:    ErrPolicyModifiedSinceLoad,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var changes int
+			a, err := NewInMemoryAdapter(WithLogger(&mockLogger{}), WithChangeCallback(func(added, removed [][]string) {
+				changes++
+			}))
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			mc := a.c.(*memoryClient)
+			if _, err := mc.UploadStream(context.Background(), a.container, a.blob, strings.NewReader("p, alice, domain1, data1, read"), nil); err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			c := &racingClient{memoryClient: mc}
+			a.c = c
+			races := test.races
+			var race func()
+			race = func() {
+				if _, err := mc.UploadStream(context.Background(), a.container, a.blob, strings.NewReader("p, alice, domain1, data1, read\np, carol, domain1, data1, read"), nil); err != nil {
+					t.Fatalf("error in test: %v\n", err)
+				}
+				if races--; races > 0 {
+					c.race = race
+				}
+			}
+			c.race = race
+
+			got, gotErr := a.UpdateFilteredPolicies("p", "p", [][]string{{"alice", "domain1", "data1", "write"}}, 0, "alice")
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("UpdateFilteredPolicies() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("UpdateFilteredPolicies() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantPolicy, string(mc.containers[a.container][a.blob].content)); diff != "" {
+				t.Errorf("UpdateFilteredPolicies() unexpected policy (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantChanges, changes); diff != "" {
+				t.Errorf("UpdateFilteredPolicies() unexpected number of changes (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_UpdatePolicies(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			c  *mockBlobClient
+			fn func(a *Adapter) error
+		}
+		wantPolicy  string
+		wantAdded   [][]string
+		wantRemoved [][]string
+		wantUploads int
+		wantErr     error
+	}{
+		{
+			name: "Update policies",
+			input: struct {
+				c  *mockBlobClient
+				fn func(a *Adapter) error
+			}{
+				c: &mockBlobClient{
+					content: []byte("# policy\np, alice, domain1, data1, read\ng, alice, admin, domain1\np, bob, domain2, data2, write"),
+				},
+				fn: func(a *Adapter) error {
+					return a.UpdatePolicies("p", "p", [][]string{{"alice", "domain1", "data1", "read"}, {"carol", "domain1", "data1", "read"}}, [][]string{{"alice", "domain1", "data1", "write"}, {"carol", "domain1", "data1", "write"}})
+				},
+			},
+			wantPolicy:  "# policy\np, alice, domain1, data1, write\ng, alice, admin, domain1\np, bob, domain2, data2, write",
+			wantAdded:   [][]string{{"p", "alice", "domain1", "data1", "write"}},
+			wantRemoved: [][]string{{"p", "alice", "domain1", "data1", "read"}},
+			wantUploads: 1,
+		},
+		{
+			name: "Update policy",
+			input: struct {
+				c  *mockBlobClient
+				fn func(a *Adapter) error
+			}{
+				c: &mockBlobClient{
+					content: []byte("p, alice, domain1, data1, read\np, bob, domain2, data2, write"),
+				},
+				fn: func(a *Adapter) error {
+					return a.UpdatePolicy("p", "p", []string{"bob", "domain2", "data2", "write"}, []string{"bob", "domain2", "data2", "read"})
+				},
+			},
+			wantPolicy:  "p, alice, domain1, data1, read\np, bob, domain2, data2, read",
+			wantAdded:   [][]string{{"p", "bob", "domain2", "data2", "read"}},
+			wantRemoved: [][]string{{"p", "bob", "domain2", "data2", "write"}},
+			wantUploads: 1,
+		},
+		{
+			name: "Update policy that does not exist",
+			input: struct {
+				c  *mockBlobClient
+				fn func(a *Adapter) error
+			}{
+				c: &mockBlobClient{},
+				fn: func(a *Adapter) error {
+					return a.UpdatePolicy("p", "p", []string{"bob", "domain2", "data2", "write"}, []string{"bob", "domain2", "data2", "read"})
+				},
+			},
+		},
+		{
+			name: "Update policies with error (number of rules)",
+			input: struct {
+				c  *mockBlobClient
+				fn func(a *Adapter) error
+			}{
+				c: &mockBlobClient{},
+				fn: func(a *Adapter) error {
+					return a.UpdatePolicies("p", "p", [][]string{{"alice", "domain1", "data1", "read"}}, nil)
+				},
+			},
+			wantErr: ErrInvalidPolicy,
+		},
+		{
+			name: "Update policies with error (upload)",
+			input: struct {
+				c  *mockBlobClient
+				fn func(a *Adapter) error
+			}{
+				c: &mockBlobClient{
+					errUpload: errTest,
+				},
+				fn: func(a *Adapter) error {
+					return a.UpdatePolicy("p", "p", []string{"alice", "domain1", "data1", "read"}, []string{"alice", "domain1", "data1", "write"})
+				},
+			},
+			wantErr: errTest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var gotAdded, gotRemoved [][]string
+			a := &Adapter{
+				c:         test.input.c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			WithChangeCallback(func(added, removed [][]string) {
+				gotAdded, gotRemoved = added, removed
+			})(a)
+
+			gotErr := test.input.fn(a)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("UpdatePolicies() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantPolicy, string(test.input.c.policies)); diff != "" {
+				t.Errorf("UpdatePolicies() unexpected policy (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantAdded, gotAdded); diff != "" {
+				t.Errorf("UpdatePolicies() unexpected added rules (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantRemoved, gotRemoved); diff != "" {
+				t.Errorf("UpdatePolicies() unexpected removed rules (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantUploads, test.input.c.uploads); diff != "" {
+				t.Errorf("UpdatePolicies() unexpected number of uploads (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package blobadapter
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// bootstrapPolicy seeds the model with the rules returned by the bootstrap
+// function when the blob does not exist, and saves them to the blob if set
+// with WithBootstrapSave.
+func (a *Adapter) bootstrapPolicy(ctx context.Context, m model.Model) error {
+	rules := a.bootstrap()
+	for i, rule := range rules {
+		if len(rule) == 0 || len(rule[0]) == 0 {
+			return fmt.Errorf("invalid bootstrap rule %d: missing ptype", i)
+		}
+		ptype := rule[0]
+		sec := ptype[:1]
+		if _, ok := m[sec][ptype]; !ok || (sec != "p" && sec != "g") {
+			return fmt.Errorf("invalid bootstrap rule %d: ptype %s is not defined in the model", i, ptype)
+		}
+		if err := persist.LoadPolicyArray(rule, m); err != nil {
+			return fmt.Errorf("invalid bootstrap rule %d: %w", i, err)
+		}
+	}
+	// The policy is loaded from a blob that does not exist, which a
+	// stale-write check of a later save compares with.
+	a.loadedETag.Store(azcore.ETag(""))
+	atomic.StoreInt32(&a.filtered, 0)
+	a.logf("blobadapter: blob %s does not exist, seeded policy with %d bootstrap rules", a.blob, len(rules))
+
+	if !a.bootstrapSave {
+		return nil
+	}
+	_, err := a.savePolicy(ctx, m, false)
+	return err
+}
@@ -0,0 +1,123 @@
+package blobadapter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_Bootstrap(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			err   error
+			rules [][]string
+			save  bool
+		}
+		want     [][]string
+		wantSave string
+		wantErr  error
+	}{
+		{
+			name: "Load policy from missing blob",
+			input: struct {
+				err   error
+				rules [][]string
+				save  bool
+			}{
+				err:   &azcore.ResponseError{ErrorCode: string(bloberror.BlobNotFound)},
+				rules: [][]string{{"p", "alice", "domain1", "data1", "read"}},
+			},
+			want: [][]string{{"alice", "domain1", "data1", "read"}},
+		},
+		{
+			name: "Load policy from missing blob and save",
+			input: struct {
+				err   error
+				rules [][]string
+				save  bool
+			}{
+				err:   &azcore.ResponseError{ErrorCode: string(bloberror.BlobNotFound)},
+				rules: [][]string{{"p", "alice", "domain1", "data1", "read"}, {"g", "alice", "admin", "domain1"}},
+				save:  true,
+			},
+			want:     [][]string{{"alice", "domain1", "data1", "read"}},
+			wantSave: "p, alice, domain1, data1, read\ng, alice, admin, domain1",
+		},
+		{
+			name: "Load policy from existing blob",
+			input: struct {
+				err   error
+				rules [][]string
+				save  bool
+			}{
+				rules: [][]string{{"p", "bob", "domain1", "data1", "read"}},
+				save:  true,
+			},
+			want: [][]string{{"alice", "domain1", "data1", "read"}},
+		},
+		{
+			name: "Load policy with error (container does not exist)",
+			input: struct {
+				err   error
+				rules [][]string
+				save  bool
+			}{
+				err:   &azcore.ResponseError{ErrorCode: string(bloberror.ContainerNotFound)},
+				rules: [][]string{{"p", "alice", "domain1", "data1", "read"}},
+			},
+			wantErr: ErrContainerDoesNotExist,
+		},
+		{
+			name: "Load policy with error (invalid rule)",
+			input: struct {
+				err   error
+				rules [][]string
+				save  bool
+			}{
+				err:   &azcore.ResponseError{ErrorCode: string(bloberror.BlobNotFound)},
+				rules: [][]string{{"x", "alice"}},
+			},
+			wantErr: cmpopts.AnyError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &mockBlobClient{content: []byte("p, alice, domain1, data1, read"), errDownload: test.input.err}
+			a := &Adapter{
+				c:         c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+				logger:    &mockLogger{},
+			}
+			WithBootstrap(func() [][]string { return test.input.rules })(a)
+			WithBootstrapSave(test.input.save)(a)
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			gotErr := a.LoadPolicy(m)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Fatalf("LoadPolicy() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if test.wantErr != nil {
+				return
+			}
+			if diff := cmp.Diff(test.want, m["p"]["p"].Policy); diff != "" {
+				t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantSave, string(c.policies)); diff != "" {
+				t.Errorf("LoadPolicy() unexpected saved policy (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package blobadapter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// policyChanges downloads the current policy blob and diffs its rules against
+// the rules of the model. It returns the rules that are added and removed by
+// saving the model. A blob or container that does not exist is treated as an
+// empty policy.
+func (a *Adapter) policyChanges(ctx context.Context, model model.Model) (added, removed [][]string, err error) {
+	current, err := a.currentRules(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rules [][]string
+	if err := pipePolicy(model, LF, defaultFieldDelimiter, func(r io.Reader) error {
+		var err error
+		rules, err = readRules(r)
+		return err
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	added, removed = diffRules(current, rules)
+	return added, removed, nil
+}
+
+// currentRules downloads the policy blob and returns its rules.
+func (a *Adapter) currentRules(ctx context.Context) ([][]string, error) {
+	var rules [][]string
+	delimiter := a.delimiter()
+	_, _, err := a.loadPolicyBlob(ctx, nil, func(line string, _ model.Model) error {
+		tokens, err := parseRuleLine(line, delimiter)
+		if err != nil || tokens == nil {
+			return err
+		}
+		rules = append(rules, tokens)
+		return nil
+	}, blob.HTTPRange{})
+	if err != nil && !errors.Is(err, ErrContainerDoesNotExist) && !errors.Is(err, ErrBlobDoesNotExist) {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// readRules reads the rules of policy data serialized with the default field
+// delimiter.
+func readRules(r io.Reader) ([][]string, error) {
+	var rules [][]string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		tokens, err := parseRuleLine(trimLine(scanner.Text()), defaultFieldDelimiter)
+		if err != nil {
+			return nil, err
+		}
+		if tokens != nil {
+			rules = append(rules, tokens)
+		}
+	}
+	return rules, scanner.Err()
+}
+
+// parseRuleLine parses a policy line into its ptype followed by the fields
+// of the rule, separated by the delimiter. Empty lines and comments return nil.
+func parseRuleLine(line string, delimiter rune) ([]string, error) {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+	return parsePolicyLine(line, delimiter)
+}
+
+// diffRules returns the rules in next that are not in prev, and the rules
+// in prev that are not in next. Duplicate rules are counted.
+func diffRules(prev, next [][]string) (added, removed [][]string) {
+	counts := make(map[string]int, len(prev))
+	for _, rule := range prev {
+		counts[ruleKey(rule)]++
+	}
+	for _, rule := range next {
+		key := ruleKey(rule)
+		if counts[key] > 0 {
+			counts[key]--
+			continue
+		}
+		added = append(added, rule)
+	}
+	for _, rule := range prev {
+		key := ruleKey(rule)
+		if counts[key] > 0 {
+			counts[key]--
+			removed = append(removed, rule)
+		}
+	}
+	return added, removed
+}
+
+// ruleKey returns a key that uniquely identifies the fields of a rule.
+func ruleKey(rule []string) string {
+	return strings.Join(rule, "\x00")
+}
+
+// Diff is the result of ComparePolicies. Each rule starts with its ptype.
+type Diff struct {
+	// OnlyInBlob contains the rules that are in the blob but not in the model.
+	OnlyInBlob [][]string
+	// OnlyInModel contains the rules that are in the model but not in the blob.
+	OnlyInModel [][]string
+	// Common contains the rules that are in both the blob and the model.
+	Common [][]string
+}
+
+// Equal reports whether the blob and the model contain the same rules.
+func (d Diff) Equal() bool {
+	return len(d.OnlyInBlob) == 0 && len(d.OnlyInModel) == 0
+}
+
+// ComparePolicies compares the rules in the policy blob with the rules in the
+// model. The blob is parsed while it is downloaded, only a set of the rules of
+// the model is held in memory. It only reads from the storage.
+func (a *Adapter) ComparePolicies(ctx context.Context, m model.Model) (Diff, error) {
+	if err := checkContainerBlobArguments(a.container, a.blob); err != nil {
+		return Diff{}, err
+	}
+
+	rules := modelRules(m)
+	inModel := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		inModel[ruleKey(rule)] = true
+	}
+
+	var diff Diff
+	seen := make(map[string]bool, len(rules))
+	delimiter := a.delimiter()
+	_, _, err := a.loadPolicyBlob(ctx, nil, func(line string, _ model.Model) error {
+		tokens, err := parseRuleLine(line, delimiter)
+		if err != nil || tokens == nil {
+			return err
+		}
+		key := ruleKey(tokens)
+		if seen[key] {
+			return nil
+		}
+		seen[key] = true
+		if inModel[key] {
+			diff.Common = append(diff.Common, tokens)
+		} else {
+			diff.OnlyInBlob = append(diff.OnlyInBlob, tokens)
+		}
+		return nil
+	}, blob.HTTPRange{})
+	if err != nil {
+		return Diff{}, err
+	}
+
+	for _, rule := range rules {
+		if !seen[ruleKey(rule)] {
+			diff.OnlyInModel = append(diff.OnlyInModel, rule)
+		}
+	}
+	return diff, nil
+}
+
+// modelRules returns the rules of the model in the order they are saved. Each
+// rule starts with its ptype.
+func modelRules(m model.Model) [][]string {
+	var rules [][]string
+	for _, sec := range []string{"p", "g"} {
+		ptypes := make([]string, 0, len(m[sec]))
+		for ptype := range m[sec] {
+			ptypes = append(ptypes, ptype)
+		}
+		sort.Strings(ptypes)
+
+		for _, ptype := range ptypes {
+			for _, rule := range m[sec][ptype].Policy {
+				rules = append(rules, append([]string{ptype}, rule...))
+			}
+		}
+	}
+	return rules
+}
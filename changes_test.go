@@ -0,0 +1,319 @@
+package blobadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_SavePolicy_ChangeCallback(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			client *mockBlobClient
+			rules  [][]string
+		}
+		wantAdded   [][]string
+		wantRemoved [][]string
+		wantErr     error
+	}{
+		{
+			name: "Save policy with added and removed rules",
+			input: struct {
+				client *mockBlobClient
+				rules  [][]string
+			}{
+				client: &mockBlobClient{
+					content: []byte("p, alice, domain1, data1, read\np, bob, domain2, data2, write\n\ng, alice, admin, domain1"),
+				},
+				rules: [][]string{
+					{"p", "alice", "domain1", "data1", "read"},
+					{"p", "carol", "domain1", "data3", "read"},
+					{"g", "alice", "admin", "domain1"},
+				},
+			},
+			wantAdded: [][]string{
+				{"p", "carol", "domain1", "data3", "read"},
+			},
+			wantRemoved: [][]string{
+				{"p", "bob", "domain2", "data2", "write"},
+			},
+		},
+		{
+			name: "Save policy without changes",
+			input: struct {
+				client *mockBlobClient
+				rules  [][]string
+			}{
+				client: &mockBlobClient{},
+				rules: [][]string{
+					{"p", "alice", "domain1", "data1", "read"},
+				},
+			},
+			wantAdded:   nil,
+			wantRemoved: nil,
+		},
+		{
+			name: "Save policy when blob does not exist",
+			input: struct {
+				client *mockBlobClient
+				rules  [][]string
+			}{
+				client: &mockBlobClient{
+					errDownload: &azcore.ResponseError{
+						ErrorCode: string(bloberror.BlobNotFound),
+					},
+				},
+				rules: [][]string{
+					{"p", "alice", "domain1", "data1", "read"},
+				},
+			},
+			wantAdded: [][]string{
+				{"p", "alice", "domain1", "data1", "read"},
+			},
+			wantRemoved: nil,
+		},
+		{
+			name: "Save policy with error (download)",
+			input: struct {
+				client *mockBlobClient
+				rules  [][]string
+			}{
+				client: &mockBlobClient{
+					errDownload: errTest,
+				},
+				rules: [][]string{
+					{"p", "alice", "domain1", "data1", "read"},
+				},
+			},
+			wantErr: errTest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var called bool
+			var gotAdded, gotRemoved [][]string
+			a := &Adapter{
+				c:         test.input.client,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			WithChangeCallback(func(added, removed [][]string) {
+				called = true
+				gotAdded, gotRemoved = added, removed
+			})(a)
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			for _, rule := range test.input.rules {
+				m.AddPolicy(rule[0], rule[0], rule[1:])
+			}
+
+			gotErr := a.SavePolicy(m)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("SavePolicy() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if gotErr != nil {
+				if called {
+					t.Errorf("SavePolicy() unexpected call of change callback\n")
+				}
+				if test.input.client.uploads > 0 {
+					t.Errorf("SavePolicy() unexpected upload\n")
+				}
+				return
+			}
+
+			if diff := cmp.Diff(test.wantAdded, gotAdded); diff != "" {
+				t.Errorf("SavePolicy() unexpected added rules (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantRemoved, gotRemoved); diff != "" {
+				t.Errorf("SavePolicy() unexpected removed rules (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestDiffRules(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			prev [][]string
+			next [][]string
+		}
+		wantAdded   [][]string
+		wantRemoved [][]string
+	}{
+		{
+			name: "Diff with duplicate rules",
+			input: struct {
+				prev [][]string
+				next [][]string
+			}{
+				prev: [][]string{
+					{"p", "alice", "data1", "read"},
+					{"p", "alice", "data1", "read"},
+				},
+				next: [][]string{
+					{"p", "alice", "data1", "read"},
+					{"p", "bob", "data1", "read"},
+				},
+			},
+			wantAdded: [][]string{
+				{"p", "bob", "data1", "read"},
+			},
+			wantRemoved: [][]string{
+				{"p", "alice", "data1", "read"},
+			},
+		},
+		{
+			name: "Diff with fields containing the separator",
+			input: struct {
+				prev [][]string
+				next [][]string
+			}{
+				prev: [][]string{
+					{"p", "a", "b"},
+				},
+				next: [][]string{
+					{"p", "a, b"},
+				},
+			},
+			wantAdded: [][]string{
+				{"p", "a, b"},
+			},
+			wantRemoved: [][]string{
+				{"p", "a", "b"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gotAdded, gotRemoved := diffRules(test.input.prev, test.input.next)
+			if diff := cmp.Diff(test.wantAdded, gotAdded); diff != "" {
+				t.Errorf("diffRules() unexpected added rules (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantRemoved, gotRemoved); diff != "" {
+				t.Errorf("diffRules() unexpected removed rules (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_ComparePolicies(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			client *mockBlobClient
+			rules  [][]string
+		}
+		want      Diff
+		wantEqual bool
+		wantErr   error
+	}{
+		{
+			name: "Compare policies with differences",
+			input: struct {
+				client *mockBlobClient
+				rules  [][]string
+			}{
+				client: &mockBlobClient{
+					content: []byte("p, alice, domain1, data1, read\np, bob, domain2, data2, write\n# comment\ng, alice, admin, domain1\np, alice, domain1, data1, read"),
+				},
+				rules: [][]string{
+					{"p", "alice", "domain1", "data1", "read"},
+					{"p", "carol", "domain1", "data3", "read"},
+					{"g", "alice", "admin", "domain1"},
+				},
+			},
+			want: Diff{
+				OnlyInBlob: [][]string{
+					{"p", "bob", "domain2", "data2", "write"},
+				},
+				OnlyInModel: [][]string{
+					{"p", "carol", "domain1", "data3", "read"},
+				},
+				Common: [][]string{
+					{"p", "alice", "domain1", "data1", "read"},
+					{"g", "alice", "admin", "domain1"},
+				},
+			},
+		},
+		{
+			name: "Compare equal policies",
+			input: struct {
+				client *mockBlobClient
+				rules  [][]string
+			}{
+				client: &mockBlobClient{},
+				rules: [][]string{
+					{"p", "alice", "domain1", "data1", "read"},
+				},
+			},
+			want: Diff{
+				Common: [][]string{
+					{"p", "alice", "domain1", "data1", "read"},
+				},
+			},
+			wantEqual: true,
+		},
+		{
+			name: "Compare policies with error (blob does not exist)",
+			input: struct {
+				client *mockBlobClient
+				rules  [][]string
+			}{
+				client: &mockBlobClient{
+					errDownload: &azcore.ResponseError{
+						ErrorCode: string(bloberror.BlobNotFound),
+					},
+				},
+			},
+			want:    Diff{},
+			wantErr: ErrBlobDoesNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         test.input.client,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			for _, rule := range test.input.rules {
+				m.AddPolicy(rule[0], rule[0], rule[1:])
+			}
+
+			got, gotErr := a.ComparePolicies(context.Background(), m)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("ComparePolicies() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantEqual, got.Equal()); gotErr == nil && diff != "" {
+				t.Errorf("Equal() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("ComparePolicies() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if test.input.client.uploads > 0 {
+				t.Errorf("ComparePolicies() unexpected upload\n")
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package blobadapter
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+)
+
+// metadataChecksum is the metadata key of the hex-encoded SHA-256 checksum of
+// the content of the policy blob.
+const metadataChecksum = "casbin_sha256"
+
+// PolicyProperties contains the properties of the policy blob.
+type PolicyProperties struct {
+	// ETag is the ETag of the blob.
+	ETag azcore.ETag
+	// LastModified is the time the blob was last modified.
+	LastModified time.Time
+	// Size is the size of the blob in bytes.
+	Size int64
+	// Checksum is the hex-encoded SHA-256 checksum of the content of the blob
+	// stored in its metadata when it was saved with WithChecksumVerification,
+	// or empty if it is not stored.
+	Checksum string
+}
+
+// PolicyProperties returns the properties of the policy blob, including the
+// checksum stored with WithChecksumVerification, for external auditing. If the
+// container or blob does not exist ErrContainerDoesNotExist or ErrBlobDoesNotExist
+// is returned.
+func (a *Adapter) PolicyProperties(ctx context.Context) (PolicyProperties, error) {
+	if err := checkContainerBlobArguments(a.container, a.blob); err != nil {
+		return PolicyProperties{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	a.requests.add(operationOther)
+	var raw *http.Response
+	res, err := a.c.GetProperties(captureResponse(ctx, &raw), a.container, a.blob, nil)
+	a.recordOperation(operationInfoProperties, raw, res.RequestID, res.ClientRequestID, err)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.ContainerNotFound) {
+			return PolicyProperties{}, newStorageErrorWithSentinel(err, ErrContainerDoesNotExist, a.container)
+		}
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return PolicyProperties{}, newStorageErrorWithSentinel(err, ErrBlobDoesNotExist, a.blob)
+		}
+		return PolicyProperties{}, newStorageError(err)
+	}
+
+	props := PolicyProperties{Checksum: metadataValue(res.Metadata, metadataChecksum)}
+	if res.ETag != nil {
+		props.ETag = *res.ETag
+	}
+	if res.LastModified != nil {
+		props.LastModified = *res.LastModified
+	}
+	if res.ContentLength != nil {
+		props.Size = *res.ContentLength
+	}
+	return props, nil
+}
+
+// integrityMetadata returns the metadata values with the checksum and signature
+// of the content hashed by checksum and mac. They are only set for the hashes
+// that are not nil.
+func (a *Adapter) integrityMetadata(checksum, mac hash.Hash) map[string]string {
+	values := make(map[string]string)
+	if a.checksumVerification && checksum != nil {
+		values[metadataChecksum] = hex.EncodeToString(checksum.Sum(nil))
+	}
+	if mac != nil {
+		values[metadataSignature] = hex.EncodeToString(mac.Sum(nil))
+	}
+	return values
+}
+
+// emptyBlobContent returns the content of an empty policy blob, which is only
+// empty if the policy is not encrypted, and the metadata values of encrypted
+// content. See encryptPolicy.
+func (a *Adapter) emptyBlobContent(ctx context.Context) ([]byte, map[string]string, error) {
+	if a.encryptionKey == nil && a.keyWrapper == nil {
+		return nil, nil, nil
+	}
+	return a.encryptPolicy(ctx, nil)
+}
+
+// emptyBlobUploadOptions returns the options of the upload that creates an empty
+// policy blob with content, with the metadata values of the content and its
+// checksum and signature with WithChecksumVerification and WithSigningKey.
+func (a *Adapter) emptyBlobUploadOptions(content []byte, metadata map[string]string) *azblob.UploadStreamOptions {
+	o := a.uploadStreamOptions()
+	checksum, mac := sha256.New(), a.newMAC()
+	checksum.Write(content)
+	if mac != nil {
+		mac.Write(content)
+	}
+	values := a.integrityMetadata(checksum, mac)
+	for k, v := range metadata {
+		values[k] = v
+	}
+	if len(values) == 0 {
+		return o
+	}
+	if o == nil {
+		o = &azblob.UploadStreamOptions{}
+	}
+	o.Metadata = withMetadata(o.Metadata, values)
+	return o
+}
+
+// withMetadata returns a copy of metadata with the values added.
+func withMetadata(metadata map[string]*string, values map[string]string) map[string]*string {
+	md := make(map[string]*string, len(metadata)+len(values))
+	for k, v := range metadata {
+		md[k] = v
+	}
+	for k, v := range values {
+		md[k] = toPtr(v)
+	}
+	return md
+}
+
+// verifyChecksum returns ErrChecksumMismatch if the checksum stored in the metadata
+// of the blob name is missing or does not match checksum.
+func verifyChecksum(name string, metadata map[string]*string, checksum []byte) error {
+	stored := metadataValue(metadata, metadataChecksum)
+	if len(stored) == 0 {
+		return fmt.Errorf("%w: blob %s has no checksum", ErrChecksumMismatch, name)
+	}
+	want, err := hex.DecodeString(stored)
+	if err != nil || !bytes.Equal(want, checksum) {
+		return fmt.Errorf("%w: blob %s has checksum %s, stored checksum is %s", ErrChecksumMismatch, name, hex.EncodeToString(checksum), stored)
+	}
+	return nil
+}
+
+// metadataValue returns the value of key in metadata, or an empty string if it
+// is not set. Keys are compared case-insensitively, since the storage does not
+// preserve the case of the keys it returns.
+func metadataValue(metadata map[string]*string, key string) string {
+	for k, v := range metadata {
+		if strings.EqualFold(k, key) && v != nil {
+			return *v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,183 @@
+package blobadapter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_ChecksumVerification(t *testing.T) {
+	content := "p, alice, domain1, data1, read"
+	checksum := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+
+	var tests = []struct {
+		name  string
+		input struct {
+			metadata map[string]*string
+			verify   bool
+		}
+		wantErr error
+	}{
+		{
+			name: "Load policy with checksum",
+			input: struct {
+				metadata map[string]*string
+				verify   bool
+			}{
+				metadata: map[string]*string{"Casbin_sha256": toPtr(checksum(content))},
+				verify:   true,
+			},
+		},
+		{
+			name: "Load policy without checksum verification",
+		},
+		{
+			name: "Load policy with error (checksum mismatch)",
+			input: struct {
+				metadata map[string]*string
+				verify   bool
+			}{
+				metadata: map[string]*string{"casbin_sha256": toPtr(checksum("p, bob, domain1, data1, read"))},
+				verify:   true,
+			},
+			wantErr: ErrChecksumMismatch,
+		},
+		{
+			name: "Load policy with error (checksum missing)",
+			input: struct {
+				metadata map[string]*string
+				verify   bool
+			}{
+				verify: true,
+			},
+			wantErr: ErrChecksumMismatch,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         &mockBlobClient{content: []byte(content), blobMetadata: test.input.metadata},
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			if test.input.verify {
+				WithChecksumVerification()(a)
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			gotErr := a.LoadPolicy(m)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("LoadPolicy() unexpected error (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_ChecksumVerification_Save(t *testing.T) {
+	c := &mockBlobClient{}
+	a, err := NewAdapter("account", "container", "blob", &mockCredential{}, func(a *Adapter) {
+		a.c = c
+	}, WithChecksumVerification())
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+
+	m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	if err := a.LoadPolicy(m); err != nil {
+		t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+	}
+
+	m.AddPolicy("p", "p", []string{"alice", "domain1", "data1", "read"})
+	if err := a.SavePolicy(m); err != nil {
+		t.Fatalf("SavePolicy() unexpected error: %v\n", err)
+	}
+	if err := a.LoadPolicy(m); err != nil {
+		t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+	}
+
+	got, err := a.PolicyProperties(context.Background())
+	if err != nil {
+		t.Fatalf("PolicyProperties() unexpected error: %v\n", err)
+	}
+	sum := sha256.Sum256(c.policies)
+	want := PolicyProperties{
+		ETag:     c.etag(),
+		Size:     int64(len(c.policies)),
+		Checksum: hex.EncodeToString(sum[:]),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("PolicyProperties() unexpected result (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestAdapter_ChecksumVerification_SaveMetadata(t *testing.T) {
+	// Setting the metadata after the upload fails, so the save only succeeds if
+	// the checksum is uploaded with the content.
+	c := &mockBlobClient{errMetadata: &azcore.ResponseError{ErrorCode: string(bloberror.ConditionNotMet)}}
+	a := &Adapter{
+		c:         c,
+		container: "container",
+		blob:      "blob",
+		timeout:   time.Second * 10,
+	}
+	WithChecksumVerification()(a)
+
+	m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	m.AddPolicy("p", "p", []string{"alice", "domain1", "data1", "read"})
+
+	if err := a.SavePolicy(m); err != nil {
+		t.Fatalf("SavePolicy() unexpected error: %v\n", err)
+	}
+	sum := sha256.Sum256(c.policies)
+	if diff := cmp.Diff(hex.EncodeToString(sum[:]), metadataValue(c.blobMetadata, metadataChecksum)); diff != "" {
+		t.Errorf("SavePolicy() unexpected checksum (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestAdapter_ChecksumVerification_LoadMismatch(t *testing.T) {
+	a := &Adapter{
+		c: &mockBlobClient{
+			content:      []byte("p, alice, domain1, data1, read"),
+			blobMetadata: map[string]*string{metadataChecksum: toPtr(hex.EncodeToString(make([]byte, sha256.Size)))},
+		},
+		container: "container",
+		blob:      "blob",
+		timeout:   time.Second * 10,
+	}
+	WithChecksumVerification()(a)
+
+	m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	if gotErr := a.LoadPolicy(m); !errors.Is(gotErr, ErrChecksumMismatch) {
+		t.Errorf("LoadPolicy() unexpected error: %v\n", gotErr)
+	}
+	if diff := cmp.Diff([][]string(nil), m["p"]["p"].Policy); diff != "" {
+		t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+	}
+}
@@ -0,0 +1,155 @@
+package blobadapter
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+)
+
+// auditOperationClear is the operation of audit records written by ClearPolicy
+// and Clear.
+const auditOperationClear = "clear"
+
+// ClearPolicy removes all policy rules from the storage by overwriting the policy
+// blob with empty content, without a model. Loading the cleared policy results in
+// an empty model. The backup options, audit blob and change callback apply like
+// for SavePolicy. With WithStaleWriteProtection the upload is conditioned on the
+// blob not being modified since the policy was loaded, and ErrPolicyModifiedSinceLoad
+// is returned if it was. The whole blob is cleared even if a filtered policy was
+// loaded. If the adapter is read-only ErrReadOnly is returned.
+func (a *Adapter) ClearPolicy(ctx context.Context) error {
+	return a.clear(ctx, false)
+}
+
+// Clear removes all policy rules from the storage without a model, for teardown
+// and tests. With WithClearByDelete the policy blob is deleted, and a later load
+// behaves like for a blob that does not exist, e.g. it returns ErrBlobDoesNotExist
+// unless WithTreatMissingAsEmpty is set. A blob that does not exist is not an
+// error. Backups are made before the blob is deleted. Otherwise the blob is
+// overwritten with empty content like with ClearPolicy. The audit blob, change
+// callback and WithStaleWriteProtection apply like for ClearPolicy. If the adapter
+// is read-only ErrReadOnly is returned.
+func (a *Adapter) Clear(ctx context.Context) error {
+	return a.clear(ctx, a.clearByDelete)
+}
+
+// clear removes all policy rules from the storage by deleting the policy blob if
+// byDelete is set, or by overwriting it with empty content otherwise.
+func (a *Adapter) clear(ctx context.Context, byDelete bool) error {
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+	var match *azcore.ETag
+	if a.staleWriteProtection {
+		if loaded, ok := a.loadedETag.Load().(azcore.ETag); ok {
+			match = &loaded
+		}
+	}
+
+	var removed [][]string
+	audit := len(a.auditBlob) > 0
+	if a.onChange != nil || audit {
+		var err error
+		if removed, err = a.currentRules(ctx); err != nil {
+			if a.onChange != nil || a.strictAudit {
+				return err
+			}
+			a.logf("blobadapter: writing audit record: %v", err)
+			audit = false
+		}
+		if a.onChange != nil {
+			a.onChange(nil, removed)
+		}
+	}
+
+	if byDelete {
+		if err := a.retryThrottled(ctx, "clear", func() error {
+			return a.deletePolicyBlob(ctx, match)
+		}); err != nil {
+			return err
+		}
+		if !a.dryRun {
+			a.loadedETag.Store(azcore.ETag(""))
+			a.logf("blobadapter: deleted blob %s", a.blob)
+		}
+	} else {
+		var result SaveResult
+		if err := a.retryThrottled(ctx, "clear", func() error {
+			var err error
+			result, err = a.uploadPolicyBlob(ctx, bytes.NewReader(nil), match)
+			return err
+		}); err != nil {
+			return err
+		}
+		if !a.dryRun {
+			a.loadedETag.Store(result.ETag)
+			a.logf("blobadapter: cleared blob %s", a.blob)
+		}
+	}
+
+	if audit {
+		if err := a.writeAuditRecord(ctx, auditOperationClear, nil, removed); err != nil {
+			if a.strictAudit {
+				return err
+			}
+			a.logf("blobadapter: writing audit record: %v", err)
+		}
+	}
+	return nil
+}
+
+// deletePolicyBlob deletes the policy blob after making the backups of the
+// adapter. A non-nil match conditions the delete on the ETag of the blob, and
+// ErrPolicyModifiedSinceLoad is returned if it does not match. A blob or
+// container that does not exist is not an error.
+func (a *Adapter) deletePolicyBlob(ctx context.Context, match *azcore.ETag) error {
+	if a.dryRun {
+		a.logf("blobadapter: dry run: suppressed deletion of blob %s", a.blob)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	if match != nil && len(*match) == 0 {
+		match = nil
+	}
+	if len(a.backupSuffix) > 0 {
+		if _, err := a.backupPolicy(ctx, match); err != nil {
+			return err
+		}
+	}
+	if a.historyKeep > 0 {
+		if _, err := a.backupHistory(ctx, match); err != nil {
+			return err
+		}
+	}
+
+	var o *azblob.DeleteBlobOptions
+	if match != nil {
+		o = &azblob.DeleteBlobOptions{
+			AccessConditions: &blob.AccessConditions{
+				ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfMatch: match},
+			},
+		}
+	}
+	a.requests.add(operationOther)
+	_, err := a.c.DeleteBlob(ctx, a.container, a.blob, o)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.ContainerNotFound) {
+			return nil
+		}
+		if bloberror.HasCode(err, bloberror.ConditionNotMet) {
+			return newStorageErrorWithSentinel(err, ErrPolicyModifiedSinceLoad, a.blob)
+		}
+		if bloberror.HasCode(err, bloberror.BlobImmutableDueToPolicy, codeBlobImmutableDueToLegalHold) {
+			return newStorageErrorWithSentinel(err, ErrImmutable, "")
+		}
+		return newStorageError(err)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package blobadapter
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_ClearPolicy(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			c        *mockBlobClient
+			readOnly bool
+		}
+		wantUploads int
+		wantErr     error
+	}{
+		{
+			name: "Clear policy",
+			input: struct {
+				c        *mockBlobClient
+				readOnly bool
+			}{
+				c: &mockBlobClient{},
+			},
+			wantUploads: 1,
+		},
+		{
+			name: "Clear policy with error (read-only)",
+			input: struct {
+				c        *mockBlobClient
+				readOnly bool
+			}{
+				c:        &mockBlobClient{},
+				readOnly: true,
+			},
+			wantErr: ErrReadOnly,
+		},
+		{
+			name: "Clear policy with error (upload)",
+			input: struct {
+				c        *mockBlobClient
+				readOnly bool
+			}{
+				c: &mockBlobClient{errUpload: errTest},
+			},
+			wantErr: errTest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         test.input.c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+				readOnly:  test.input.readOnly,
+				logger:    &mockLogger{},
+			}
+
+			gotErr := a.ClearPolicy(context.Background())
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("ClearPolicy() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantUploads, test.input.c.uploads); diff != "" {
+				t.Errorf("ClearPolicy() unexpected number of uploads (-want +got):\n%s\n", diff)
+			}
+			if test.wantErr != nil {
+				return
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			if err := a.LoadPolicy(m); err != nil {
+				t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+			}
+			if diff := cmp.Diff([][]string(nil), m["p"]["p"].Policy); diff != "" {
+				t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_ClearPolicy_Options(t *testing.T) {
+	a, err := NewInMemoryAdapter(WithStaleWriteProtection(), WithBackupOnSave(".bak"), WithLogger(&mockLogger{}))
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	c := a.c.(*memoryClient)
+	if _, err := a.MergePolicies(context.Background(), "p", "p", [][]string{{"alice", "domain1", "data1", "read"}}); err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+
+	m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	if err := a.LoadPolicy(m); err != nil {
+		t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+	}
+	if err := a.ClearPolicy(context.Background()); err != nil {
+		t.Fatalf("ClearPolicy() unexpected error: %v\n", err)
+	}
+	if diff := cmp.Diff("p, alice, domain1, data1, read", string(c.containers[a.container][a.blob+".bak"].content)); diff != "" {
+		t.Errorf("ClearPolicy() unexpected backup (-want +got):\n%s\n", diff)
+	}
+
+	if _, err := c.UploadStream(context.Background(), a.container, a.blob, bytes.NewReader(nil), nil); err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	if gotErr := a.ClearPolicy(context.Background()); !cmp.Equal(ErrPolicyModifiedSinceLoad, gotErr, cmpopts.EquateErrors()) {
+		t.Errorf("ClearPolicy() unexpected error: %v\n", gotErr)
+	}
+}
+
+func TestAdapter_Clear(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			options []Option
+			missing bool
+		}
+		want    [][]string
+		wantErr error
+	}{
+		{
+			name: "Clear policy",
+			input: struct {
+				options []Option
+				missing bool
+			}{},
+		},
+		{
+			name: "Clear policy by delete",
+			input: struct {
+				options []Option
+				missing bool
+			}{
+				options: []Option{WithClearByDelete(true)},
+			},
+			wantErr: ErrBlobDoesNotExist,
+		},
+		{
+			name: "Clear policy by delete (treat missing as empty)",
+			input: struct {
+				options []Option
+				missing bool
+			}{
+				options: []Option{WithClearByDelete(true), WithTreatMissingAsEmpty(true)},
+			},
+		},
+		{
+			name: "Clear policy by delete (blob does not exist)",
+			input: struct {
+				options []Option
+				missing bool
+			}{
+				options: []Option{WithClearByDelete(true), WithTreatMissingAsEmpty(true)},
+				missing: true,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, err := NewInMemoryAdapter(append(test.input.options, WithLogger(&mockLogger{}))...)
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			c := a.c.(*memoryClient)
+			if test.input.missing {
+				if _, err := c.DeleteBlob(context.Background(), a.container, a.blob, nil); err != nil {
+					t.Fatalf("error in test: %v\n", err)
+				}
+			} else if _, err := a.MergePolicies(context.Background(), "p", "p", [][]string{{"alice", "domain1", "data1", "read"}}); err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			if err := a.Clear(context.Background()); err != nil {
+				t.Fatalf("Clear() unexpected error: %v\n", err)
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			gotErr := a.LoadPolicy(m)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("LoadPolicy() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.want, m["p"]["p"].Policy); diff != "" {
+				t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
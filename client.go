@@ -0,0 +1,256 @@
+package blobadapter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/appendblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+)
+
+// client is the interface that wraps around methods NewListContainersPager, NewListBlobsFlatPager,
+// CreateContainer, DownloadStream, DownloadBuffer, UploadStream, SetImmutabilityPolicy, SetLegalHold,
+// DeleteBlob, CreateAppendBlob, AppendBlock, StartCopyFromURL, GetProperties, SetMetadata, SetTier,
+// FilterBlobs and BlobURL.
+type client interface {
+	NewListContainersPager(o *azblob.ListContainersOptions) *runtime.Pager[azblob.ListContainersResponse]
+	NewListBlobsFlatPager(containerName string, o *azblob.ListBlobsFlatOptions) *runtime.Pager[azblob.ListBlobsFlatResponse]
+	CreateContainer(ctx context.Context, containerName string, o *azblob.CreateContainerOptions) (azblob.CreateContainerResponse, error)
+	DownloadStream(ctx context.Context, containerName string, blobName string, o *azblob.DownloadStreamOptions) (azblob.DownloadStreamResponse, error)
+	DownloadBuffer(ctx context.Context, containerName string, blobName string, buffer []byte, o *azblob.DownloadBufferOptions) (int64, error)
+	UploadStream(ctx context.Context, containerName string, blobName string, body io.Reader, o *azblob.UploadStreamOptions) (azblob.UploadStreamResponse, error)
+	DeleteBlob(ctx context.Context, containerName string, blobName string, o *azblob.DeleteBlobOptions) (azblob.DeleteBlobResponse, error)
+	SetImmutabilityPolicy(ctx context.Context, containerName string, blobName string, expiryTime time.Time, o *blob.SetImmutabilityPolicyOptions) (blob.SetImmutabilityPolicyResponse, error)
+	SetLegalHold(ctx context.Context, containerName string, blobName string, legalHold bool, o *blob.SetLegalHoldOptions) (blob.SetLegalHoldResponse, error)
+	CreateAppendBlob(ctx context.Context, containerName string, blobName string, o *appendblob.CreateOptions) (appendblob.CreateResponse, error)
+	AppendBlock(ctx context.Context, containerName string, blobName string, body io.ReadSeekCloser, o *appendblob.AppendBlockOptions) (appendblob.AppendBlockResponse, error)
+	StartCopyFromURL(ctx context.Context, containerName string, blobName string, copySource string, o *blob.StartCopyFromURLOptions) (blob.StartCopyFromURLResponse, error)
+	GetProperties(ctx context.Context, containerName string, blobName string, o *blob.GetPropertiesOptions) (blob.GetPropertiesResponse, error)
+	SetMetadata(ctx context.Context, containerName string, blobName string, metadata map[string]*string, o *blob.SetMetadataOptions) (blob.SetMetadataResponse, error)
+	SetTier(ctx context.Context, containerName string, blobName string, tier blob.AccessTier, o *blob.SetTierOptions) (blob.SetTierResponse, error)
+	FilterBlobs(ctx context.Context, containerName string, where string, o *container.FilterBlobsOptions) (container.FilterBlobsResponse, error)
+	BlobURL(containerName string, blobName string) string
+}
+
+// blobClient wraps an *azblob.Client and adds the blob operations that are only
+// available on the blob client. The added methods take the container and blob name
+// as arguments, like the methods of *azblob.Client.
+type blobClient struct {
+	*azblob.Client
+}
+
+// newBlobClient returns a new blobClient wrapping the provided client. It accepts
+// the return values of the azblob client constructors.
+func newBlobClient(c *azblob.Client, err error) (client, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &blobClient{Client: c}, nil
+}
+
+// SetImmutabilityPolicy sets the immutability policy of the blob.
+func (c *blobClient) SetImmutabilityPolicy(ctx context.Context, containerName string, blobName string, expiryTime time.Time, o *blob.SetImmutabilityPolicyOptions) (blob.SetImmutabilityPolicyResponse, error) {
+	return c.blobClient(containerName, blobName).SetImmutabilityPolicy(ctx, expiryTime, o)
+}
+
+// SetLegalHold sets the legal hold of the blob.
+func (c *blobClient) SetLegalHold(ctx context.Context, containerName string, blobName string, legalHold bool, o *blob.SetLegalHoldOptions) (blob.SetLegalHoldResponse, error) {
+	return c.blobClient(containerName, blobName).SetLegalHold(ctx, legalHold, o)
+}
+
+// StartCopyFromURL starts a server-side copy of the blob at copySource to the blob.
+func (c *blobClient) StartCopyFromURL(ctx context.Context, containerName string, blobName string, copySource string, o *blob.StartCopyFromURLOptions) (blob.StartCopyFromURLResponse, error) {
+	return c.blobClient(containerName, blobName).StartCopyFromURL(ctx, copySource, o)
+}
+
+// GetProperties returns the properties of the blob.
+func (c *blobClient) GetProperties(ctx context.Context, containerName string, blobName string, o *blob.GetPropertiesOptions) (blob.GetPropertiesResponse, error) {
+	return c.blobClient(containerName, blobName).GetProperties(ctx, o)
+}
+
+// SetMetadata replaces the metadata of the blob.
+func (c *blobClient) SetMetadata(ctx context.Context, containerName string, blobName string, metadata map[string]*string, o *blob.SetMetadataOptions) (blob.SetMetadataResponse, error) {
+	return c.blobClient(containerName, blobName).SetMetadata(ctx, metadata, o)
+}
+
+// SetTier sets the access tier of the blob.
+func (c *blobClient) SetTier(ctx context.Context, containerName string, blobName string, tier blob.AccessTier, o *blob.SetTierOptions) (blob.SetTierResponse, error) {
+	return c.blobClient(containerName, blobName).SetTier(ctx, tier, o)
+}
+
+// FilterBlobs returns the blobs in the container whose tags match the where expression.
+func (c *blobClient) FilterBlobs(ctx context.Context, containerName string, where string, o *container.FilterBlobsOptions) (container.FilterBlobsResponse, error) {
+	return c.ServiceClient().NewContainerClient(containerName).FilterBlobs(ctx, where, o)
+}
+
+// BlobURL returns the URL of the blob.
+func (c *blobClient) BlobURL(containerName string, blobName string) string {
+	return c.blobClient(containerName, blobName).URL()
+}
+
+// CreateAppendBlob creates an append blob.
+func (c *blobClient) CreateAppendBlob(ctx context.Context, containerName string, blobName string, o *appendblob.CreateOptions) (appendblob.CreateResponse, error) {
+	return c.appendBlobClient(containerName, blobName).Create(ctx, o)
+}
+
+// AppendBlock appends a block to an append blob.
+func (c *blobClient) AppendBlock(ctx context.Context, containerName string, blobName string, body io.ReadSeekCloser, o *appendblob.AppendBlockOptions) (appendblob.AppendBlockResponse, error) {
+	return c.appendBlobClient(containerName, blobName).AppendBlock(ctx, body, o)
+}
+
+// appendBlobClient returns an append blob client for the provided container and blob.
+func (c *blobClient) appendBlobClient(containerName, blobName string) *appendblob.Client {
+	return c.ServiceClient().NewContainerClient(containerName).NewAppendBlobClient(blobName)
+}
+
+// blobClient returns a client for the provided container and blob.
+func (c *blobClient) blobClient(containerName, blobName string) *blob.Client {
+	return c.ServiceClient().NewContainerClient(containerName).NewBlobClient(blobName)
+}
+
+// sharedClients is the process-wide cache of clients shared between adapters.
+var sharedClients = &clientCache{}
+
+// clientKey identifies a client in the client cache.
+type clientKey struct {
+	// endpoint is the service URL of the account. It is empty for clients
+	// created from a connection string, which contains the endpoint.
+	endpoint string
+	// credential is the token credential of the client, or the result of
+	// secretKey for account keys and connection strings.
+	credential any
+	// options, applicationID and serviceAPIVersion are set with WithClientOptions,
+	// WithApplicationID and WithServiceAPIVersion. Clients are only shared if the
+	// same are used.
+	options           *azblob.ClientOptions
+	applicationID     string
+	serviceAPIVersion string
+	// httpClient is set with WithHTTPClient.
+	httpClient *http.Client
+}
+
+// secretKey returns a SHA-256 checksum of the provided secret, so that secrets
+// are not kept as keys in the client cache.
+func secretKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// clientCache caches clients by key. It is safe for concurrent use.
+type clientCache struct {
+	mu      sync.Mutex
+	clients map[clientKey]client
+}
+
+// get returns the cached client for key, or creates it with fn and caches it.
+// If the credential of the key is not comparable the client is created with fn
+// and not cached.
+func (c *clientCache) get(key clientKey, fn func() (client, error)) (client, error) {
+	if key.credential != nil && !reflect.TypeOf(key.credential).Comparable() {
+		return fn()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cl, ok := c.clients[key]; ok {
+		return cl, nil
+	}
+	cl, err := fn()
+	if err != nil {
+		return nil, err
+	}
+	if c.clients == nil {
+		c.clients = make(map[clientKey]client)
+	}
+	c.clients[key] = cl
+	return cl, nil
+}
+
+// newClientOptions returns a copy of the client options set with WithClientOptions
+// with the application ID set with WithApplicationID and a policy that adds the
+// name and version of the adapter to the User-Agent header of every request. If
+// a service API version is set with WithServiceAPIVersion a policy that sets it
+// on every request is added.
+func (a *Adapter) newClientOptions() *azblob.ClientOptions {
+	var o azblob.ClientOptions
+	if a.clientOptions != nil {
+		o = *a.clientOptions
+	}
+	if len(a.applicationID) > 0 {
+		o.Telemetry.ApplicationID = a.applicationID
+	}
+	if a.httpClient != nil {
+		o.Transport = a.httpClient
+	}
+	policies := make([]policy.Policy, 0, len(o.PerCallPolicies)+3)
+	policies = append(policies, userAgentPolicy{}, secondaryReadPolicy{})
+	if len(a.serviceAPIVersion) > 0 {
+		policies = append(policies, serviceAPIVersionPolicy{version: a.serviceAPIVersion})
+	}
+	o.PerCallPolicies = append(policies, o.PerCallPolicies...)
+	return &o
+}
+
+// userAgentPolicy is a policy that prepends the name and version of the adapter
+// to the User-Agent header set by the telemetry policy of the SDK.
+type userAgentPolicy struct{}
+
+// Do sets the User-Agent header of the request.
+func (p userAgentPolicy) Do(req *policy.Request) (*http.Response, error) {
+	ua := userAgent
+	if v := req.Raw().Header.Get(headerUserAgent); len(v) > 0 {
+		ua += " " + v
+	}
+	req.Raw().Header.Set(headerUserAgent, ua)
+	return req.Next()
+}
+
+// headerUserAgent is the User-Agent request header.
+const headerUserAgent = "User-Agent"
+
+// serviceAPIVersionPolicy is a policy that sets the x-ms-version header of every
+// request. The SDK does not support overriding the version with the APIVersion of
+// the client options.
+type serviceAPIVersionPolicy struct {
+	version string
+}
+
+// Do replaces the x-ms-version header of the request. A malformed version fails the
+// request without sending it, and a version rejected by the storage fails with an
+// error matching ErrInvalidServiceAPIVersion.
+func (p serviceAPIVersionPolicy) Do(req *policy.Request) (*http.Response, error) {
+	if _, err := time.Parse("2006-01-02", p.version); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidServiceAPIVersion, p.version)
+	}
+	// The SDK sets the header without canonicalizing its key.
+	req.Raw().Header.Del(headerVersion)
+	req.Raw().Header[headerVersion] = []string{p.version}
+	resp, err := req.Next()
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusBadRequest && resp.Header.Get(headerErrorCode) == string(bloberror.InvalidHeaderValue) {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s is not supported by the storage (request ID: %s)", ErrInvalidServiceAPIVersion, p.version, resp.Header.Get(headerRequestID))
+	}
+	return resp, nil
+}
+
+// headerVersion and headerErrorCode are the x-ms-version request header and the
+// x-ms-error-code response header.
+const (
+	headerVersion   = "x-ms-version"
+	headerErrorCode = "x-ms-error-code"
+)
@@ -0,0 +1,352 @@
+package blobadapter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestClientCache_Get(t *testing.T) {
+	cred := &mockCredential{}
+	o := &azblob.ClientOptions{}
+
+	var tests = []struct {
+		name        string
+		input       []clientKey
+		wantCreated int
+		wantShared  bool
+	}{
+		{
+			name: "Get client with the same key",
+			input: []clientKey{
+				{endpoint: "https://account.blob.core.windows.net/", credential: cred},
+				{endpoint: "https://account.blob.core.windows.net/", credential: cred},
+			},
+			wantCreated: 1,
+			wantShared:  true,
+		},
+		{
+			name: "Get client with the same key and options",
+			input: []clientKey{
+				{endpoint: "https://account.blob.core.windows.net/", credential: secretKey("key"), options: o},
+				{endpoint: "https://account.blob.core.windows.net/", credential: secretKey("key"), options: o},
+			},
+			wantCreated: 1,
+			wantShared:  true,
+		},
+		{
+			name: "Get client with different options",
+			input: []clientKey{
+				{endpoint: "https://account.blob.core.windows.net/", credential: cred},
+				{endpoint: "https://account.blob.core.windows.net/", credential: cred, options: o},
+			},
+			wantCreated: 2,
+		},
+		{
+			name: "Get client with different credentials",
+			input: []clientKey{
+				{endpoint: "https://account.blob.core.windows.net/", credential: secretKey("key1")},
+				{endpoint: "https://account.blob.core.windows.net/", credential: secretKey("key2")},
+			},
+			wantCreated: 2,
+		},
+		{
+			name: "Get client with different endpoints",
+			input: []clientKey{
+				{endpoint: "https://account1.blob.core.windows.net/", credential: cred},
+				{endpoint: "https://account2.blob.core.windows.net/", credential: cred},
+			},
+			wantCreated: 2,
+		},
+		{
+			name: "Get client with credential that is not comparable",
+			input: []clientKey{
+				{endpoint: "https://account.blob.core.windows.net/", credential: []string{"key"}},
+				{endpoint: "https://account.blob.core.windows.net/", credential: []string{"key"}},
+			},
+			wantCreated: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := &clientCache{}
+			var created int
+			var got []client
+			for _, key := range test.input {
+				c, err := cache.get(key, func() (client, error) {
+					created++
+					return &mockBlobClient{}, nil
+				})
+				if err != nil {
+					t.Fatalf("get() unexpected error: %v\n", err)
+				}
+				got = append(got, c)
+			}
+
+			if diff := cmp.Diff(test.wantCreated, created); diff != "" {
+				t.Errorf("get() unexpected number of created clients (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantShared, got[0] == got[1]); diff != "" {
+				t.Errorf("get() unexpected sharing of client (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestClientCache_Get_Error(t *testing.T) {
+	cache := &clientCache{}
+	key := clientKey{endpoint: "https://account.blob.core.windows.net/", credential: secretKey("key")}
+
+	_, gotErr := cache.get(key, func() (client, error) {
+		return nil, errTest
+	})
+	if diff := cmp.Diff(errTest, gotErr, cmpopts.EquateErrors()); diff != "" {
+		t.Errorf("get() unexpected error (-want +got):\n%s\n", diff)
+	}
+
+	var created bool
+	if _, err := cache.get(key, func() (client, error) {
+		created = true
+		return &mockBlobClient{}, nil
+	}); err != nil {
+		t.Fatalf("get() unexpected error: %v\n", err)
+	}
+	if !created {
+		t.Errorf("get() expected a new client after a failed creation\n")
+	}
+}
+
+func TestAdapter_NewClientOptions_UserAgent(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input []Option
+		want  string
+	}{
+		{
+			name: "User agent with default options",
+			want: userAgent + " azsdk-go-",
+		},
+		{
+			name:  "User agent with application ID",
+			input: []Option{WithApplicationID("my-app")},
+			want:  userAgent + " my-app azsdk-go-",
+		},
+		{
+			name: "User agent with application ID and client options",
+			input: []Option{
+				WithClientOptions(&azblob.ClientOptions{}),
+				WithApplicationID("my-app"),
+			},
+			want: userAgent + " my-app azsdk-go-",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{}
+			for _, option := range test.input {
+				option(a)
+			}
+
+			transport := &mockTransport{}
+			o := a.newClientOptions()
+			o.Transport = transport
+			c, err := azblob.NewClientWithNoCredential("https://account.blob.core.windows.net/", o)
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			if _, err := c.DownloadStream(context.Background(), "container", "blob", nil); err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			if got := transport.req.Header.Get("User-Agent"); !strings.HasPrefix(got, test.want) {
+				t.Errorf("newClientOptions() unexpected User-Agent, want prefix: %q, got: %q\n", test.want, got)
+			}
+			if a.clientOptions != nil && len(a.clientOptions.PerCallPolicies) > 0 {
+				t.Errorf("newClientOptions() unexpected modification of client options\n")
+			}
+		})
+	}
+}
+
+func TestAdapter_NewClientOptions_ServiceAPIVersion(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			version   string
+			transport *mockTransport
+		}
+		want    string
+		wantErr error
+	}{
+		{
+			name: "Request with default service API version",
+			input: struct {
+				version   string
+				transport *mockTransport
+			}{
+				transport: &mockTransport{},
+			},
+			want: "",
+		},
+		{
+			name: "Request with service API version",
+			input: struct {
+				version   string
+				transport *mockTransport
+			}{
+				version:   "2021-12-02",
+				transport: &mockTransport{},
+			},
+			want: "2021-12-02",
+		},
+		{
+			name: "Request with error (malformed service API version)",
+			input: struct {
+				version   string
+				transport *mockTransport
+			}{
+				version:   "latest",
+				transport: &mockTransport{},
+			},
+			wantErr: ErrInvalidServiceAPIVersion,
+		},
+		{
+			name: "Request with error (unsupported service API version)",
+			input: struct {
+				version   string
+				transport *mockTransport
+			}{
+				version: "2001-01-01",
+				transport: &mockTransport{
+					statusCode: http.StatusBadRequest,
+					header:     http.Header{"X-Ms-Error-Code": []string{"InvalidHeaderValue"}},
+				},
+			},
+			want:    "2001-01-01",
+			wantErr: ErrInvalidServiceAPIVersion,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{}
+			WithServiceAPIVersion(test.input.version)(a)
+
+			o := a.newClientOptions()
+			o.Transport = test.input.transport
+			o.Retry.MaxRetries = -1
+			c, err := azblob.NewClientWithNoCredential("https://account.blob.core.windows.net/", o)
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			_, gotErr := c.DownloadStream(context.Background(), "container", "blob", nil)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("DownloadStream() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if test.input.transport.req == nil {
+				if len(test.want) > 0 {
+					t.Fatalf("DownloadStream() expected a request\n")
+				}
+				return
+			}
+			if test.want == "" {
+				if got := test.input.transport.req.Header["x-ms-version"]; len(got) != 1 {
+					t.Errorf("DownloadStream() expected default x-ms-version\n")
+				}
+				return
+			}
+			if diff := cmp.Diff([]string{test.want}, test.input.transport.req.Header["x-ms-version"]); diff != "" {
+				t.Errorf("DownloadStream() unexpected x-ms-version (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_NewClientOptions_HTTPClient(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("p, alice, domain1, data1, read"))
+	}))
+	defer srv.Close()
+
+	var tests = []struct {
+		name  string
+		input []Option
+	}{
+		{
+			name:  "Request with HTTP client",
+			input: []Option{WithHTTPClient(srv.Client())},
+		},
+		{
+			name: "Request with HTTP client and client options",
+			input: []Option{
+				WithClientOptions(&azblob.ClientOptions{ClientOptions: policy.ClientOptions{Transport: &mockTransport{}}}),
+				WithHTTPClient(srv.Client()),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests = 0
+			a := &Adapter{}
+			for _, option := range test.input {
+				option(a)
+			}
+
+			c, err := azblob.NewClientWithNoCredential(srv.URL, a.newClientOptions())
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			if _, err := c.DownloadStream(context.Background(), "container", "blob", nil); err != nil {
+				t.Fatalf("DownloadStream() unexpected error: %v\n", err)
+			}
+			if diff := cmp.Diff(1, requests); diff != "" {
+				t.Errorf("DownloadStream() unexpected number of requests (-want +got):\n%s\n", diff)
+			}
+			if a.clientOptions != nil {
+				if _, ok := a.clientOptions.Transport.(*mockTransport); !ok {
+					t.Errorf("newClientOptions() unexpected modification of client options\n")
+				}
+			}
+		})
+	}
+}
+
+// mockTransport is a transport that records the last request and responds
+// with an empty body and the status code and header, which default to 200
+// and no headers.
+type mockTransport struct {
+	req        *http.Request
+	statusCode int
+	header     http.Header
+}
+
+func (t *mockTransport) Do(req *http.Request) (*http.Response, error) {
+	t.req = req
+	statusCode, header := t.statusCode, t.header
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
@@ -0,0 +1,141 @@
+package blobadapter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// maxConflictRetries is the number of times the rules are merged by the conflict
+// resolver set with WithConflictResolver before the save fails.
+const maxConflictRetries = 3
+
+// PolicyLine is a policy rule starting with its ptype, e.g.
+// {"p", "alice", "data1", "read"}.
+type PolicyLine []string
+
+// UnionResolver is a conflict resolver for WithConflictResolver that returns the
+// rules of current followed by the rules of mine that are not in current. It keeps
+// the changes of both sides when they only added rules. Rules removed by either
+// side are kept if the other side still has them.
+func UnionResolver(current, mine []PolicyLine) ([]PolicyLine, error) {
+	merged := make([]PolicyLine, 0, len(current)+len(mine))
+	seen := make(map[string]bool, len(current)+len(mine))
+	for _, rules := range [][]PolicyLine{current, mine} {
+		for _, rule := range rules {
+			key := ruleKey(rule)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			merged = append(merged, rule)
+		}
+	}
+	return merged, nil
+}
+
+// resolveConflict saves the rules of the model merged with the current rules of
+// the blob by the conflict resolver. The upload of the merged rules is conditioned
+// on the ETag of the downloaded rules, and the merge is retried if the blob changed
+// in between.
+func (a *Adapter) resolveConflict(ctx context.Context, m model.Model) (SaveResult, error) {
+	mine := toPolicyLines(modelRules(m))
+	for attempt := 1; attempt <= maxConflictRetries; attempt++ {
+		start := time.Now()
+		var current [][]string
+		delimiter := a.delimiter()
+		_, etag, err := a.loadPolicyBlob(ctx, nil, func(line string, _ model.Model) error {
+			tokens, err := parseRuleLine(line, delimiter)
+			if err != nil || tokens == nil {
+				return err
+			}
+			current = append(current, tokens)
+			return nil
+		}, blob.HTTPRange{})
+		if err != nil && !errors.Is(err, ErrContainerDoesNotExist) && !errors.Is(err, ErrBlobDoesNotExist) {
+			return SaveResult{}, err
+		}
+
+		lines, err := a.conflictResolver(toPolicyLines(current), mine)
+		if err != nil {
+			return SaveResult{}, err
+		}
+		merged := make([][]string, len(lines))
+		for i, line := range lines {
+			merged[i] = line
+		}
+
+		result, err := a.saveMerged(ctx, current, merged, etag, start)
+		if err != nil {
+			if errors.Is(err, ErrPolicyModifiedSinceLoad) && attempt < maxConflictRetries {
+				a.logf("blobadapter: blob %s modified during merge, retrying (attempt %d of %d)", a.blob, attempt, maxConflictRetries)
+				continue
+			}
+			return SaveResult{}, err
+		}
+		return result, nil
+	}
+	return SaveResult{}, ErrPolicyModifiedSinceLoad
+}
+
+// saveMerged uploads the merged rules on the condition that the blob still has
+// etag, and reports the changes to the current rules of the blob to the change
+// callback and the audit blob. Like savePolicy, the ETag of the saved blob is
+// stored as the loaded ETag, and the statistics and the hook set with WithOnSave
+// are updated. The changes are only reported once the upload succeeded, since
+// the merge is retried if it fails with ErrPolicyModifiedSinceLoad.
+func (a *Adapter) saveMerged(ctx context.Context, current, merged [][]string, etag azcore.ETag, start time.Time) (SaveResult, error) {
+	cr := &countingReader{}
+	var result SaveResult
+	if err := a.retryThrottled(ctx, "save", func() error {
+		return pipe(func(w io.Writer) error {
+			return a.writeRules(w, nil, merged)
+		}, func(r io.Reader) error {
+			cr.r, cr.n = r, 0
+			var err error
+			result, err = a.uploadPolicyBlob(ctx, cr, &etag)
+			return err
+		})
+	}); err != nil {
+		return SaveResult{}, err
+	}
+	if !a.dryRun {
+		a.loadedETag.Store(result.ETag)
+	}
+
+	added, removed := diffRules(current, merged)
+	if a.onChange != nil {
+		a.onChange(added, removed)
+	}
+	if len(a.auditBlob) > 0 {
+		if err := a.writeAuditRecord(ctx, auditOperationSave, added, removed); err != nil {
+			if a.strictAudit {
+				return SaveResult{}, err
+			}
+			a.logf("blobadapter: writing audit record: %v", err)
+		}
+	}
+
+	stats := OperationStats{Rules: ptypeCounts(merged), Bytes: cr.n, Duration: time.Since(start), At: start}
+	a.stats.save.Store(stats)
+	if a.onSave != nil {
+		info := SaveInfo{Rules: stats.Rules, Bytes: cr.n, ETag: result.ETag, Duration: stats.Duration}
+		a.runHook("save", func() { a.onSave(ctx, info) })
+	}
+	result.Bytes, result.Rules = cr.n, stats.Rules
+	return result, nil
+}
+
+// toPolicyLines converts rules starting with their ptype to policy lines.
+func toPolicyLines(rules [][]string) []PolicyLine {
+	lines := make([]PolicyLine, len(rules))
+	for i, rule := range rules {
+		lines[i] = rule
+	}
+	return lines
+}
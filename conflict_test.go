@@ -0,0 +1,158 @@
+package blobadapter
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_ConflictResolver(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   func(current, mine []PolicyLine) ([]PolicyLine, error)
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "Save policy merged with union resolver",
+			input: UnionResolver,
+			want:  "p, alice, domain1, data1, read\np, carol, domain1, data1, read\np, bob, domain1, data2, write",
+		},
+		{
+			name: "Save policy with error (resolver)",
+			input: func(current, mine []PolicyLine) ([]PolicyLine, error) {
+				return nil, errTest
+			},
+			want:    "p, alice, domain1, data1, read\np, carol, domain1, data1, read",
+			wantErr: errTest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &mockBlobClient{}
+			a := &Adapter{
+				c:         c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			WithStaleWriteProtection()(a)
+			WithConflictResolver(test.input)(a)
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			if err := a.LoadPolicy(m); err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			c.policies = []byte("p, alice, domain1, data1, read\np, carol, domain1, data1, read")
+			c.uploads++
+			m.AddPolicy("p", "p", []string{"bob", "domain1", "data2", "write"})
+
+			gotErr := a.SavePolicy(m)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("SavePolicy() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.want, string(c.policies)); diff != "" {
+				t.Errorf("SavePolicy() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestUnionResolver(t *testing.T) {
+	current := []PolicyLine{{"p", "alice", "data1", "read"}, {"g", "alice", "admin"}}
+	mine := []PolicyLine{{"p", "alice", "data1", "read"}, {"p", "bob", "data2", "write"}}
+	want := []PolicyLine{{"p", "alice", "data1", "read"}, {"g", "alice", "admin"}, {"p", "bob", "data2", "write"}}
+
+	got, err := UnionResolver(current, mine)
+	if err != nil {
+		t.Fatalf("UnionResolver() unexpected error: %v\n", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("UnionResolver() unexpected result (-want +got):\n%s\n", diff)
+	}
+}
+
+// racingClient is a memoryClient that calls race once before the next upload, to
+// modify the blob between a download and an upload of the adapter.
+type racingClient struct {
+	*memoryClient
+	race func()
+}
+
+func (c *racingClient) UploadStream(ctx context.Context, containerName string, blobName string, body io.Reader, o *azblob.UploadStreamOptions) (azblob.UploadStreamResponse, error) {
+	if race := c.race; race != nil {
+		c.race = nil
+		race()
+	}
+	return c.memoryClient.UploadStream(ctx, containerName, blobName, body, o)
+}
+
+func TestAdapter_ConflictResolver_ModifiedDuringMerge(t *testing.T) {
+	var merges int
+	a, err := NewInMemoryAdapter(WithStaleWriteProtection(), WithConflictResolver(func(current, mine []PolicyLine) ([]PolicyLine, error) {
+		merges++
+		return UnionResolver(current, mine)
+	}), WithLogger(&mockLogger{}))
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	mc := a.c.(*memoryClient)
+	c := &racingClient{memoryClient: mc}
+	a.c = c
+	upload := func(content string) {
+		if _, err := mc.UploadStream(context.Background(), a.container, a.blob, strings.NewReader(content), nil); err != nil {
+			t.Fatalf("error in test: %v\n", err)
+		}
+	}
+
+	m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	if err := a.LoadPolicy(m); err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	upload("p, carol, domain1, data1, read")
+	// The save fails the condition of its upload and is merged, and the blob is
+	// modified again before the upload of the merge.
+	c.race = func() {
+		c.race = func() {
+			upload("p, carol, domain1, data1, read\np, dave, domain1, data1, read")
+		}
+	}
+	m.AddPolicy("p", "p", []string{"bob", "domain1", "data2", "write"})
+
+	if err := a.SavePolicy(m); err != nil {
+		t.Fatalf("SavePolicy() unexpected error: %v\n", err)
+	}
+	want := "p, carol, domain1, data1, read\np, dave, domain1, data1, read\np, bob, domain1, data2, write"
+	if diff := cmp.Diff(want, string(mc.containers[a.container][a.blob].content)); diff != "" {
+		t.Errorf("SavePolicy() unexpected result (-want +got):\n%s\n", diff)
+	}
+	if diff := cmp.Diff(2, merges); diff != "" {
+		t.Errorf("SavePolicy() unexpected number of merges (-want +got):\n%s\n", diff)
+	}
+
+	// The merged save is the loaded state, so the next save is not merged again.
+	m.RemovePolicy("p", "p", []string{"bob", "domain1", "data2", "write"})
+	if err := a.SavePolicy(m); err != nil {
+		t.Fatalf("SavePolicy() unexpected error: %v\n", err)
+	}
+	if diff := cmp.Diff("", string(mc.containers[a.container][a.blob].content)); diff != "" {
+		t.Errorf("SavePolicy() unexpected result (-want +got):\n%s\n", diff)
+	}
+	if diff := cmp.Diff(2, merges); diff != "" {
+		t.Errorf("SavePolicy() unexpected number of merges (-want +got):\n%s\n", diff)
+	}
+}
@@ -0,0 +1,175 @@
+package blobadapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+const (
+	// envClientID is the environment variable for the client ID of a service principal
+	// or identity.
+	envClientID = "AZURE_CLIENT_ID"
+	// envTenantID is the environment variable for the tenant ID of a service principal
+	// or identity.
+	envTenantID = "AZURE_TENANT_ID"
+	// envFederatedTokenFile is the environment variable for the path of the federated
+	// token file used by workload identity.
+	envFederatedTokenFile = "AZURE_FEDERATED_TOKEN_FILE"
+)
+
+// failureCredential wraps a credential and wraps the errors of acquiring a token
+// with it so that they match ErrCredentialFailure, which tells them apart from the
+// errors returned by the storage. Errors caused by the context of the request are
+// returned as they are.
+type failureCredential struct {
+	cred azcore.TokenCredential
+}
+
+// GetToken returns a token from the wrapped credential.
+func (c failureCredential) GetToken(ctx context.Context, o policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	tk, err := c.cred.GetToken(ctx, o)
+	if err != nil && ctx.Err() == nil {
+		return tk, newWrappedError(ErrCredentialFailure, err)
+	}
+	return tk, err
+}
+
+// NewAdapterWithManagedIdentity returns a new adapter with the given account, container and blob
+// that authenticates with a managed identity. If clientID is empty the system-assigned managed
+// identity is used, otherwise the user-assigned managed identity with the provided client ID.
+// If the container and blob does not exist, they will be created.
+func NewAdapterWithManagedIdentity(account, container, blob, clientID string, options ...Option) (*Adapter, error) {
+	var opts *azidentity.ManagedIdentityCredentialOptions
+	if len(clientID) > 0 {
+		opts = &azidentity.ManagedIdentityCredentialOptions{
+			ID: azidentity.ClientID(clientID),
+		}
+	}
+
+	cred, err := newManagedIdentityCredential(opts)
+	if err != nil {
+		return nil, newWrappedError(ErrInvalidCredential, err)
+	}
+
+	return newCredentialAdapter(account, container, blob, cred, false, options...)
+}
+
+// newManagedIdentityCredential creates a managed identity credential. It is a variable
+// to allow for replacing it in tests.
+var newManagedIdentityCredential = func(o *azidentity.ManagedIdentityCredentialOptions) (azcore.TokenCredential, error) {
+	return azidentity.NewManagedIdentityCredential(o)
+}
+
+// NewAdapterWithClientSecret returns a new adapter with the given account, container and blob
+// that authenticates as a service principal with the provided tenant ID, client ID and client secret.
+// If the container and blob does not exist, they will be created.
+func NewAdapterWithClientSecret(tenantID, clientID, clientSecret, account, container, blob string, options ...Option) (*Adapter, error) {
+	if len(tenantID) == 0 {
+		return nil, newWrappedError(ErrInvalidCredential, errors.New("client secret: tenant ID is not set"))
+	}
+	if len(clientID) == 0 {
+		return nil, newWrappedError(ErrInvalidCredential, errors.New("client secret: client ID is not set"))
+	}
+	if len(clientSecret) == 0 {
+		return nil, newWrappedError(ErrInvalidCredential, errors.New("client secret: client secret is not set"))
+	}
+
+	cred, err := newClientSecretCredential(tenantID, clientID, clientSecret)
+	if err != nil {
+		return nil, newWrappedError(ErrInvalidCredential, err)
+	}
+
+	return newCredentialAdapter(account, container, blob, cred, false, options...)
+}
+
+// newClientSecretCredential creates a client secret credential. It is a variable
+// to allow for replacing it in tests.
+var newClientSecretCredential = func(tenantID, clientID, clientSecret string) (azcore.TokenCredential, error) {
+	return azidentity.NewClientSecretCredential(tenantID, clientID, clientSecret, nil)
+}
+
+// WorkloadIdentityOptions contains options for authenticating with workload identity.
+// Empty fields default to the values of the environment variables AZURE_CLIENT_ID,
+// AZURE_TENANT_ID and AZURE_FEDERATED_TOKEN_FILE.
+type WorkloadIdentityOptions struct {
+	// ClientID is the client ID of the identity.
+	ClientID string
+	// TenantID is the tenant ID of the identity.
+	TenantID string
+	// TokenFilePath is the path of the file containing the federated (service account) token.
+	TokenFilePath string
+}
+
+// NewAdapterWithWorkloadIdentity returns a new adapter with the given account, container and blob
+// that authenticates with workload identity configured from the environment variables
+// AZURE_CLIENT_ID, AZURE_TENANT_ID and AZURE_FEDERATED_TOKEN_FILE.
+// If the container and blob does not exist, they will be created.
+func NewAdapterWithWorkloadIdentity(account, container, blob string, options ...Option) (*Adapter, error) {
+	return NewAdapterWithWorkloadIdentityOptions(account, container, blob, WorkloadIdentityOptions{}, options...)
+}
+
+// NewAdapterWithWorkloadIdentityOptions returns a new adapter with the given account, container and blob
+// that authenticates with workload identity configured with the provided workload identity options.
+// If the container and blob does not exist, they will be created.
+func NewAdapterWithWorkloadIdentityOptions(account, container, blob string, wiOptions WorkloadIdentityOptions, options ...Option) (*Adapter, error) {
+	wiOptions, err := resolveWorkloadIdentityOptions(wiOptions)
+	if err != nil {
+		return nil, newWrappedError(ErrInvalidCredential, err)
+	}
+
+	cred, err := newWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{
+		ClientID:      wiOptions.ClientID,
+		TenantID:      wiOptions.TenantID,
+		TokenFilePath: wiOptions.TokenFilePath,
+	})
+	if err != nil {
+		return nil, newWrappedError(ErrInvalidCredential, err)
+	}
+
+	return newCredentialAdapter(account, container, blob, cred, false, options...)
+}
+
+// newWorkloadIdentityCredential creates a workload identity credential. It is a variable
+// to allow for replacing it in tests.
+var newWorkloadIdentityCredential = func(o *azidentity.WorkloadIdentityCredentialOptions) (azcore.TokenCredential, error) {
+	return azidentity.NewWorkloadIdentityCredential(o)
+}
+
+// resolveWorkloadIdentityOptions sets empty fields of the provided options from the
+// environment and verifies that all fields are set and that the token file can be read.
+func resolveWorkloadIdentityOptions(o WorkloadIdentityOptions) (WorkloadIdentityOptions, error) {
+	if len(o.ClientID) == 0 {
+		o.ClientID = os.Getenv(envClientID)
+	}
+	if len(o.TenantID) == 0 {
+		o.TenantID = os.Getenv(envTenantID)
+	}
+	if len(o.TokenFilePath) == 0 {
+		o.TokenFilePath = os.Getenv(envFederatedTokenFile)
+	}
+
+	if len(o.ClientID) == 0 {
+		return o, fmt.Errorf("workload identity: client ID is not set, set it in the options or with %s", envClientID)
+	}
+	if len(o.TenantID) == 0 {
+		return o, fmt.Errorf("workload identity: tenant ID is not set, set it in the options or with %s", envTenantID)
+	}
+	if len(o.TokenFilePath) == 0 {
+		return o, fmt.Errorf("workload identity: token file is not set, set it in the options or with %s", envFederatedTokenFile)
+	}
+
+	fi, err := os.Stat(o.TokenFilePath)
+	if err != nil {
+		return o, fmt.Errorf("workload identity: token file: %w", err)
+	}
+	if fi.IsDir() {
+		return o, fmt.Errorf("workload identity: token file: %s is a directory", o.TokenFilePath)
+	}
+	return o, nil
+}
@@ -0,0 +1,583 @@
+package blobadapter
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestNewAdapterWithManagedIdentity(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			account   string
+			container string
+			blob      string
+			clientID  string
+			credErr   error
+			options   []Option
+		}
+		want    *Adapter
+		wantID  azidentity.ManagedIDKind
+		wantErr error
+	}{
+		{
+			name: "Create a new adapter with system-assigned managed identity",
+			input: struct {
+				account   string
+				container string
+				blob      string
+				clientID  string
+				credErr   error
+				options   []Option
+			}{
+				account:   "account",
+				container: "container",
+				blob:      "blob",
+				options: []Option{
+					func(a *Adapter) {
+						a.c = &mockBlobClient{}
+					},
+				},
+			},
+			want: &Adapter{
+				c:             &mockBlobClient{},
+				container:     "container",
+				blob:          "blob",
+				timeout:       time.Second * 10,
+				maxPolicySize: defaultMaxPolicySize,
+				maxRules:      defaultMaxRules,
+			},
+			wantID: nil,
+		},
+		{
+			name: "Create a new adapter with user-assigned managed identity",
+			input: struct {
+				account   string
+				container string
+				blob      string
+				clientID  string
+				credErr   error
+				options   []Option
+			}{
+				account:   "account",
+				container: "container",
+				blob:      "blob",
+				clientID:  "00000000-0000-0000-0000-000000000000",
+				options: []Option{
+					func(a *Adapter) {
+						a.c = &mockBlobClient{}
+					},
+				},
+			},
+			want: &Adapter{
+				c:             &mockBlobClient{},
+				container:     "container",
+				blob:          "blob",
+				timeout:       time.Second * 10,
+				maxPolicySize: defaultMaxPolicySize,
+				maxRules:      defaultMaxRules,
+			},
+			wantID: azidentity.ClientID("00000000-0000-0000-0000-000000000000"),
+		},
+		{
+			name: "Create a new adapter with error (credential)",
+			input: struct {
+				account   string
+				container string
+				blob      string
+				clientID  string
+				credErr   error
+				options   []Option
+			}{
+				account:   "account",
+				container: "container",
+				blob:      "blob",
+				credErr:   errTest,
+				options: []Option{
+					func(a *Adapter) {
+						a.c = &mockBlobClient{}
+					},
+				},
+			},
+			want:    nil,
+			wantID:  nil,
+			wantErr: ErrInvalidCredential,
+		},
+		{
+			name: "Create a new adapter with invalid account",
+			input: struct {
+				account   string
+				container string
+				blob      string
+				clientID  string
+				credErr   error
+				options   []Option
+			}{
+				account:   "",
+				container: "container",
+				blob:      "blob",
+				options: []Option{
+					func(a *Adapter) {
+						a.c = &mockBlobClient{}
+					},
+				},
+			},
+			want:    nil,
+			wantErr: ErrInvalidAccount,
+		},
+	}
+
+	fn := newManagedIdentityCredential
+	defer func() {
+		newManagedIdentityCredential = fn
+	}()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var gotID azidentity.ManagedIDKind
+			newManagedIdentityCredential = func(o *azidentity.ManagedIdentityCredentialOptions) (azcore.TokenCredential, error) {
+				if o != nil {
+					gotID = o.ID
+				}
+				if test.input.credErr != nil {
+					return nil, test.input.credErr
+				}
+				return &mockCredential{}, nil
+			}
+
+			got, gotErr := NewAdapterWithManagedIdentity(test.input.account, test.input.container, test.input.blob, test.input.clientID, test.input.options...)
+
+			if diff := cmp.Diff(test.want, got, cmpAdapterOptions...); diff != "" {
+				t.Errorf("NewAdapterWithManagedIdentity() unexpected result (-want +got):\n%s\n", diff)
+			}
+
+			if diff := cmp.Diff(test.wantID, gotID); diff != "" {
+				t.Errorf("NewAdapterWithManagedIdentity() unexpected managed identity ID (-want +got):\n%s\n", diff)
+			}
+
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("NewAdapterWithManagedIdentity() unexpected error (-want +got):\n%s\n", diff)
+			}
+
+			if test.input.credErr != nil && !errors.Is(gotErr, test.input.credErr) {
+				t.Errorf("NewAdapterWithManagedIdentity() expected error to wrap %v, got: %v\n", test.input.credErr, gotErr)
+			}
+		})
+	}
+}
+
+func TestNewAdapterWithManagedIdentity_ClientCache(t *testing.T) {
+	fn := newManagedIdentityCredential
+	defer func() {
+		newManagedIdentityCredential = fn
+	}()
+	newManagedIdentityCredential = func(o *azidentity.ManagedIdentityCredentialOptions) (azcore.TokenCredential, error) {
+		return &mockCredential{}, nil
+	}
+
+	clients := func() int {
+		sharedClients.mu.Lock()
+		defer sharedClients.mu.Unlock()
+		return len(sharedClients.clients)
+	}
+	want := clients()
+	for i := 0; i < 3; i++ {
+		if _, err := NewAdapterWithManagedIdentity("account", "container", "blob", "", WithReadOnly(true)); err != nil {
+			t.Fatalf("NewAdapterWithManagedIdentity() unexpected error: %v\n", err)
+		}
+	}
+	if diff := cmp.Diff(want, clients()); diff != "" {
+		t.Errorf("NewAdapterWithManagedIdentity() unexpected number of cached clients (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestNewAdapterWithClientSecret(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			tenantID     string
+			clientID     string
+			clientSecret string
+			account      string
+			credErr      error
+		}
+		want     *Adapter
+		wantCall bool
+		wantErr  error
+	}{
+		{
+			name: "Create a new adapter with client secret",
+			input: struct {
+				tenantID     string
+				clientID     string
+				clientSecret string
+				account      string
+				credErr      error
+			}{
+				tenantID:     "tenant",
+				clientID:     "client",
+				clientSecret: "secret",
+				account:      "account",
+			},
+			want: &Adapter{
+				c:             &mockBlobClient{},
+				container:     "container",
+				blob:          "blob",
+				timeout:       time.Second * 10,
+				maxPolicySize: defaultMaxPolicySize,
+				maxRules:      defaultMaxRules,
+			},
+			wantCall: true,
+		},
+		{
+			name: "Create a new adapter with missing tenant ID",
+			input: struct {
+				tenantID     string
+				clientID     string
+				clientSecret string
+				account      string
+				credErr      error
+			}{
+				tenantID:     "",
+				clientID:     "client",
+				clientSecret: "secret",
+				account:      "account",
+			},
+			want:     nil,
+			wantCall: false,
+			wantErr:  ErrInvalidCredential,
+		},
+		{
+			name: "Create a new adapter with missing client ID",
+			input: struct {
+				tenantID     string
+				clientID     string
+				clientSecret string
+				account      string
+				credErr      error
+			}{
+				tenantID:     "tenant",
+				clientID:     "",
+				clientSecret: "secret",
+				account:      "account",
+			},
+			want:     nil,
+			wantCall: false,
+			wantErr:  ErrInvalidCredential,
+		},
+		{
+			name: "Create a new adapter with missing client secret",
+			input: struct {
+				tenantID     string
+				clientID     string
+				clientSecret string
+				account      string
+				credErr      error
+			}{
+				tenantID:     "tenant",
+				clientID:     "client",
+				clientSecret: "",
+				account:      "account",
+			},
+			want:     nil,
+			wantCall: false,
+			wantErr:  ErrInvalidCredential,
+		},
+		{
+			name: "Create a new adapter with error (credential)",
+			input: struct {
+				tenantID     string
+				clientID     string
+				clientSecret string
+				account      string
+				credErr      error
+			}{
+				tenantID:     "tenant",
+				clientID:     "client",
+				clientSecret: "secret",
+				account:      "account",
+				credErr:      errTest,
+			},
+			want:     nil,
+			wantCall: true,
+			wantErr:  ErrInvalidCredential,
+		},
+		{
+			name: "Create a new adapter with invalid account",
+			input: struct {
+				tenantID     string
+				clientID     string
+				clientSecret string
+				account      string
+				credErr      error
+			}{
+				tenantID:     "tenant",
+				clientID:     "client",
+				clientSecret: "secret",
+				account:      "",
+			},
+			want:     nil,
+			wantCall: true,
+			wantErr:  ErrInvalidAccount,
+		},
+	}
+
+	fn := newClientSecretCredential
+	defer func() {
+		newClientSecretCredential = fn
+	}()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var gotCall bool
+			newClientSecretCredential = func(tenantID, clientID, clientSecret string) (azcore.TokenCredential, error) {
+				gotCall = true
+				if test.input.credErr != nil {
+					return nil, test.input.credErr
+				}
+				return &mockCredential{}, nil
+			}
+
+			got, gotErr := NewAdapterWithClientSecret(test.input.tenantID, test.input.clientID, test.input.clientSecret, test.input.account, "container", "blob", func(a *Adapter) {
+				a.c = &mockBlobClient{}
+			})
+
+			if diff := cmp.Diff(test.want, got, cmpAdapterOptions...); diff != "" {
+				t.Errorf("NewAdapterWithClientSecret() unexpected result (-want +got):\n%s\n", diff)
+			}
+
+			if diff := cmp.Diff(test.wantCall, gotCall); diff != "" {
+				t.Errorf("NewAdapterWithClientSecret() unexpected credential call (-want +got):\n%s\n", diff)
+			}
+
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("NewAdapterWithClientSecret() unexpected error (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestNewAdapterWithWorkloadIdentityOptions(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("token"), 0600); err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+
+	var tests = []struct {
+		name  string
+		input struct {
+			env       map[string]string
+			wiOptions WorkloadIdentityOptions
+			options   []Option
+		}
+		want        *Adapter
+		wantOptions *azidentity.WorkloadIdentityCredentialOptions
+		wantErr     error
+	}{
+		{
+			name: "Create a new adapter with workload identity from environment",
+			input: struct {
+				env       map[string]string
+				wiOptions WorkloadIdentityOptions
+				options   []Option
+			}{
+				env: map[string]string{
+					envClientID:           "client",
+					envTenantID:           "tenant",
+					envFederatedTokenFile: tokenFile,
+				},
+				options: []Option{
+					func(a *Adapter) {
+						a.c = &mockBlobClient{}
+					},
+				},
+			},
+			want: &Adapter{
+				c:             &mockBlobClient{},
+				container:     "container",
+				blob:          "blob",
+				timeout:       time.Second * 10,
+				maxPolicySize: defaultMaxPolicySize,
+				maxRules:      defaultMaxRules,
+			},
+			wantOptions: &azidentity.WorkloadIdentityCredentialOptions{
+				ClientID:      "client",
+				TenantID:      "tenant",
+				TokenFilePath: tokenFile,
+			},
+		},
+		{
+			name: "Create a new adapter with workload identity from options",
+			input: struct {
+				env       map[string]string
+				wiOptions WorkloadIdentityOptions
+				options   []Option
+			}{
+				env: map[string]string{
+					envClientID: "client",
+				},
+				wiOptions: WorkloadIdentityOptions{
+					ClientID:      "other-client",
+					TenantID:      "tenant",
+					TokenFilePath: tokenFile,
+				},
+				options: []Option{
+					func(a *Adapter) {
+						a.c = &mockBlobClient{}
+					},
+				},
+			},
+			want: &Adapter{
+				c:             &mockBlobClient{},
+				container:     "container",
+				blob:          "blob",
+				timeout:       time.Second * 10,
+				maxPolicySize: defaultMaxPolicySize,
+				maxRules:      defaultMaxRules,
+			},
+			wantOptions: &azidentity.WorkloadIdentityCredentialOptions{
+				ClientID:      "other-client",
+				TenantID:      "tenant",
+				TokenFilePath: tokenFile,
+			},
+		},
+		{
+			name: "Create a new adapter with workload identity with missing tenant ID",
+			input: struct {
+				env       map[string]string
+				wiOptions WorkloadIdentityOptions
+				options   []Option
+			}{
+				env: map[string]string{
+					envClientID:           "client",
+					envFederatedTokenFile: tokenFile,
+				},
+			},
+			want:    nil,
+			wantErr: ErrInvalidCredential,
+		},
+		{
+			name: "Create a new adapter with workload identity with missing token file",
+			input: struct {
+				env       map[string]string
+				wiOptions WorkloadIdentityOptions
+				options   []Option
+			}{
+				env: map[string]string{
+					envClientID:           "client",
+					envTenantID:           "tenant",
+					envFederatedTokenFile: filepath.Join(t.TempDir(), "missing"),
+				},
+			},
+			want:    nil,
+			wantErr: ErrInvalidCredential,
+		},
+	}
+
+	fn := newWorkloadIdentityCredential
+	defer func() {
+		newWorkloadIdentityCredential = fn
+	}()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, env := range []string{envClientID, envTenantID, envFederatedTokenFile} {
+				t.Setenv(env, test.input.env[env])
+			}
+
+			var gotOptions *azidentity.WorkloadIdentityCredentialOptions
+			newWorkloadIdentityCredential = func(o *azidentity.WorkloadIdentityCredentialOptions) (azcore.TokenCredential, error) {
+				gotOptions = o
+				return &mockCredential{}, nil
+			}
+
+			got, gotErr := NewAdapterWithWorkloadIdentityOptions("account", "container", "blob", test.input.wiOptions, test.input.options...)
+
+			if diff := cmp.Diff(test.want, got, cmpAdapterOptions...); diff != "" {
+				t.Errorf("NewAdapterWithWorkloadIdentityOptions() unexpected result (-want +got):\n%s\n", diff)
+			}
+
+			if diff := cmp.Diff(test.wantOptions, gotOptions, cmpopts.IgnoreFields(azidentity.WorkloadIdentityCredentialOptions{}, "ClientOptions")); diff != "" {
+				t.Errorf("NewAdapterWithWorkloadIdentityOptions() unexpected options (-want +got):\n%s\n", diff)
+			}
+
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("NewAdapterWithWorkloadIdentityOptions() unexpected error (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestFailureCredential(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var tests = []struct {
+		name  string
+		input struct {
+			ctx context.Context
+			err error
+		}
+		wantErr error
+	}{
+		{
+			name: "Get token",
+			input: struct {
+				ctx context.Context
+				err error
+			}{
+				ctx: context.Background(),
+			},
+		},
+		{
+			name: "Get token with error",
+			input: struct {
+				ctx context.Context
+				err error
+			}{
+				ctx: context.Background(),
+				err: errTest,
+			},
+			wantErr: ErrCredentialFailure,
+		},
+		{
+			name: "Get token with error (context canceled)",
+			input: struct {
+				ctx context.Context
+				err error
+			}{
+				ctx: canceled,
+				err: errTest,
+			},
+			wantErr: context.Canceled,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cred := failureCredential{cred: &mockCredential{err: test.input.err}}
+
+			_, gotErr := cred.GetToken(test.input.ctx, policy.TokenRequestOptions{})
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("GetToken() unexpected error (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestNewAdapter_CredentialFailure(t *testing.T) {
+	_, gotErr := NewAdapter("account", "container", "blob", &mockCredential{err: errTest}, WithLogger(&mockLogger{}))
+	if !errors.Is(gotErr, ErrCredentialFailure) || !errors.Is(gotErr, errTest) {
+		t.Errorf("NewAdapter() unexpected error: %v\n", gotErr)
+	}
+}
@@ -0,0 +1,138 @@
+package blobadapter
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"golang.org/x/text/transform"
+)
+
+const (
+	// encryptionVersion is the version of the format of encrypted policy blobs.
+	encryptionVersion = 1
+	// encryptionKeySize is the size of AES-256 keys.
+	encryptionKeySize = 32
+)
+
+// encryptionMagic starts the header of encrypted policy blobs. It is followed
+// by the version of the format, the nonce and the sealed content.
+var encryptionMagic = []byte("CBAE")
+
+// encrypt returns the content encrypted with the key set with
+// WithClientSideEncryption. See sealPolicy.
+func (a *Adapter) encrypt(b []byte) ([]byte, error) {
+	return sealPolicy(a.encryptionKey, b)
+}
+
+// decrypt returns the decrypted content of the blob name with the key set with
+// WithClientSideEncryption. See openPolicy.
+func (a *Adapter) decrypt(name string, b []byte) ([]byte, error) {
+	return openPolicy(name, a.encryptionKey, b)
+}
+
+// sealPolicy returns the content encrypted with AES-256-GCM and key, after a
+// header with the format version and the nonce.
+func sealPolicy(key, b []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, len(encryptionMagic)+1+aead.NonceSize())
+	copy(header, encryptionMagic)
+	header[len(encryptionMagic)] = encryptionVersion
+	nonce := header[len(encryptionMagic)+1:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	// The header is authenticated, so that the version cannot be changed.
+	return aead.Seal(header, nonce, b, header), nil
+}
+
+// openPolicy returns the content of the blob name decrypted with key. If the
+// content is not encrypted ErrNotEncrypted is returned, and if it cannot be
+// decrypted with the key ErrDecryptionFailed.
+func openPolicy(name string, key, b []byte) ([]byte, error) {
+	if !isEncrypted(b) {
+		return nil, fmt.Errorf("%w: blob %s is not encrypted, it can be encrypted with MigrateToEncryption", ErrNotEncrypted, name)
+	}
+	if version := b[len(encryptionMagic)]; version != encryptionVersion {
+		return nil, fmt.Errorf("%w: blob %s has unsupported format version %d", ErrDecryptionFailed, name, version)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	n := len(encryptionMagic) + 1 + aead.NonceSize()
+	if len(b) < n+aead.Overhead() {
+		return nil, fmt.Errorf("%w: blob %s is truncated", ErrDecryptionFailed, name)
+	}
+	plain, err := aead.Open(nil, b[len(encryptionMagic)+1:n], b[n:], b[:n])
+	if err != nil {
+		return nil, fmt.Errorf("%w: blob %s: %v", ErrDecryptionFailed, name, err)
+	}
+	return plain, nil
+}
+
+// newAEAD returns AES-256-GCM with key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != encryptionKeySize {
+		return nil, ErrInvalidEncryptionKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// isEncrypted returns true if b starts with the header of encrypted policy blobs.
+func isEncrypted(b []byte) bool {
+	return len(b) > len(encryptionMagic) && bytes.HasPrefix(b, encryptionMagic)
+}
+
+// MigrateToEncryption encrypts a policy blob that was saved without client-side
+// encryption with the key set with WithClientSideEncryption or WithKeyVaultEncryption.
+// The unencrypted content is downloaded and uploaded again encrypted, without being
+// parsed. It is a no-op if the blob is already encrypted. Like SavePolicy, changes
+// made to the blob by others between the download and the upload are overwritten.
+func (a *Adapter) MigrateToEncryption(ctx context.Context) error {
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+	if a.keyWrapper == nil && len(a.encryptionKey) != encryptionKeySize {
+		return ErrInvalidEncryptionKey
+	}
+
+	var b []byte
+	if err := a.readPolicyBlob(ctx, func(r io.Reader, _ int64) error {
+		if a.maxPolicySize > 0 {
+			r = &maxSizeReader{r: r, n: a.maxPolicySize, err: ErrPolicyTooLarge}
+		}
+		var err error
+		b, err = io.ReadAll(r)
+		return err
+	}); err != nil {
+		return err
+	}
+	if isEncrypted(b) {
+		return nil
+	}
+
+	var r io.Reader = bytes.NewReader(b)
+	if a.encoding != nil {
+		// The content is encoded again when it is uploaded.
+		r = transform.NewReader(r, a.encoding.NewDecoder())
+	}
+	if _, err := a.savePolicyBlob(ctx, r); err != nil {
+		return err
+	}
+	if !a.dryRun {
+		a.logf("blobadapter: encrypted blob %s", a.blob)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package blobadapter
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_ClientSideEncryption(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	encrypted := func(key []byte, s string) []byte {
+		b, err := (&Adapter{encryptionKey: key}).encrypt([]byte(s))
+		if err != nil {
+			t.Fatalf("error in test: %v\n", err)
+		}
+		return b
+	}
+
+	var tests = []struct {
+		name    string
+		input   []byte
+		want    [][]string
+		wantErr error
+	}{
+		{
+			name:  "Load encrypted policy",
+			input: encrypted(key, "p, alice, domain1, data1, read"),
+			want:  [][]string{{"alice", "domain1", "data1", "read"}},
+		},
+		{
+			name:    "Load policy with error (not encrypted)",
+			input:   []byte("p, alice, domain1, data1, read"),
+			wantErr: ErrNotEncrypted,
+		},
+		{
+			name:    "Load policy with error (other key)",
+			input:   encrypted(bytes.Repeat([]byte{2}, 32), "p, alice, domain1, data1, read"),
+			wantErr: ErrDecryptionFailed,
+		},
+		{
+			name: "Load policy with error (modified)",
+			input: func() []byte {
+				b := encrypted(key, "p, alice, domain1, data1, read")
+				b[len(b)-1] ^= 1
+				return b
+			}(),
+			wantErr: ErrDecryptionFailed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         &mockBlobClient{content: test.input},
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			WithClientSideEncryption(key)(a)
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			gotErr := a.LoadPolicy(m)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("LoadPolicy() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.want, m["p"]["p"].Policy); diff != "" {
+				t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_ClientSideEncryption_Save(t *testing.T) {
+	c := &mockBlobClient{}
+	a := &Adapter{
+		c:         c,
+		container: "container",
+		blob:      "blob",
+		timeout:   time.Second * 10,
+	}
+	WithClientSideEncryption(bytes.Repeat([]byte{1}, 32))(a)
+
+	m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	m.AddPolicy("p", "p", []string{"alice", "domain1", "data1", "read"})
+	if err := a.SavePolicy(m); err != nil {
+		t.Fatalf("SavePolicy() unexpected error: %v\n", err)
+	}
+	if bytes.Contains(c.policies, []byte("alice")) {
+		t.Errorf("SavePolicy() unexpected result, policy is not encrypted: %q\n", c.policies)
+	}
+
+	m.ClearPolicy()
+	if err := a.LoadPolicy(m); err != nil {
+		t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+	}
+	want := [][]string{{"alice", "domain1", "data1", "read"}}
+	if diff := cmp.Diff(want, m["p"]["p"].Policy); diff != "" {
+		t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestAdapter_MigrateToEncryption(t *testing.T) {
+	c := &mockBlobClient{}
+	a := &Adapter{
+		c:         c,
+		container: "container",
+		blob:      "blob",
+		timeout:   time.Second * 10,
+		logger:    &mockLogger{},
+	}
+	WithClientSideEncryption(bytes.Repeat([]byte{1}, 32))(a)
+
+	m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	if err := a.LoadPolicy(m); !cmp.Equal(ErrNotEncrypted, err, cmpopts.EquateErrors()) {
+		t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := a.MigrateToEncryption(context.Background()); err != nil {
+			t.Fatalf("MigrateToEncryption() unexpected error: %v\n", err)
+		}
+	}
+	if c.uploads != 1 {
+		t.Errorf("MigrateToEncryption() unexpected uploads, want: 1, got: %d\n", c.uploads)
+	}
+
+	if err := a.LoadPolicy(m); err != nil {
+		t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+	}
+	want := [][]string{{"alice", "domain1", "data1", "read"}}
+	if diff := cmp.Diff(want, m["p"]["p"].Policy); diff != "" {
+		t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestNewAdapter_ClientSideEncryption(t *testing.T) {
+	_, gotErr := NewAdapter("account", "container", "blob", &mockCredential{}, func(a *Adapter) {
+		a.c = &mockBlobClient{}
+	}, WithClientSideEncryption([]byte("short")))
+	if diff := cmp.Diff(ErrInvalidEncryptionKey, gotErr, cmpopts.EquateErrors()); diff != "" {
+		t.Errorf("NewAdapter() unexpected error (-want +got):\n%s\n", diff)
+	}
+}
@@ -0,0 +1,109 @@
+package blobadapter
+
+import (
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/casbin/casbin/v2"
+)
+
+// NewEnforcer returns a new casbin enforcer with the model at modelPath and
+// an adapter created with NewAdapter. Errors from creating the adapter are
+// returned unmodified, errors from creating the enforcer (including the
+// initial load of the policy) match ErrEnforcer.
+func NewEnforcer(modelPath string, account, container, blob string, cred azcore.TokenCredential, options ...Option) (*casbin.Enforcer, error) {
+	a, err := NewAdapter(account, container, blob, cred, options...)
+	if err != nil {
+		return nil, err
+	}
+	return newEnforcer(modelPath, a)
+}
+
+// NewEnforcerFromConnectionString returns a new casbin enforcer with the model
+// at modelPath and an adapter created with NewAdapterFromConnectionString. Errors
+// are returned the same way as NewEnforcer.
+func NewEnforcerFromConnectionString(modelPath string, connectionString, container, blob string, options ...Option) (*casbin.Enforcer, error) {
+	a, err := NewAdapterFromConnectionString(connectionString, container, blob, options...)
+	if err != nil {
+		return nil, err
+	}
+	return newEnforcer(modelPath, a)
+}
+
+// NewEnforcerFromSharedKeyCredential returns a new casbin enforcer with the model
+// at modelPath and an adapter created with NewAdapterFromSharedKeyCredential. Errors
+// are returned the same way as NewEnforcer.
+func NewEnforcerFromSharedKeyCredential(modelPath string, account, key, container, blob string, options ...Option) (*casbin.Enforcer, error) {
+	a, err := NewAdapterFromSharedKeyCredential(account, key, container, blob, options...)
+	if err != nil {
+		return nil, err
+	}
+	return newEnforcer(modelPath, a)
+}
+
+// NewSyncedEnforcer returns a new casbin synced enforcer, safe for concurrent
+// use, with the model at modelPath and an adapter created with NewAdapter.
+// Errors are returned the same way as NewEnforcer.
+func NewSyncedEnforcer(modelPath string, account, container, blob string, cred azcore.TokenCredential, options ...Option) (*casbin.SyncedEnforcer, error) {
+	a, err := NewAdapter(account, container, blob, cred, options...)
+	if err != nil {
+		return nil, err
+	}
+	return newSyncedEnforcer(modelPath, a)
+}
+
+// NewSyncedEnforcerFromConnectionString returns a new casbin synced enforcer with
+// the model at modelPath and an adapter created with NewAdapterFromConnectionString.
+// Errors are returned the same way as NewEnforcer.
+func NewSyncedEnforcerFromConnectionString(modelPath string, connectionString, container, blob string, options ...Option) (*casbin.SyncedEnforcer, error) {
+	a, err := NewAdapterFromConnectionString(connectionString, container, blob, options...)
+	if err != nil {
+		return nil, err
+	}
+	return newSyncedEnforcer(modelPath, a)
+}
+
+// NewSyncedEnforcerFromSharedKeyCredential returns a new casbin synced enforcer with
+// the model at modelPath and an adapter created with NewAdapterFromSharedKeyCredential.
+// Errors are returned the same way as NewEnforcer.
+func NewSyncedEnforcerFromSharedKeyCredential(modelPath string, account, key, container, blob string, options ...Option) (*casbin.SyncedEnforcer, error) {
+	a, err := NewAdapterFromSharedKeyCredential(account, key, container, blob, options...)
+	if err != nil {
+		return nil, err
+	}
+	return newSyncedEnforcer(modelPath, a)
+}
+
+// NewEnforcerFromBlobs returns a new casbin enforcer with the model loaded from the
+// blob modelBlob with LoadModel and an adapter for the blob policyBlob created with
+// NewAdapter. Both blobs are in the same container. A missing model blob returns
+// ErrModelDoesNotExist, other errors are returned the same way as NewEnforcer.
+func NewEnforcerFromBlobs(account, container, modelBlob, policyBlob string, cred azcore.TokenCredential, options ...Option) (*casbin.Enforcer, error) {
+	a, err := NewAdapter(account, container, policyBlob, cred, options...)
+	if err != nil {
+		return nil, err
+	}
+	m, err := a.LoadModel(a.baseContext(), modelBlob)
+	if err != nil {
+		return nil, err
+	}
+	return newEnforcer(m, a)
+}
+
+// newEnforcer returns a new enforcer with the model and the adapter. The model
+// is either a path to a model file or a model.Model.
+func newEnforcer(model interface{}, a *Adapter) (*casbin.Enforcer, error) {
+	e, err := casbin.NewEnforcer(model, a)
+	if err != nil {
+		return nil, newWrappedError(ErrEnforcer, err)
+	}
+	return e, nil
+}
+
+// newSyncedEnforcer returns a new synced enforcer with the model at modelPath and
+// the adapter.
+func newSyncedEnforcer(modelPath string, a *Adapter) (*casbin.SyncedEnforcer, error) {
+	e, err := casbin.NewSyncedEnforcer(modelPath, a)
+	if err != nil {
+		return nil, newWrappedError(ErrEnforcer, err)
+	}
+	return e, nil
+}
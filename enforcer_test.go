@@ -0,0 +1,185 @@
+package blobadapter
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestNewEnforcer(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			modelPath string
+			account   string
+			cred      azcore.TokenCredential
+			client    *mockBlobClient
+		}
+		want       [][]string
+		wantErr    error
+		notWantErr error
+	}{
+		{
+			name: "Create a new enforcer",
+			input: struct {
+				modelPath string
+				account   string
+				cred      azcore.TokenCredential
+				client    *mockBlobClient
+			}{
+				modelPath: "_examples/rbac_with_domains_model.conf",
+				account:   "account",
+				cred:      &mockCredential{},
+				client: &mockBlobClient{
+					containerFound: true,
+					blobFound:      true,
+				},
+			},
+			want: [][]string{
+				{"alice", "domain1", "data1", "read"},
+			},
+		},
+		{
+			name: "Create a new enforcer with error (adapter)",
+			input: struct {
+				modelPath string
+				account   string
+				cred      azcore.TokenCredential
+				client    *mockBlobClient
+			}{
+				modelPath: "_examples/rbac_with_domains_model.conf",
+				account:   "",
+				cred:      &mockCredential{},
+				client:    &mockBlobClient{},
+			},
+			wantErr:    ErrInvalidAccount,
+			notWantErr: ErrEnforcer,
+		},
+		{
+			name: "Create a new enforcer with error (model)",
+			input: struct {
+				modelPath string
+				account   string
+				cred      azcore.TokenCredential
+				client    *mockBlobClient
+			}{
+				modelPath: "_examples/missing.conf",
+				account:   "account",
+				cred:      &mockCredential{},
+				client:    &mockBlobClient{},
+			},
+			wantErr: ErrEnforcer,
+		},
+		{
+			name: "Create a new enforcer with error (load policy)",
+			input: struct {
+				modelPath string
+				account   string
+				cred      azcore.TokenCredential
+				client    *mockBlobClient
+			}{
+				modelPath: "_examples/rbac_with_domains_model.conf",
+				account:   "account",
+				cred:      &mockCredential{},
+				client: &mockBlobClient{
+					containerFound: true,
+					blobFound:      true,
+					errDownload:    errTest,
+				},
+			},
+			wantErr: ErrEnforcer,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setClient := func(a *Adapter) {
+				a.c = test.input.client
+			}
+
+			got, gotErr := NewEnforcer(test.input.modelPath, test.input.account, "container", "blob", test.input.cred, setClient)
+			if gotErr == nil {
+				if diff := cmp.Diff(test.want, got.GetPolicy()); diff != "" {
+					t.Errorf("NewEnforcer() unexpected result (-want +got):\n%s\n", diff)
+				}
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("NewEnforcer() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if test.notWantErr != nil && errors.Is(gotErr, test.notWantErr) {
+				t.Errorf("NewEnforcer() unexpected error match %v: %v\n", test.notWantErr, gotErr)
+			}
+
+			gotSynced, gotErr := NewSyncedEnforcer(test.input.modelPath, test.input.account, "container", "blob", test.input.cred, setClient)
+			if gotErr == nil {
+				if diff := cmp.Diff(test.want, gotSynced.GetPolicy()); diff != "" {
+					t.Errorf("NewSyncedEnforcer() unexpected result (-want +got):\n%s\n", diff)
+				}
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("NewSyncedEnforcer() unexpected error (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestNewEnforcerFromBlobs(t *testing.T) {
+	modelData, err := os.ReadFile("_examples/rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+
+	var tests = []struct {
+		name    string
+		input   *mockBlobClient
+		want    [][]string
+		wantErr error
+	}{
+		{
+			name: "Create a new enforcer from blobs",
+			input: &mockBlobClient{
+				containerFound: true,
+				blobFound:      true,
+				blobs:          map[string][]byte{"model.conf": modelData},
+			},
+			want: [][]string{
+				{"alice", "domain1", "data1", "read"},
+			},
+		},
+		{
+			name: "Create a new enforcer from blobs with error (model does not exist)",
+			input: &mockBlobClient{
+				containerFound: true,
+				blobFound:      true,
+				errDownload: &azcore.ResponseError{
+					ErrorCode: string(bloberror.BlobNotFound),
+				},
+			},
+			wantErr: ErrModelDoesNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, gotErr := NewEnforcerFromBlobs("account", "container", "model.conf", "blob", &mockCredential{}, func(a *Adapter) {
+				a.c = test.input
+			})
+			if gotErr == nil {
+				if diff := cmp.Diff(test.want, got.GetPolicy()); diff != "" {
+					t.Errorf("NewEnforcerFromBlobs() unexpected result (-want +got):\n%s\n", diff)
+				}
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("NewEnforcerFromBlobs() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if errors.Is(gotErr, ErrBlobDoesNotExist) {
+				t.Errorf("NewEnforcerFromBlobs() unexpected error match %v: %v\n", ErrBlobDoesNotExist, gotErr)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package blobadapter
 
 import (
 	"errors"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 )
 
 var (
@@ -9,6 +11,8 @@ var (
 	ErrInvalidAccount = errors.New("invalid account")
 	// ErrInvalidCredential is returned when the credentials are invald.
 	ErrInvalidCredential = errors.New("invalid credentials")
+	// ErrInvalidClient is returned when the client is invalid.
+	ErrInvalidClient = errors.New("invalid client")
 	// ErrInvalidConnectionString is returned when the connection string is invalid.
 	ErrInvalidConnectionString = errors.New("invalid connection string")
 	// ErrInvalidKey is returned when the key is invalid.
@@ -21,4 +25,244 @@ var (
 	ErrContainerDoesNotExist = errors.New("container does not exist")
 	// ErrBlobDoesNotExist is returned when the blob does not exist.
 	ErrBlobDoesNotExist = errors.New("blob does not exist")
+	// ErrBlobIsDirectory is returned when the blob path is a directory on an account
+	// with hierarchical namespace.
+	ErrBlobIsDirectory = errors.New("blob is a directory")
+	// ErrImmutable is returned when the blob cannot be modified due to an
+	// immutability policy or legal hold.
+	ErrImmutable = errors.New("blob is immutable")
+	// ErrInvalidPolicy is returned when policy data does not parse.
+	ErrInvalidPolicy = errors.New("invalid policy")
+	// ErrSaveVerificationFailed is returned when a saved blob does not match
+	// the uploaded content.
+	ErrSaveVerificationFailed = errors.New("save verification failed")
+	// ErrModelDoesNotExist is returned when the blob of the model does not exist.
+	ErrModelDoesNotExist = errors.New("model does not exist")
+	// ErrBackupDoesNotExist is returned when the backup blob does not exist.
+	ErrBackupDoesNotExist = errors.New("backup does not exist")
+	// ErrEnforcer is returned when the enforcer cannot be created.
+	ErrEnforcer = errors.New("could not create enforcer")
+	// ErrBlobTooLarge is returned when the policy blob or the serialized policy
+	// exceeds the size set with WithMaxBlobSize.
+	ErrBlobTooLarge = errors.New("blob is too large")
+	// ErrPolicyTooLarge is returned when the policy blob that is loaded exceeds
+	// the size set with WithMaxPolicySize or the number of rules set with
+	// WithMaxRules.
+	ErrPolicyTooLarge = errors.New("policy is too large")
+	// ErrChecksumMismatch is returned when the checksum of a loaded policy blob
+	// does not match the checksum stored in its metadata, or none is stored.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrSignatureInvalid is returned when the signature stored in the metadata
+	// of a loaded policy blob is missing or does not match its content with any
+	// of the keys set with WithSigningKey.
+	ErrSignatureInvalid = errors.New("signature is invalid")
+	// ErrInvalidEncryptionKey is returned when the key set with
+	// WithClientSideEncryption is not a 32 byte AES-256 key.
+	ErrInvalidEncryptionKey = errors.New("invalid encryption key")
+	// ErrNotEncrypted is returned when a policy blob loaded with
+	// WithClientSideEncryption is not encrypted, e.g. because it was saved
+	// before the encryption was enabled.
+	ErrNotEncrypted = errors.New("policy is not encrypted")
+	// ErrDecryptionFailed is returned when a policy blob loaded with
+	// WithClientSideEncryption cannot be decrypted with the key, e.g. because
+	// it was encrypted with another key or has been modified.
+	ErrDecryptionFailed = errors.New("decryption failed")
+	// ErrInvalidKeyURL is returned when the URL of the Key Vault key set with
+	// WithKeyVaultEncryption is not the URL of a key.
+	ErrInvalidKeyURL = errors.New("invalid key URL")
+	// ErrSecondaryNotAvailable wraps the errors of reads from the secondary
+	// endpoint with WithSecondaryReads when the container or blob is not yet
+	// replicated to it.
+	ErrSecondaryNotAvailable = errors.New("not available on secondary endpoint")
+	// ErrInvalidServiceAPIVersion is returned when the service API version set
+	// with WithServiceAPIVersion is malformed or not supported by the storage.
+	ErrInvalidServiceAPIVersion = errors.New("invalid service API version")
+	// ErrReadOnly is returned by write operations of an adapter created with
+	// WithReadOnly.
+	ErrReadOnly = errors.New("adapter is read-only")
+	// ErrFilteredPolicy is returned when saving the policy after it was loaded
+	// with a filter.
+	ErrFilteredPolicy = errors.New("cannot save a filtered policy")
+	// ErrNoWriter is returned by the writes of a MultiAdapter without a writer.
+	ErrNoWriter = errors.New("no writer")
+	// ErrPolicyModifiedSinceLoad is returned when saving the policy with
+	// stale-write protection after the blob was modified since it was loaded.
+	ErrPolicyModifiedSinceLoad = errors.New("policy modified since load")
+	// ErrPermissionDenied is returned when the credential of the adapter is not
+	// authorized to make a request to the storage.
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrCredentialFailure is returned when a token cannot be acquired with the
+	// credential of the adapter, e.g. because the identity is misconfigured or
+	// lacks the scope, before a request is made to the storage.
+	ErrCredentialFailure = errors.New("credential failure")
+	// ErrBlobHasSnapshots is returned with WithIncludeSnapshots when the blob does
+	// not exist but has snapshots or previous versions that it can be recovered
+	// from.
+	ErrBlobHasSnapshots = errors.New("blob does not exist but has snapshots or versions")
+)
+
+// wrappedError is an error that matches a sentinel error with errors.Is
+// while keeping the underlying cause available for errors.As and errors.Unwrap.
+type wrappedError struct {
+	sentinel error
+	err      error
+}
+
+// newWrappedError returns a new error that matches sentinel and wraps err.
+func newWrappedError(sentinel, err error) error {
+	return &wrappedError{sentinel: sentinel, err: err}
+}
+
+// Error returns the error message of the sentinel followed by the message of the cause.
+func (e *wrappedError) Error() string {
+	return e.sentinel.Error() + ": " + e.err.Error()
+}
+
+// Is reports whether target is the sentinel of the error.
+func (e *wrappedError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+// Unwrap returns the underlying cause.
+func (e *wrappedError) Unwrap() error {
+	return e.err
+}
+
+// The steps of the initialization of the adapter identified by InitError.
+const (
+	// InitStepListContainers is the listing of the containers to find the
+	// container of the adapter.
+	InitStepListContainers = "list_containers"
+	// InitStepCreateContainer is the creation of the container.
+	InitStepCreateContainer = "create_container"
+	// InitStepListBlobs is the listing of the blobs to find the blob of the
+	// adapter.
+	InitStepListBlobs = "list_blobs"
+	// InitStepCreateBlob is the creation of the blob with its initial content.
+	InitStepCreateBlob = "create_blob"
+	// InitStepCheckExists is the check that the container and blob exist with
+	// WithNoCreate, or that the blob exists with WithHierarchicalNamespace.
+	InitStepCheckExists = "check_exists"
+)
+
+// InitError is returned when creating the container or blob of the adapter fails
+// on initialization or with EnsureResources. It identifies the step that failed,
+// and the error of the step is matched by errors.Is and errors.As.
+type InitError struct {
+	// Step is the step that failed, e.g. InitStepCreateBlob.
+	Step string
+	// Err is the error of the step.
+	Err error
+}
+
+// newInitError returns err wrapped in an InitError for step.
+func newInitError(step string, err error) error {
+	return &InitError{Step: step, Err: err}
+}
+
+// Error returns the error message.
+func (e *InitError) Error() string {
+	return "init " + e.Step + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error of the step.
+func (e *InitError) Unwrap() error {
+	return e.Err
+}
+
+// StorageError is returned when a request to the storage fails. It wraps the
+// error of the request and exposes the details needed to trace the request
+// with Azure support. If the failure maps to one of the sentinel errors of the
+// package, like ErrBlobDoesNotExist, the error matches it with errors.Is.
+type StorageError struct {
+	// Err is the error returned by the storage request.
+	Err      error
+	sentinel error
+	detail   string
+}
+
+// newStorageError returns err wrapped in a StorageError. If err already is a
+// StorageError it is returned as is.
+func newStorageError(err error) error {
+	return newStorageErrorWithSentinel(err, nil, "")
+}
+
+// newStorageErrorWithSentinel returns err wrapped in a StorageError that matches
+// sentinel. The message of the error is the message of the sentinel followed
+// by detail, or by the message of err if detail is empty.
+func newStorageErrorWithSentinel(err, sentinel error, detail string) error {
+	if err == nil {
+		return nil
+	}
+	var serr *StorageError
+	if sentinel == nil && errors.As(err, &serr) {
+		return err
+	}
+	redactURLError(err)
+	return &StorageError{Err: err, sentinel: sentinel, detail: detail}
+}
+
+// Error returns the error message. Secrets like the signature of a SAS are
+// redacted.
+func (e *StorageError) Error() string {
+	if e.sentinel == nil {
+		return redact(e.Err.Error())
+	}
+	if len(e.detail) > 0 {
+		return e.sentinel.Error() + ": " + e.detail
+	}
+	return e.sentinel.Error() + ": " + redact(e.Err.Error())
+}
+
+// Is reports whether target is the sentinel error the storage error maps to.
+func (e *StorageError) Is(target error) bool {
+	return e.sentinel != nil && target == e.sentinel
+}
+
+// Unwrap returns the error returned by the storage request.
+func (e *StorageError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns the HTTP status code of the response, or 0 if no
+// response was received.
+func (e *StorageError) StatusCode() int {
+	if resErr := e.responseError(); resErr != nil {
+		return resErr.StatusCode
+	}
+	return 0
+}
+
+// ErrorCode returns the error code of the storage service (e.g. BlobNotFound),
+// or an empty string if no response was received.
+func (e *StorageError) ErrorCode() string {
+	if resErr := e.responseError(); resErr != nil {
+		return resErr.ErrorCode
+	}
+	return ""
+}
+
+// RequestID returns the request ID (x-ms-request-id) of the response, or an
+// empty string if no response was received.
+func (e *StorageError) RequestID() string {
+	if resErr := e.responseError(); resErr != nil && resErr.RawResponse != nil {
+		return resErr.RawResponse.Header.Get(headerRequestID)
+	}
+	return ""
+}
+
+// responseError returns the azcore.ResponseError wrapped by the error, if any.
+func (e *StorageError) responseError() *azcore.ResponseError {
+	var resErr *azcore.ResponseError
+	if errors.As(e.Err, &resErr) {
+		return resErr
+	}
+	return nil
+}
+
+// headerRequestID and headerClientRequestID are the response headers
+// containing the request ID and client request ID of a storage request.
+const (
+	headerRequestID       = "x-ms-request-id"
+	headerClientRequestID = "x-ms-client-request-id"
 )
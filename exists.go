@@ -0,0 +1,47 @@
+package blobadapter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+)
+
+// Exists reports whether the container and the blob of the adapter exist, without
+// creating them or loading the policy. It makes a single request for the properties
+// of the blob, and the storage reports whether it is the container or the blob that
+// is missing. If the credential of the adapter is not permitted to read the blob
+// ErrPermissionDenied is returned, so that it is not mistaken for a missing blob.
+func (a *Adapter) Exists(ctx context.Context) (containerExists bool, blobExists bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	a.requests.add(operationOther)
+	var raw *http.Response
+	props, err := a.c.GetProperties(captureResponse(ctx, &raw), a.container, a.blob, nil)
+	a.recordOperation(operationInfoProperties, raw, props.RequestID, props.ClientRequestID, err)
+	if err == nil {
+		return true, true, nil
+	}
+	switch {
+	case bloberror.HasCode(err, bloberror.ContainerNotFound):
+		return false, false, nil
+	case bloberror.HasCode(err, bloberror.BlobNotFound):
+		return true, false, nil
+	case isPermissionError(err):
+		return false, false, newStorageErrorWithSentinel(err, ErrPermissionDenied, "")
+	}
+	return false, false, newStorageError(err)
+}
+
+// isPermissionError reports whether err is a response of the storage refusing
+// the request because the credential is not authorized to make it.
+func isPermissionError(err error) bool {
+	var resErr *azcore.ResponseError
+	if errors.As(err, &resErr) && resErr.StatusCode == http.StatusForbidden {
+		return true
+	}
+	return bloberror.HasCode(err, bloberror.AuthorizationFailure, bloberror.AuthorizationPermissionMismatch, bloberror.InsufficientAccountPermissions)
+}
@@ -0,0 +1,70 @@
+package blobadapter
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_Exists(t *testing.T) {
+	var tests = []struct {
+		name          string
+		input         error
+		wantContainer bool
+		wantBlob      bool
+		wantErr       error
+	}{
+		{
+			name:          "Container and blob exist",
+			wantContainer: true,
+			wantBlob:      true,
+		},
+		{
+			name:          "Blob does not exist",
+			input:         &azcore.ResponseError{StatusCode: http.StatusNotFound, ErrorCode: string(bloberror.BlobNotFound)},
+			wantContainer: true,
+		},
+		{
+			name:  "Container does not exist",
+			input: &azcore.ResponseError{StatusCode: http.StatusNotFound, ErrorCode: string(bloberror.ContainerNotFound)},
+		},
+		{
+			name:    "Exists with error (permission denied)",
+			input:   &azcore.ResponseError{StatusCode: http.StatusForbidden, ErrorCode: string(bloberror.AuthorizationPermissionMismatch)},
+			wantErr: ErrPermissionDenied,
+		},
+		{
+			name:    "Exists with error",
+			input:   errTest,
+			wantErr: errTest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         &mockBlobClient{errProperties: test.input},
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+
+			gotContainer, gotBlob, gotErr := a.Exists(context.Background())
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Exists() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantContainer, gotContainer); diff != "" {
+				t.Errorf("Exists() unexpected container existence (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantBlob, gotBlob); diff != "" {
+				t.Errorf("Exists() unexpected blob existence (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
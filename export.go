@@ -0,0 +1,100 @@
+package blobadapter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// ExportToWriter downloads the policy blob and copies its content to w as it is
+// downloaded, without holding the full policy in memory.
+func (a *Adapter) ExportToWriter(ctx context.Context, w io.Writer) error {
+	return a.readPolicyBlob(ctx, func(r io.Reader, _ int64) error {
+		_, err := io.Copy(w, r)
+		return err
+	})
+}
+
+// LoadPolicyBytes reads the content of the policy blob into buf. See
+// LoadPolicyBytesCtx.
+func (a *Adapter) LoadPolicyBytes(buf []byte) (int, error) {
+	return a.LoadPolicyBytesCtx(a.baseContext(), buf)
+}
+
+// LoadPolicyBytesCtx reads the content of the policy blob into buf with context
+// and returns the number of bytes read. It is meant for frequent reloads that
+// reuse buf between calls to avoid allocations, the content is not parsed. If the
+// blob does not fit in buf an error matching io.ErrShortBuffer is returned, with
+// the size of the blob if it is known.
+func (a *Adapter) LoadPolicyBytesCtx(ctx context.Context, buf []byte) (int, error) {
+	var n int
+	err := a.readPolicyBlob(ctx, func(r io.Reader, size int64) error {
+		if size > int64(len(buf)) {
+			return fmt.Errorf("%w: blob is %d bytes, buffer is %d bytes", io.ErrShortBuffer, size, len(buf))
+		}
+		var err error
+		if n, err = io.ReadFull(r, buf); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		var b [1]byte
+		if m, _ := r.Read(b[:]); m > 0 {
+			return fmt.Errorf("%w: blob is larger than buffer of %d bytes", io.ErrShortBuffer, len(buf))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// readPolicyBlob downloads the policy blob and calls fn with the body as it is
+// downloaded and the content length of the blob, or -1 if it is not known.
+func (a *Adapter) readPolicyBlob(ctx context.Context, fn func(r io.Reader, size int64) error) error {
+	if err := checkContainerBlobArguments(a.container, a.blob); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	a.requests.add(operationDownload)
+	var raw *http.Response
+	res, err := a.c.DownloadStream(captureResponse(ctx, &raw), a.container, a.blob, a.downloadStreamOptions(nil))
+	a.recordOperation(operationInfoDownload, raw, res.RequestID, res.ClientRequestID, err)
+	if err != nil {
+		return a.downloadError(err, a.blob)
+	}
+	body := a.downloadBody(ctx, &res)
+	defer body.Close()
+
+	if a.hierarchicalNamespace && isDirectory(res.Metadata) {
+		return fmt.Errorf("%w: %s", ErrBlobIsDirectory, a.blob)
+	}
+
+	size := int64(-1)
+	if res.ContentLength != nil {
+		size = *res.ContentLength
+	}
+	return fn(body, size)
+}
+
+// ExportToFile exports the policy blob to the file at path with ExportToWriter.
+// The file is created or truncated, and removed if the export fails.
+func (a *Adapter) ExportToFile(ctx context.Context, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := a.ExportToWriter(ctx, f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,192 @@
+package blobadapter
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_ExportToWriter(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   *mockBlobClient
+		want    string
+		wantErr error
+	}{
+		{
+			name: "Export policy",
+			input: &mockBlobClient{
+				content: []byte("p, alice, domain1, data1, read\n# comment\ng, alice, admin, domain1\n"),
+			},
+			want: "p, alice, domain1, data1, read\n# comment\ng, alice, admin, domain1\n",
+		},
+		{
+			name: "Export policy with error (blob does not exist)",
+			input: &mockBlobClient{
+				errDownload: &azcore.ResponseError{
+					ErrorCode: string(bloberror.BlobNotFound),
+				},
+			},
+			want:    "",
+			wantErr: ErrBlobDoesNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         test.input,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+
+			var buf bytes.Buffer
+			gotErr := a.ExportToWriter(context.Background(), &buf)
+			if diff := cmp.Diff(test.want, buf.String()); diff != "" {
+				t.Errorf("ExportToWriter() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("ExportToWriter() unexpected error (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_ExportToFile(t *testing.T) {
+	var tests = []struct {
+		name     string
+		input    *mockBlobClient
+		want     string
+		wantFile bool
+		wantErr  error
+	}{
+		{
+			name:     "Export policy to file",
+			input:    &mockBlobClient{},
+			want:     "p, alice, domain1, data1, read",
+			wantFile: true,
+		},
+		{
+			name:     "Export policy to file with error",
+			input:    &mockBlobClient{errDownload: errTest},
+			wantFile: false,
+			wantErr:  errTest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         test.input,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			path := filepath.Join(t.TempDir(), "policy.csv")
+
+			gotErr := a.ExportToFile(context.Background(), path)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("ExportToFile() unexpected error (-want +got):\n%s\n", diff)
+			}
+
+			got, err := os.ReadFile(path)
+			if diff := cmp.Diff(test.wantFile, err == nil); diff != "" {
+				t.Fatalf("ExportToFile() unexpected file existence (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.want, string(got)); diff != "" {
+				t.Errorf("ExportToFile() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_LoadPolicyBytesCtx(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			c    *mockBlobClient
+			size int
+		}
+		want    string
+		wantErr error
+	}{
+		{
+			name: "Load policy bytes",
+			input: struct {
+				c    *mockBlobClient
+				size int
+			}{
+				c:    &mockBlobClient{},
+				size: 64,
+			},
+			want: "p, alice, domain1, data1, read",
+		},
+		{
+			name: "Load policy bytes with buffer of blob size",
+			input: struct {
+				c    *mockBlobClient
+				size int
+			}{
+				c:    &mockBlobClient{},
+				size: 30,
+			},
+			want: "p, alice, domain1, data1, read",
+		},
+		{
+			name: "Load policy bytes with error (short buffer)",
+			input: struct {
+				c    *mockBlobClient
+				size int
+			}{
+				c:    &mockBlobClient{},
+				size: 16,
+			},
+			wantErr: io.ErrShortBuffer,
+		},
+		{
+			name: "Load policy bytes with error (blob does not exist)",
+			input: struct {
+				c    *mockBlobClient
+				size int
+			}{
+				c: &mockBlobClient{
+					errDownload: &azcore.ResponseError{
+						ErrorCode: string(bloberror.BlobNotFound),
+					},
+				},
+				size: 64,
+			},
+			wantErr: ErrBlobDoesNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         test.input.c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+
+			buf := make([]byte, test.input.size)
+			n, gotErr := a.LoadPolicyBytesCtx(context.Background(), buf)
+			if diff := cmp.Diff(test.want, string(buf[:n])); diff != "" {
+				t.Errorf("LoadPolicyBytesCtx() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("LoadPolicyBytesCtx() unexpected error (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package blobadapter
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// Classes of the failures counted by the failures variable of WithExpvar.
+const (
+	failureClassNotFound      = "not_found"
+	failureClassPermission    = "permission_denied"
+	failureClassCredential    = "credential"
+	failureClassModified      = "modified"
+	failureClassTooLarge      = "too_large"
+	failureClassInvalidPolicy = "invalid_policy"
+	failureClassIntegrity     = "integrity"
+	failureClassReadOnly      = "read_only"
+	failureClassThrottled     = "throttled"
+	failureClassTimeout       = "timeout"
+	failureClassCanceled      = "canceled"
+	failureClassStorage       = "storage"
+	failureClassOther         = "other"
+)
+
+// adapterVars are the variables published with WithExpvar. They are shared by
+// the adapters created with the same prefix, and are safe for concurrent use.
+type adapterVars struct {
+	loads            expvar.Int
+	saves            expvar.Int
+	loadFailures     expvar.Int
+	saveFailures     expvar.Int
+	failures         expvar.Map
+	lastETag         expvar.String
+	lastLoadDuration expvar.Float
+	lastSaveDuration expvar.Float
+}
+
+var (
+	// publishedVarsMu protects publishedVars, the variables published with
+	// WithExpvar by prefix.
+	publishedVarsMu sync.Mutex
+	publishedVars   = make(map[string]*adapterVars)
+)
+
+// publishVars returns the variables published under prefix, and publishes them
+// if they have not been published before. expvar panics if a name is published
+// twice, so the variables are published once per prefix and shared after that.
+// If prefix is used by a variable that was published by others the variables
+// are not published, but still updated.
+func publishVars(prefix string) *adapterVars {
+	publishedVarsMu.Lock()
+	defer publishedVarsMu.Unlock()
+	if v, ok := publishedVars[prefix]; ok {
+		return v
+	}
+
+	v := &adapterVars{}
+	v.failures.Init()
+	if expvar.Get(prefix) == nil {
+		m := expvar.NewMap(prefix)
+		m.Set("loads", &v.loads)
+		m.Set("saves", &v.saves)
+		m.Set("load_failures", &v.loadFailures)
+		m.Set("save_failures", &v.saveFailures)
+		m.Set("failures", &v.failures)
+		m.Set("last_etag", &v.lastETag)
+		m.Set("last_load_duration_seconds", &v.lastLoadDuration)
+		m.Set("last_save_duration_seconds", &v.lastSaveDuration)
+	}
+	publishedVars[prefix] = v
+	return v
+}
+
+// recordLoad updates the variables after a load of the policy that took d and
+// failed with err, or succeeded with the blob at etag if err is nil.
+func (v *adapterVars) recordLoad(d time.Duration, etag azcore.ETag, err error) {
+	v.loads.Add(1)
+	v.lastLoadDuration.Set(d.Seconds())
+	if err != nil {
+		v.loadFailures.Add(1)
+		v.failures.Add(failureClass(err), 1)
+		return
+	}
+	v.lastETag.Set(string(etag))
+}
+
+// recordSave updates the variables after a save of the policy that took d and
+// failed with err, or succeeded with the blob at etag if err is nil.
+func (v *adapterVars) recordSave(d time.Duration, etag azcore.ETag, err error) {
+	v.saves.Add(1)
+	v.lastSaveDuration.Set(d.Seconds())
+	if err != nil {
+		v.saveFailures.Add(1)
+		v.failures.Add(failureClass(err), 1)
+		return
+	}
+	if len(etag) > 0 {
+		v.lastETag.Set(string(etag))
+	}
+}
+
+// failureClass returns the class of the failure err, by the sentinel errors it
+// matches or the kind of error it is.
+func failureClass(err error) string {
+	var serr *StorageError
+	switch {
+	case errors.Is(err, ErrContainerDoesNotExist), errors.Is(err, ErrBlobDoesNotExist):
+		return failureClassNotFound
+	case errors.Is(err, ErrPermissionDenied), isPermissionError(err):
+		return failureClassPermission
+	case errors.Is(err, ErrCredentialFailure), errors.Is(err, ErrInvalidCredential):
+		return failureClassCredential
+	case errors.Is(err, ErrPolicyModifiedSinceLoad):
+		return failureClassModified
+	case errors.Is(err, ErrPolicyTooLarge), errors.Is(err, ErrBlobTooLarge):
+		return failureClassTooLarge
+	case errors.Is(err, ErrInvalidPolicy):
+		return failureClassInvalidPolicy
+	case errors.Is(err, ErrChecksumMismatch), errors.Is(err, ErrSignatureInvalid), errors.Is(err, ErrDecryptionFailed), errors.Is(err, ErrSaveVerificationFailed):
+		return failureClassIntegrity
+	case errors.Is(err, ErrReadOnly), errors.Is(err, ErrImmutable), errors.Is(err, ErrFilteredPolicy):
+		return failureClassReadOnly
+	case errors.Is(err, context.DeadlineExceeded):
+		return failureClassTimeout
+	case errors.Is(err, context.Canceled):
+		return failureClassCanceled
+	}
+	if _, _, ok := throttled(err); ok {
+		return failureClassThrottled
+	}
+	if errors.As(err, &serr) {
+		return failureClassStorage
+	}
+	return failureClassOther
+}
@@ -0,0 +1,66 @@
+package blobadapter
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAdapter_Expvar(t *testing.T) {
+	// Variables cannot be unpublished, so the prefix is unique to each run.
+	prefix := fmt.Sprintf("blobadapter_test_%d", time.Now().UnixNano())
+	a, err := NewInMemoryAdapter(WithExpvar(prefix), WithLogger(&mockLogger{}))
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	b, err := NewInMemoryAdapter(WithExpvar(prefix), WithLogger(&mockLogger{}))
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+
+	m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	m.AddPolicy("p", "p", []string{"alice", "domain1", "data1", "read"})
+	if err := a.SavePolicy(m); err != nil {
+		t.Fatalf("SavePolicy() unexpected error: %v\n", err)
+	}
+	if err := b.LoadPolicy(m); err != nil {
+		t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+	}
+	c := a.c.(*memoryClient)
+	if _, err := c.DeleteBlob(context.Background(), a.container, a.blob, nil); err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	if err := a.LoadPolicy(m); err == nil {
+		t.Fatalf("LoadPolicy() expected an error\n")
+	}
+
+	vars, ok := expvar.Get(prefix).(*expvar.Map)
+	if !ok {
+		t.Fatalf("Get() expected variables published under %s\n", prefix)
+	}
+	got := make(map[string]string)
+	for _, name := range []string{"loads", "saves", "load_failures", "save_failures", "failures"} {
+		got[name] = vars.Get(name).String()
+	}
+	want := map[string]string{
+		"loads":         "2",
+		"saves":         "1",
+		"load_failures": "1",
+		"save_failures": "0",
+		"failures":      `{"not_found": 1}`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("WithExpvar() unexpected variables (-want +got):\n%s\n", diff)
+	}
+	if got := vars.Get("last_etag").String(); got == `""` {
+		t.Errorf("WithExpvar() expected the ETag of the last load or save\n")
+	}
+}
@@ -0,0 +1,149 @@
+package blobadapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/casbin/casbin/v2/model"
+	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+)
+
+// LoadFilteredPolicy loads the policy rules that match the filter from the
+// storage. See LoadFilteredPolicyCtx.
+func (a *Adapter) LoadFilteredPolicy(m model.Model, filter interface{}) error {
+	return a.LoadFilteredPolicyCtx(a.baseContext(), m, filter)
+}
+
+// LoadFilteredPolicyCtx loads the policy rules that match the filter from the
+// storage with context. The filter is a fileadapter.Filter (or a pointer to one)
+// with the same semantics as the filtered file adapter of casbin: the fields of
+// the rules of each ptype are matched by position, and an empty value matches any
+// field. E.g. Filter{P: []string{"", "domain1"}, G: []string{"", "", "domain1"}}
+// loads the rules of domain1. A nil filter loads all rules like LoadPolicyCtx.
+//
+// The rules are filtered while the blob is streamed. If ctx is done, or the load
+// fails for another reason, the download is aborted and the error is returned;
+// the model then contains the rules that were loaded before the failure and
+// should be discarded. After a successful load IsFiltered returns true, and
+// SavePolicy returns ErrFilteredPolicy until the full policy is loaded again.
+func (a *Adapter) LoadFilteredPolicyCtx(ctx context.Context, m model.Model, filter interface{}) error {
+	if filter == nil {
+		return a.LoadPolicyCtx(ctx, m)
+	}
+	if err := checkContainerBlobArguments(a.container, a.blob); err != nil {
+		return err
+	}
+
+	var f *fileadapter.Filter
+	switch v := filter.(type) {
+	case *fileadapter.Filter:
+		f = v
+	case fileadapter.Filter:
+		f = &v
+	default:
+		return errors.New("invalid filter type")
+	}
+
+	handler, delimiter := a.policyLineHandler(), a.delimiter()
+	if err := a.loadPolicy(ctx, m, func(line string, m model.Model) error {
+		if !matchFilter(line, f, delimiter) {
+			return nil
+		}
+		return handler(line, m)
+	}, blob.HTTPRange{}); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&a.filtered, 1)
+	return nil
+}
+
+// LoadSection loads the policy rules of the section from the storage. See
+// LoadSectionCtx.
+func (a *Adapter) LoadSection(m model.Model, section string) error {
+	return a.LoadSectionCtx(a.baseContext(), m, section)
+}
+
+// LoadSectionCtx loads only the policy rules of the section, "p" for the
+// permission policies or "g" for the grouping policies, from the storage with
+// context. Lines of the other section are skipped by their ptype without being
+// parsed. As with LoadFilteredPolicyCtx, IsFiltered returns true after a successful
+// load and SavePolicy returns ErrFilteredPolicy until the full policy is loaded
+// again.
+func (a *Adapter) LoadSectionCtx(ctx context.Context, m model.Model, section string) error {
+	if section != "p" && section != "g" {
+		return fmt.Errorf("invalid section: %q", section)
+	}
+	if err := checkContainerBlobArguments(a.container, a.blob); err != nil {
+		return err
+	}
+
+	handler, delimiter := a.policyLineHandler(), a.delimiter()
+	if err := a.loadPolicy(ctx, m, func(line string, m model.Model) error {
+		if ptype := linePtype(line, delimiter); len(ptype) > 0 && ptype[:1] != section {
+			return nil
+		}
+		return handler(line, m)
+	}, blob.HTTPRange{}); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&a.filtered, 1)
+	return nil
+}
+
+// linePtype returns the ptype of the policy line, the text before the first
+// delimiter. Comments and empty lines return an empty string.
+func linePtype(line string, delimiter rune) string {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ""
+	}
+	if i := strings.IndexRune(line, delimiter); i >= 0 {
+		line = line[:i]
+	}
+	return strings.TrimSpace(line)
+}
+
+// IsFiltered returns true if the policy was last loaded with a filter.
+func (a *Adapter) IsFiltered() bool {
+	return atomic.LoadInt32(&a.filtered) == 1
+}
+
+// matchFilter reports whether the policy line, with fields separated by the
+// delimiter, matches the filter. Comments, empty lines and lines that do not
+// parse are passed on to the line handler.
+func matchFilter(line string, f *fileadapter.Filter, delimiter rune) bool {
+	tokens, err := parseRuleLine(line, delimiter)
+	if err != nil || tokens == nil {
+		return true
+	}
+
+	var fields []string
+	switch tokens[0] {
+	case "p":
+		fields = f.P
+	case "g":
+		fields = f.G
+	case "g1":
+		fields = f.G1
+	case "g2":
+		fields = f.G2
+	case "g3":
+		fields = f.G3
+	case "g4":
+		fields = f.G4
+	case "g5":
+		fields = f.G5
+	}
+	if len(tokens) < len(fields)+1 {
+		return false
+	}
+	for i, v := range fields {
+		if len(v) > 0 && v != tokens[i+1] {
+			return false
+		}
+	}
+	return true
+}
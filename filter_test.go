@@ -0,0 +1,196 @@
+package blobadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_LoadFilteredPolicyCtx(t *testing.T) {
+	content := []byte("p, alice, domain1, data1, read\np, bob, domain2, data2, write\ng, alice, admin, domain1\ng, bob, admin, domain2\n")
+
+	var tests = []struct {
+		name         string
+		input        interface{}
+		want         [][]string
+		wantGroup    [][]string
+		wantFiltered bool
+		wantErr      error
+	}{
+		{
+			name:  "Load filtered policy",
+			input: &fileadapter.Filter{P: []string{"", "domain1"}, G: []string{"", "", "domain1"}},
+			want: [][]string{
+				{"alice", "domain1", "data1", "read"},
+			},
+			wantGroup: [][]string{
+				{"alice", "admin", "domain1"},
+			},
+			wantFiltered: true,
+		},
+		{
+			name:  "Load filtered policy with filter value",
+			input: fileadapter.Filter{P: []string{"bob"}},
+			want: [][]string{
+				{"bob", "domain2", "data2", "write"},
+			},
+			wantGroup: [][]string{
+				{"alice", "admin", "domain1"},
+				{"bob", "admin", "domain2"},
+			},
+			wantFiltered: true,
+		},
+		{
+			name:  "Load filtered policy without filter",
+			input: nil,
+			want: [][]string{
+				{"alice", "domain1", "data1", "read"},
+				{"bob", "domain2", "data2", "write"},
+			},
+			wantGroup: [][]string{
+				{"alice", "admin", "domain1"},
+				{"bob", "admin", "domain2"},
+			},
+		},
+		{
+			name:    "Load filtered policy with error (invalid filter type)",
+			input:   []string{"domain1"},
+			wantErr: cmpopts.AnyError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         &mockBlobClient{content: content},
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			gotErr := a.LoadFilteredPolicyCtx(context.Background(), m, test.input)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("LoadFilteredPolicyCtx() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.want, m["p"]["p"].Policy); diff != "" {
+				t.Errorf("LoadFilteredPolicyCtx() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantGroup, m["g"]["g"].Policy); diff != "" {
+				t.Errorf("LoadFilteredPolicyCtx() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantFiltered, a.IsFiltered()); diff != "" {
+				t.Errorf("IsFiltered() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_LoadFilteredPolicyCtx_Save(t *testing.T) {
+	a := &Adapter{
+		c:         &mockBlobClient{},
+		container: "container",
+		blob:      "blob",
+		timeout:   time.Second * 10,
+	}
+
+	m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := a.LoadFilteredPolicyCtx(ctx, m, &fileadapter.Filter{P: []string{"alice"}}); err == nil {
+		t.Errorf("LoadFilteredPolicyCtx() expected error with cancelled context\n")
+	}
+	if a.IsFiltered() {
+		t.Errorf("IsFiltered() unexpected result after failed load\n")
+	}
+
+	if err := a.LoadFilteredPolicy(m, &fileadapter.Filter{P: []string{"alice"}}); err != nil {
+		t.Fatalf("LoadFilteredPolicy() unexpected error: %v\n", err)
+	}
+	if diff := cmp.Diff(ErrFilteredPolicy, a.SavePolicy(m), cmpopts.EquateErrors()); diff != "" {
+		t.Errorf("SavePolicy() unexpected error (-want +got):\n%s\n", diff)
+	}
+
+	m.ClearPolicy()
+	if err := a.LoadPolicy(m); err != nil {
+		t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+	}
+	if err := a.SavePolicy(m); err != nil {
+		t.Errorf("SavePolicy() unexpected error: %v\n", err)
+	}
+}
+
+func TestAdapter_LoadSection(t *testing.T) {
+	var tests = []struct {
+		name      string
+		input     string
+		want      [][]string
+		wantGroup [][]string
+		wantErr   bool
+	}{
+		{
+			name:  "Load permission policies",
+			input: "p",
+			want: [][]string{
+				{"alice", "domain1", "data1", "read"},
+			},
+		},
+		{
+			name:  "Load grouping policies",
+			input: "g",
+			wantGroup: [][]string{
+				{"alice", "admin", "domain1"},
+			},
+		},
+		{
+			name:    "Load section with error (invalid section)",
+			input:   "e",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c: &mockBlobClient{
+					content: []byte("# rules\np, alice, domain1, data1, read\n\ng, alice, admin, domain1"),
+				},
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			gotErr := a.LoadSection(m, test.input)
+			if test.wantErr != (gotErr != nil) {
+				t.Errorf("LoadSection() unexpected error: %v\n", gotErr)
+			}
+			if diff := cmp.Diff(test.want, m["p"]["p"].Policy); diff != "" {
+				t.Errorf("LoadSection() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantGroup, m["g"]["g"].Policy); diff != "" {
+				t.Errorf("LoadSection() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(!test.wantErr, a.IsFiltered()); diff != "" {
+				t.Errorf("IsFiltered() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
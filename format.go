@@ -0,0 +1,101 @@
+package blobadapter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Format is the format of the policy blob.
+type Format int
+
+const (
+	// FormatDefault is the format of the file adapter of casbin: one rule per
+	// line with the fields separated by a comma and a space. This is the
+	// default.
+	FormatDefault Format = iota
+	// FormatCSVWithHeader is RFC 4180 CSV with a header row (ptype,v0,v1,...).
+	// Every row has the same number of columns, rules with fewer fields are
+	// padded with empty fields, and fields are quoted when needed. Empty fields
+	// of rules are written as "" to tell them apart from padding.
+	FormatCSVWithHeader
+)
+
+// csvHeaderPtype is the name of the first column of the header row of
+// FormatCSVWithHeader.
+const csvHeaderPtype = "ptype"
+
+// writeCSV writes the rules, each starting with its ptype, to the writer in
+// FormatCSVWithHeader. Rows are separated by the line ending, without a trailing
+// line ending after the last row. Nothing is written if there are no rules.
+func writeCSV(w io.Writer, rules [][]string, lineEnding LineEnding) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	var columns int
+	for _, rule := range rules {
+		if len(rule)-1 > columns {
+			columns = len(rule) - 1
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(csvHeaderPtype)
+	for i := 0; i < columns; i++ {
+		bw.WriteString(",v" + strconv.Itoa(i))
+	}
+	sep := lineEnding.String()
+	for _, rule := range rules {
+		bw.WriteString(sep)
+		bw.WriteString(csvField(rule[0]))
+		for i := 1; i <= columns; i++ {
+			bw.WriteByte(',')
+			if i < len(rule) {
+				bw.WriteString(csvField(rule[i]))
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// csvField returns the field quoted if it is empty, contains a comma, quote or
+// line break, or has leading or trailing spaces, which would otherwise be lost
+// on load.
+func csvField(field string) string {
+	if len(field) > 0 && !strings.ContainsAny(field, ",\"\r\n") && field == strings.TrimSpace(field) {
+		return field
+	}
+	return `"` + strings.ReplaceAll(field, `"`, `""`) + `"`
+}
+
+// csvLine returns the line of a blob in FormatCSVWithHeader as a line of the
+// default format: the header row is returned as an empty line after it is
+// validated, and the padding of rows is removed.
+func csvLine(line string) (string, error) {
+	if line != csvHeaderPtype && !strings.HasPrefix(line, csvHeaderPtype+",") {
+		return strings.TrimRight(line, ","), nil
+	}
+	for i, column := range strings.Split(line, ",")[1:] {
+		if strings.TrimSpace(column) != "v"+strconv.Itoa(i) {
+			return "", fmt.Errorf("%w: invalid header: %q", ErrInvalidPolicy, line)
+		}
+	}
+	return "", nil
+}
+
+// rulesFromLines returns the rules of the lines, followed by the rules.
+func rulesFromLines(lines []string, rules [][]string) ([][]string, error) {
+	all := make([][]string, 0, len(lines)+len(rules))
+	for _, line := range lines {
+		tokens, err := parseRuleLine(line, defaultFieldDelimiter)
+		if err != nil {
+			return nil, err
+		}
+		if tokens != nil {
+			all = append(all, tokens)
+		}
+	}
+	return append(all, rules...), nil
+}
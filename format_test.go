@@ -0,0 +1,223 @@
+package blobadapter
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestWriteCSV(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			rules      [][]string
+			lineEnding LineEnding
+		}
+		want string
+	}{
+		{
+			name: "Write rules with mixed arity",
+			input: struct {
+				rules      [][]string
+				lineEnding LineEnding
+			}{
+				rules: [][]string{
+					{"p", "alice", "domain1", "data1", "read"},
+					{"g", "alice", "admin", "domain1"},
+					{"g2", "data1", "group1"},
+				},
+			},
+			want: "ptype,v0,v1,v2,v3\np,alice,domain1,data1,read\ng,alice,admin,domain1,\ng2,data1,group1,,",
+		},
+		{
+			name: "Write rules with quoted fields",
+			input: struct {
+				rules      [][]string
+				lineEnding LineEnding
+			}{
+				rules: [][]string{
+					{"p", "alice", "data,1", `say "hi"`, ""},
+					{"p", " bob", "data2"},
+				},
+				lineEnding: CRLF,
+			},
+			want: "ptype,v0,v1,v2,v3\r\np,alice,\"data,1\",\"say \"\"hi\"\"\",\"\"\r\np,\" bob\",data2,,",
+		},
+		{
+			name: "Write without rules",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeCSV(&buf, test.input.rules, test.input.lineEnding); err != nil {
+				t.Fatalf("writeCSV() unexpected error: %v\n", err)
+			}
+			if diff := cmp.Diff(test.want, buf.String()); diff != "" {
+				t.Errorf("writeCSV() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestCSVLine(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "Header",
+			input: "ptype,v0,v1,v2",
+			want:  "",
+		},
+		{
+			name:  "Row with padding",
+			input: "g,alice,admin,,",
+			want:  "g,alice,admin",
+		},
+		{
+			name:  "Row with empty quoted field",
+			input: `p,alice,"",`,
+			want:  `p,alice,""`,
+		},
+		{
+			name:    "Header with error (invalid column)",
+			input:   "ptype,v0,sub",
+			wantErr: ErrInvalidPolicy,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, gotErr := csvLine(test.input)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("csvLine() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("csvLine() unexpected error (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_FormatCSVWithHeader(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input [][]string
+	}{
+		{
+			name: "Round-trip rules with mixed arity",
+			input: [][]string{
+				{"p", "alice", "domain1", "data1", "read"},
+				{"p2", "bob", "write"},
+				{"g", "alice", "admin", "domain1"},
+				{"g2", "data1", "group1"},
+			},
+		},
+		{
+			name: "Round-trip rules with fields that need quoting",
+			input: [][]string{
+				{"p", "alice", "domain,1", `data "1"`, ""},
+				{"p2", "bob", "write"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newMixedArityModel(t)
+			for _, rule := range test.input {
+				m.AddPolicy(rule[0][:1], rule[0], rule[1:])
+			}
+
+			c := &mockBlobClient{}
+			a := &Adapter{
+				c:         c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			WithFormat(FormatCSVWithHeader)(a)
+			if err := a.SavePolicy(m); err != nil {
+				t.Fatalf("SavePolicy() unexpected error: %v\n", err)
+			}
+			got := newMixedArityModel(t)
+			if err := a.LoadPolicy(got); err != nil {
+				t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+			}
+
+			if diff := cmp.Diff(modelRules(m), modelRules(got)); diff != "" {
+				t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_FormatCSVWithHeader_Default(t *testing.T) {
+	m := newMixedArityModel(t)
+	m.AddPolicy("p", "p", []string{"alice", "domain1", "data1", "read"})
+	m.AddPolicy("p", "p2", []string{"bob", "write"})
+	m.AddPolicy("g", "g", []string{"alice", "admin", "domain1"})
+	m.AddPolicy("g", "g2", []string{"data1", "group1"})
+
+	loaded := make(map[Format][][]string)
+	for _, format := range []Format{FormatDefault, FormatCSVWithHeader} {
+		a := &Adapter{
+			c:         &mockBlobClient{},
+			container: "container",
+			blob:      "blob",
+			timeout:   time.Second * 10,
+			format:    format,
+		}
+		if err := a.SavePolicy(m); err != nil {
+			t.Fatalf("SavePolicy() unexpected error: %v\n", err)
+		}
+		got := newMixedArityModel(t)
+		if err := a.LoadPolicy(got); err != nil {
+			t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+		}
+		loaded[format] = modelRules(got)
+	}
+
+	if diff := cmp.Diff(loaded[FormatDefault], loaded[FormatCSVWithHeader]); diff != "" {
+		t.Errorf("LoadPolicy() unexpected difference between formats (-default +csv):\n%s\n", diff)
+	}
+	if diff := cmp.Diff(modelRules(m), loaded[FormatCSVWithHeader]); diff != "" {
+		t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+	}
+}
+
+// newMixedArityModel returns a model with policy and role definitions with
+// different numbers of fields.
+func newMixedArityModel(t *testing.T) model.Model {
+	t.Helper()
+	m, err := model.NewModelFromString(`
+[request_definition]
+r = sub, dom, obj, act
+
+[policy_definition]
+p = sub, dom, obj, act
+p2 = sub, act
+
+[role_definition]
+g = _, _, _
+g2 = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub, r.dom) && r.dom == p.dom && r.obj == p.obj && r.act == p.act
+`)
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	return m
+}
@@ -0,0 +1,87 @@
+package blobadapter
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+)
+
+// historyBlobPrefix returns the prefix of the history copies of the policy blob.
+func (a *Adapter) historyBlobPrefix() string {
+	return blobPath(a.historyPrefix, a.blob) + "-"
+}
+
+// backupHistory copies the policy blob to a timestamped history copy and prunes
+// the oldest copies beyond the number to keep, and reports whether the copy was
+// made. If the policy blob does not exist the copy is skipped. A failure to prune
+// is logged and does not return an error. Like backupPolicy, the copy is
+// conditioned on match if it is set.
+func (a *Adapter) backupHistory(ctx context.Context, match *azcore.ETag) (bool, error) {
+	name := a.historyBlobPrefix() + time.Now().UTC().Format(time.RFC3339)
+	if err := a.copyBlob(ctx, a.blob, name, match); err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.CannotVerifyCopySource) {
+			return false, nil
+		}
+		if match != nil && bloberror.HasCode(err, bloberror.SourceConditionNotMet) {
+			return false, newStorageErrorWithSentinel(err, ErrPolicyModifiedSinceLoad, a.blob)
+		}
+		return false, err
+	}
+
+	if err := a.pruneHistory(ctx); err != nil {
+		a.logf("blobadapter: pruning backup history: %v", err)
+	}
+	return true, nil
+}
+
+// pruneHistory deletes the oldest history copies beyond the number to keep.
+// Blobs under the history prefix that are not history copies of the policy
+// blob are ignored.
+func (a *Adapter) pruneHistory(ctx context.Context) error {
+	prefix := a.historyBlobPrefix()
+	type historyCopy struct {
+		name string
+		at   time.Time
+	}
+
+	var copies []historyCopy
+	pager := a.c.NewListBlobsFlatPager(a.container, &azblob.ListBlobsFlatOptions{
+		Prefix: toPtr(prefix),
+	})
+	for pager.More() {
+		a.requests.add(operationList)
+		res, err := pager.NextPage(ctx)
+		if err != nil {
+			return newStorageError(err)
+		}
+		for _, b := range res.Segment.BlobItems {
+			if b.Name == nil || !strings.HasPrefix(*b.Name, prefix) {
+				continue
+			}
+			at, err := time.Parse(time.RFC3339, strings.TrimPrefix(*b.Name, prefix))
+			if err != nil {
+				continue
+			}
+			copies = append(copies, historyCopy{name: *b.Name, at: at})
+		}
+	}
+	if len(copies) <= a.historyKeep {
+		return nil
+	}
+
+	sort.Slice(copies, func(i, j int) bool {
+		return copies[i].at.After(copies[j].at)
+	})
+	for _, c := range copies[a.historyKeep:] {
+		a.requests.add(operationOther)
+		if _, err := a.c.DeleteBlob(ctx, a.container, c.name, nil); err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return newStorageError(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package blobadapter
+
+import (
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// LoadInfo contains information about a successful load of the policy.
+// It is passed to the hook set with WithOnLoad.
+type LoadInfo struct {
+	// Rules is the number of rules in the model by policy type (p, p2, g, g2 ...)
+	// after the load.
+	Rules map[string]int
+	// Bytes is the number of bytes downloaded.
+	Bytes int64
+	// ETag is the ETag of the downloaded blob.
+	ETag azcore.ETag
+	// Duration is the duration of the load.
+	Duration time.Duration
+}
+
+// SaveInfo contains information about a successful save of the policy.
+// It is passed to the hook set with WithOnSave.
+type SaveInfo struct {
+	// Rules is the number of rules in the model by policy type (p, p2, g, g2 ...)
+	// that were saved.
+	Rules map[string]int
+	// Bytes is the number of bytes uploaded.
+	Bytes int64
+	// ETag is the ETag of the uploaded blob.
+	ETag azcore.ETag
+	// Duration is the duration of the save.
+	Duration time.Duration
+}
+
+// runHook calls fn and recovers and logs a panic from it, so that a hook
+// cannot fail the operation it is called after.
+func (a *Adapter) runHook(name string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			a.logf("blobadapter: %s hook panicked: %v", name, r)
+		}
+	}()
+	fn()
+}
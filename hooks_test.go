@@ -0,0 +1,138 @@
+package blobadapter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_Hooks(t *testing.T) {
+	var tests = []struct {
+		name     string
+		input    *mockBlobClient
+		wantLoad []LoadInfo
+		wantSave []SaveInfo
+	}{
+		{
+			name:  "Hooks are called after successful load and save",
+			input: &mockBlobClient{},
+			wantLoad: []LoadInfo{
+				{
+					Rules: map[string]int{"p": 1, "g": 0},
+					Bytes: 30,
+					ETag:  azcore.ETag("\"0x0\""),
+				},
+			},
+			wantSave: []SaveInfo{
+				{
+					Rules: map[string]int{"p": 1, "g": 0},
+					Bytes: 30,
+					ETag:  azcore.ETag("\"0x1\""),
+				},
+			},
+		},
+		{
+			name: "Hooks are not called on failed load and save",
+			input: &mockBlobClient{
+				errDownload: errTest,
+				errUpload:   errTest,
+			},
+			wantLoad: nil,
+			wantSave: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var gotLoad []LoadInfo
+			var gotSave []SaveInfo
+			a := &Adapter{
+				c:         test.input,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			WithOnLoad(func(ctx context.Context, info LoadInfo) {
+				gotLoad = append(gotLoad, info)
+			})(a)
+			WithOnSave(func(ctx context.Context, info SaveInfo) {
+				gotSave = append(gotSave, info)
+			})(a)
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			if err := a.LoadPolicy(m); err != nil {
+				m.AddPolicy("p", "p", []string{"alice", "domain1", "data1", "read"})
+			}
+			_ = a.SavePolicy(m)
+
+			opts := []cmp.Option{
+				cmpopts.IgnoreFields(LoadInfo{}, "Duration"),
+				cmpopts.IgnoreFields(SaveInfo{}, "Duration"),
+			}
+			if diff := cmp.Diff(test.wantLoad, gotLoad, opts...); diff != "" {
+				t.Errorf("LoadPolicy() unexpected hook calls (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantSave, gotSave, opts...); diff != "" {
+				t.Errorf("SavePolicy() unexpected hook calls (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_Hooks_Panic(t *testing.T) {
+	logger := &mockLogger{}
+	a := &Adapter{
+		c:         &mockBlobClient{},
+		container: "container",
+		blob:      "blob",
+		timeout:   time.Second * 10,
+	}
+	for _, option := range []Option{
+		WithOnLoad(func(ctx context.Context, info LoadInfo) {
+			panic("load")
+		}),
+		WithOnSave(func(ctx context.Context, info SaveInfo) {
+			panic("save")
+		}),
+		WithLogger(logger),
+	} {
+		option(a)
+	}
+
+	m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	if err := a.LoadPolicy(m); err != nil {
+		t.Errorf("LoadPolicy() unexpected error: %v\n", err)
+	}
+	if err := a.SavePolicy(m); err != nil {
+		t.Errorf("SavePolicy() unexpected error: %v\n", err)
+	}
+
+	want := []string{
+		"blobadapter: load hook panicked: load",
+		"blobadapter: save hook panicked: save",
+	}
+	if diff := cmp.Diff(want, logger.lines); diff != "" {
+		t.Errorf("Hooks unexpected log lines (-want +got):\n%s\n", diff)
+	}
+}
+
+type mockLogger struct {
+	lines []string
+}
+
+func (l *mockLogger) Printf(format string, v ...any) {
+	l.lines = append(l.lines, strings.TrimSpace(fmt.Sprintf(format, v...)))
+}
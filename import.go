@@ -0,0 +1,63 @@
+package blobadapter
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"strings"
+)
+
+// ImportFromReader validates the policy lines read from r the same way as Validate
+// and streams them into the policy blob, replacing its content. Since the blob is
+// only committed when the upload completes, an invalid line or a failure to read
+// from r returns an error and leaves the blob unchanged.
+func (a *Adapter) ImportFromReader(ctx context.Context, r io.Reader) error {
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+
+	v := a.newValidator()
+	return pipe(func(w io.Writer) error {
+		return copyPolicyLines(w, a.decodeReader(r), v, a.lineEnding)
+	}, func(r io.Reader) error {
+		_, err := a.savePolicyBlob(ctx, r)
+		return err
+	})
+}
+
+// ImportFromFile imports the policy from the file at path with ImportFromReader.
+func (a *Adapter) ImportFromFile(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return a.ImportFromReader(ctx, f)
+}
+
+// copyPolicyLines copies the lines read from r to w after validating them with v.
+// Lines are separated by the line ending.
+func copyPolicyLines(w io.Writer, r io.Reader, v *validator, lineEnding LineEnding) error {
+	bw := bufio.NewWriter(w)
+	sep := lineEnding.String()
+	scanner := bufio.NewScanner(r)
+	for n := 0; scanner.Scan(); n++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if n == 0 {
+			line = strings.TrimPrefix(line, byteOrderMark)
+		}
+		if err := v.validate(line); err != nil {
+			return err
+		}
+		if n > 0 {
+			bw.WriteString(sep)
+		}
+		bw.WriteString(line)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
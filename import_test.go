@@ -0,0 +1,113 @@
+package blobadapter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_ImportFromReader(t *testing.T) {
+	var tests = []struct {
+		name        string
+		input       string
+		format      Format
+		want        string
+		wantUploads int
+		wantErr     error
+	}{
+		{
+			name:        "Import policy",
+			input:       "p, alice, domain1, data1, read\np, bob, domain2, data2, write\ng, alice, admin, domain1\n",
+			want:        "p, alice, domain1, data1, read\np, bob, domain2, data2, write\ng, alice, admin, domain1",
+			wantUploads: 1,
+		},
+		{
+			name:        "Import policy with comments and empty lines",
+			input:       "# policy\np, alice, domain1, data1, read\n\ng, alice, admin, domain1",
+			want:        "# policy\np, alice, domain1, data1, read\n\ng, alice, admin, domain1",
+			wantUploads: 1,
+		},
+		{
+			name:        "Import policy with byte order mark",
+			input:       "\ufeffp, alice, domain1, data1, read\ng, alice, admin, domain1\n",
+			want:        "p, alice, domain1, data1, read\ng, alice, admin, domain1",
+			wantUploads: 1,
+		},
+		{
+			name:        "Import policy in CSV format",
+			input:       "ptype,v0,v1,v2,v3\np,alice,domain1,data1,read\ng,alice,admin,domain1,\n",
+			format:      FormatCSVWithHeader,
+			want:        "ptype,v0,v1,v2,v3\np,alice,domain1,data1,read\ng,alice,admin,domain1,",
+			wantUploads: 1,
+		},
+		{
+			name:        "Import policy in CSV format with error (invalid header)",
+			input:       "ptype,x,y\np,alice,data1\n",
+			format:      FormatCSVWithHeader,
+			wantUploads: 0,
+			wantErr:     ErrInvalidPolicy,
+		},
+		{
+			name:        "Import policy with error (invalid line)",
+			input:       "p, alice, domain1, data1, read\nx, bob, domain2, data2, write\n",
+			wantUploads: 0,
+			wantErr:     ErrInvalidPolicy,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &mockBlobClient{}
+			a := &Adapter{
+				c:         c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+				format:    test.format,
+			}
+
+			gotErr := a.ImportFromReader(context.Background(), strings.NewReader(test.input))
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("ImportFromReader() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantUploads, c.uploads); diff != "" {
+				t.Errorf("ImportFromReader() unexpected uploads (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.want, string(c.policies)); diff != "" {
+				t.Errorf("ImportFromReader() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_ImportFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.csv")
+	if err := os.WriteFile(path, []byte("p, alice, domain1, data1, read\n"), 0600); err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+
+	c := &mockBlobClient{}
+	a := &Adapter{
+		c:         c,
+		container: "container",
+		blob:      "blob",
+		timeout:   time.Second * 10,
+	}
+
+	if err := a.ImportFromFile(context.Background(), path); err != nil {
+		t.Errorf("ImportFromFile() unexpected error: %v\n", err)
+	}
+	if diff := cmp.Diff("p, alice, domain1, data1, read", string(c.policies)); diff != "" {
+		t.Errorf("ImportFromFile() unexpected result (-want +got):\n%s\n", diff)
+	}
+
+	if err := a.ImportFromFile(context.Background(), filepath.Join(t.TempDir(), "missing.csv")); !os.IsNotExist(err) {
+		t.Errorf("ImportFromFile() expected not exist error, got: %v\n", err)
+	}
+}
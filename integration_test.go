@@ -0,0 +1,84 @@
+//go:build integration
+
+package blobadapter
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/google/go-cmp/cmp"
+)
+
+// Integration tests against the Azure Storage emulator (Azurite) and
+// optionally a storage account with hierarchical namespace. Run them with:
+//
+//	azurite-blob --silent &
+//	go test -tags integration ./...
+//
+// The Azurite connection string defaults to UseDevelopmentStorage=true and can be
+// overridden with AZURITE_CONNECTION_STRING. Tests against a storage account with
+// hierarchical namespace enabled (which Azurite does not emulate) run when
+// HNS_CONNECTION_STRING is set.
+
+func TestIntegration_Azurite(t *testing.T) {
+	connectionString := os.Getenv("AZURITE_CONNECTION_STRING")
+	if len(connectionString) == 0 {
+		connectionString = "UseDevelopmentStorage=true"
+	}
+	testIntegrationLoadSave(t, connectionString)
+}
+
+func TestIntegration_HierarchicalNamespace(t *testing.T) {
+	connectionString := os.Getenv("HNS_CONNECTION_STRING")
+	if len(connectionString) == 0 {
+		t.Skip("HNS_CONNECTION_STRING is not set")
+	}
+	testIntegrationLoadSave(t, connectionString, WithHierarchicalNamespace(), WithBlobPrefix("casbin/policies"))
+}
+
+// testIntegrationLoadSave creates an adapter in a new container and verifies that
+// an empty policy is loaded, and that a saved policy is loaded by a new adapter.
+func testIntegrationLoadSave(t *testing.T, connectionString string, options ...Option) {
+	t.Helper()
+	container := fmt.Sprintf("casbin-%d", time.Now().UnixNano())
+
+	a, err := NewAdapterFromConnectionString(connectionString, container, "policy.csv", options...)
+	if err != nil {
+		t.Fatalf("NewAdapterFromConnectionString() unexpected error: %v\n", err)
+	}
+
+	e, err := casbin.NewEnforcer("_examples/rbac_with_domains_model.conf", a)
+	if err != nil {
+		t.Fatalf("NewEnforcer() unexpected error: %v\n", err)
+	}
+
+	if got := e.GetPolicy(); len(got) != 0 {
+		t.Errorf("LoadPolicy() unexpected result, want empty policy, got: %v\n", got)
+	}
+
+	_, _ = e.AddPolicy("alice", "domain1", "data1", "read")
+	_, _ = e.AddGroupingPolicy("alice", "admin", "domain1")
+	if err := e.SavePolicy(); err != nil {
+		t.Fatalf("SavePolicy() unexpected error: %v\n", err)
+	}
+
+	a, err = NewAdapterFromConnectionString(connectionString, container, "policy.csv", options...)
+	if err != nil {
+		t.Fatalf("NewAdapterFromConnectionString() unexpected error: %v\n", err)
+	}
+
+	e, err = casbin.NewEnforcer("_examples/rbac_with_domains_model.conf", a)
+	if err != nil {
+		t.Fatalf("NewEnforcer() unexpected error: %v\n", err)
+	}
+
+	if diff := cmp.Diff([][]string{{"alice", "domain1", "data1", "read"}}, e.GetPolicy()); diff != "" {
+		t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+	}
+	if diff := cmp.Diff([][]string{{"alice", "admin", "domain1"}}, e.GetGroupingPolicy()); diff != "" {
+		t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+	}
+}
@@ -0,0 +1,28 @@
+package blobadapter
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// IterateRules downloads the policy blob and calls fn with the ptype and fields of
+// each rule as it is parsed, without loading the rules into a model. Comments and
+// empty lines are skipped. If fn returns an error the download is stopped and the
+// error is returned as is.
+func (a *Adapter) IterateRules(ctx context.Context, fn func(ptype string, rule []string) error) error {
+	if err := checkContainerBlobArguments(a.container, a.blob); err != nil {
+		return err
+	}
+
+	delimiter := a.delimiter()
+	_, _, err := a.loadPolicyBlob(ctx, nil, func(line string, _ model.Model) error {
+		tokens, err := parseRuleLine(line, delimiter)
+		if err != nil || tokens == nil {
+			return err
+		}
+		return fn(tokens[0], tokens[1:])
+	}, blob.HTTPRange{})
+	return err
+}
@@ -0,0 +1,101 @@
+package blobadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_IterateRules(t *testing.T) {
+	errStop := errors.New("stop")
+
+	var tests = []struct {
+		name  string
+		input struct {
+			c    *mockBlobClient
+			stop int
+		}
+		want    [][]string
+		wantErr error
+	}{
+		{
+			name: "Iterate rules",
+			input: struct {
+				c    *mockBlobClient
+				stop int
+			}{
+				c: &mockBlobClient{
+					content: []byte("p, alice, domain1, data1, read\n# comment\n\ng, alice, admin, domain1\n"),
+				},
+			},
+			want: [][]string{
+				{"p", "alice", "domain1", "data1", "read"},
+				{"g", "alice", "admin", "domain1"},
+			},
+		},
+		{
+			name: "Iterate rules and stop early",
+			input: struct {
+				c    *mockBlobClient
+				stop int
+			}{
+				c: &mockBlobClient{
+					content: []byte("p, alice, domain1, data1, read\np, bob, domain1, data2, write\ng, alice, admin, domain1\n"),
+				},
+				stop: 2,
+			},
+			want: [][]string{
+				{"p", "alice", "domain1", "data1", "read"},
+				{"p", "bob", "domain1", "data2", "write"},
+			},
+			wantErr: errStop,
+		},
+		{
+			name: "Iterate rules with error (blob does not exist)",
+			input: struct {
+				c    *mockBlobClient
+				stop int
+			}{
+				c: &mockBlobClient{
+					errDownload: &azcore.ResponseError{
+						ErrorCode: string(bloberror.BlobNotFound),
+					},
+				},
+			},
+			wantErr: ErrBlobDoesNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         test.input.c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+
+			var got [][]string
+			gotErr := a.IterateRules(context.Background(), func(ptype string, rule []string) error {
+				got = append(got, append([]string{ptype}, rule...))
+				if len(got) == test.input.stop {
+					return errStop
+				}
+				return nil
+			})
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("IterateRules() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("IterateRules() unexpected error (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
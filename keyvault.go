@@ -0,0 +1,188 @@
+package blobadapter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+const (
+	// metadataWrappedKey is the metadata key of the base64-encoded data key of
+	// the policy blob, wrapped by the Key Vault key.
+	metadataWrappedKey = "casbin_wrapped_key"
+	// metadataKeyID is the metadata key of the ID, including the version, of the
+	// Key Vault key that wrapped the data key of the policy blob.
+	metadataKeyID = "casbin_key_id"
+	// keyVaultAPIVersion is the version of the Key Vault API.
+	keyVaultAPIVersion = "7.4"
+	// keyVaultWrapAlgorithm is the algorithm data keys are wrapped with.
+	keyVaultWrapAlgorithm = "RSA-OAEP-256"
+)
+
+// keyWrapper wraps and unwraps the data keys of policy blobs.
+type keyWrapper interface {
+	// wrapKey wraps the key and returns it with the ID, including the
+	// version, of the key it was wrapped with.
+	wrapKey(ctx context.Context, key []byte) ([]byte, string, error)
+	// unwrapKey unwraps the key wrapped with the key with keyID.
+	unwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// keyVaultClient wraps and unwraps keys with a key in Azure Key Vault.
+type keyVaultClient struct {
+	keyURL *url.URL
+	pl     runtime.Pipeline
+}
+
+// newKeyVaultClient returns a new keyVaultClient for the key at keyURL, e.g.
+// https://myvault.vault.azure.net/keys/mykey, with an optional version.
+func newKeyVaultClient(keyURL string, cred azcore.TokenCredential, o *policy.ClientOptions) (*keyVaultClient, error) {
+	u, err := url.Parse(keyURL)
+	if err != nil || u.Scheme != "https" || len(u.Host) == 0 || len(keyName(u.Path)) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKeyURL, keyURL)
+	}
+	if cred == nil {
+		return nil, ErrInvalidCredential
+	}
+	// The scope is the Key Vault endpoint of the cloud of the vault, e.g.
+	// https://vault.azure.net for myvault.vault.azure.net.
+	scope := "https://" + u.Host[strings.Index(u.Host, ".")+1:] + "/.default"
+	pl := runtime.NewPipeline("blobadapter", Version, runtime.PipelineOptions{
+		PerRetry: []policy.Policy{runtime.NewBearerTokenPolicy(failureCredential{cred}, []string{scope}, nil)},
+	}, o)
+	return &keyVaultClient{keyURL: u, pl: pl}, nil
+}
+
+// keyOperation is the request and response of the wrap and unwrap operations.
+type keyOperation struct {
+	Algorithm string `json:"alg,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+	Value     string `json:"value"`
+}
+
+// wrapKey wraps the key with the latest version of the key, or the version in
+// the key URL.
+func (c *keyVaultClient) wrapKey(ctx context.Context, key []byte) ([]byte, string, error) {
+	res, err := c.do(ctx, c.keyURL.String(), "wrapkey", key)
+	if err != nil {
+		return nil, "", err
+	}
+	wrapped, err := base64.RawURLEncoding.DecodeString(res.Value)
+	if err != nil {
+		return nil, "", err
+	}
+	return wrapped, res.KeyID, nil
+}
+
+// unwrapKey unwraps the key with the key with keyID, which must be a version of
+// the key of the client, so that a modified blob cannot make the key be unwrapped
+// with another key.
+func (c *keyVaultClient) unwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	u, err := url.Parse(keyID)
+	if err != nil || u.Scheme != c.keyURL.Scheme || !strings.EqualFold(u.Host, c.keyURL.Host) || keyName(u.Path) != keyName(c.keyURL.Path) {
+		return nil, fmt.Errorf("%w: key %s is not a version of key %s", ErrDecryptionFailed, keyID, c.keyURL)
+	}
+	res, err := c.do(ctx, u.String(), "unwrapkey", wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return base64.RawURLEncoding.DecodeString(res.Value)
+}
+
+// do calls the operation of the key at keyURL with the value.
+func (c *keyVaultClient) do(ctx context.Context, keyURL, operation string, value []byte) (keyOperation, error) {
+	req, err := runtime.NewRequest(ctx, http.MethodPost, strings.TrimSuffix(keyURL, "/")+"/"+operation)
+	if err != nil {
+		return keyOperation{}, err
+	}
+	req.Raw().URL.RawQuery = "api-version=" + keyVaultAPIVersion
+	req.Raw().Header.Set("Accept", "application/json")
+	body := keyOperation{Algorithm: keyVaultWrapAlgorithm, Value: base64.RawURLEncoding.EncodeToString(value)}
+	if err := runtime.MarshalAsJSON(req, body); err != nil {
+		return keyOperation{}, err
+	}
+	resp, err := c.pl.Do(req)
+	if err != nil {
+		return keyOperation{}, err
+	}
+	if !runtime.HasStatusCode(resp, http.StatusOK) {
+		return keyOperation{}, runtime.NewResponseError(resp)
+	}
+	var res keyOperation
+	if err := runtime.UnmarshalAsJSON(resp, &res); err != nil {
+		return keyOperation{}, err
+	}
+	return res, nil
+}
+
+// keyName returns the name of the key of the path of a key URL, e.g. mykey for
+// /keys/mykey/version, or an empty string if it is not the path of a key.
+func keyName(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] != "keys" {
+		return ""
+	}
+	return parts[1]
+}
+
+// encryptPolicy encrypts the content with the key set with WithClientSideEncryption,
+// or a new data key wrapped with the Key Vault key set with WithKeyVaultEncryption.
+// The metadata values with the wrapped data key and the ID of the Key Vault key
+// are returned with the encrypted content.
+func (a *Adapter) encryptPolicy(ctx context.Context, b []byte) ([]byte, map[string]string, error) {
+	if a.keyWrapper == nil {
+		encrypted, err := a.encrypt(b)
+		return encrypted, nil, err
+	}
+	key := make([]byte, encryptionKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, nil, err
+	}
+	encrypted, err := sealPolicy(key, b)
+	if err != nil {
+		return nil, nil, err
+	}
+	wrapped, keyID, err := a.keyWrapper.wrapKey(ctx, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("wrapping the data key: %w", err)
+	}
+	values := map[string]string{
+		metadataWrappedKey: base64.StdEncoding.EncodeToString(wrapped),
+		metadataKeyID:      keyID,
+	}
+	return encrypted, values, nil
+}
+
+// decryptPolicy decrypts the content of the blob name with the key set with
+// WithClientSideEncryption, or the data key in metadata unwrapped with the Key
+// Vault key set with WithKeyVaultEncryption.
+func (a *Adapter) decryptPolicy(ctx context.Context, name string, b []byte, metadata map[string]*string) ([]byte, error) {
+	if a.keyWrapper == nil {
+		return a.decrypt(name, b)
+	}
+	if !isEncrypted(b) {
+		return nil, fmt.Errorf("%w: blob %s is not encrypted, it can be encrypted with MigrateToEncryption", ErrNotEncrypted, name)
+	}
+	keyID, stored := metadataValue(metadata, metadataKeyID), metadataValue(metadata, metadataWrappedKey)
+	if len(keyID) == 0 || len(stored) == 0 {
+		return nil, fmt.Errorf("%w: blob %s has no wrapped data key", ErrDecryptionFailed, name)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(stored)
+	if err != nil {
+		return nil, fmt.Errorf("%w: blob %s has a malformed wrapped data key", ErrDecryptionFailed, name)
+	}
+	key, err := a.keyWrapper.unwrapKey(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping the data key of blob %s: %w", name, err)
+	}
+	return openPolicy(name, key, b)
+}
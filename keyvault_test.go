@@ -0,0 +1,193 @@
+package blobadapter
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_KeyVaultEncryption(t *testing.T) {
+	vault := &mockKeyVault{version: "v1"}
+	srv := httptest.NewTLSServer(vault)
+	defer srv.Close()
+
+	kv, err := newKeyVaultClient(srv.URL+"/keys/key", &mockCredential{}, &policy.ClientOptions{Transport: srv.Client()})
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	c := &mockBlobClient{}
+	a := &Adapter{
+		c:          c,
+		container:  "container",
+		blob:       "blob",
+		timeout:    time.Second * 10,
+		keyWrapper: kv,
+	}
+
+	m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	m.AddPolicy("p", "p", []string{"alice", "domain1", "data1", "read"})
+	if err := a.SavePolicy(m); err != nil {
+		t.Fatalf("SavePolicy() unexpected error: %v\n", err)
+	}
+	if diff := cmp.Diff(srv.URL+"/keys/key/v1", *c.blobMetadata[metadataKeyID]); diff != "" {
+		t.Errorf("SavePolicy() unexpected key ID (-want +got):\n%s\n", diff)
+	}
+
+	// The key is rotated after the save.
+	vault.version = "v2"
+	m.ClearPolicy()
+	if err := a.LoadPolicy(m); err != nil {
+		t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+	}
+	want := [][]string{{"alice", "domain1", "data1", "read"}}
+	if diff := cmp.Diff(want, m["p"]["p"].Policy); diff != "" {
+		t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+	}
+
+	c.blobMetadata[metadataKeyID] = toPtr("https://other.vault.azure.net/keys/key/v1")
+	if gotErr := a.LoadPolicy(m); !cmp.Equal(ErrDecryptionFailed, gotErr, cmpopts.EquateErrors()) {
+		t.Errorf("LoadPolicy() unexpected error: %v\n", gotErr)
+	}
+	c.blobMetadata = nil
+	if gotErr := a.LoadPolicy(m); !cmp.Equal(ErrDecryptionFailed, gotErr, cmpopts.EquateErrors()) {
+		t.Errorf("LoadPolicy() unexpected error: %v\n", gotErr)
+	}
+	c.policies = []byte("p, alice, domain1, data1, read")
+	if gotErr := a.LoadPolicy(m); !cmp.Equal(ErrNotEncrypted, gotErr, cmpopts.EquateErrors()) {
+		t.Errorf("LoadPolicy() unexpected error: %v\n", gotErr)
+	}
+}
+
+func TestAdapter_KeyVaultEncryption_DryRun(t *testing.T) {
+	vault := &mockKeyVault{version: "v1"}
+	srv := httptest.NewTLSServer(vault)
+	defer srv.Close()
+
+	kv, err := newKeyVaultClient(srv.URL+"/keys/key", &mockCredential{}, &policy.ClientOptions{Transport: srv.Client()})
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	c := &mockBlobClient{}
+	a := &Adapter{
+		c:          c,
+		container:  "container",
+		blob:       "blob",
+		timeout:    time.Second * 10,
+		keyWrapper: kv,
+		logger:     &mockLogger{},
+	}
+	WithDryRun(true)(a)
+
+	m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	m.AddPolicy("p", "p", []string{"alice", "domain1", "data1", "read"})
+	if err := a.SavePolicy(m); err != nil {
+		t.Fatalf("SavePolicy() unexpected error: %v\n", err)
+	}
+	if diff := cmp.Diff(0, vault.wraps); diff != "" {
+		t.Errorf("SavePolicy() unexpected number of wrapped keys (-want +got):\n%s\n", diff)
+	}
+	if diff := cmp.Diff(0, c.uploads); diff != "" {
+		t.Errorf("SavePolicy() unexpected number of uploads (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestNewKeyVaultClient(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{
+			name:  "New client",
+			input: "https://vault.vault.azure.net/keys/key",
+		},
+		{
+			name:  "New client with key version",
+			input: "https://vault.vault.azure.net/keys/key/version",
+		},
+		{
+			name:    "New client with error (not a key)",
+			input:   "https://vault.vault.azure.net/secrets/key",
+			wantErr: ErrInvalidKeyURL,
+		},
+		{
+			name:    "New client with error (not https)",
+			input:   "http://vault.vault.azure.net/keys/key",
+			wantErr: ErrInvalidKeyURL,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, gotErr := newKeyVaultClient(test.input, &mockCredential{}, nil)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("newKeyVaultClient() unexpected error (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+// mockKeyVault is a Key Vault that wraps keys by reversing them, prefixed
+// with the version of the key. It counts the wrapped keys.
+type mockKeyVault struct {
+	version string
+	wraps   int
+}
+
+func (v *mockKeyVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var op keyOperation
+	if err := json.NewDecoder(r.Body).Decode(&op); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	value, err := base64.RawURLEncoding.DecodeString(op.Value)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	version := v.version
+	switch {
+	case len(parts) == 3 && parts[2] == "wrapkey":
+		v.wraps++
+		value = append([]byte(version), reverse(value)...)
+	case len(parts) == 4 && parts[3] == "unwrapkey":
+		version = parts[2]
+		if !strings.HasPrefix(string(value), version) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		value = reverse(value[len(version):])
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(keyOperation{
+		KeyID: "https://" + r.Host + "/keys/" + parts[1] + "/" + version,
+		Value: base64.RawURLEncoding.EncodeToString(value),
+	})
+}
+
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
@@ -0,0 +1,37 @@
+package blobadapter
+
+import (
+	"github.com/casbin/casbin/v2/model"
+)
+
+// SkippedLines returns the lines that were skipped by the last load of the
+// policy because they are not valid rules, e.g. section headers or directives
+// written by other tools. Lines are only skipped with WithLenientParsing, and
+// nil is returned if no lines were skipped.
+func (a *Adapter) SkippedLines() []LineError {
+	skipped, _ := a.skippedLines.Load().([]LineError)
+	return skipped
+}
+
+// lenientHandler returns a handler that calls handler with the lines that are
+// valid rules of the model, and appends the lines that are not, or that handler
+// fails on, to skipped instead of failing the load. Lines are only checked
+// against the model if no custom line handler is set, since it may accept
+// lines that are not rules.
+func (a *Adapter) lenientHandler(handler func(string, model.Model) error, skipped *[]LineError) func(string, model.Model) error {
+	delimiter := a.delimiter()
+	var n int
+	return func(line string, m model.Model) error {
+		n++
+		if a.lineHandler == nil {
+			if reason := verifyLine(line, m, delimiter); len(reason) > 0 {
+				*skipped = append(*skipped, LineError{Line: n, Content: line, Reason: reason})
+				return nil
+			}
+		}
+		if err := handler(line, m); err != nil {
+			*skipped = append(*skipped, LineError{Line: n, Content: line, Reason: err.Error()})
+		}
+		return nil
+	}
+}
@@ -0,0 +1,94 @@
+package blobadapter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAdapter_LenientParsing(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			content string
+			lenient bool
+		}
+		want        [][]string
+		wantSkipped []LineError
+		wantErr     bool
+	}{
+		{
+			name: "Load policy with sections and directives",
+			input: struct {
+				content string
+				lenient bool
+			}{
+				content: "#!version: 2\n[policies]\np, alice, domain1, data1, read\n; comment\np, bob, domain1\np, bob, domain1, data1, write",
+				lenient: true,
+			},
+			want: [][]string{{"alice", "domain1", "data1", "read"}, {"bob", "domain1", "data1", "write"}},
+			wantSkipped: []LineError{
+				{Line: 2, Content: "[policies]", Reason: "ptype [policies] is not defined in the model"},
+				{Line: 4, Content: "; comment", Reason: "ptype ; comment is not defined in the model"},
+				{Line: 5, Content: "p, bob, domain1", Reason: "invalid number of fields: expected 4, got 2"},
+			},
+		},
+		{
+			name: "Load policy without invalid lines",
+			input: struct {
+				content string
+				lenient bool
+			}{
+				content: "p, alice, domain1, data1, read",
+				lenient: true,
+			},
+			want: [][]string{{"alice", "domain1", "data1", "read"}},
+		},
+		{
+			name: "Load policy with error (strict)",
+			input: struct {
+				content string
+				lenient bool
+			}{
+				content: "p, alice, domain1, data1, read\np, bob, domain1",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         &mockBlobClient{content: []byte(test.input.content)},
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+				logger:    &mockLogger{},
+			}
+			if test.input.lenient {
+				WithLenientParsing()(a)
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			gotErr := a.LoadPolicy(m)
+			if test.wantErr != (gotErr != nil) {
+				t.Fatalf("LoadPolicy() unexpected error: %v\n", gotErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if diff := cmp.Diff(test.want, m["p"]["p"].Policy); diff != "" {
+				t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantSkipped, a.SkippedLines()); diff != "" {
+				t.Errorf("SkippedLines() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package blobadapter
+
+import (
+	"fmt"
+	"log"
+)
+
+// Logger is the interface used by the adapter to log events that are not
+// returned as errors, like recovered panics in hooks. It is satisfied by
+// *log.Logger.
+type Logger interface {
+	Printf(format string, v ...any)
+}
+
+// logf logs with the logger set with WithLogger, or the standard logger of
+// the log package if it is not set. Secrets like the signature of a SAS are
+// redacted from the message.
+func (a *Adapter) logf(format string, v ...any) {
+	msg := redact(fmt.Sprintf(format, v...))
+	if a.logger != nil {
+		a.logger.Printf("%s", msg)
+		return
+	}
+	log.Print(msg)
+}
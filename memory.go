@@ -0,0 +1,511 @@
+package blobadapter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/appendblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+)
+
+const (
+	// inMemoryContainer and inMemoryBlob are the names of the container and
+	// blob of adapters created with NewInMemoryAdapter.
+	inMemoryContainer = "casbin"
+	inMemoryBlob      = "policy.csv"
+	// memoryURLScheme is the scheme of the blob URLs of memoryClient.
+	memoryURLScheme = "memory://"
+)
+
+// NewInMemoryAdapter returns a new adapter that stores the policy in memory
+// instead of in a storage account, for tests of code that uses the adapter
+// without access to a storage account or an emulator. The policy is read and
+// written the same way as by adapters that use a storage account, with the same
+// options, so that policies are parsed and serialized the same way. The storage
+// starts out empty, and the container and blob are created like by NewAdapter.
+// Conditional requests, metadata and copies are supported, while operations that
+// depend on features of a storage account, such as tags and versions, find no
+// blobs. Adapters do not share their storage.
+func NewInMemoryAdapter(options ...Option) (*Adapter, error) {
+	c := newMemoryClient()
+	return newAdapter(inMemoryContainer, inMemoryBlob, nil, func(o *azblob.ClientOptions) (client, error) {
+		return c, nil
+	}, append(options[:len(options):len(options)], WithSharedClient(false))...)
+}
+
+// memoryClient is a client that stores containers and blobs in memory. It is
+// safe for concurrent use.
+type memoryClient struct {
+	mu         sync.Mutex
+	containers map[string]map[string]*memoryBlob
+	etags      int64
+}
+
+// memoryBlob is a blob stored by memoryClient.
+type memoryBlob struct {
+	content      []byte
+	metadata     map[string]*string
+	etag         azcore.ETag
+	lastModified time.Time
+}
+
+// newMemoryClient returns a new memoryClient without containers.
+func newMemoryClient() *memoryClient {
+	return &memoryClient{containers: make(map[string]map[string]*memoryBlob)}
+}
+
+// NewListContainersPager returns a pager of the containers with the prefix of o.
+func (c *memoryClient) NewListContainersPager(o *azblob.ListContainersOptions) *runtime.Pager[azblob.ListContainersResponse] {
+	var prefix string
+	if o != nil && o.Prefix != nil {
+		prefix = *o.Prefix
+	}
+	return singlePager(func() (azblob.ListContainersResponse, error) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		var items []*service.ContainerItem
+		for _, name := range sortedKeys(c.containers) {
+			if strings.HasPrefix(name, prefix) {
+				items = append(items, &service.ContainerItem{Name: toPtr(name)})
+			}
+		}
+		var res azblob.ListContainersResponse
+		res.ContainerItems = items
+		return res, nil
+	})
+}
+
+// NewListBlobsFlatPager returns a pager of the blobs in the container with the
+// prefix of o.
+func (c *memoryClient) NewListBlobsFlatPager(containerName string, o *azblob.ListBlobsFlatOptions) *runtime.Pager[azblob.ListBlobsFlatResponse] {
+	var prefix string
+	if o != nil && o.Prefix != nil {
+		prefix = *o.Prefix
+	}
+	return singlePager(func() (azblob.ListBlobsFlatResponse, error) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		blobs, ok := c.containers[containerName]
+		if !ok {
+			return azblob.ListBlobsFlatResponse{}, memoryError(http.StatusNotFound, bloberror.ContainerNotFound)
+		}
+		segment := &container.BlobFlatListSegment{}
+		for _, name := range sortedKeys(blobs) {
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			b := blobs[name]
+			segment.BlobItems = append(segment.BlobItems, &container.BlobItem{
+				Name:     toPtr(name),
+				Metadata: b.metadata,
+				Properties: &container.BlobProperties{
+					ETag:          toPtr(b.etag),
+					LastModified:  toPtr(b.lastModified),
+					ContentLength: toPtr(int64(len(b.content))),
+				},
+			})
+		}
+		var res azblob.ListBlobsFlatResponse
+		res.Segment = segment
+		return res, nil
+	})
+}
+
+// CreateContainer creates the container.
+func (c *memoryClient) CreateContainer(ctx context.Context, containerName string, o *azblob.CreateContainerOptions) (azblob.CreateContainerResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.containers[containerName]; ok {
+		return azblob.CreateContainerResponse{}, memoryError(http.StatusConflict, bloberror.ContainerAlreadyExists)
+	}
+	c.containers[containerName] = make(map[string]*memoryBlob)
+	return azblob.CreateContainerResponse{}, nil
+}
+
+// DownloadStream returns the content of the blob, or of the range of o.
+func (c *memoryClient) DownloadStream(ctx context.Context, containerName string, blobName string, o *azblob.DownloadStreamOptions) (azblob.DownloadStreamResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var conditions *blob.AccessConditions
+	if o != nil {
+		conditions = o.AccessConditions
+	}
+	b, err := c.blob(containerName, blobName, conditions)
+	if err != nil {
+		return azblob.DownloadStreamResponse{}, err
+	}
+
+	content := b.content
+	var contentRange *string
+	if o != nil && o.Range != (blob.HTTPRange{}) {
+		size := int64(len(content))
+		start, end := o.Range.Offset, size
+		if start > size {
+			start = size
+		}
+		if o.Range.Count > 0 && start+o.Range.Count < size {
+			end = start + o.Range.Count
+		}
+		content = content[start:end]
+		contentRange = toPtr(fmt.Sprintf("bytes %d-%d/%d", start, end-1, size))
+	}
+	var res azblob.DownloadStreamResponse
+	res.Body = io.NopCloser(bytes.NewReader(content))
+	res.ContentLength = toPtr(int64(len(content)))
+	res.ContentRange = contentRange
+	res.ETag = toPtr(b.etag)
+	res.LastModified = toPtr(b.lastModified)
+	res.Metadata = b.metadata
+	return res, nil
+}
+
+// DownloadBuffer copies the content of the blob, or the range of it set in o,
+// into the buffer.
+func (c *memoryClient) DownloadBuffer(ctx context.Context, containerName string, blobName string, buffer []byte, o *azblob.DownloadBufferOptions) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var conditions *blob.AccessConditions
+	if o != nil {
+		conditions = o.AccessConditions
+	}
+	b, err := c.blob(containerName, blobName, conditions)
+	if err != nil {
+		return 0, err
+	}
+	content := b.content
+	if o != nil && o.Range.Offset > 0 {
+		if o.Range.Offset > int64(len(content)) {
+			return 0, nil
+		}
+		content = content[o.Range.Offset:]
+	}
+	return int64(copy(buffer, content)), nil
+}
+
+// UploadStream replaces the content and metadata of the blob with the body and
+// the metadata of o.
+func (c *memoryClient) UploadStream(ctx context.Context, containerName string, blobName string, body io.Reader, o *azblob.UploadStreamOptions) (azblob.UploadStreamResponse, error) {
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return azblob.UploadStreamResponse{}, err
+	}
+	var metadata map[string]*string
+	var conditions *blob.AccessConditions
+	if o != nil {
+		metadata, conditions = o.Metadata, o.AccessConditions
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, err := c.writableBlob(containerName, blobName, conditions)
+	if err != nil {
+		return azblob.UploadStreamResponse{}, err
+	}
+	b.content, b.metadata = content, copyMetadata(metadata)
+	c.modified(b)
+	var res azblob.UploadStreamResponse
+	res.ETag = toPtr(b.etag)
+	res.LastModified = toPtr(b.lastModified)
+	return res, nil
+}
+
+// DeleteBlob deletes the blob.
+func (c *memoryClient) DeleteBlob(ctx context.Context, containerName string, blobName string, o *azblob.DeleteBlobOptions) (azblob.DeleteBlobResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var conditions *blob.AccessConditions
+	if o != nil {
+		conditions = o.AccessConditions
+	}
+	if _, err := c.blob(containerName, blobName, conditions); err != nil {
+		return azblob.DeleteBlobResponse{}, err
+	}
+	delete(c.containers[containerName], blobName)
+	return azblob.DeleteBlobResponse{}, nil
+}
+
+// SetImmutabilityPolicy succeeds without setting an immutability policy.
+func (c *memoryClient) SetImmutabilityPolicy(ctx context.Context, containerName string, blobName string, expiryTime time.Time, o *blob.SetImmutabilityPolicyOptions) (blob.SetImmutabilityPolicyResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.blob(containerName, blobName, nil)
+	return blob.SetImmutabilityPolicyResponse{}, err
+}
+
+// SetLegalHold succeeds without setting a legal hold.
+func (c *memoryClient) SetLegalHold(ctx context.Context, containerName string, blobName string, legalHold bool, o *blob.SetLegalHoldOptions) (blob.SetLegalHoldResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.blob(containerName, blobName, nil)
+	return blob.SetLegalHoldResponse{}, err
+}
+
+// CreateAppendBlob creates an empty blob that blocks are appended to.
+func (c *memoryClient) CreateAppendBlob(ctx context.Context, containerName string, blobName string, o *appendblob.CreateOptions) (appendblob.CreateResponse, error) {
+	var metadata map[string]*string
+	var conditions *blob.AccessConditions
+	if o != nil {
+		metadata, conditions = o.Metadata, o.AccessConditions
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, err := c.writableBlob(containerName, blobName, conditions)
+	if err != nil {
+		return appendblob.CreateResponse{}, err
+	}
+	b.content, b.metadata = nil, copyMetadata(metadata)
+	c.modified(b)
+	return appendblob.CreateResponse{ETag: toPtr(b.etag)}, nil
+}
+
+// AppendBlock appends the body to the blob.
+func (c *memoryClient) AppendBlock(ctx context.Context, containerName string, blobName string, body io.ReadSeekCloser, o *appendblob.AppendBlockOptions) (appendblob.AppendBlockResponse, error) {
+	block, err := io.ReadAll(body)
+	if err != nil {
+		return appendblob.AppendBlockResponse{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, err := c.blob(containerName, blobName, nil)
+	if err != nil {
+		return appendblob.AppendBlockResponse{}, err
+	}
+	b.content = append(b.content, block...)
+	c.modified(b)
+	return appendblob.AppendBlockResponse{ETag: toPtr(b.etag)}, nil
+}
+
+// StartCopyFromURL copies the blob at the URL returned by BlobURL to the blob.
+// The copy completes before it returns.
+func (c *memoryClient) StartCopyFromURL(ctx context.Context, containerName string, blobName string, copySource string, o *blob.StartCopyFromURLOptions) (blob.StartCopyFromURLResponse, error) {
+	srcContainer, srcBlob, ok := strings.Cut(strings.TrimPrefix(copySource, memoryURLScheme), "/")
+	if !ok || !strings.HasPrefix(copySource, memoryURLScheme) {
+		return blob.StartCopyFromURLResponse{}, memoryError(http.StatusBadRequest, bloberror.InvalidHeaderValue)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	src, err := c.blob(srcContainer, srcBlob, nil)
+	if err != nil {
+		return blob.StartCopyFromURLResponse{}, err
+	}
+	if o != nil && o.SourceModifiedAccessConditions != nil {
+		sc := o.SourceModifiedAccessConditions
+		if err := checkConditions(src, &blob.AccessConditions{ModifiedAccessConditions: &blob.ModifiedAccessConditions{
+			IfMatch:     sc.SourceIfMatch,
+			IfNoneMatch: sc.SourceIfNoneMatch,
+		}}); err != nil {
+			return blob.StartCopyFromURLResponse{}, memoryError(http.StatusPreconditionFailed, bloberror.SourceConditionNotMet)
+		}
+	}
+	b, err := c.writableBlob(containerName, blobName, nil)
+	if err != nil {
+		return blob.StartCopyFromURLResponse{}, err
+	}
+	b.content, b.metadata = append([]byte(nil), src.content...), copyMetadata(src.metadata)
+	c.modified(b)
+	return blob.StartCopyFromURLResponse{
+		ETag:       toPtr(b.etag),
+		CopyStatus: toPtr(blob.CopyStatusTypeSuccess),
+	}, nil
+}
+
+// GetProperties returns the properties of the blob.
+func (c *memoryClient) GetProperties(ctx context.Context, containerName string, blobName string, o *blob.GetPropertiesOptions) (blob.GetPropertiesResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var conditions *blob.AccessConditions
+	if o != nil {
+		conditions = o.AccessConditions
+	}
+	b, err := c.blob(containerName, blobName, conditions)
+	if err != nil {
+		return blob.GetPropertiesResponse{}, err
+	}
+	return blob.GetPropertiesResponse{
+		ETag:          toPtr(b.etag),
+		LastModified:  toPtr(b.lastModified),
+		ContentLength: toPtr(int64(len(b.content))),
+		Metadata:      b.metadata,
+		CopyStatus:    toPtr(blob.CopyStatusTypeSuccess),
+	}, nil
+}
+
+// SetMetadata replaces the metadata of the blob.
+func (c *memoryClient) SetMetadata(ctx context.Context, containerName string, blobName string, metadata map[string]*string, o *blob.SetMetadataOptions) (blob.SetMetadataResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var conditions *blob.AccessConditions
+	if o != nil {
+		conditions = o.AccessConditions
+	}
+	b, err := c.blob(containerName, blobName, conditions)
+	if err != nil {
+		return blob.SetMetadataResponse{}, err
+	}
+	b.metadata = copyMetadata(metadata)
+	c.modified(b)
+	return blob.SetMetadataResponse{ETag: toPtr(b.etag), LastModified: toPtr(b.lastModified)}, nil
+}
+
+// SetTier succeeds without setting the tier.
+func (c *memoryClient) SetTier(ctx context.Context, containerName string, blobName string, tier blob.AccessTier, o *blob.SetTierOptions) (blob.SetTierResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.blob(containerName, blobName, nil)
+	return blob.SetTierResponse{}, err
+}
+
+// FilterBlobs returns no blobs, since blobs stored in memory have no tags.
+func (c *memoryClient) FilterBlobs(ctx context.Context, containerName string, where string, o *container.FilterBlobsOptions) (container.FilterBlobsResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.containers[containerName]; !ok {
+		return container.FilterBlobsResponse{}, memoryError(http.StatusNotFound, bloberror.ContainerNotFound)
+	}
+	return container.FilterBlobsResponse{}, nil
+}
+
+// BlobURL returns the URL of the blob, which is only valid as the source of
+// StartCopyFromURL.
+func (c *memoryClient) BlobURL(containerName string, blobName string) string {
+	return memoryURLScheme + containerName + "/" + blobName
+}
+
+// blob returns the blob if it matches the access conditions, which may be nil.
+// The lock must be held.
+func (c *memoryClient) blob(containerName, blobName string, conditions *blob.AccessConditions) (*memoryBlob, error) {
+	blobs, ok := c.containers[containerName]
+	if !ok {
+		return nil, memoryError(http.StatusNotFound, bloberror.ContainerNotFound)
+	}
+	b, ok := blobs[blobName]
+	if !ok {
+		return nil, memoryError(http.StatusNotFound, bloberror.BlobNotFound)
+	}
+	if err := checkConditions(b, conditions); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// writableBlob returns the blob to write, which is added to the container if it
+// does not exist, if it matches the access conditions, which may be nil. The
+// lock must be held.
+func (c *memoryClient) writableBlob(containerName, blobName string, conditions *blob.AccessConditions) (*memoryBlob, error) {
+	blobs, ok := c.containers[containerName]
+	if !ok {
+		return nil, memoryError(http.StatusNotFound, bloberror.ContainerNotFound)
+	}
+	b, ok := blobs[blobName]
+	if !ok {
+		if conditions != nil && conditions.ModifiedAccessConditions != nil && conditions.ModifiedAccessConditions.IfMatch != nil {
+			return nil, memoryError(http.StatusNotFound, bloberror.BlobNotFound)
+		}
+		b = &memoryBlob{}
+		blobs[blobName] = b
+		return b, nil
+	}
+	if conditions != nil && conditions.ModifiedAccessConditions != nil {
+		if etag := conditions.ModifiedAccessConditions.IfNoneMatch; etag != nil && *etag == azcore.ETagAny {
+			return nil, memoryError(http.StatusConflict, bloberror.BlobAlreadyExists)
+		}
+	}
+	if err := checkConditions(b, conditions); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// modified sets a new ETag and the last modified time of the blob. The lock
+// must be held.
+func (c *memoryClient) modified(b *memoryBlob) {
+	c.etags++
+	b.etag = azcore.ETag(fmt.Sprintf("\"0x%X\"", c.etags))
+	b.lastModified = time.Now().UTC()
+}
+
+// checkConditions returns an error with code ConditionNotMet if the blob does not
+// match the ETag conditions, which may be nil.
+func checkConditions(b *memoryBlob, conditions *blob.AccessConditions) error {
+	if conditions == nil || conditions.ModifiedAccessConditions == nil {
+		return nil
+	}
+	mc := conditions.ModifiedAccessConditions
+	if mc.IfMatch != nil && *mc.IfMatch != azcore.ETagAny && *mc.IfMatch != b.etag {
+		return memoryError(http.StatusPreconditionFailed, bloberror.ConditionNotMet)
+	}
+	if mc.IfNoneMatch != nil && (*mc.IfNoneMatch == azcore.ETagAny || *mc.IfNoneMatch == b.etag) {
+		return memoryError(http.StatusPreconditionFailed, bloberror.ConditionNotMet)
+	}
+	return nil
+}
+
+// memoryError returns a response error with the status code and error code,
+// like the errors returned by the storage.
+func memoryError(statusCode int, code bloberror.Code) error {
+	return &azcore.ResponseError{
+		ErrorCode:  string(code),
+		StatusCode: statusCode,
+		RawResponse: &http.Response{
+			StatusCode: statusCode,
+			Status:     fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+			Body:       http.NoBody,
+		},
+	}
+}
+
+// singlePager returns a pager with the single page returned by fetch.
+func singlePager[T any](fetch func() (T, error)) *runtime.Pager[T] {
+	return runtime.NewPager(runtime.PagingHandler[T]{
+		More: func(T) bool {
+			return false
+		},
+		Fetcher: func(ctx context.Context, _ *T) (T, error) {
+			if err := ctx.Err(); err != nil {
+				var zero T
+				return zero, err
+			}
+			return fetch()
+		},
+	})
+}
+
+// sortedKeys returns the sorted keys of m.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// copyMetadata returns a copy of the metadata.
+func copyMetadata(metadata map[string]*string) map[string]*string {
+	if metadata == nil {
+		return nil
+	}
+	md := make(map[string]*string, len(metadata))
+	for k, v := range metadata {
+		if v != nil {
+			md[k] = toPtr(*v)
+		}
+	}
+	return md
+}
@@ -0,0 +1,117 @@
+package blobadapter
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestNewInMemoryAdapter(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   []Option
+		want    [][]string
+		wantErr error
+	}{
+		{
+			name: "Save and load policy",
+			want: [][]string{{"alice", "domain1", "data1", "read"}, {"bob", "domain1", "data1", "write"}},
+		},
+		{
+			name: "Save and load policy with options",
+			input: []Option{
+				WithBackupOnSave(".bak"),
+				WithStaleWriteProtection(),
+				WithChecksumVerification(),
+				WithClientSideEncryption(bytes.Repeat([]byte{1}, 32)),
+			},
+			want: [][]string{{"alice", "domain1", "data1", "read"}, {"bob", "domain1", "data1", "write"}},
+		},
+		{
+			name:    "New adapter with error",
+			input:   []Option{WithClientSideEncryption([]byte("short"))},
+			wantErr: ErrInvalidEncryptionKey,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, gotErr := NewInMemoryAdapter(test.input...)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Fatalf("NewInMemoryAdapter() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if test.wantErr != nil {
+				return
+			}
+
+			e, err := casbin.NewEnforcer("_examples/rbac_with_domains_model.conf", a)
+			if err != nil {
+				t.Fatalf("NewEnforcer() unexpected error: %v\n", err)
+			}
+			e.EnableAutoSave(false)
+			for _, rule := range test.want {
+				if _, err := e.AddPolicy(rule); err != nil {
+					t.Fatalf("AddPolicy() unexpected error: %v\n", err)
+				}
+			}
+			if err := e.SavePolicy(); err != nil {
+				t.Fatalf("SavePolicy() unexpected error: %v\n", err)
+			}
+
+			e.ClearPolicy()
+			if err := e.LoadPolicy(); err != nil {
+				t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+			}
+			if diff := cmp.Diff(test.want, e.GetPolicy()); diff != "" {
+				t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestNewInMemoryAdapter_StaleWriteProtection(t *testing.T) {
+	a, err := NewInMemoryAdapter(WithStaleWriteProtection())
+	if err != nil {
+		t.Fatalf("NewInMemoryAdapter() unexpected error: %v\n", err)
+	}
+	e, err := casbin.NewEnforcer("_examples/rbac_with_domains_model.conf", a)
+	if err != nil {
+		t.Fatalf("NewEnforcer() unexpected error: %v\n", err)
+	}
+
+	if _, err := a.MergePolicies(context.Background(), "p", "p", [][]string{{"bob", "domain1", "data1", "write"}}); err != nil {
+		t.Fatalf("MergePolicies() unexpected error: %v\n", err)
+	}
+	if _, err := a.UpdateFilteredPoliciesCtx(context.Background(), "p", "p", nil, 0, "bob"); err != nil {
+		t.Fatalf("UpdateFilteredPolicies() unexpected error: %v\n", err)
+	}
+	// The blob is modified by others after the load.
+	if _, err := a.c.UploadStream(context.Background(), a.container, a.blob, bytes.NewReader(nil), nil); err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	if gotErr := e.SavePolicy(); !cmp.Equal(ErrPolicyModifiedSinceLoad, gotErr, cmpopts.EquateErrors()) {
+		t.Errorf("SavePolicy() unexpected error: %v\n", gotErr)
+	}
+}
+
+func TestNewInMemoryAdapter_Options(t *testing.T) {
+	var called bool
+	options := make([]Option, 1, 2)
+	options[0] = WithReadOnly(true)
+	options[:2][1] = func(a *Adapter) {
+		called = true
+	}
+
+	if _, err := NewInMemoryAdapter(options...); err != nil {
+		t.Fatalf("NewInMemoryAdapter() unexpected error: %v\n", err)
+	}
+	// The spare capacity of the options of the caller is not overwritten.
+	options[:2][1](&Adapter{})
+	if !called {
+		t.Errorf("NewInMemoryAdapter() modified the options of the caller\n")
+	}
+}
@@ -0,0 +1,43 @@
+package blobadapter
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// LoadModel downloads the casbin model from the blob modelBlob in the container of
+// the adapter. The blob prefix set with WithBlobPrefix is applied to the name. If the
+// blob does not exist ErrModelDoesNotExist is returned.
+func (a *Adapter) LoadModel(ctx context.Context, modelBlob string) (model.Model, error) {
+	name := blobPath(a.prefix, modelBlob)
+	if len(name) == 0 {
+		return nil, ErrInvalidBlob
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	a.requests.add(operationDownload)
+	var raw *http.Response
+	res, err := a.c.DownloadStream(captureResponse(ctx, &raw), a.container, name, a.downloadStreamOptions(nil))
+	a.recordOperation(operationInfoDownload, raw, res.RequestID, res.ClientRequestID, err)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.ContainerNotFound) {
+			return nil, newStorageErrorWithSentinel(err, ErrContainerDoesNotExist, a.container)
+		} else if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil, newStorageErrorWithSentinel(err, ErrModelDoesNotExist, name)
+		}
+		return nil, newStorageError(err)
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, newStorageError(err)
+	}
+	return model.NewModelFromString(string(b))
+}
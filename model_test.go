@@ -0,0 +1,112 @@
+package blobadapter
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_LoadModel(t *testing.T) {
+	modelData, err := os.ReadFile("_examples/rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+
+	var tests = []struct {
+		name  string
+		input struct {
+			client    *mockBlobClient
+			prefix    string
+			modelBlob string
+		}
+		want    string
+		wantErr error
+	}{
+		{
+			name: "Load model",
+			input: struct {
+				client    *mockBlobClient
+				prefix    string
+				modelBlob string
+			}{
+				client: &mockBlobClient{
+					blobs: map[string][]byte{"model.conf": modelData},
+				},
+				modelBlob: "model.conf",
+			},
+			want: "g(r_sub, p_sub, r_dom) && r_dom == p_dom && r_obj == p_obj && r_act == p_act",
+		},
+		{
+			name: "Load model with prefix",
+			input: struct {
+				client    *mockBlobClient
+				prefix    string
+				modelBlob string
+			}{
+				client: &mockBlobClient{
+					blobs: map[string][]byte{"tenant/model.conf": modelData},
+				},
+				prefix:    "tenant",
+				modelBlob: "model.conf",
+			},
+			want: "g(r_sub, p_sub, r_dom) && r_dom == p_dom && r_obj == p_obj && r_act == p_act",
+		},
+		{
+			name: "Load model with error (model does not exist)",
+			input: struct {
+				client    *mockBlobClient
+				prefix    string
+				modelBlob string
+			}{
+				client: &mockBlobClient{
+					errDownload: &azcore.ResponseError{
+						ErrorCode: string(bloberror.BlobNotFound),
+					},
+				},
+				modelBlob: "model.conf",
+			},
+			wantErr: ErrModelDoesNotExist,
+		},
+		{
+			name: "Load model with error (invalid blob)",
+			input: struct {
+				client    *mockBlobClient
+				prefix    string
+				modelBlob string
+			}{
+				client:    &mockBlobClient{},
+				modelBlob: "",
+			},
+			wantErr: ErrInvalidBlob,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         test.input.client,
+				container: "container",
+				blob:      "policy.csv",
+				prefix:    test.input.prefix,
+				timeout:   time.Second * 10,
+			}
+
+			got, gotErr := a.LoadModel(context.Background(), test.input.modelBlob)
+			if gotErr == nil {
+				if diff := cmp.Diff(test.want, got["m"]["m"].Value); diff != "" {
+					t.Errorf("LoadModel() unexpected result (-want +got):\n%s\n", diff)
+				}
+			}
+
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("LoadModel() unexpected error (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
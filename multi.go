@@ -0,0 +1,178 @@
+package blobadapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// MultiAdapter is a casbin adapter that loads the policy from an ordered list of
+// adapters, e.g. org-wide base rules followed by team overrides, possibly in
+// different storage accounts. Writes are routed to a designated writer among the
+// adapters. It is safe for concurrent use.
+type MultiAdapter struct {
+	adapters []*Adapter
+	writer   *Adapter
+	// mu protects inherited, the keys of the rules loaded from the adapters
+	// other than the writer that the writer does not have.
+	mu        sync.Mutex
+	inherited map[string]bool
+}
+
+var _ persist.Adapter = (*MultiAdapter)(nil)
+
+// NewMultiAdapter returns a new MultiAdapter that loads the policy from the adapters
+// in order. The writer must be one of the adapters, or nil if the policy should not
+// be written, in which case writes return ErrNoWriter.
+func NewMultiAdapter(adapters []*Adapter, writer *Adapter) (*MultiAdapter, error) {
+	if len(adapters) == 0 {
+		return nil, errors.New("no adapters")
+	}
+	found := writer == nil
+	for i, a := range adapters {
+		if a == nil {
+			return nil, fmt.Errorf("adapter %d is nil", i)
+		}
+		if a == writer {
+			found = true
+		}
+	}
+	if !found {
+		return nil, errors.New("writer is not one of the adapters")
+	}
+	return &MultiAdapter{adapters: adapters, writer: writer}, nil
+}
+
+// LoadPolicy loads the policy rules of all adapters into the model.
+func (ma *MultiAdapter) LoadPolicy(model model.Model) error {
+	return ma.LoadPolicyCtx(context.Background(), model)
+}
+
+// LoadPolicyCtx loads the policy rules of all adapters into the model in order with
+// context. A rule loaded by an earlier adapter is not added again. If an adapter
+// fails its error is returned, identifying the adapter, and the model is not
+// modified.
+func (ma *MultiAdapter) LoadPolicyCtx(ctx context.Context, m model.Model) error {
+	loaded := make([]model.Model, len(ma.adapters))
+	for i, a := range ma.adapters {
+		loaded[i] = m.Copy()
+		loaded[i].ClearPolicy()
+		if err := a.LoadPolicyCtx(ctx, loaded[i]); err != nil {
+			return ma.adapterError(i, err)
+		}
+	}
+
+	own := make(map[string]bool)
+	inherited := make(map[string]bool)
+	for i, l := range loaded {
+		for _, rule := range modelRules(l) {
+			key := ruleKey(rule)
+			if ma.adapters[i] == ma.writer {
+				own[key] = true
+			} else {
+				inherited[key] = true
+			}
+			if err := persist.LoadPolicyArray(rule, m); err != nil {
+				return ma.adapterError(i, err)
+			}
+		}
+	}
+	for key := range own {
+		delete(inherited, key)
+	}
+
+	ma.mu.Lock()
+	ma.inherited = inherited
+	ma.mu.Unlock()
+	return nil
+}
+
+// SavePolicy saves the policy rules of the model with the writer.
+func (ma *MultiAdapter) SavePolicy(model model.Model) error {
+	return ma.SavePolicyCtx(context.Background(), model)
+}
+
+// SavePolicyCtx saves the policy rules of the model with the writer with context.
+// Rules that were loaded from the other adapters, and not from the writer, are not
+// saved. If there is no writer ErrNoWriter is returned.
+func (ma *MultiAdapter) SavePolicyCtx(ctx context.Context, model model.Model) error {
+	if ma.writer == nil {
+		return ErrNoWriter
+	}
+
+	ma.mu.Lock()
+	inherited := ma.inherited
+	ma.mu.Unlock()
+
+	if err := ma.writer.SavePolicyCtx(ctx, withoutRules(model, inherited)); err != nil {
+		return ma.adapterError(ma.writerIndex(), err)
+	}
+	return nil
+}
+
+// AddPolicy adds a policy rule with the writer.
+func (ma *MultiAdapter) AddPolicy(sec, ptype string, rule []string) error {
+	if ma.writer == nil {
+		return ErrNoWriter
+	}
+	return ma.writer.AddPolicy(sec, ptype, rule)
+}
+
+// RemovePolicy removes a policy rule with the writer.
+func (ma *MultiAdapter) RemovePolicy(sec, ptype string, rule []string) error {
+	if ma.writer == nil {
+		return ErrNoWriter
+	}
+	return ma.writer.RemovePolicy(sec, ptype, rule)
+}
+
+// RemoveFilteredPolicy removes policy rules that match the filter with the writer.
+func (ma *MultiAdapter) RemoveFilteredPolicy(sec, ptype string, fieldIndex int, fieldValues ...string) error {
+	if ma.writer == nil {
+		return ErrNoWriter
+	}
+	return ma.writer.RemoveFilteredPolicy(sec, ptype, fieldIndex, fieldValues...)
+}
+
+// adapterError returns err of the adapter at index i, identifying the adapter.
+func (ma *MultiAdapter) adapterError(i int, err error) error {
+	a := ma.adapters[i]
+	return fmt.Errorf("adapter %d (%s/%s): %w", i, a.container, a.blob, err)
+}
+
+// writerIndex returns the index of the writer in the adapters.
+func (ma *MultiAdapter) writerIndex() int {
+	for i, a := range ma.adapters {
+		if a == ma.writer {
+			return i
+		}
+	}
+	return -1
+}
+
+// withoutRules returns a model with the policy rules of m, without the rules whose
+// keys are in exclude. Only the rules are set on the returned model, which is only
+// meant to be saved.
+func withoutRules(m model.Model, exclude map[string]bool) model.Model {
+	if len(exclude) == 0 {
+		return m
+	}
+	filtered := model.Model{}
+	for _, sec := range []string{"p", "g"} {
+		filtered[sec] = model.AssertionMap{}
+		for ptype, ast := range m[sec] {
+			var rules [][]string
+			for _, rule := range ast.Policy {
+				if !exclude[ruleKey(append([]string{ptype}, rule...))] {
+					rules = append(rules, rule)
+				}
+			}
+			filtered[sec][ptype] = &model.Assertion{Key: ast.Key, Value: ast.Value, Policy: rules}
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,121 @@
+package blobadapter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestMultiAdapter(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			errDownload error
+			writer      bool
+		}
+		want      [][]string
+		wantSaved string
+		wantErr   error
+	}{
+		{
+			name: "Load and save policy",
+			input: struct {
+				errDownload error
+				writer      bool
+			}{
+				writer: true,
+			},
+			want: [][]string{
+				{"alice", "domain1", "data1", "read"},
+				{"bob", "domain1", "data2", "write"},
+			},
+			wantSaved: "p, bob, domain1, data2, write\np, carol, domain1, data3, read",
+		},
+		{
+			name: "Load and save policy with error (no writer)",
+			want: [][]string{
+				{"alice", "domain1", "data1", "read"},
+				{"bob", "domain1", "data2", "write"},
+			},
+			wantErr: ErrNoWriter,
+		},
+		{
+			name: "Load policy with error (adapter)",
+			input: struct {
+				errDownload error
+				writer      bool
+			}{
+				errDownload: errTest,
+				writer:      true,
+			},
+			wantErr: errTest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			base := &Adapter{
+				c:         &mockBlobClient{},
+				container: "container",
+				blob:      "base.csv",
+				timeout:   time.Second * 10,
+			}
+			teamClient := &mockBlobClient{
+				content:     []byte("p, bob, domain1, data2, write"),
+				errDownload: test.input.errDownload,
+			}
+			team := &Adapter{
+				c:         teamClient,
+				container: "container",
+				blob:      "team.csv",
+				timeout:   time.Second * 10,
+			}
+			var writer *Adapter
+			if test.input.writer {
+				writer = team
+			}
+			ma, err := NewMultiAdapter([]*Adapter{base, team}, writer)
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			gotErr := ma.LoadPolicy(m)
+			if gotErr == nil {
+				m.AddPolicy("p", "p", []string{"carol", "domain1", "data3", "read"})
+				gotErr = ma.SavePolicy(m)
+			} else if !strings.Contains(gotErr.Error(), "adapter 1 (container/team.csv)") {
+				t.Errorf("LoadPolicy() expected error to identify the adapter, got: %v\n", gotErr)
+			}
+
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("MultiAdapter unexpected error (-want +got):\n%s\n", diff)
+			}
+			if test.want != nil {
+				if diff := cmp.Diff(test.want, m["p"]["p"].Policy[:len(test.want)]); diff != "" {
+					t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+				}
+			}
+			if diff := cmp.Diff(test.wantSaved, string(teamClient.policies)); diff != "" {
+				t.Errorf("SavePolicy() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestNewMultiAdapter_Error(t *testing.T) {
+	a := &Adapter{container: "container", blob: "blob"}
+	if _, err := NewMultiAdapter(nil, nil); err == nil {
+		t.Errorf("NewMultiAdapter() expected error without adapters\n")
+	}
+	if _, err := NewMultiAdapter([]*Adapter{a}, &Adapter{}); err == nil {
+		t.Errorf("NewMultiAdapter() expected error with writer that is not one of the adapters\n")
+	}
+}
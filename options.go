@@ -1,6 +1,16 @@
 package blobadapter
 
-import "time"
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/casbin/casbin/v2/model"
+	"golang.org/x/text/encoding"
+)
 
 // Option is a function that sets options on the adapter.
 type Option func(*Adapter)
@@ -11,3 +21,660 @@ func WithTimeout(d time.Duration) Option {
 		a.timeout = d
 	}
 }
+
+// WithBlobPrefix sets a prefix (virtual directory) for the blob on the adapter.
+// The prefix is applied to the blob name for all operations.
+func WithBlobPrefix(prefix string) Option {
+	return func(a *Adapter) {
+		a.prefix = prefix
+	}
+}
+
+// WithLineHandler sets the handler that is called with each trimmed line of the
+// policy blob on load. It replaces the default handler persist.LoadPolicyLine,
+// which can be called by the handler after custom processing of the line.
+func WithLineHandler(handler func(line string, model model.Model) error) Option {
+	return func(a *Adapter) {
+		a.lineHandler = handler
+	}
+}
+
+// WithHierarchicalNamespace configures the adapter for a storage account with
+// hierarchical namespace (Data Lake Storage Gen2) enabled. On initialization the
+// blob is looked up by its path instead of by listing, and created with the
+// missing parent directories of the path if it does not exist. A directory with
+// the same path as the blob results in ErrBlobIsDirectory instead of it being
+// treated as the policy blob. The Blob service API is used for all requests,
+// the Data Lake Storage API is not required.
+func WithHierarchicalNamespace() Option {
+	return func(a *Adapter) {
+		a.hierarchicalNamespace = true
+	}
+}
+
+// WithDownloadConcurrency sets the number of parallel ranged requests and the size
+// of each range used when loading policy blobs larger than blockSize. Smaller blobs
+// are downloaded with a single request. Concurrent downloads are disabled by default.
+func WithDownloadConcurrency(parallel int, blockSize int64) Option {
+	return func(a *Adapter) {
+		if parallel < 1 || blockSize < 1 {
+			return
+		}
+		a.downloadConcurrency = parallel
+		a.downloadBlockSize = blockSize
+	}
+}
+
+// WithImmutabilityPolicy sets an immutability policy that is applied to the blob
+// after each save, making it write-once until the provided time. Mode is either
+// blob.ImmutabilityPolicySettingUnlocked or blob.ImmutabilityPolicySettingLocked.
+// Saves rejected due to an active policy return ErrImmutable.
+func WithImmutabilityPolicy(until time.Time, mode blob.ImmutabilityPolicySetting) Option {
+	return func(a *Adapter) {
+		a.immutableUntil = until
+		a.immutabilityMode = mode
+	}
+}
+
+// WithLegalHold sets whether a legal hold is applied to the blob after each save.
+// Saves rejected due to an active legal hold return ErrImmutable.
+func WithLegalHold(legalHold bool) Option {
+	return func(a *Adapter) {
+		a.legalHold = legalHold
+	}
+}
+
+// WithUploadOptions sets the block size and the number of concurrent block
+// uploads used for all uploads. Zero values use the defaults of the SDK.
+func WithUploadOptions(blockSize int64, concurrency int) Option {
+	return func(a *Adapter) {
+		a.uploadBlockSize = blockSize
+		a.uploadConcurrency = concurrency
+	}
+}
+
+// WithDownloadStreamOptions sets a function that is called with the options of every
+// streamed download right before the download, to set options like access conditions
+// or CPK info. The function is called after the adapter has applied
+// its own settings, like the range of LoadPolicyRange, and may modify them. A range
+// set by the function is handled like a range of LoadPolicyRange.
+func WithDownloadStreamOptions(fn func(o *azblob.DownloadStreamOptions)) Option {
+	return func(a *Adapter) {
+		a.downloadOptionsFn = fn
+	}
+}
+
+// WithRetryReaderOptions sets the options of the retry reader that the policy blob
+// is read through when it is loaded or exported. If the connection fails while
+// reading, the retry reader makes up to MaxRetries additional requests to continue
+// reading from where it failed. Without this option the body is read without
+// retries.
+func WithRetryReaderOptions(o blob.RetryReaderOptions) Option {
+	return func(a *Adapter) {
+		a.retryReaderOptions = &o
+	}
+}
+
+// WithUploadStreamOptions sets a function that is called with the options of every
+// upload right before the upload, to set options that the adapter has no option
+// for, like tags, access tier or HTTP headers. The function is called after the
+// adapter has applied its own settings, like those of WithUploadOptions, and may
+// override them.
+func WithUploadStreamOptions(fn func(o *azblob.UploadStreamOptions)) Option {
+	return func(a *Adapter) {
+		a.uploadOptionsFn = fn
+	}
+}
+
+// WithMaxBlobSize sets the maximum size of the policy blob in bytes. A load of a
+// larger blob returns ErrBlobTooLarge without reading it, and a save of a policy
+// that serializes to more bytes fails with ErrBlobTooLarge without modifying the
+// blob. A size of 0 disables the limit.
+func WithMaxBlobSize(size int64) Option {
+	return func(a *Adapter) {
+		a.maxBlobSize = size
+	}
+}
+
+// WithVerifyOnSave sets whether saves should be verified by downloading the blob
+// and comparing its ETag and content with the uploaded content. A failed
+// verification returns ErrSaveVerificationFailed.
+func WithVerifyOnSave(verify bool) Option {
+	return func(a *Adapter) {
+		a.verifyOnSave = verify
+	}
+}
+
+// WithOnLoad sets a hook that is called after each successful load of the policy.
+// The hook cannot fail the load, a panic in it is recovered and logged.
+func WithOnLoad(fn func(ctx context.Context, info LoadInfo)) Option {
+	return func(a *Adapter) {
+		a.onLoad = fn
+	}
+}
+
+// WithOnSave sets a hook that is called after each successful save of the policy.
+// The hook cannot fail the save, a panic in it is recovered and logged.
+func WithOnSave(fn func(ctx context.Context, info SaveInfo)) Option {
+	return func(a *Adapter) {
+		a.onSave = fn
+	}
+}
+
+// WithLogger sets the logger used by the adapter. Defaults to the standard
+// logger of the log package.
+func WithLogger(logger Logger) Option {
+	return func(a *Adapter) {
+		a.logger = logger
+	}
+}
+
+// WithChangeCallback sets a callback that is called during each save with the
+// rules that are added and removed compared to the policy in the storage. Each
+// rule starts with its ptype. The callback is called before the upload, which
+// requires an additional download of the blob on every save.
+func WithChangeCallback(fn func(added, removed [][]string)) Option {
+	return func(a *Adapter) {
+		a.onChange = fn
+	}
+}
+
+// WithAuditBlob sets the name of an append blob in the same container as the policy
+// that an AuditRecord is appended to on each successful save. The blob prefix set with
+// WithBlobPrefix is applied to the name. A failure to write the record is logged and
+// does not fail the save unless WithStrictAudit is set.
+func WithAuditBlob(name string) Option {
+	return func(a *Adapter) {
+		a.auditBlob = name
+	}
+}
+
+// WithStrictAudit sets whether a failure to write the audit record set with
+// WithAuditBlob fails the save. Since the record is written after the upload,
+// the policy is saved even if an error is returned.
+func WithStrictAudit(strict bool) Option {
+	return func(a *Adapter) {
+		a.strictAudit = strict
+	}
+}
+
+// WithBackupOnSave sets that the policy blob is copied to a backup blob named
+// <blob><suffix> with a server-side copy before each save. The suffix defaults
+// to .bak if empty. If the policy blob does not exist the backup is skipped.
+// The backup is made after the size of the policy is checked, so that a save
+// rejected with ErrBlobTooLarge does not overwrite it. Use RestoreBackup to
+// restore the policy blob from the backup.
+func WithBackupOnSave(suffix string) Option {
+	return func(a *Adapter) {
+		if len(suffix) == 0 {
+			suffix = defaultBackupSuffix
+		}
+		a.backupSuffix = suffix
+	}
+}
+
+// WithBackupHistory sets that the policy blob is copied to {prefix}/{blob}-{timestamp}
+// with a server-side copy before each save, where the timestamp is the time of the
+// save in RFC 3339 format (UTC). Only the newest keep copies are kept, older copies
+// are deleted. A failure to delete old copies is logged and does not fail the save.
+// Like WithBackupOnSave, the copy is made after the size of the policy is checked.
+// A keep of less than 1 disables the history.
+func WithBackupHistory(prefix string, keep int) Option {
+	return func(a *Adapter) {
+		a.historyPrefix = prefix
+		a.historyKeep = keep
+	}
+}
+
+// LineEnding is the line ending that separates the rules written to the
+// policy blob.
+type LineEnding int
+
+const (
+	// LF separates rules with \n. This is the default.
+	LF LineEnding = iota
+	// CRLF separates rules with \r\n.
+	CRLF
+)
+
+// String returns the characters of the line ending.
+func (l LineEnding) String() string {
+	if l == CRLF {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// WithLineEnding sets the line ending used between rules when the policy is
+// saved or imported. Defaults to LF. Both line endings are accepted on load.
+func WithLineEnding(lineEnding LineEnding) Option {
+	return func(a *Adapter) {
+		a.lineEnding = lineEnding
+	}
+}
+
+// WithClientOptions sets the options used when creating the storage client.
+// Adapters only share a client if they are created with the same options
+// value (the same pointer) or none at all.
+func WithClientOptions(o *azblob.ClientOptions) Option {
+	return func(a *Adapter) {
+		a.clientOptions = o
+	}
+}
+
+// WithApplicationID sets the telemetry application ID of the storage client, which
+// is sent in the User-Agent header of every request after the name and version of
+// the adapter (casbin-blob-adapter/<version> <id>). The SDK replaces spaces with
+// slashes and truncates the ID to 24 characters. It overrides an application ID
+// set with WithClientOptions.
+func WithApplicationID(id string) Option {
+	return func(a *Adapter) {
+		a.applicationID = id
+	}
+}
+
+// WithServiceAPIVersion sets the version of the storage service API (x-ms-version)
+// used for all requests, e.g. 2021-12-02, instead of the default version of the
+// SDK. A malformed version, or a version that the storage does not support, fails
+// the first request with an error matching ErrInvalidServiceAPIVersion.
+func WithServiceAPIVersion(version string) Option {
+	return func(a *Adapter) {
+		a.serviceAPIVersion = version
+	}
+}
+
+// WithSharedClient sets whether the storage client is shared with other adapters
+// for the same account, credentials and client options in the process. Sharing
+// a client shares its connection pool and token refreshes. Defaults to true.
+// Set it to false to create a client that is used only by this adapter. Clients
+// of adapters created with NewAdapterWithManagedIdentity, NewAdapterWithClientSecret
+// and NewAdapterWithWorkloadIdentity are never shared, since their credential is
+// created for the adapter.
+func WithSharedClient(shared bool) Option {
+	return func(a *Adapter) {
+		a.noSharedClient = !shared
+	}
+}
+
+// WithReadOnly sets whether the adapter is read-only. A read-only adapter does not
+// create the container and blob when it is created, and the methods that write to
+// the storage (SavePolicy, AddPolicy, AddPolicies, RemovePolicy, ImportFromReader,
+// RestoreBackup etc.) return ErrReadOnly without making any requests. Loading the
+// policy is not affected.
+func WithReadOnly(readOnly bool) Option {
+	return func(a *Adapter) {
+		a.readOnly = readOnly
+	}
+}
+
+// WithThrottleRetry sets the maximum number of times a load or save of the policy
+// is retried when it fails because the storage throttles requests (429 Too Many
+// Requests or 503 Server Busy) after the retries of the storage client. Before
+// each retry the adapter waits for the Retry-After of the response, or an
+// exponential delay if it is missing, with jitter and capped to 30 seconds. All
+// retries stay within the timeout of the adapter. Each retry is logged. Since a
+// load is retried from the start, a custom line handler may be passed lines of
+// the policy again. A max of less than 1 disables the retries.
+func WithThrottleRetry(max int) Option {
+	return func(a *Adapter) {
+		a.throttleRetries = max
+	}
+}
+
+// WithOnThrottle sets a function that is called before each retry of a throttled
+// load or save (see WithThrottleRetry), e.g. to record metrics. A panic in the
+// function is recovered and logged.
+func WithOnThrottle(fn func(ctx context.Context, info ThrottleInfo)) Option {
+	return func(a *Adapter) {
+		a.onThrottle = fn
+	}
+}
+
+// WithBaseContext sets the context that is the parent of the contexts of all
+// operations that are not passed a context, like LoadPolicy, SavePolicy and the
+// creation of the container and blob by the constructors. Cancelling it aborts
+// pending storage requests of those operations, and its values are passed to the
+// storage client. The methods that take a context (LoadPolicyCtx, SavePolicyCtx
+// etc.) use the context of the caller instead.
+func WithBaseContext(ctx context.Context) Option {
+	return func(a *Adapter) {
+		a.baseCtx = ctx
+	}
+}
+
+// WithFieldDelimiter sets the delimiter that separates the fields of rules, e.g.
+// '\t' or ';', for policy blobs that are not comma-separated. It is used when the
+// policy is loaded with the default line handler and when it is saved. The delimiter
+// cannot be a line break, a quote or '#'. Defaults to a comma.
+func WithFieldDelimiter(delimiter rune) Option {
+	return func(a *Adapter) {
+		a.fieldDelimiter = delimiter
+	}
+}
+
+// WithDryRun sets whether writes are only logged. In a dry run the policy is
+// serialized and diffed, and hooks set with WithChangeCallback and WithOnSave are
+// called, but the upload, backups, audit records, restores and the creation of
+// the container and blob are skipped and logged with a "dry run" prefix. Write
+// operations return success.
+func WithDryRun(dryRun bool) Option {
+	return func(a *Adapter) {
+		a.dryRun = dryRun
+	}
+}
+
+// WithTreatMissingAsEmpty sets whether a policy blob that does not exist loads as
+// an empty policy. When set, LoadPolicy and LoadFilteredPolicy return no error
+// instead of ErrBlobDoesNotExist if the blob is absent, e.g. in a new environment
+// where it has not been created yet. A container that does not exist is still an
+// error. Defaults to false.
+func WithTreatMissingAsEmpty(missingAsEmpty bool) Option {
+	return func(a *Adapter) {
+		a.missingAsEmpty = missingAsEmpty
+	}
+}
+
+// WithStaleWriteProtection enables protection against overwriting changes made
+// by others. The ETag of the blob is remembered when the policy is loaded, and
+// the upload of SavePolicy is conditioned on it. If the blob was modified, or
+// created, since the policy was loaded, SavePolicy returns
+// ErrPolicyModifiedSinceLoad without overwriting it. Use ForceSave to save anyway.
+func WithStaleWriteProtection() Option {
+	return func(a *Adapter) {
+		a.staleWriteProtection = true
+	}
+}
+
+// WithConflictResolver sets a function that merges concurrent changes instead of
+// failing the save when stale-write protection (see WithStaleWriteProtection)
+// detects that the blob was modified since the policy was loaded. The adapter
+// downloads the current rules of the blob and calls fn with them and the rules of
+// the model, and saves the merged rules returned by fn. If the blob is modified
+// again before the merged rules are saved, the merge is retried up to 3 times
+// before ErrPolicyModifiedSinceLoad is returned. An error returned by fn fails the
+// save. The model is not modified, load the policy to get the merged rules.
+// UnionResolver can be used when the concurrent changes only add rules.
+func WithConflictResolver(fn func(current, mine []PolicyLine) ([]PolicyLine, error)) Option {
+	return func(a *Adapter) {
+		a.conflictResolver = fn
+	}
+}
+
+// WithFormat sets the format of the policy blob, FormatDefault or
+// FormatCSVWithHeader. The policy is saved in the format, and loaded from it:
+// with FormatCSVWithHeader the header row is validated and skipped, and empty
+// trailing fields that pad rows are removed. Rules are loaded line by line, so
+// fields cannot contain line breaks. With FormatCSVWithHeader the fields are
+// always separated by a comma and WithFieldDelimiter has no effect. Defaults to
+// FormatDefault.
+func WithFormat(format Format) Option {
+	return func(a *Adapter) {
+		a.format = format
+	}
+}
+
+// WithLenientParsing sets the adapter to skip lines of the policy blob that are
+// not valid rules of the model when the policy is loaded, e.g. section headers
+// or directives written by other tools, instead of failing the load. The skipped
+// lines of the last load can be retrieved with SkippedLines. By default a load
+// fails on the first invalid line.
+func WithLenientParsing() Option {
+	return func(a *Adapter) {
+		a.lenient = true
+	}
+}
+
+// WithEncoding sets the character encoding of the policy blob, e.g.
+// unicode.UTF16(unicode.LittleEndian, unicode.UseBOM) or charmap.Windows1252 of
+// golang.org/x/text/encoding, for blobs that are not UTF-8. The blob is decoded
+// when the policy is loaded and encoded when it is saved. A leading UTF-8 byte
+// order mark is always stripped on load. Defaults to UTF-8.
+func WithEncoding(enc encoding.Encoding) Option {
+	return func(a *Adapter) {
+		a.encoding = enc
+	}
+}
+
+// WithBootstrap sets a function that returns the rules to seed the policy with
+// when LoadPolicy finds that the blob does not exist, instead of failing with
+// ErrBlobDoesNotExist. Each rule starts with its ptype, e.g.
+// {"p", "alice", "data1", "read"}. The rules are added to the model, and saved to
+// the blob if WithBootstrapSave is set. A container that does not exist is still an error,
+// and the function is not called if WithTreatMissingAsEmpty is set, since the
+// blob is then loaded as an empty policy.
+func WithBootstrap(fn func() [][]string) Option {
+	return func(a *Adapter) {
+		a.bootstrap = fn
+	}
+}
+
+// WithBootstrapSave sets if the rules seeded with the function of WithBootstrap
+// should be saved to the blob, which creates it. A failed save fails the load.
+// Defaults to false.
+func WithBootstrapSave(save bool) Option {
+	return func(a *Adapter) {
+		a.bootstrapSave = save
+	}
+}
+
+// WithContainerExists sets if the container is known to exist, in which case
+// the adapter does not list the containers to check for it, and does not create
+// it, when it is initialized. It cuts round-trips at startup when the container
+// is guaranteed to exist. Defaults to false.
+func WithContainerExists(exists bool) Option {
+	return func(a *Adapter) {
+		a.containerExists = exists
+	}
+}
+
+// WithBlobMayNotExist sets the adapter to create the blob when it is initialized
+// with a single upload that is conditioned on the blob not existing, instead of
+// listing the blobs to check for it first. A blob that already exists is left as
+// is. The check that the blob is not a directory with WithHierarchicalNamespace is
+// skipped. Defaults to false.
+func WithBlobMayNotExist(mayNotExist bool) Option {
+	return func(a *Adapter) {
+		a.blobMayNotExist = mayNotExist
+	}
+}
+
+// WithMaxPolicySize sets the maximum number of bytes read when the policy is
+// loaded, to guard against loading a blob that is not a policy, such as a large
+// log file. A load of a larger blob fails with ErrPolicyTooLarge, checked against
+// the content length of the download before reading it and while reading it.
+// Unlike WithMaxBlobSize it does not limit saves. A size of 0 disables the limit.
+// Defaults to 256 MiB.
+func WithMaxPolicySize(size int64) Option {
+	return func(a *Adapter) {
+		a.maxPolicySize = size
+	}
+}
+
+// WithMaxRules sets the maximum number of rules read when the policy is loaded.
+// A load of a blob with more rules stops and fails with ErrPolicyTooLarge.
+// Comments and empty lines are not counted. A number of 0 disables the limit.
+// Defaults to 10,000,000.
+func WithMaxRules(n int) Option {
+	return func(a *Adapter) {
+		a.maxRules = n
+	}
+}
+
+// WithChecksumVerification sets the adapter to store the SHA-256 checksum of the
+// serialized policy in the casbin_sha256 metadata of the blob when it is saved,
+// and to verify the checksum of the downloaded content when the policy is loaded.
+// A load fails with ErrChecksumMismatch if the checksums differ or the metadata is
+// missing, e.g. because the blob was modified by other tools. The checksum is
+// uploaded in the metadata together with the content, so the policy is serialized
+// completely before the upload. On load the content is read completely and
+// verified before any line is passed to the model, so the model is not modified by
+// a load that fails. Loads of a range of the blob are not verified. The stored
+// checksum is returned by PolicyProperties.
+func WithChecksumVerification() Option {
+	return func(a *Adapter) {
+		a.checksumVerification = true
+	}
+}
+
+// WithSecondaryReads sets if the policy should be downloaded from the secondary
+// endpoint of a read-access geo-redundant (RA-GRS or RA-GZRS) account, e.g.
+// account-secondary.blob.core.windows.net, to reduce the load on the primary
+// endpoint and to tolerate its outages. If the download from the secondary endpoint
+// fails the policy is downloaded from the primary endpoint. The failure is logged,
+// wrapped in ErrSecondaryNotAvailable if the blob is not yet replicated, and also
+// matched by the returned error if the download from the primary endpoint fails
+// too. Writes are always made to the primary endpoint. The secondary endpoint can lag behind the
+// primary, so a loaded policy can be older than the last save. It has no effect on
+// adapters created with NewAdaptersFromClient, or endpoints without an account
+// name in the host such as the storage emulator. Defaults to false.
+func WithSecondaryReads(secondary bool) Option {
+	return func(a *Adapter) {
+		a.secondaryReads = secondary
+	}
+}
+
+// WithSigningKey sets the adapter to sign the serialized policy with HMAC-SHA256
+// and key when it is saved, storing the hex-encoded signature in the
+// casbin_hmac_sha256 metadata of the blob, and to verify the signature of the
+// downloaded content when the policy is loaded. The content is read completely and
+// verified before any line is passed to the model, and a load fails with
+// ErrSignatureInvalid if the signature is missing or does not match, e.g. because
+// the blob was modified by someone without the key. Signatures made with any of
+// the previous keys are also accepted on load, so that the key can be rotated
+// without failing loads of policies signed with an earlier key. The signature is
+// uploaded in the metadata together with the content, so the policy is serialized
+// completely before the upload. Loads of a range of the blob fail, since they
+// cannot be verified.
+func WithSigningKey(key []byte, previous ...[]byte) Option {
+	return func(a *Adapter) {
+		a.signingKeys = append([][]byte{key}, previous...)
+	}
+}
+
+// WithClientSideEncryption sets the adapter to encrypt the serialized policy with
+// AES-256-GCM and key, which must be 32 bytes, before it is uploaded, and to
+// decrypt it after it is downloaded, before it is parsed. The encrypted blob starts
+// with a header with the version of the format and the nonce, which is generated
+// for every save. A load of a blob that is not encrypted fails with ErrNotEncrypted,
+// and existing blobs can be encrypted with MigrateToEncryption. A load fails with
+// ErrDecryptionFailed if the blob cannot be decrypted with the key. The checksum set
+// with WithChecksumVerification and the signature set with WithSigningKey are
+// computed over the encrypted content. ExportToWriter and LoadPolicyBytes return
+// the content as it is stored. Loads of a range of the blob fail, since they
+// cannot be decrypted.
+func WithClientSideEncryption(key []byte) Option {
+	return func(a *Adapter) {
+		a.encryptionKey = key
+	}
+}
+
+// WithKeyVaultEncryption sets the adapter to encrypt the policy with envelope
+// encryption, with the key in Azure Key Vault at keyURL, e.g.
+// https://myvault.vault.azure.net/keys/mykey, and the credential cred of the vault.
+// On save a new AES-256 data key is generated and the policy is encrypted with it
+// like with WithClientSideEncryption. The data key is wrapped by the Key Vault key
+// with RSA-OAEP-256, and stored in the casbin_wrapped_key metadata of the blob
+// with the ID of the key version that wrapped it in the casbin_key_id metadata. On
+// load the data key is unwrapped with the recorded key version, which must be a
+// version of the key at keyURL, and the policy is decrypted. Without a version in
+// keyURL the latest version of the key wraps new data keys, so the key can be
+// rotated without failing loads of blobs saved with earlier versions. The key
+// requires the wrapKey and unwrapKey permissions. The azcore client options set
+// with WithClientOptions, such as the transport and retry options, are used for
+// the requests to the vault. It cannot be combined with WithClientSideEncryption.
+func WithKeyVaultEncryption(keyURL string, cred azcore.TokenCredential) Option {
+	return func(a *Adapter) {
+		a.keyVaultKeyURL = keyURL
+		a.keyVaultCred = cred
+	}
+}
+
+// WithSortFunc sets a function that orders the rules of each ptype when the policy
+// is saved, e.g. to group the rules by subject and then by object. less reports
+// whether rule a, without its ptype, sorts before rule b. The sort is stable, so
+// rules that are equal keep the order of the model, and the ptypes are written in
+// the same order as without it. The model itself is not reordered. When nil the
+// rules are saved in the order of the model. Defaults to nil.
+func WithSortFunc(less func(a, b []string) bool) Option {
+	return func(a *Adapter) {
+		a.sortFunc = less
+	}
+}
+
+// WithClearByDelete sets whether Clear deletes the policy blob instead of
+// overwriting it with empty content. After a delete a load behaves like for a
+// blob that does not exist, see WithTreatMissingAsEmpty. Defaults to false.
+func WithClearByDelete(clearByDelete bool) Option {
+	return func(a *Adapter) {
+		a.clearByDelete = clearByDelete
+	}
+}
+
+// WithNoCreate sets the adapter to never create the container or blob. On
+// initialization the adapter checks that they exist instead, and returns
+// ErrContainerDoesNotExist or ErrBlobDoesNotExist if they don't, so that missing
+// infrastructure fails loudly instead of being created by the adapter. Saves do
+// not create the container either, and fail with ErrContainerDoesNotExist if it
+// does not exist. Unlike WithContainerExists the existence is still checked.
+func WithNoCreate() Option {
+	return func(a *Adapter) {
+		a.noCreate = true
+	}
+}
+
+// WithIncludeSnapshots sets whether the snapshots and previous versions of the blob
+// are listed when the adapter checks if the blob exists on initialization. If the
+// blob does not exist but has snapshots or previous versions, e.g. because it was
+// deleted on an account with versioning, ErrBlobHasSnapshots is returned instead
+// of creating an empty blob over it, so that it can be recovered manually. The
+// blob is then always checked for by listing, also with WithBlobMayNotExist.
+// Defaults to false.
+func WithIncludeSnapshots(include bool) Option {
+	return func(a *Adapter) {
+		a.includeSnapshots = include
+	}
+}
+
+// WithHTTPClient sets the HTTP client that sends the requests to the storage, and
+// to the vault with WithKeyVaultEncryption, e.g. for a proxy, mutual TLS or a test
+// server. It replaces the transport of the options set with WithClientOptions,
+// while their other options still apply. Adapters only share a client if they are
+// created with the same HTTP client (the same pointer) or none at all.
+func WithHTTPClient(c *http.Client) Option {
+	return func(a *Adapter) {
+		a.httpClient = c
+	}
+}
+
+// WithExpvar publishes counters of the adapter with expvar under prefix, e.g. for
+// the /debug/vars endpoint of expvar. The variables are published as a map with
+// the number of loads and saves, the number of failed loads and saves, the number
+// of failures by class (e.g. not_found, permission_denied, credential, modified,
+// throttled or timeout), the ETag of the last loaded or saved blob and the duration
+// of the last load and save in seconds. They are updated for the same loads and
+// saves as the hooks set with WithOnLoad and WithOnSave, and also for the failed
+// ones. Adapters created with the same prefix share the variables, which are only
+// published once. Nothing is published or updated when prefix is empty, which is
+// the default.
+func WithExpvar(prefix string) Option {
+	return func(a *Adapter) {
+		a.expvarPrefix = prefix
+	}
+}
+
+// WithLoadRetry sets the number of attempts of a load of the policy that fails with
+// a transient error of the storage (408, 429, 500, 502, 503 or 504) after the
+// retries of the storage client, so that the retries of the client can be kept
+// conservative while the load of the policy is retried further. Before each retry
+// the adapter waits for baseDelay, doubled for each attempt before it, with jitter
+// and capped to 30 seconds. A baseDelay of 0 or less waits 500 milliseconds before
+// the first retry. Each attempt has the timeout of the adapter, and each retry is
+// logged. The retries are made within the retries of WithThrottleRetry when both
+// are set. Like with WithThrottleRetry, a custom line handler may be passed lines
+// of the policy again. Attempts of less than 2 disable the retries.
+func WithLoadRetry(attempts int, baseDelay time.Duration) Option {
+	return func(a *Adapter) {
+		a.loadAttempts = attempts
+		a.loadRetryBaseDelay = baseDelay
+	}
+}
@@ -0,0 +1,57 @@
+package blobadapter
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+)
+
+// secretPattern matches the sensitive query parameters of SAS URLs, the signature
+// and the object and tenant IDs of the key of a user delegation SAS, and the account
+// key and shared access signature of connection strings, capturing the name of the
+// value.
+var secretPattern = regexp.MustCompile(`(?i)(\b(?:sig|skoid|sktid|saoid|suoid)=|AccountKey=|SharedAccessSignature=)[^&;\s"']+`)
+
+// redacted replaces secrets in logs and error messages.
+const redacted = "REDACTED"
+
+// redact returns s with the secrets matched by secretPattern replaced.
+func redact(s string) string {
+	return secretPattern.ReplaceAllString(s, "${1}"+redacted)
+}
+
+// redactURLError redacts the URL of a *url.Error wrapped by err in place, so
+// that the secrets are also removed for callers that use errors.As. Errors of
+// the HTTP client contain the full URL of the request, including a SAS.
+func redactURLError(err error) {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = redact(urlErr.URL)
+	}
+}
+
+// redactedError is an error whose message has its secrets redacted. It wraps
+// the original error.
+type redactedError struct {
+	err error
+}
+
+// redactError returns err with the secrets of its message redacted. It returns
+// nil if err is nil.
+func redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	redactURLError(err)
+	return &redactedError{err: err}
+}
+
+// Error returns the redacted error message.
+func (e *redactedError) Error() string {
+	return redact(e.err.Error())
+}
+
+// Unwrap returns the original error.
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,200 @@
+package blobadapter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewAdapterFromConnectionString_Redact(t *testing.T) {
+	const token = "c2VjcmV0LXNhcy10b2tlbg%3D%3D"
+	logger := &mockLogger{}
+	_, gotErr := NewAdapterFromConnectionString(
+		"BlobEndpoint=https://account.blob.core.windows.net/;SharedAccessSignature=sv=2022-11-02&ss=b&sig="+token,
+		"container",
+		"blob",
+		WithLogger(logger),
+		WithSharedClient(false),
+		WithClientOptions(&azblob.ClientOptions{
+			ClientOptions: policy.ClientOptions{
+				Transport: errTransport{},
+				Retry:     policy.RetryOptions{MaxRetries: -1},
+			},
+		}),
+	)
+	if gotErr == nil {
+		t.Fatalf("NewAdapterFromConnectionString() expected error\n")
+	}
+
+	var urlErr *url.Error
+	if !errors.As(gotErr, &urlErr) {
+		t.Fatalf("NewAdapterFromConnectionString() expected url.Error, got: %v\n", gotErr)
+	}
+	for _, s := range append([]string{gotErr.Error(), urlErr.Error()}, logger.lines...) {
+		if strings.Contains(s, token) {
+			t.Errorf("NewAdapterFromConnectionString() unexpected SAS token in: %s\n", s)
+		}
+	}
+	if !strings.Contains(gotErr.Error(), "sig="+redacted) {
+		t.Errorf("NewAdapterFromConnectionString() expected redacted SAS in: %s\n", gotErr)
+	}
+}
+
+func TestAdapter_Redact(t *testing.T) {
+	const sasURL = "https://account.blob.core.windows.net/container/blob?sv=2022-11-02&skoid=b7a1f2c3&sktid=9e8d7c6b&sig=c2VjcmV0"
+	newErr := func() error {
+		return &url.Error{Op: "Get", URL: sasURL, Err: errTest}
+	}
+
+	var tests = []struct {
+		name  string
+		input func() error
+	}{
+		{
+			name: "Load policy",
+			input: func() error {
+				a := &Adapter{c: &mockBlobClient{errDownload: newErr()}, container: "container", blob: "blob", timeout: time.Second * 10}
+				m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+				if err != nil {
+					t.Fatalf("error in test: %v\n", err)
+				}
+				return a.LoadPolicy(m)
+			},
+		},
+		{
+			name: "Save policy",
+			input: func() error {
+				a := &Adapter{c: &mockBlobClient{errUpload: newErr()}, container: "container", blob: "blob", timeout: time.Second * 10}
+				m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+				if err != nil {
+					t.Fatalf("error in test: %v\n", err)
+				}
+				return a.SavePolicy(m)
+			},
+		},
+		{
+			name: "Create adapter",
+			input: func() error {
+				_, err := NewAdapter("account", "container", "blob", &mockCredential{}, func(a *Adapter) {
+					a.c = &mockBlobClient{errCreate: newErr()}
+				})
+				return err
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gotErr := test.input()
+			if gotErr == nil {
+				t.Fatalf("%s expected error\n", test.name)
+			}
+			var urlErr *url.Error
+			if !errors.As(gotErr, &urlErr) {
+				t.Fatalf("%s expected url.Error, got: %v\n", test.name, gotErr)
+			}
+			for _, s := range []string{gotErr.Error(), urlErr.URL} {
+				for _, secret := range []string{"c2VjcmV0", "b7a1f2c3", "9e8d7c6b"} {
+					if strings.Contains(s, secret) {
+						t.Errorf("%s unexpected secret %q in: %s\n", test.name, secret, s)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAdapter_LastOperationInfo_Redact(t *testing.T) {
+	const token = "c2VjcmV0LXNhcy10b2tlbg%3D%3D"
+	c, err := newBlobClient(azblob.NewClientWithNoCredential("https://account.blob.core.windows.net/?sv=2022-11-02&skoid=b7a1f2c3&sig="+token, &azblob.ClientOptions{
+		ClientOptions: policy.ClientOptions{
+			Transport: errTransport{},
+			Retry:     policy.RetryOptions{MaxRetries: -1},
+		},
+	}))
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	a := &Adapter{c: c, container: "container", blob: "blob", timeout: time.Second * 10}
+
+	// The download is not wrapped in a StorageError, like the failed read
+	// from the secondary endpoint before the fallback to the primary.
+	if _, err := a.downloadStreamFrom(context.Background(), a.blob, nil); err == nil {
+		t.Fatalf("downloadStreamFrom() expected error\n")
+	}
+	gotErr := a.LastOperationInfo().Err
+	if gotErr == nil {
+		t.Fatalf("LastOperationInfo() expected error\n")
+	}
+	var urlErr *url.Error
+	if !errors.As(gotErr, &urlErr) {
+		t.Fatalf("LastOperationInfo() expected url.Error, got: %v\n", gotErr)
+	}
+	for _, s := range []string{gotErr.Error(), urlErr.URL} {
+		for _, secret := range []string{token, "b7a1f2c3"} {
+			if strings.Contains(s, secret) {
+				t.Errorf("LastOperationInfo() unexpected secret %q in: %s\n", secret, s)
+			}
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "Redact SAS signature of URL",
+			input: `Get "https://account.blob.core.windows.net/container?sv=2022-11-02&sig=abc%2Fdef&se=2030": EOF`,
+			want:  `Get "https://account.blob.core.windows.net/container?sv=2022-11-02&sig=REDACTED&se=2030": EOF`,
+		},
+		{
+			name:  "Redact account key of connection string",
+			input: "DefaultEndpointsProtocol=https;AccountName=account;AccountKey=a2V5==;EndpointSuffix=core.windows.net",
+			want:  "DefaultEndpointsProtocol=https;AccountName=account;AccountKey=REDACTED;EndpointSuffix=core.windows.net",
+		},
+		{
+			name:  "Redact shared access signature of connection string",
+			input: "BlobEndpoint=https://account.blob.core.windows.net/;SharedAccessSignature=sv=2022-11-02&sig=abc",
+			want:  "BlobEndpoint=https://account.blob.core.windows.net/;SharedAccessSignature=REDACTED&sig=REDACTED",
+		},
+		{
+			name:  "Redact key IDs of user delegation SAS",
+			input: "https://account.blob.core.windows.net/container?skoid=abc&sktid=def&skt=2030&sig=ghi",
+			want:  "https://account.blob.core.windows.net/container?skoid=REDACTED&sktid=REDACTED&skt=2030&sig=REDACTED",
+		},
+		{
+			name:  "Message without secrets",
+			input: "blob does not exist: policy.csv",
+			want:  "blob does not exist: policy.csv",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := redact(test.input)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("redact() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+// errTransport is a transport that fails every request with a *url.Error
+// containing the full URL of the request, like the transport of net/http.
+type errTransport struct{}
+
+func (t errTransport) Do(req *http.Request) (*http.Response, error) {
+	return nil, &url.Error{Op: req.Method, URL: req.URL.String(), Err: errTest}
+}
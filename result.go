@@ -0,0 +1,47 @@
+package blobadapter
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// SaveResult contains the result of a save of the policy.
+type SaveResult struct {
+	// Bytes is the number of bytes of the serialized policy that were written.
+	Bytes int64
+	// Rules is the number of rules by policy type (p, p2, g, g2 ...) that were
+	// saved.
+	Rules map[string]int
+	// ContainerCreated is set if the container did not exist and was created.
+	ContainerCreated bool
+	// ETag is the ETag of the saved blob.
+	ETag azcore.ETag
+	// BackupCreated is set if a copy of the previous blob was made with
+	// WithBackupOnSave or WithBackupHistory.
+	BackupCreated bool
+}
+
+// SavePolicyWithResult saves all policy rules to the storage like SavePolicy and
+// returns the result of the save.
+func (a *Adapter) SavePolicyWithResult(model model.Model) (SaveResult, error) {
+	return a.SavePolicyWithResultCtx(a.baseContext(), model)
+}
+
+// SavePolicyWithResultCtx saves all policy rules to the storage with context like
+// SavePolicyCtx and returns the result of the save. With WithDryRun nothing is
+// written and only Bytes and Rules are set.
+func (a *Adapter) SavePolicyWithResultCtx(ctx context.Context, model model.Model) (SaveResult, error) {
+	return a.savePolicy(ctx, model, false)
+}
+
+// ptypeCounts returns the number of rules, each starting with its ptype, by
+// policy type.
+func ptypeCounts(rules [][]string) map[string]int {
+	counts := make(map[string]int)
+	for _, rule := range rules {
+		counts[rule[0]]++
+	}
+	return counts
+}
@@ -0,0 +1,97 @@
+package blobadapter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAdapter_SavePolicyWithResult(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			client  *mockBlobClient
+			options []Option
+		}
+		want SaveResult
+	}{
+		{
+			name: "Save policy and create container",
+			input: struct {
+				client  *mockBlobClient
+				options []Option
+			}{
+				client: &mockBlobClient{},
+			},
+			want: SaveResult{
+				Bytes:            30,
+				Rules:            map[string]int{"p": 1, "g": 0},
+				ContainerCreated: true,
+				ETag:             azcore.ETag("\"0x1\""),
+			},
+		},
+		{
+			name: "Save policy with backup",
+			input: struct {
+				client  *mockBlobClient
+				options []Option
+			}{
+				client:  &mockBlobClient{errCreate: &azcore.ResponseError{ErrorCode: string(bloberror.ContainerAlreadyExists)}},
+				options: []Option{WithBackupOnSave("")},
+			},
+			want: SaveResult{
+				Bytes:         30,
+				Rules:         map[string]int{"p": 1, "g": 0},
+				ETag:          azcore.ETag("\"0x1\""),
+				BackupCreated: true,
+			},
+		},
+		{
+			name: "Save policy with dry run",
+			input: struct {
+				client  *mockBlobClient
+				options []Option
+			}{
+				client:  &mockBlobClient{},
+				options: []Option{WithDryRun(true)},
+			},
+			want: SaveResult{
+				Bytes: 30,
+				Rules: map[string]int{"p": 1, "g": 0},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         test.input.client,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+				logger:    &mockLogger{},
+			}
+			for _, option := range test.input.options {
+				option(a)
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			m.AddPolicy("p", "p", []string{"alice", "domain1", "data1", "read"})
+
+			got, err := a.SavePolicyWithResult(m)
+			if err != nil {
+				t.Fatalf("SavePolicyWithResult() unexpected error: %v\n", err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("SavePolicyWithResult() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
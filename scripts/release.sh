@@ -11,6 +11,11 @@ if [[ ! $version =~ ^[0-9]+\.[0-9]+\.[0-9]+$ ]]; then
   exit 1
 fi
 
+if ! grep -q "const Version = \"$version\"" version.go; then
+  echo "Version must match the Version constant in version.go."
+  exit 1
+fi
+
 if [[ $(git branch --show-current) != "main" ]]; then
   echo "Must be on main branch."
   exit 1
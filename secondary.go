@@ -0,0 +1,142 @@
+package blobadapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+)
+
+// secondarySuffix is appended to the account name of the host of the primary
+// endpoint to get the host of the secondary endpoint of a geo-redundant account.
+const secondarySuffix = "-secondary"
+
+// secondaryReadKey is the context key of requests that should be sent to the
+// secondary endpoint.
+type secondaryReadKey struct{}
+
+// withSecondaryRead returns a context for requests that should be sent to the
+// secondary endpoint of the account.
+func withSecondaryRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, secondaryReadKey{}, true)
+}
+
+// isSecondaryRead reports whether requests with ctx should be sent to the secondary
+// endpoint of the account.
+func isSecondaryRead(ctx context.Context) bool {
+	read, _ := ctx.Value(secondaryReadKey{}).(bool)
+	return read
+}
+
+// secondaryReadPolicy is a policy that sends requests with a context returned by
+// withSecondaryRead to the secondary endpoint of the account.
+type secondaryReadPolicy struct{}
+
+// Do replaces the host of the request with the host of the secondary endpoint if
+// the request should be sent to it.
+func (p secondaryReadPolicy) Do(req *policy.Request) (*http.Response, error) {
+	if isSecondaryRead(req.Raw().Context()) {
+		if host, ok := secondaryHost(req.Raw().URL.Host); ok {
+			req.Raw().URL.Host = host
+			req.Raw().Host = host
+		}
+	}
+	return req.Next()
+}
+
+// secondaryHost returns the host of the secondary endpoint for the host of a primary
+// endpoint, e.g. account-secondary.blob.core.windows.net for
+// account.blob.core.windows.net. It returns false for hosts without an account name,
+// such as IP addresses of the storage emulator.
+func secondaryHost(host string) (string, bool) {
+	hostname, port := host, ""
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		hostname, port = h, ":"+p
+	}
+	if net.ParseIP(hostname) != nil {
+		return "", false
+	}
+	i := strings.IndexByte(hostname, '.')
+	if i <= 0 {
+		return "", false
+	}
+	if strings.HasSuffix(hostname[:i], secondarySuffix) {
+		return host, true
+	}
+	return hostname[:i] + secondarySuffix + hostname[i:] + port, true
+}
+
+// downloadStream downloads the blob name. With WithSecondaryReads it is downloaded
+// from the secondary endpoint, falling back to the primary endpoint if that fails.
+// If both fail the error of the primary endpoint is returned wrapped with the error
+// of the secondary endpoint. It returns the context to read the body with, which
+// targets the endpoint the blob was downloaded from.
+func (a *Adapter) downloadStream(ctx context.Context, name string, o *azblob.DownloadStreamOptions) (context.Context, azblob.DownloadStreamResponse, error) {
+	if !a.secondaryReads {
+		res, err := a.downloadStreamFrom(ctx, name, o)
+		return ctx, res, err
+	}
+
+	secondary := withSecondaryRead(ctx)
+	res, err := a.downloadStreamFrom(secondary, name, o)
+	if err == nil || ctx.Err() != nil {
+		return secondary, res, err
+	}
+	serr := secondaryError(err)
+	a.logf("blobadapter: reading blob %s from secondary endpoint: %v, reading from primary endpoint", name, serr)
+	if res, err = a.downloadStreamFrom(ctx, name, o); err != nil {
+		return ctx, res, &endpointsError{primary: err, secondary: serr}
+	}
+	return ctx, res, nil
+}
+
+// endpointsError is the error of a read that failed on both the secondary and
+// the primary endpoint. It wraps the error of the primary endpoint, which is the
+// one matched by errors.As, and also matches the error of the secondary endpoint
+// with errors.Is, e.g. ErrSecondaryNotAvailable.
+type endpointsError struct {
+	primary   error
+	secondary error
+}
+
+// Error returns the message of the error of the primary endpoint followed by
+// the message of the error of the secondary endpoint.
+func (e *endpointsError) Error() string {
+	return e.primary.Error() + " (secondary endpoint: " + e.secondary.Error() + ")"
+}
+
+// Is reports whether the error of the secondary endpoint matches target. The
+// error of the primary endpoint is matched through Unwrap.
+func (e *endpointsError) Is(target error) bool {
+	return errors.Is(e.secondary, target)
+}
+
+// Unwrap returns the error of the primary endpoint.
+func (e *endpointsError) Unwrap() error {
+	return e.primary
+}
+
+// downloadStreamFrom downloads the blob name with ctx and records the request.
+func (a *Adapter) downloadStreamFrom(ctx context.Context, name string, o *azblob.DownloadStreamOptions) (azblob.DownloadStreamResponse, error) {
+	a.requests.add(operationDownload)
+	var raw *http.Response
+	res, err := a.c.DownloadStream(captureResponse(ctx, &raw), a.container, name, o)
+	a.recordOperation(operationInfoDownload, raw, res.RequestID, res.ClientRequestID, err)
+	return res, err
+}
+
+// secondaryError returns err of a read from the secondary endpoint, wrapped with
+// ErrSecondaryNotAvailable if the container or blob is not found, which happens
+// when it is not yet replicated to the secondary endpoint.
+func secondaryError(err error) error {
+	if bloberror.HasCode(err, bloberror.ContainerNotFound, bloberror.BlobNotFound) {
+		return fmt.Errorf("%w: %v", ErrSecondaryNotAvailable, err)
+	}
+	return err
+}
@@ -0,0 +1,234 @@
+package blobadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAdapter_SecondaryReads(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			client    *mockBlobClient
+			secondary bool
+		}
+		wantSecondaryReads int
+		wantDownloads      int64
+		wantLog            bool
+	}{
+		{
+			name: "Load policy from secondary endpoint",
+			input: struct {
+				client    *mockBlobClient
+				secondary bool
+			}{
+				client:    &mockBlobClient{},
+				secondary: true,
+			},
+			wantSecondaryReads: 1,
+			wantDownloads:      1,
+		},
+		{
+			name: "Load policy from primary endpoint after failed secondary read",
+			input: struct {
+				client    *mockBlobClient
+				secondary bool
+			}{
+				client:    &mockBlobClient{errSecondary: &azcore.ResponseError{ErrorCode: string(bloberror.BlobNotFound)}},
+				secondary: true,
+			},
+			wantSecondaryReads: 1,
+			wantDownloads:      2,
+			wantLog:            true,
+		},
+		{
+			name: "Load policy from primary endpoint",
+			input: struct {
+				client    *mockBlobClient
+				secondary bool
+			}{
+				client: &mockBlobClient{},
+			},
+			wantDownloads: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger := &mockLogger{}
+			a := &Adapter{
+				c:         test.input.client,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+				logger:    logger,
+			}
+			WithSecondaryReads(test.input.secondary)(a)
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			if err := a.LoadPolicy(m); err != nil {
+				t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+			}
+			if diff := cmp.Diff([][]string{{"alice", "domain1", "data1", "read"}}, m["p"]["p"].Policy); diff != "" {
+				t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantSecondaryReads, test.input.client.secondaryReads); diff != "" {
+				t.Errorf("LoadPolicy() unexpected secondary reads (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantDownloads, a.RequestCounts().Download); diff != "" {
+				t.Errorf("LoadPolicy() unexpected downloads (-want +got):\n%s\n", diff)
+			}
+			if test.wantLog != (len(logger.lines) > 0) {
+				t.Errorf("LoadPolicy() unexpected log lines: %v\n", logger.lines)
+			}
+
+			// Writes are made to the primary endpoint.
+			if err := a.SavePolicy(m); err != nil {
+				t.Fatalf("SavePolicy() unexpected error: %v\n", err)
+			}
+			if diff := cmp.Diff(test.wantSecondaryReads, test.input.client.secondaryReads); diff != "" {
+				t.Errorf("SavePolicy() unexpected secondary reads (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_SecondaryReads_Error(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   *mockBlobClient
+		wantErr []error
+	}{
+		{
+			name: "Load policy with error on both endpoints (not replicated)",
+			input: &mockBlobClient{
+				errSecondary: &azcore.ResponseError{ErrorCode: string(bloberror.BlobNotFound)},
+				errDownload:  errTest,
+			},
+			wantErr: []error{ErrSecondaryNotAvailable, errTest},
+		},
+		{
+			name: "Load policy with error on both endpoints",
+			input: &mockBlobClient{
+				errSecondary: errTest,
+				errDownload: &azcore.ResponseError{
+					ErrorCode: string(bloberror.BlobNotFound),
+				},
+			},
+			wantErr: []error{ErrBlobDoesNotExist, errTest},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         test.input,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+				logger:    &mockLogger{},
+			}
+			WithSecondaryReads(true)(a)
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			gotErr := a.LoadPolicy(m)
+			for _, wantErr := range test.wantErr {
+				if !errors.Is(gotErr, wantErr) {
+					t.Errorf("LoadPolicy() unexpected error, want: %v, got: %v\n", wantErr, gotErr)
+				}
+			}
+		})
+	}
+}
+
+func TestSecondaryReadPolicy(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			url       string
+			secondary bool
+		}
+		want string
+	}{
+		{
+			name: "Request to secondary endpoint",
+			input: struct {
+				url       string
+				secondary bool
+			}{
+				url:       "https://account.blob.core.windows.net/",
+				secondary: true,
+			},
+			want: "account-secondary.blob.core.windows.net",
+		},
+		{
+			name: "Request to primary endpoint",
+			input: struct {
+				url       string
+				secondary bool
+			}{
+				url: "https://account.blob.core.windows.net/",
+			},
+			want: "account.blob.core.windows.net",
+		},
+		{
+			name: "Request to secondary endpoint with port",
+			input: struct {
+				url       string
+				secondary bool
+			}{
+				url:       "http://account.blob.localhost:10000/",
+				secondary: true,
+			},
+			want: "account-secondary.blob.localhost:10000",
+		},
+		{
+			name: "Request to secondary endpoint of IP address",
+			input: struct {
+				url       string
+				secondary bool
+			}{
+				url:       "http://127.0.0.1:10000/devstoreaccount1/",
+				secondary: true,
+			},
+			want: "127.0.0.1:10000",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := &mockTransport{}
+			o := (&Adapter{}).newClientOptions()
+			o.Transport = transport
+			c, err := azblob.NewClientWithNoCredential(test.input.url, o)
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			ctx := context.Background()
+			if test.input.secondary {
+				ctx = withSecondaryRead(ctx)
+			}
+			if _, err := c.DownloadStream(ctx, "container", "blob", nil); err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			if diff := cmp.Diff(test.want, transport.req.URL.Host); diff != "" {
+				t.Errorf("secondaryReadPolicy unexpected host (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package blobadapter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+)
+
+// metadataSignature is the metadata key of the hex-encoded HMAC-SHA256 signature
+// of the content of the policy blob.
+const metadataSignature = "casbin_hmac_sha256"
+
+// newMAC returns a new HMAC-SHA256 with the signing key set with WithSigningKey,
+// or nil if no key is set.
+func (a *Adapter) newMAC() hash.Hash {
+	if len(a.signingKeys) == 0 {
+		return nil
+	}
+	return hmac.New(sha256.New, a.signingKeys[0])
+}
+
+// verifySignature verifies that the signature stored in metadata matches the
+// HMAC-SHA256 of the content b of the blob name with one of the keys set with
+// WithSigningKey. Otherwise ErrSignatureInvalid is returned.
+func (a *Adapter) verifySignature(name string, b []byte, metadata map[string]*string) error {
+	stored := metadataValue(metadata, metadataSignature)
+	if len(stored) == 0 {
+		return fmt.Errorf("%w: blob %s has no signature", ErrSignatureInvalid, name)
+	}
+	signature, err := hex.DecodeString(stored)
+	if err != nil {
+		return fmt.Errorf("%w: blob %s has a malformed signature", ErrSignatureInvalid, name)
+	}
+	for _, key := range a.signingKeys {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(b)
+		if hmac.Equal(mac.Sum(nil), signature) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: blob %s does not match its signature", ErrSignatureInvalid, name)
+}
@@ -0,0 +1,151 @@
+package blobadapter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_SigningKey(t *testing.T) {
+	content := "p, alice, domain1, data1, read"
+	sign := func(key, s string) *string {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(s))
+		return toPtr(hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	var tests = []struct {
+		name  string
+		input struct {
+			metadata map[string]*string
+			keys     []string
+		}
+		want    [][]string
+		wantErr error
+	}{
+		{
+			name: "Load policy with signature",
+			input: struct {
+				metadata map[string]*string
+				keys     []string
+			}{
+				metadata: map[string]*string{"Casbin_hmac_sha256": sign("key", content)},
+				keys:     []string{"key"},
+			},
+			want: [][]string{{"alice", "domain1", "data1", "read"}},
+		},
+		{
+			name: "Load policy with signature of previous key",
+			input: struct {
+				metadata map[string]*string
+				keys     []string
+			}{
+				metadata: map[string]*string{"casbin_hmac_sha256": sign("old", content)},
+				keys:     []string{"new", "old"},
+			},
+			want: [][]string{{"alice", "domain1", "data1", "read"}},
+		},
+		{
+			name: "Load policy with error (signature mismatch)",
+			input: struct {
+				metadata map[string]*string
+				keys     []string
+			}{
+				metadata: map[string]*string{"casbin_hmac_sha256": sign("other", content)},
+				keys:     []string{"key"},
+			},
+			wantErr: ErrSignatureInvalid,
+		},
+		{
+			name: "Load policy with error (content modified)",
+			input: struct {
+				metadata map[string]*string
+				keys     []string
+			}{
+				metadata: map[string]*string{"casbin_hmac_sha256": sign("key", "p, bob, domain1, data1, read")},
+				keys:     []string{"key"},
+			},
+			wantErr: ErrSignatureInvalid,
+		},
+		{
+			name: "Load policy with error (signature missing)",
+			input: struct {
+				metadata map[string]*string
+				keys     []string
+			}{
+				keys: []string{"key"},
+			},
+			wantErr: ErrSignatureInvalid,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         &mockBlobClient{content: []byte(content), blobMetadata: test.input.metadata},
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			var previous [][]byte
+			for _, key := range test.input.keys[1:] {
+				previous = append(previous, []byte(key))
+			}
+			WithSigningKey([]byte(test.input.keys[0]), previous...)(a)
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			gotErr := a.LoadPolicy(m)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("LoadPolicy() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.want, m["p"]["p"].Policy); diff != "" {
+				t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_SigningKey_Save(t *testing.T) {
+	// Setting the metadata after the upload fails, so the saved policy only loads
+	// if the signature is uploaded with the content.
+	c := &mockBlobClient{errMetadata: errTest}
+	a, err := NewAdapter("account", "container", "blob", &mockCredential{}, func(a *Adapter) {
+		a.c = c
+	}, WithSigningKey([]byte("key")))
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+
+	m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	if err := a.LoadPolicy(m); err != nil {
+		t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+	}
+
+	m.AddPolicy("p", "p", []string{"alice", "domain1", "data1", "read"})
+	if err := a.SavePolicy(m); err != nil {
+		t.Fatalf("SavePolicy() unexpected error: %v\n", err)
+	}
+
+	WithSigningKey([]byte("new"), []byte("key"))(a)
+	m.ClearPolicy()
+	if err := a.LoadPolicy(m); err != nil {
+		t.Fatalf("LoadPolicy() unexpected error: %v\n", err)
+	}
+	want := [][]string{{"alice", "domain1", "data1", "read"}}
+	if diff := cmp.Diff(want, m["p"]["p"].Policy); diff != "" {
+		t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+	}
+}
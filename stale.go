@@ -0,0 +1,61 @@
+package blobadapter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// ForceSave saves all policy rules to the storage without the stale-write check
+// of WithStaleWriteProtection, overwriting any changes made since the policy was
+// loaded.
+func (a *Adapter) ForceSave(model model.Model) error {
+	return a.ForceSaveCtx(a.baseContext(), model)
+}
+
+// ForceSaveCtx saves all policy rules to the storage with context without the
+// stale-write check of WithStaleWriteProtection.
+func (a *Adapter) ForceSaveCtx(ctx context.Context, model model.Model) error {
+	_, err := a.savePolicy(ctx, model, true)
+	return err
+}
+
+// checkStale returns ErrPolicyModifiedSinceLoad if the ETag of the blob differs
+// from the ETag when the policy was last loaded or saved. A blob that did not
+// exist when it was loaded must still not exist. If the policy has not been
+// loaded there is nothing to compare with and the check passes.
+func (a *Adapter) checkStale(ctx context.Context) error {
+	loaded, ok := a.loadedETag.Load().(azcore.ETag)
+	if !ok {
+		return nil
+	}
+	return a.checkETag(ctx, loaded)
+}
+
+// checkETag returns ErrPolicyModifiedSinceLoad if the ETag of the blob is not
+// etag. An empty etag matches a blob that does not exist.
+func (a *Adapter) checkETag(ctx context.Context, etag azcore.ETag) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	a.requests.add(operationOther)
+	var raw *http.Response
+	props, err := a.c.GetProperties(captureResponse(ctx, &raw), a.container, a.blob, nil)
+	a.recordOperation(operationInfoProperties, raw, props.RequestID, props.ClientRequestID, err)
+	var current azcore.ETag
+	if err != nil {
+		if !bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.ContainerNotFound) {
+			return newStorageError(err)
+		}
+	} else if props.ETag != nil {
+		current = *props.ETag
+	}
+	if current != etag {
+		return fmt.Errorf("%w: blob %s has ETag %q, expected %q", ErrPolicyModifiedSinceLoad, a.blob, current, etag)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package blobadapter
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_StaleWriteProtection(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			load     bool
+			modified bool
+			force    bool
+			saves    int
+		}
+		wantUploads int
+		wantErr     error
+	}{
+		{
+			name: "Save policy after load",
+			input: struct {
+				load     bool
+				modified bool
+				force    bool
+				saves    int
+			}{
+				load:  true,
+				saves: 2,
+			},
+			wantUploads: 2,
+		},
+		{
+			name: "Save policy without load",
+			input: struct {
+				load     bool
+				modified bool
+				force    bool
+				saves    int
+			}{
+				saves: 1,
+			},
+			wantUploads: 1,
+		},
+		{
+			name: "Force save policy modified since load",
+			input: struct {
+				load     bool
+				modified bool
+				force    bool
+				saves    int
+			}{
+				load:     true,
+				modified: true,
+				force:    true,
+				saves:    1,
+			},
+			wantUploads: 2,
+		},
+		{
+			name: "Save policy with error (modified since load)",
+			input: struct {
+				load     bool
+				modified bool
+				force    bool
+				saves    int
+			}{
+				load:     true,
+				modified: true,
+				saves:    1,
+			},
+			wantUploads: 1,
+			wantErr:     ErrPolicyModifiedSinceLoad,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &mockBlobClient{}
+			a := &Adapter{
+				c:         c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+			WithStaleWriteProtection()(a)
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+			if test.input.load {
+				if err := a.LoadPolicy(m); err != nil {
+					t.Fatalf("error in test: %v\n", err)
+				}
+			}
+			if test.input.modified {
+				c.uploads++
+			}
+
+			var gotErr error
+			for i := 0; i < test.input.saves && gotErr == nil; i++ {
+				if test.input.force {
+					gotErr = a.ForceSave(m)
+				} else {
+					gotErr = a.SavePolicy(m)
+				}
+			}
+
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("SavePolicy() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantUploads, c.uploads); diff != "" {
+				t.Errorf("SavePolicy() unexpected number of uploads (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestAdapter_StaleWriteProtection_ModifiedDuringSave(t *testing.T) {
+	var changes int
+	a, err := NewInMemoryAdapter(WithStaleWriteProtection(), WithChangeCallback(func(added, removed [][]string) {
+		changes++
+	}))
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	mc := a.c.(*memoryClient)
+	if _, err := mc.UploadStream(context.Background(), a.container, a.blob, strings.NewReader("p, alice, domain1, data1, read"), nil); err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	c := &racingClient{memoryClient: mc}
+	a.c = c
+
+	m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	if err := a.LoadPolicy(m); err != nil {
+		t.Fatalf("error in test: %v\n", err)
+	}
+	c.race = func() {
+		if _, err := mc.UploadStream(context.Background(), a.container, a.blob, strings.NewReader("p, carol, domain1, data1, read"), nil); err != nil {
+			t.Fatalf("error in test: %v\n", err)
+		}
+	}
+	m.AddPolicy("p", "p", []string{"bob", "domain1", "data2", "write"})
+
+	gotErr := a.SavePolicy(m)
+	if diff := cmp.Diff(ErrPolicyModifiedSinceLoad, gotErr, cmpopts.EquateErrors()); diff != "" {
+		t.Errorf("SavePolicy() unexpected error (-want +got):\n%s\n", diff)
+	}
+	if diff := cmp.Diff("p, carol, domain1, data1, read", string(mc.containers[a.container][a.blob].content)); diff != "" {
+		t.Errorf("SavePolicy() unexpected policy (-want +got):\n%s\n", diff)
+	}
+	if diff := cmp.Diff(0, changes); diff != "" {
+		t.Errorf("SavePolicy() unexpected number of changes (-want +got):\n%s\n", diff)
+	}
+}
@@ -0,0 +1,243 @@
+package blobadapter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// RequestCounts contains the number of storage requests issued
+// by the adapter, by operation.
+type RequestCounts struct {
+	// List is the number of list requests (containers and blobs).
+	List int64
+	// Download is the number of download requests.
+	Download int64
+	// Upload is the number of upload requests.
+	Upload int64
+	// Create is the number of create container requests.
+	Create int64
+	// Other is the number of other requests, like setting the
+	// immutability policy or legal hold.
+	Other int64
+}
+
+// Total returns the total number of storage requests.
+func (c RequestCounts) Total() int64 {
+	return c.List + c.Download + c.Upload + c.Create + c.Other
+}
+
+// operation is a kind of storage request.
+type operation int
+
+const (
+	operationList operation = iota
+	operationDownload
+	operationUpload
+	operationCreate
+	operationOther
+)
+
+// requestCounter counts storage requests by operation. It is safe
+// for concurrent use.
+type requestCounter struct {
+	list     int64
+	download int64
+	upload   int64
+	create   int64
+	other    int64
+}
+
+// add increments the counter for the provided operation.
+func (c *requestCounter) add(op operation) {
+	switch op {
+	case operationList:
+		atomic.AddInt64(&c.list, 1)
+	case operationDownload:
+		atomic.AddInt64(&c.download, 1)
+	case operationUpload:
+		atomic.AddInt64(&c.upload, 1)
+	case operationCreate:
+		atomic.AddInt64(&c.create, 1)
+	case operationOther:
+		atomic.AddInt64(&c.other, 1)
+	}
+}
+
+// counts returns a snapshot of the counters.
+func (c *requestCounter) counts() RequestCounts {
+	return RequestCounts{
+		List:     atomic.LoadInt64(&c.list),
+		Download: atomic.LoadInt64(&c.download),
+		Upload:   atomic.LoadInt64(&c.upload),
+		Create:   atomic.LoadInt64(&c.create),
+		Other:    atomic.LoadInt64(&c.other),
+	}
+}
+
+// RequestCount returns the total number of storage requests issued by the adapter.
+func (a *Adapter) RequestCount() int64 {
+	return a.requests.counts().Total()
+}
+
+// RequestCounts returns the number of storage requests issued by the adapter,
+// by operation.
+func (a *Adapter) RequestCounts() RequestCounts {
+	return a.requests.counts()
+}
+
+// Stats contains statistics about the last successful load and save
+// of the policy.
+type Stats struct {
+	// LastLoad contains statistics about the last load of the policy.
+	LastLoad OperationStats
+	// LastSave contains statistics about the last save of the policy.
+	LastSave OperationStats
+}
+
+// OperationStats contains statistics about a load or save of the policy.
+// It is the zero value if the operation has not been performed.
+type OperationStats struct {
+	// Rules is the number of rules in the model by policy type (p, p2, g, g2 ...)
+	// after the operation.
+	Rules map[string]int
+	// Bytes is the number of bytes downloaded or uploaded.
+	Bytes int64
+	// Duration is the duration of the operation.
+	Duration time.Duration
+	// At is the time the operation started.
+	At time.Time
+}
+
+// operationStats stores the statistics of the last load and save, and the
+// information about the last storage request. It is safe for concurrent use.
+type operationStats struct {
+	load atomic.Value
+	save atomic.Value
+	last atomic.Value
+}
+
+// snapshot returns the stored statistics.
+func (s *operationStats) snapshot() Stats {
+	var stats Stats
+	if v, ok := s.load.Load().(OperationStats); ok {
+		stats.LastLoad = v
+	}
+	if v, ok := s.save.Load().(OperationStats); ok {
+		stats.LastSave = v
+	}
+	return stats
+}
+
+// newOperationStats returns the statistics of an operation that started at
+// start and transferred n bytes.
+func newOperationStats(model model.Model, n int64, start time.Time) OperationStats {
+	return OperationStats{
+		Rules:    ruleCounts(model),
+		Bytes:    n,
+		Duration: time.Since(start),
+		At:       start,
+	}
+}
+
+// ruleCounts returns the number of rules in the model by policy type.
+func ruleCounts(model model.Model) map[string]int {
+	counts := make(map[string]int)
+	for _, sec := range []string{"p", "g"} {
+		for ptype, ast := range model[sec] {
+			counts[ptype] = len(ast.Policy)
+		}
+	}
+	return counts
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read reads from the underlying reader and counts the bytes read.
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// Stats returns statistics about the last successful load and save of
+// the policy.
+func (a *Adapter) Stats() Stats {
+	return a.stats.snapshot()
+}
+
+// OperationInfo contains information about the most recent download, upload
+// or properties request to the storage, to be provided when contacting Azure
+// support.
+type OperationInfo struct {
+	// Operation is the kind of request: download, upload or properties.
+	Operation string
+	// ClientRequestID is the x-ms-client-request-id of the request.
+	ClientRequestID string
+	// RequestID is the x-ms-request-id returned by the storage.
+	RequestID string
+	// StatusCode is the HTTP status code of the response, if available.
+	StatusCode int
+	// Err is the error of the request, nil if it succeeded. Secrets like the
+	// signature of a SAS are redacted from it.
+	Err error
+	// At is the time the request completed.
+	At time.Time
+}
+
+// Kinds of requests in OperationInfo.
+const (
+	operationInfoDownload   = "download"
+	operationInfoUpload     = "upload"
+	operationInfoProperties = "properties"
+)
+
+// LastOperationInfo returns information about the most recent download, upload
+// or properties request to the storage, successful or not. It is the zero value
+// if no such request has been made.
+func (a *Adapter) LastOperationInfo() OperationInfo {
+	info, _ := a.stats.last.Load().(OperationInfo)
+	return info
+}
+
+// captureResponse returns a context that captures the raw HTTP response of the
+// request made with it into resp.
+func captureResponse(ctx context.Context, resp **http.Response) context.Context {
+	return policy.WithCaptureResponse(ctx, resp)
+}
+
+// recordOperation stores the information about a completed request. The request
+// IDs and status code are read from the captured raw response, or the response
+// of the error, with requestID and clientRequestID from the typed response taking
+// precedence when set. The secrets of the error are redacted, since not every
+// error of a request is wrapped in a StorageError.
+func (a *Adapter) recordOperation(op string, resp *http.Response, requestID, clientRequestID *string, err error) {
+	info := OperationInfo{Operation: op, Err: redactError(err), At: time.Now()}
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) && respErr.RawResponse != nil {
+		resp = respErr.RawResponse
+	}
+	if resp != nil {
+		info.StatusCode = resp.StatusCode
+		info.RequestID = resp.Header.Get(headerRequestID)
+		info.ClientRequestID = resp.Header.Get(headerClientRequestID)
+	}
+	if requestID != nil {
+		info.RequestID = *requestID
+	}
+	if clientRequestID != nil {
+		info.ClientRequestID = *clientRequestID
+	}
+	a.stats.last.Store(info)
+}
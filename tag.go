@@ -0,0 +1,86 @@
+package blobadapter
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// LoadPolicyByTag loads the policy rules of all blobs in the container whose index
+// tags match tagQuery into the model. See LoadPolicyByTagCtx.
+func (a *Adapter) LoadPolicyByTag(model model.Model, tagQuery string) error {
+	return a.LoadPolicyByTagCtx(a.baseContext(), model, tagQuery)
+}
+
+// LoadPolicyByTagCtx loads the policy rules of all blobs in the container whose index
+// tags match tagQuery (e.g. "tenant" = 'contoso') into the model with context. The
+// blobs are found by the storage with Find Blobs by Tags, and are loaded in the order
+// of their names with the line handler of the adapter. Since the index is updated
+// asynchronously, recently tagged blobs might not be found. The policy blob of the
+// adapter is only loaded if it matches the query.
+func (a *Adapter) LoadPolicyByTagCtx(ctx context.Context, model model.Model, tagQuery string) (err error) {
+	if len(a.container) == 0 {
+		return ErrInvalidContainer
+	}
+
+	start := time.Now()
+	if a.vars != nil {
+		defer func() {
+			a.vars.recordLoad(time.Since(start), "", err)
+		}()
+	}
+	names, err := a.findBlobsByTag(ctx, tagQuery)
+	if err != nil {
+		return err
+	}
+
+	var n int64
+	handler := a.policyLineHandler()
+	for _, name := range names {
+		read, _, err := a.loadBlob(ctx, name, model, handler, blob.HTTPRange{})
+		if err != nil {
+			return err
+		}
+		n += read
+	}
+
+	stats := newOperationStats(model, n, start)
+	a.stats.load.Store(stats)
+	if a.onLoad != nil {
+		info := LoadInfo{Rules: ruleCounts(model), Bytes: n, Duration: stats.Duration}
+		a.runHook("load", func() { a.onLoad(ctx, info) })
+	}
+	return nil
+}
+
+// findBlobsByTag returns the sorted names of the blobs in the container whose
+// tags match tagQuery.
+func (a *Adapter) findBlobsByTag(ctx context.Context, tagQuery string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	var names []string
+	o := &container.FilterBlobsOptions{}
+	for {
+		a.requests.add(operationList)
+		res, err := a.c.FilterBlobs(ctx, a.container, tagQuery, o)
+		if err != nil {
+			return nil, newStorageError(err)
+		}
+		for _, b := range res.Blobs {
+			if b.Name != nil {
+				names = append(names, *b.Name)
+			}
+		}
+		if res.NextMarker == nil || len(*res.NextMarker) == 0 {
+			break
+		}
+		o.Marker = res.NextMarker
+	}
+	sort.Strings(names)
+	return names, nil
+}
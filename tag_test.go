@@ -0,0 +1,93 @@
+package blobadapter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_LoadPolicyByTag(t *testing.T) {
+	blobs := map[string][]byte{
+		"tenant1/policy.csv": []byte("p, alice, domain1, data1, read\ng, alice, admin, domain1\n"),
+		"tenant1/extra.csv":  []byte("p, bob, domain1, data2, write\n"),
+	}
+
+	var tests = []struct {
+		name      string
+		input     *mockBlobClient
+		want      [][]string
+		wantGroup [][]string
+		wantErr   error
+	}{
+		{
+			name: "Load policy by tag",
+			input: &mockBlobClient{
+				blobs:       blobs,
+				filterPages: [][]string{{"tenant1/policy.csv"}, {"tenant1/extra.csv"}},
+			},
+			want: [][]string{
+				{"bob", "domain1", "data2", "write"},
+				{"alice", "domain1", "data1", "read"},
+			},
+			wantGroup: [][]string{
+				{"alice", "admin", "domain1"},
+			},
+		},
+		{
+			name:  "Load policy by tag without matching blobs",
+			input: &mockBlobClient{},
+		},
+		{
+			name:    "Load policy by tag with error (filter)",
+			input:   &mockBlobClient{errFilter: errTest},
+			wantErr: errTest,
+		},
+		{
+			name: "Load policy by tag with error (blob does not exist)",
+			input: &mockBlobClient{
+				errDownload: &azcore.ResponseError{
+					ErrorCode: string(bloberror.BlobNotFound),
+				},
+				filterPages: [][]string{{"tenant1/deleted.csv"}},
+			},
+			wantErr: ErrBlobDoesNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         test.input,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			gotErr := a.LoadPolicyByTag(m, `"tenant" = 'tenant1'`)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("LoadPolicyByTag() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.want, m["p"]["p"].Policy); diff != "" {
+				t.Errorf("LoadPolicyByTag() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantGroup, m["g"]["g"].Policy); diff != "" {
+				t.Errorf("LoadPolicyByTag() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if test.input.errFilter == nil {
+				if diff := cmp.Diff(`"tenant" = 'tenant1'`, test.input.filterQuery); diff != "" {
+					t.Errorf("LoadPolicyByTag() unexpected query (-want +got):\n%s\n", diff)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package blobadapter
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+const (
+	// headerRetryAfter is the header with the number of seconds, or the
+	// time, after which a throttled request can be retried.
+	headerRetryAfter = "Retry-After"
+	// defaultThrottleDelay is the delay before the first retry of a throttled
+	// operation if the response has no Retry-After header. It is doubled for
+	// each following retry.
+	defaultThrottleDelay = time.Second
+	// defaultMaxThrottleDelay is the maximum delay before a retry of a
+	// throttled operation.
+	defaultMaxThrottleDelay = time.Second * 30
+	// defaultLoadRetryDelay is the delay before the first retry of a load that
+	// failed with a transient error if no delay is set with WithLoadRetry.
+	defaultLoadRetryDelay = time.Millisecond * 500
+)
+
+// ThrottleInfo contains information about a throttled operation that is
+// retried. It is passed to the hook set with WithOnThrottle.
+type ThrottleInfo struct {
+	// Operation is the throttled operation, load or save.
+	Operation string
+	// StatusCode is the HTTP status code of the throttling response
+	// (429 or 503).
+	StatusCode int
+	// Attempt is the number of the retry, starting at 1.
+	Attempt int
+	// Delay is the time waited before the retry.
+	Delay time.Duration
+}
+
+// retryThrottled calls fn and retries it when it fails with a throttling response,
+// up to the number of retries set with WithThrottleRetry. Before each retry it waits
+// for the Retry-After of the response with jitter, capped to the maximum delay. The
+// retries stay within the timeout of the adapter: if the delay would exceed it, or
+// ctx is done, the last error is returned.
+func (a *Adapter) retryThrottled(ctx context.Context, operation string, fn func() error) error {
+	if a.throttleRetries < 1 {
+		return fn()
+	}
+
+	deadline := time.Now().Add(a.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		statusCode, retryAfter, ok := throttled(err)
+		if !ok || attempt > a.throttleRetries {
+			return err
+		}
+
+		delay := a.throttleDelay(retryAfter, attempt)
+		if time.Now().Add(delay).After(deadline) {
+			return err
+		}
+		a.logf("blobadapter: %s throttled with status %d, retrying in %s (retry %d of %d)", operation, statusCode, delay, attempt, a.throttleRetries)
+		if a.onThrottle != nil {
+			info := ThrottleInfo{Operation: operation, StatusCode: statusCode, Attempt: attempt, Delay: delay}
+			a.runHook("throttle", func() { a.onThrottle(ctx, info) })
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// throttleDelay returns the delay before the retry attempt. It is the Retry-After
+// of the response, or an exponential delay if it is not set, with up to 20%
+// jitter added, capped to the maximum delay.
+func (a *Adapter) throttleDelay(retryAfter time.Duration, attempt int) time.Duration {
+	maxDelay := a.maxThrottleDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultMaxThrottleDelay
+	}
+	delay := retryAfter
+	if delay < 0 {
+		delay = maxDelay
+		if shift := attempt - 1; shift < 16 {
+			delay = defaultThrottleDelay << shift
+		}
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	if jitter := int64(delay / 5); jitter > 0 {
+		delay += time.Duration(rand.Int63n(jitter))
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// retryLoad calls fn and retries it when it fails with a transient error, until
+// the number of attempts set with WithLoadRetry is reached. Before each retry it
+// waits for an exponential delay from the base delay with jitter, capped to the
+// maximum delay. If ctx is done the last error is returned.
+func (a *Adapter) retryLoad(ctx context.Context, fn func() error) error {
+	if a.loadAttempts < 2 {
+		return fn()
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if !transient(err) || attempt >= a.loadAttempts || ctx.Err() != nil {
+			return err
+		}
+
+		delay := a.loadRetryDelay(attempt)
+		a.logf("blobadapter: load failed with transient error, retrying in %s (attempt %d of %d): %v", delay, attempt+1, a.loadAttempts, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// loadRetryDelay returns the delay before the retry after attempt. It is the
+// base delay doubled for each attempt before it, with up to 20% jitter added,
+// capped to the maximum delay.
+func (a *Adapter) loadRetryDelay(attempt int) time.Duration {
+	delay := a.loadRetryBaseDelay
+	if delay <= 0 {
+		delay = defaultLoadRetryDelay
+	}
+	for i := 1; i < attempt && delay < defaultMaxThrottleDelay; i++ {
+		delay *= 2
+	}
+	if jitter := int64(delay / 5); jitter > 0 {
+		delay += time.Duration(rand.Int63n(jitter))
+	}
+	if delay > defaultMaxThrottleDelay {
+		delay = defaultMaxThrottleDelay
+	}
+	return delay
+}
+
+// transient reports whether err is caused by a response of the storage that
+// indicates a transient failure (408 Request Timeout, 429 Too Many Requests,
+// 500 Internal Server Error, 502 Bad Gateway, 503 Server Busy or 504 Gateway
+// Timeout), which a later request may not fail with.
+func transient(err error) bool {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return false
+	}
+	switch respErr.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// throttled reports whether err is caused by a throttling response (429 Too Many
+// Requests or 503 Server Busy) and returns its status code and Retry-After. The
+// Retry-After is negative if the response has no valid Retry-After header.
+func throttled(err error) (int, time.Duration, bool) {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return 0, 0, false
+	}
+	if respErr.StatusCode != http.StatusTooManyRequests && respErr.StatusCode != http.StatusServiceUnavailable {
+		return 0, 0, false
+	}
+	retryAfter := time.Duration(-1)
+	if respErr.RawResponse != nil {
+		retryAfter = parseRetryAfter(respErr.RawResponse.Header.Get(headerRetryAfter))
+	}
+	return respErr.StatusCode, retryAfter, true
+}
+
+// parseRetryAfter parses the value of a Retry-After header, either a number
+// of seconds or an HTTP date. It returns a negative duration if the value is
+// empty or invalid.
+func parseRetryAfter(v string) time.Duration {
+	if len(v) == 0 {
+		return -1
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		if seconds < 0 {
+			return -1
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+		return 0
+	}
+	return -1
+}
@@ -0,0 +1,322 @@
+package blobadapter
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_ThrottleRetry(t *testing.T) {
+	throttleErr := func(statusCode int, retryAfter string) *azcore.ResponseError {
+		return &azcore.ResponseError{
+			StatusCode: statusCode,
+			RawResponse: &http.Response{
+				StatusCode: statusCode,
+				Header:     http.Header{"Retry-After": []string{retryAfter}},
+			},
+		}
+	}
+
+	var tests = []struct {
+		name  string
+		input struct {
+			throttle []*azcore.ResponseError
+			retries  int
+			maxDelay time.Duration
+			save     bool
+		}
+		want    []ThrottleInfo
+		wantErr bool
+	}{
+		{
+			name: "Load policy after throttling",
+			input: struct {
+				throttle []*azcore.ResponseError
+				retries  int
+				maxDelay time.Duration
+				save     bool
+			}{
+				throttle: []*azcore.ResponseError{
+					throttleErr(http.StatusTooManyRequests, "0"),
+					throttleErr(http.StatusServiceUnavailable, "0"),
+				},
+				retries: 2,
+			},
+			want: []ThrottleInfo{
+				{Operation: "load", StatusCode: http.StatusTooManyRequests, Attempt: 1},
+				{Operation: "load", StatusCode: http.StatusServiceUnavailable, Attempt: 2},
+			},
+		},
+		{
+			name: "Save policy after throttling",
+			input: struct {
+				throttle []*azcore.ResponseError
+				retries  int
+				maxDelay time.Duration
+				save     bool
+			}{
+				throttle: []*azcore.ResponseError{
+					throttleErr(http.StatusTooManyRequests, "0"),
+				},
+				retries: 1,
+				save:    true,
+			},
+			want: []ThrottleInfo{
+				{Operation: "save", StatusCode: http.StatusTooManyRequests, Attempt: 1},
+			},
+		},
+		{
+			name: "Load policy with error (retries exhausted)",
+			input: struct {
+				throttle []*azcore.ResponseError
+				retries  int
+				maxDelay time.Duration
+				save     bool
+			}{
+				throttle: []*azcore.ResponseError{
+					throttleErr(http.StatusTooManyRequests, "0"),
+					throttleErr(http.StatusTooManyRequests, "0"),
+				},
+				retries: 1,
+			},
+			want: []ThrottleInfo{
+				{Operation: "load", StatusCode: http.StatusTooManyRequests, Attempt: 1},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Load policy with error (retries disabled)",
+			input: struct {
+				throttle []*azcore.ResponseError
+				retries  int
+				maxDelay time.Duration
+				save     bool
+			}{
+				throttle: []*azcore.ResponseError{
+					throttleErr(http.StatusTooManyRequests, "0"),
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Load policy with error (not throttled)",
+			input: struct {
+				throttle []*azcore.ResponseError
+				retries  int
+				maxDelay time.Duration
+				save     bool
+			}{
+				throttle: []*azcore.ResponseError{
+					throttleErr(http.StatusInternalServerError, "0"),
+				},
+				retries: 1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "Load policy with error (delay exceeds timeout)",
+			input: struct {
+				throttle []*azcore.ResponseError
+				retries  int
+				maxDelay time.Duration
+				save     bool
+			}{
+				throttle: []*azcore.ResponseError{
+					throttleErr(http.StatusTooManyRequests, "60"),
+				},
+				retries:  1,
+				maxDelay: time.Minute,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []ThrottleInfo
+			a := &Adapter{
+				c:                &mockBlobClient{throttle: test.input.throttle},
+				container:        "container",
+				blob:             "blob",
+				timeout:          time.Second * 10,
+				logger:           &mockLogger{},
+				maxThrottleDelay: time.Millisecond,
+			}
+			WithThrottleRetry(test.input.retries)(a)
+			WithOnThrottle(func(ctx context.Context, info ThrottleInfo) {
+				got = append(got, info)
+			})(a)
+			if test.input.maxDelay > 0 {
+				a.maxThrottleDelay = test.input.maxDelay
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			var gotErr error
+			if test.input.save {
+				m.AddPolicy("p", "p", []string{"alice", "domain1", "data1", "read"})
+				gotErr = a.SavePolicy(m)
+			} else {
+				gotErr = a.LoadPolicy(m)
+			}
+
+			if diff := cmp.Diff(test.want, got, cmpopts.IgnoreFields(ThrottleInfo{}, "Delay")); diff != "" {
+				t.Errorf("retryThrottled() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if test.wantErr != (gotErr != nil) {
+				t.Errorf("retryThrottled() unexpected error: %v\n", gotErr)
+			}
+			if !test.wantErr && !test.input.save {
+				if diff := cmp.Diff([][]string{{"alice", "domain1", "data1", "read"}}, m["p"]["p"].Policy); diff != "" {
+					t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestAdapter_LoadRetry(t *testing.T) {
+	responseErr := func(statusCode int) *azcore.ResponseError {
+		return &azcore.ResponseError{
+			StatusCode:  statusCode,
+			RawResponse: &http.Response{StatusCode: statusCode, Header: http.Header{}},
+		}
+	}
+
+	var tests = []struct {
+		name  string
+		input struct {
+			errs     []*azcore.ResponseError
+			attempts int
+		}
+		wantRequests int
+		wantErr      bool
+	}{
+		{
+			name: "Load policy after transient errors",
+			input: struct {
+				errs     []*azcore.ResponseError
+				attempts int
+			}{
+				errs:     []*azcore.ResponseError{responseErr(http.StatusInternalServerError), responseErr(http.StatusServiceUnavailable)},
+				attempts: 3,
+			},
+			wantRequests: 3,
+		},
+		{
+			name: "Load policy with error (attempts exhausted)",
+			input: struct {
+				errs     []*azcore.ResponseError
+				attempts int
+			}{
+				errs:     []*azcore.ResponseError{responseErr(http.StatusBadGateway), responseErr(http.StatusGatewayTimeout)},
+				attempts: 2,
+			},
+			wantRequests: 2,
+			wantErr:      true,
+		},
+		{
+			name: "Load policy with error (not transient)",
+			input: struct {
+				errs     []*azcore.ResponseError
+				attempts int
+			}{
+				errs:     []*azcore.ResponseError{responseErr(http.StatusForbidden)},
+				attempts: 3,
+			},
+			wantRequests: 1,
+			wantErr:      true,
+		},
+		{
+			name: "Load policy with error (retries disabled)",
+			input: struct {
+				errs     []*azcore.ResponseError
+				attempts int
+			}{
+				errs:     []*azcore.ResponseError{responseErr(http.StatusInternalServerError)},
+				attempts: 1,
+			},
+			wantRequests: 1,
+			wantErr:      true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &mockBlobClient{throttle: test.input.errs}
+			a := &Adapter{
+				c:         c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+				logger:    &mockLogger{},
+			}
+			WithLoadRetry(test.input.attempts, time.Millisecond)(a)
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			gotErr := a.LoadPolicy(m)
+			if test.wantErr != (gotErr != nil) {
+				t.Errorf("retryLoad() unexpected error: %v\n", gotErr)
+			}
+			if diff := cmp.Diff(test.wantRequests, len(c.downloadOptions)); diff != "" {
+				t.Errorf("retryLoad() unexpected number of requests (-want +got):\n%s\n", diff)
+			}
+			if !test.wantErr {
+				if diff := cmp.Diff([][]string{{"alice", "domain1", "data1", "read"}}, m["p"]["p"].Policy); diff != "" {
+					t.Errorf("LoadPolicy() unexpected result (-want +got):\n%s\n", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input string
+		want  time.Duration
+	}{
+		{
+			name:  "Seconds",
+			input: "5",
+			want:  time.Second * 5,
+		},
+		{
+			name:  "Date in the past",
+			input: "Wed, 21 Oct 2015 07:28:00 GMT",
+			want:  0,
+		},
+		{
+			name:  "Empty",
+			input: "",
+			want:  -1,
+		},
+		{
+			name:  "Invalid",
+			input: "soon",
+			want:  -1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := parseRetryAfter(test.input)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("parseRetryAfter() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
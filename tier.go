@@ -0,0 +1,40 @@
+package blobadapter
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+)
+
+// SetTier sets the access tier of the policy blob, e.g. blob.AccessTierHot or
+// blob.AccessTierCool. The blob keeps the tier when the policy is saved, unless
+// the account moves it. If the container or blob does not exist
+// ErrContainerDoesNotExist or ErrBlobDoesNotExist is returned.
+func (a *Adapter) SetTier(ctx context.Context, tier blob.AccessTier) error {
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+	if len(tier) == 0 {
+		return errors.New("invalid tier")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	if a.dryRun {
+		a.logf("blobadapter: dry run: suppressed setting tier of blob %s to %s", a.blob, tier)
+		return nil
+	}
+	a.requests.add(operationOther)
+	if _, err := a.c.SetTier(ctx, a.container, a.blob, tier, nil); err != nil {
+		if bloberror.HasCode(err, bloberror.ContainerNotFound) {
+			return newStorageErrorWithSentinel(err, ErrContainerDoesNotExist, a.container)
+		} else if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return newStorageErrorWithSentinel(err, ErrBlobDoesNotExist, a.blob)
+		}
+		return newStorageError(err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package blobadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_SetTier(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			c        *mockBlobClient
+			tier     blob.AccessTier
+			readOnly bool
+		}
+		want    blob.AccessTier
+		wantErr error
+	}{
+		{
+			name: "Set tier",
+			input: struct {
+				c        *mockBlobClient
+				tier     blob.AccessTier
+				readOnly bool
+			}{
+				c:    &mockBlobClient{},
+				tier: blob.AccessTierCool,
+			},
+			want: blob.AccessTierCool,
+		},
+		{
+			name: "Set tier with error (blob does not exist)",
+			input: struct {
+				c        *mockBlobClient
+				tier     blob.AccessTier
+				readOnly bool
+			}{
+				c: &mockBlobClient{
+					errTier: &azcore.ResponseError{ErrorCode: string(bloberror.BlobNotFound)},
+				},
+				tier: blob.AccessTierCool,
+			},
+			wantErr: ErrBlobDoesNotExist,
+		},
+		{
+			name: "Set tier with error (read-only)",
+			input: struct {
+				c        *mockBlobClient
+				tier     blob.AccessTier
+				readOnly bool
+			}{
+				c:        &mockBlobClient{},
+				tier:     blob.AccessTierCool,
+				readOnly: true,
+			},
+			wantErr: ErrReadOnly,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         test.input.c,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+				readOnly:  test.input.readOnly,
+			}
+
+			gotErr := a.SetTier(context.Background(), test.input.tier)
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("SetTier() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.want, test.input.c.tier); diff != "" {
+				t.Errorf("SetTier() unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package blobadapter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/casbin/casbin/v2/model"
+	"golang.org/x/text/transform"
+)
+
+// Validate checks that the provided policy data is accepted by LoadPolicy without
+// accessing the storage. Each line is passed through the line handler of the adapter
+// against a throwaway model. Since the model is not known by the adapter, the number
+// of fields of the first rule of each ptype is expected for the remaining rules of
+// that ptype. The first error is returned with the number of the offending line.
+// Like with LoadPolicy, the data is decoded with the encoding set with WithEncoding
+// and a byte order mark at the start is ignored.
+func (a *Adapter) Validate(data []byte) error {
+	v := a.newValidator()
+	scanner := bufio.NewScanner(a.decodeReader(bytes.NewReader(data)))
+	for scanner.Scan() {
+		if err := v.validate(scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// validator validates policy lines the same way as Validate.
+type validator struct {
+	m         model.Model
+	handler   func(string, model.Model) error
+	delimiter rune
+	format    Format
+	n         int
+}
+
+// newValidator returns a new validator with the line handler of the adapter.
+func (a *Adapter) newValidator() *validator {
+	return &validator{m: model.Model{}, handler: a.policyLineHandler(), delimiter: a.delimiter(), format: a.format}
+}
+
+// decodeReader returns r decoded with the encoding set with WithEncoding, like
+// the content of a loaded blob, or r if no encoding is set.
+func (a *Adapter) decodeReader(r io.Reader) io.Reader {
+	if a.encoding == nil {
+		return r
+	}
+	return transform.NewReader(r, a.encoding.NewDecoder())
+}
+
+// validate validates the next line of the policy. A byte order mark at the start
+// of the first line is ignored and, in FormatCSVWithHeader, the line is read the
+// same way as when the blob is loaded.
+func (v *validator) validate(line string) error {
+	if v.n++; v.n == 1 {
+		line = strings.TrimPrefix(line, byteOrderMark)
+	}
+	line = trimLine(line)
+	if v.format == FormatCSVWithHeader {
+		var err error
+		if line, err = csvLine(line); err != nil {
+			return fmt.Errorf("%w: line %d", err, v.n)
+		}
+	}
+	if err := prepareAssertion(line, v.m, v.delimiter); err != nil {
+		return fmt.Errorf("%w: line %d: %v", ErrInvalidPolicy, v.n, err)
+	}
+	if err := v.handler(line, v.m); err != nil {
+		return fmt.Errorf("%w: line %d: %v", ErrInvalidPolicy, v.n, err)
+	}
+	return nil
+}
+
+// prepareAssertion adds an assertion for the ptype of the line, with fields
+// separated by the delimiter, to the model if it does not already exist. The
+// assertion expects the number of fields of the line.
+func prepareAssertion(line string, m model.Model, delimiter rune) error {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	tokens, err := parsePolicyLine(line, delimiter)
+	if err != nil {
+		return err
+	}
+	ptype := tokens[0]
+	if len(ptype) == 0 {
+		return errors.New("missing ptype")
+	}
+	sec := ptype[:1]
+	if sec != "p" && sec != "g" {
+		return fmt.Errorf("invalid ptype: %s", ptype)
+	}
+
+	if m[sec] == nil {
+		m[sec] = model.AssertionMap{}
+	}
+	if _, ok := m[sec][ptype]; !ok {
+		m[sec][ptype] = &model.Assertion{
+			Key:       ptype,
+			Tokens:    make([]string, len(tokens)-1),
+			PolicyMap: map[string]int{},
+		}
+	}
+	return nil
+}
+
+// parsePolicyLine parses a policy line into tokens separated by the delimiter
+// the same way as persist.LoadPolicyLine.
+func parsePolicyLine(line string, delimiter rune) ([]string, error) {
+	r := csv.NewReader(strings.NewReader(line))
+	r.Comma = delimiter
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+	return r.Read()
+}
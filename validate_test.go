@@ -0,0 +1,89 @@
+package blobadapter
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestAdapter_Validate(t *testing.T) {
+	utf16 := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+	encode := func(s string) []byte {
+		b, err := utf16.NewEncoder().Bytes([]byte(s))
+		if err != nil {
+			t.Fatalf("error in test: %v\n", err)
+		}
+		return b
+	}
+
+	var tests = []struct {
+		name     string
+		input    []byte
+		encoding encoding.Encoding
+		format   Format
+		wantErr  error
+	}{
+		{
+			name:  "Validate policy",
+			input: []byte("p, alice, domain1, data1, read\n\n# comment\ng, alice, admin, domain1\np, bob, domain1, data1, write"),
+		},
+		{
+			name:  "Validate empty policy",
+			input: []byte(""),
+		},
+		{
+			name:  "Validate policy with byte order mark",
+			input: []byte("\ufeffp, alice, domain1, data1, read\ng, alice, admin, domain1"),
+		},
+		{
+			name:     "Validate policy with UTF-16LE encoding",
+			input:    encode("p, alice, domain1, data1, read\np, bob, domain1, data1, write"),
+			encoding: utf16,
+		},
+		{
+			name:   "Validate policy in CSV format",
+			input:  []byte("ptype,v0,v1,v2,v3\np,alice,domain1,data1,read\ng,alice,admin,domain1,"),
+			format: FormatCSVWithHeader,
+		},
+		{
+			name:    "Validate policy in CSV format with invalid header",
+			input:   []byte("ptype,x,y\np,alice,data1"),
+			format:  FormatCSVWithHeader,
+			wantErr: ErrInvalidPolicy,
+		},
+		{
+			name:    "Validate policy with invalid ptype",
+			input:   []byte("p, alice, domain1, data1, read\nx, alice, admin"),
+			wantErr: ErrInvalidPolicy,
+		},
+		{
+			name:    "Validate policy with inconsistent number of fields",
+			input:   []byte("p, alice, domain1, data1, read\np, bob, data1"),
+			wantErr: ErrInvalidPolicy,
+		},
+		{
+			name:    "Validate policy with invalid quoting",
+			input:   []byte(`p, alice, "domain1, data1, read`),
+			wantErr: ErrInvalidPolicy,
+		},
+		{
+			name:    "Validate policy with missing ptype",
+			input:   []byte(", alice, domain1"),
+			wantErr: ErrInvalidPolicy,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{encoding: test.encoding, format: test.format}
+			gotErr := a.Validate(test.input)
+
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Validate() unexpected error (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package blobadapter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// VerifyReport contains the lines of the policy blob that failed verification.
+type VerifyReport struct {
+	Errors []LineError
+}
+
+// LineError describes a policy line that failed verification.
+type LineError struct {
+	// Line is the line number, starting at 1.
+	Line int
+	// Content is the content of the line.
+	Content string
+	// Reason describes why the line failed verification.
+	Reason string
+}
+
+// Verify streams the policy blob and checks that every line can be parsed and
+// that the ptype and number of fields of every rule matches the model, the same
+// way as casbin does when the policy is loaded. The model is not modified.
+// All invalid lines are collected in the report, and if there are any an error
+// matching ErrInvalidPolicy is returned with the report. Comments and empty
+// lines are skipped.
+func (a *Adapter) Verify(ctx context.Context, m model.Model) (VerifyReport, error) {
+	if err := checkContainerBlobArguments(a.container, a.blob); err != nil {
+		return VerifyReport{}, err
+	}
+
+	var report VerifyReport
+	var n int
+	delimiter := a.delimiter()
+	if _, _, err := a.loadPolicyBlob(ctx, nil, func(line string, _ model.Model) error {
+		n++
+		if reason := verifyLine(line, m, delimiter); len(reason) > 0 {
+			report.Errors = append(report.Errors, LineError{Line: n, Content: line, Reason: reason})
+		}
+		return nil
+	}, blob.HTTPRange{}); err != nil {
+		return VerifyReport{}, err
+	}
+
+	if len(report.Errors) > 0 {
+		return report, fmt.Errorf("%w: %d invalid lines", ErrInvalidPolicy, len(report.Errors))
+	}
+	return report, nil
+}
+
+// verifyLine checks the policy line, with fields separated by the delimiter,
+// against the model and returns the reason it is invalid, or an empty string
+// if it is valid.
+func verifyLine(line string, m model.Model, delimiter rune) string {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ""
+	}
+
+	tokens, err := parsePolicyLine(line, delimiter)
+	if err != nil {
+		return err.Error()
+	}
+	ptype := tokens[0]
+	if len(ptype) == 0 {
+		return "missing ptype"
+	}
+	sec := ptype[:1]
+	assertion, ok := m[sec][ptype]
+	if !ok || (sec != "p" && sec != "g") {
+		return fmt.Sprintf("ptype %s is not defined in the model", ptype)
+	}
+
+	fields := len(tokens) - 1
+	if sec == "p" && fields != len(assertion.Tokens) || sec == "g" && fields < len(assertion.Tokens) {
+		return fmt.Sprintf("invalid number of fields: expected %d, got %d", len(assertion.Tokens), fields)
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+package blobadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_Verify(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   *mockBlobClient
+		want    VerifyReport
+		wantErr error
+	}{
+		{
+			name: "Verify policy",
+			input: &mockBlobClient{
+				content: []byte("p, alice, domain1, data1, read\n# comment\n\ng, alice, admin, domain1"),
+			},
+			want: VerifyReport{},
+		},
+		{
+			name: "Verify policy with invalid lines",
+			input: &mockBlobClient{
+				content: []byte("p, alice, domain1, data1, read\np, bob, data2, write\nx, bob, domain2, data2, write\ng, alice\n\"\", alice, domain1\ng2, alice, admin, domain1"),
+			},
+			want: VerifyReport{
+				Errors: []LineError{
+					{Line: 2, Content: "p, bob, data2, write", Reason: "invalid number of fields: expected 4, got 3"},
+					{Line: 3, Content: "x, bob, domain2, data2, write", Reason: "ptype x is not defined in the model"},
+					{Line: 4, Content: "g, alice", Reason: "invalid number of fields: expected 3, got 1"},
+					{Line: 5, Content: "\"\", alice, domain1", Reason: "missing ptype"},
+					{Line: 6, Content: "g2, alice, admin, domain1", Reason: "ptype g2 is not defined in the model"},
+				},
+			},
+			wantErr: ErrInvalidPolicy,
+		},
+		{
+			name: "Verify policy with error (blob does not exist)",
+			input: &mockBlobClient{
+				errDownload: &azcore.ResponseError{
+					ErrorCode: string(bloberror.BlobNotFound),
+				},
+			},
+			want:    VerifyReport{},
+			wantErr: ErrBlobDoesNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         test.input,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+
+			m, err := model.NewModelFromFile("_examples/rbac_with_domains_model.conf")
+			if err != nil {
+				t.Fatalf("error in test: %v\n", err)
+			}
+
+			got, gotErr := a.Verify(context.Background(), m)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Verify() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Verify() unexpected error (-want +got):\n%s\n", diff)
+			}
+			if len(m["p"]["p"].Policy) > 0 || len(m["g"]["g"].Policy) > 0 {
+				t.Errorf("Verify() unexpected modification of model\n")
+			}
+		})
+	}
+}
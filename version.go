@@ -0,0 +1,8 @@
+package blobadapter
+
+// Version is the version of the adapter. It is sent with every request to the
+// storage as part of the User-Agent header.
+const Version = "0.1.0"
+
+// userAgent identifies the adapter in the User-Agent header of every request.
+const userAgent = "casbin-blob-adapter/" + Version
@@ -0,0 +1,78 @@
+package blobadapter
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+)
+
+// BlobVersion contains information about a version of the policy blob.
+type BlobVersion struct {
+	// ID is the version ID of the version.
+	ID string
+	// LastModified is the time the version was last modified.
+	LastModified time.Time
+	// Size is the size of the version in bytes.
+	Size int64
+	// IsCurrent is set if the version is the current version of the blob.
+	IsCurrent bool
+}
+
+// ListVersions returns the versions of the policy blob, in the order they are
+// listed by the storage (oldest first). Versioning must be enabled on the storage
+// account, otherwise no versions are returned. If the container does not exist
+// ErrContainerDoesNotExist is returned.
+func (a *Adapter) ListVersions(ctx context.Context) ([]BlobVersion, error) {
+	if err := checkContainerBlobArguments(a.container, a.blob); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	var versions []BlobVersion
+	pager := a.c.NewListBlobsFlatPager(a.container, &azblob.ListBlobsFlatOptions{
+		Include: container.ListBlobsInclude{Versions: true},
+		Prefix:  toPtr(a.blob),
+	})
+	for pager.More() {
+		a.requests.add(operationList)
+		res, err := pager.NextPage(ctx)
+		if err != nil {
+			if bloberror.HasCode(err, bloberror.ContainerNotFound) {
+				return nil, newStorageErrorWithSentinel(err, ErrContainerDoesNotExist, a.container)
+			}
+			return nil, newStorageError(err)
+		}
+		if res.Segment == nil {
+			continue
+		}
+		for _, b := range res.Segment.BlobItems {
+			if b.Name == nil || *b.Name != a.blob || b.VersionID == nil {
+				continue
+			}
+			versions = append(versions, newBlobVersion(b))
+		}
+	}
+	return versions, nil
+}
+
+// newBlobVersion returns a BlobVersion from a listed blob item.
+func newBlobVersion(b *container.BlobItem) BlobVersion {
+	v := BlobVersion{ID: *b.VersionID}
+	if b.IsCurrentVersion != nil {
+		v.IsCurrent = *b.IsCurrentVersion
+	}
+	if b.Properties != nil {
+		if b.Properties.LastModified != nil {
+			v.LastModified = *b.Properties.LastModified
+		}
+		if b.Properties.ContentLength != nil {
+			v.Size = *b.Properties.ContentLength
+		}
+	}
+	return v
+}
@@ -0,0 +1,89 @@
+package blobadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdapter_ListVersions(t *testing.T) {
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	item := func(name, id string, size int64, current bool) *container.BlobItem {
+		return &container.BlobItem{
+			Name:             toPtr(name),
+			VersionID:        toPtr(id),
+			IsCurrentVersion: toPtr(current),
+			Properties: &container.BlobProperties{
+				LastModified:  toPtr(modified),
+				ContentLength: toPtr(size),
+			},
+		}
+	}
+
+	var tests = []struct {
+		name    string
+		input   *mockBlobClient
+		want    []BlobVersion
+		wantErr error
+	}{
+		{
+			name: "List versions",
+			input: &mockBlobClient{
+				listItems: []*container.BlobItem{
+					item("blob", "2024-01-01T00:00:00.0000000Z", 30, false),
+					item("blob", "2024-01-02T00:00:00.0000000Z", 55, true),
+					item("blob.bak", "2024-01-02T00:00:00.0000000Z", 30, true),
+				},
+			},
+			want: []BlobVersion{
+				{ID: "2024-01-01T00:00:00.0000000Z", LastModified: modified, Size: 30},
+				{ID: "2024-01-02T00:00:00.0000000Z", LastModified: modified, Size: 55, IsCurrent: true},
+			},
+		},
+		{
+			name: "List versions without versions",
+			input: &mockBlobClient{
+				blobFound: true,
+			},
+		},
+		{
+			name: "List versions with error (container does not exist)",
+			input: &mockBlobClient{
+				errList: &azcore.ResponseError{ErrorCode: string(bloberror.ContainerNotFound)},
+			},
+			wantErr: ErrContainerDoesNotExist,
+		},
+		{
+			name: "List versions with error",
+			input: &mockBlobClient{
+				errList: errTest,
+			},
+			wantErr: errTest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Adapter{
+				c:         test.input,
+				container: "container",
+				blob:      "blob",
+				timeout:   time.Second * 10,
+			}
+
+			got, gotErr := a.ListVersions(context.Background())
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("ListVersions() unexpected result (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("ListVersions() unexpected error (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}